@@ -5,14 +5,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
+	"os/exec"
 	"os/signal"
 	"strings"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/mgr"
@@ -21,20 +24,20 @@ import (
 	"inventario/agent/internal/collector"
 	"inventario/agent/internal/config"
 	"inventario/agent/internal/token"
+	"inventario/agent/internal/updater"
 )
 
 const (
 	serviceName    = "InventoryAgent"
 	serviceDisplay = "Inventory Agent"
 	serviceDesc    = "Windows IT Asset Inventory Agent"
-	version        = "1.0.0"
 )
 
 func main() {
 	if len(os.Args) > 1 {
 		switch strings.ToLower(os.Args[1]) {
 		case "version":
-			fmt.Printf("inventory-agent v%s\n", version)
+			fmt.Printf("inventory-agent v%s\n", collector.AgentVersion)
 			return
 		case "install":
 			installService()
@@ -72,7 +75,7 @@ func main() {
 }
 
 func printUsage() {
-	fmt.Printf("Inventory Agent v%s\n\n", version)
+	fmt.Printf("Inventory Agent v%s\n\n", collector.AgentVersion)
 	fmt.Println("Commands:")
 	fmt.Println("  collect     Collect inventory and print JSON (no server needed)")
 	fmt.Println("  install     Install as Windows service")
@@ -143,12 +146,22 @@ func (s *agentService) Execute(args []string, r <-chan svc.ChangeRequest, change
 
 	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
 
-	runAgent(ctx, "")
+	if runAgent(ctx, "") {
+		// Exiting with an error makes the SCM restart the service (see configureRecovery),
+		// now running the new executable.
+		changes <- svc.Status{State: svc.StopPending}
+		return true, 1
+	}
 
 	return false, 0
 }
 
 func runWindowsService() {
+	// Services installed by older versions have no recovery actions, which self-update
+	// relies on to restart.
+	if err := ensureRecovery(); err != nil {
+		slog.Warn("failed to configure service recovery", "error", err)
+	}
 	if err := svc.Run(serviceName, &agentService{}); err != nil {
 		fmt.Fprintf(os.Stderr, "service run failed: %v\n", err)
 		os.Exit(1)
@@ -175,51 +188,140 @@ func runForeground() {
 		cancel()
 	}()
 
-	runAgent(ctx, configPath)
+	if runAgent(ctx, configPath) {
+		restartForeground()
+	}
+}
+
+// restartForeground starts the new executable with the same arguments after a self-update.
+func restartForeground() {
+	exe, err := os.Executable()
+	if err != nil {
+		slog.Error("failed to restart after update", "error", err)
+		return
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		slog.Error("failed to restart after update", "error", err)
+	}
 }
 
 // ---------------------------------------------------------------------------
 // Core agent loop
 // ---------------------------------------------------------------------------
 
-func runAgent(ctx context.Context, configPath string) {
+// runAgent runs inventory cycles until ctx is done. It returns true when a self-update
+// replaced the executable and the agent must be restarted.
+func runAgent(ctx context.Context, configPath string) bool {
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		slog.Error("failed to load config", "error", err)
-		return
+		return false
 	}
 
 	logger := setupLogger(cfg.LogLevel)
-	logger.Info("starting inventory agent", "version", version)
+	logger.Info("starting inventory agent", "version", collector.AgentVersion)
 
 	store := token.NewStore(cfg.DataDir)
 	coll := collector.New(logger)
 	apiClient := client.New(cfg.ServerURL, cfg.InsecureSkipVerify, logger)
 
+	started := time.Now()
+	var upd *updater.Updater
+	if len(cfg.UpdatePublicKeys) > 0 {
+		upd, err = updater.New(apiClient, cfg.DataDir, cfg.UpdateChannel, collector.AgentVersion, cfg.UpdatePublicKeys, logger)
+		if err != nil {
+			logger.Error("self-update disabled", "error", err)
+		} else if upd.Boot() {
+			return true
+		}
+	}
+
 	// Load existing token if available.
 	tok, err := store.Load()
 	if err != nil {
 		logger.Error("failed to load saved token", "error", err)
 	}
+	apiClient.SetToken(tok)
 
 	// Run initial inventory cycle immediately.
-	runCycle(ctx, cfg, logger, store, coll, apiClient, &tok)
+	restart, cycleErr := runCycle(ctx, cfg, logger, store, coll, apiClient, upd, &tok)
+	if restart {
+		return true
+	}
 
-	// Schedule periodic cycles.
+	// Schedule periodic cycles, with heartbeats in between.
 	ticker := time.NewTicker(cfg.Interval)
 	defer ticker.Stop()
+	heartbeat := time.NewTicker(cfg.HeartbeatInterval)
+	defer heartbeat.Stop()
+	// An update that ran this long is no longer rolled back on the next starts.
+	var healthy <-chan time.Time
+	if upd != nil {
+		healthy = time.After(time.Until(started.Add(updater.HealthyAfter)))
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Info("agent shutting down")
-			return
+			return false
 		case <-ticker.C:
-			runCycle(ctx, cfg, logger, store, coll, apiClient, &tok)
+			if restart, cycleErr = runCycle(ctx, cfg, logger, store, coll, apiClient, upd, &tok); restart {
+				return true
+			}
+		case <-heartbeat.C:
+			if tok != "" {
+				sendHeartbeat(ctx, cfg, logger, coll, apiClient, cycleErr)
+			}
+		case <-healthy:
+			upd.MarkHealthy()
 		}
 	}
 }
 
+// sendHeartbeat reports that the agent is running and whether its last inventory cycle
+// failed. Failures are only logged: the next heartbeat or inventory retries.
+func sendHeartbeat(
+	ctx context.Context,
+	cfg *config.Config,
+	logger *slog.Logger,
+	coll *collector.Collector,
+	apiClient *client.Client,
+	cycleErr error,
+) {
+	hb := coll.Heartbeat()
+	hb.IntervalSeconds = int(cfg.HeartbeatInterval / time.Second)
+	hb.State = "ok"
+	if cycleErr != nil {
+		hb.State = "error"
+		hb.Error = truncate(cycleErr.Error(), 1000)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := apiClient.SendHeartbeat(ctx, hb); err != nil {
+		logger.Warn("heartbeat failed", "error", err)
+		return
+	}
+	logger.Debug("heartbeat sent")
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// runCycle collects and submits the inventory, then checks for an agent update.
+// It returns true when an update was installed and the agent must restart, and the
+// error that ended a failed cycle, which the heartbeats report.
 func runCycle(
 	ctx context.Context,
 	cfg *config.Config,
@@ -227,15 +329,18 @@ func runCycle(
 	store *token.Store,
 	coll *collector.Collector,
 	apiClient *client.Client,
+	upd *updater.Updater,
 	tok *string,
-) {
+) (bool, error) {
 	logger.Info("starting inventory cycle")
 
 	inventory, err := coll.Collect()
 	if err != nil {
 		logger.Error("inventory collection failed", "error", err)
-		return
+		return false, fmt.Errorf("inventory collection failed: %w", err)
 	}
+	inventory.HeartbeatIntervalSeconds = int(cfg.HeartbeatInterval / time.Second)
+	inventory.CollectionIntervalSeconds = int(cfg.Interval / time.Second)
 
 	// Enroll if we have no token yet.
 	if *tok == "" {
@@ -243,11 +348,11 @@ func runCycle(
 		resp, err := apiClient.Enroll(ctx, cfg.EnrollmentKey, inventory.Hostname, inventory.SerialNumber)
 		if err != nil {
 			logger.Error("enrollment failed", "error", err)
-			return
+			return false, fmt.Errorf("enrollment failed: %w", err)
 		}
 		if resp.Token == "" {
 			logger.Error("enrollment returned empty token")
-			return
+			return false, errors.New("enrollment returned empty token")
 		}
 		*tok = resp.Token
 		if err := store.Save(*tok); err != nil {
@@ -267,10 +372,12 @@ func runCycle(
 			*tok = ""
 			_ = store.Delete()
 		}
-		return
+		return false, fmt.Errorf("inventory submission failed: %w", err)
 	}
 
 	logger.Info("inventory submitted successfully")
+
+	return upd != nil && upd.Run(ctx), nil
 }
 
 func setupLogger(level string) *slog.Logger {
@@ -322,10 +429,43 @@ func installService() {
 		fmt.Fprintf(os.Stderr, "failed to create service: %v\n", err)
 		os.Exit(1)
 	}
+	if err := configureRecovery(s); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to configure service recovery: %v\n", err)
+	}
 	s.Close()
 	fmt.Println("service installed successfully")
 }
 
+// configureRecovery makes the SCM restart the service when it fails or exits with an
+// error, which is also how the agent restarts after a self-update.
+func configureRecovery(s *mgr.Service) error {
+	actions := []mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 2 * time.Minute},
+	}
+	if err := s.SetRecoveryActions(actions, uint32((24 * time.Hour).Seconds())); err != nil {
+		return err
+	}
+	return s.SetRecoveryActionsOnNonCrashFailures(true)
+}
+
+// ensureRecovery applies configureRecovery to the installed service.
+func ensureRecovery() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return configureRecovery(s)
+}
+
 func uninstallService() {
 	m, err := mgr.Connect()
 	if err != nil {
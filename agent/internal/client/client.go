@@ -13,6 +13,7 @@ import (
 	"math"
 	"math/rand/v2"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -34,10 +35,11 @@ func (e *AuthError) Error() string {
 
 // Client communicates with the central inventory API.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
-	token      string
-	logger     *slog.Logger
+	baseURL        string
+	httpClient     *http.Client
+	downloadClient *http.Client // no overall timeout; downloads are bounded by their context
+	token          string
+	logger         *slog.Logger
 }
 
 // New creates a new API client pointing at the given base URL.
@@ -53,7 +55,8 @@ func New(baseURL string, insecureSkipVerify bool, logger *slog.Logger) *Client {
 			Timeout:   30 * time.Second,
 			Transport: transport,
 		},
-		logger: logger,
+		downloadClient: &http.Client{Transport: transport},
+		logger:         logger,
 	}
 }
 
@@ -166,6 +169,117 @@ func (c *Client) SubmitWithRetry(ctx context.Context, inventory *dto.InventoryRe
 	return nil
 }
 
+// SendHeartbeat tells the API the agent is running.
+func (c *Client) SendHeartbeat(ctx context.Context, heartbeat *dto.HeartbeatRequest) error {
+	data, err := json.Marshal(heartbeat)
+	if err != nil {
+		return fmt.Errorf("marshal heartbeat: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/heartbeat", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("heartbeat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			return &AuthError{StatusCode: resp.StatusCode, Message: string(respBody)}
+		}
+		return fmt.Errorf("heartbeat failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// CheckUpdate asks the API which agent release this device should run.
+func (c *Client) CheckUpdate(ctx context.Context, goos, arch, channel, version string) (*dto.AgentUpdateResponse, error) {
+	query := url.Values{"os": {goos}, "arch": {arch}, "channel": {channel}, "version": {version}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/v1/agent/update?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("update check failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return nil, fmt.Errorf("update check failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	var result dto.AgentUpdateResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode update response: %w", err)
+	}
+	return &result, nil
+}
+
+// Download copies at most maxSize bytes of a release artifact (path relative to the
+// server URL) to w and returns the number of bytes written.
+func (c *Client) Download(ctx context.Context, path string, w io.Writer, maxSize int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.downloadClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return 0, fmt.Errorf("download failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	n, err := io.Copy(w, io.LimitReader(resp.Body, maxSize))
+	if err != nil {
+		return n, fmt.Errorf("download failed: %w", err)
+	}
+	return n, nil
+}
+
+// ReportUpdate sends the outcome of an update attempt to the API.
+func (c *Client) ReportUpdate(ctx context.Context, report *dto.AgentUpdateReportRequest) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshal update report: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/agent/update-report", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("update report failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return fmt.Errorf("update report failed (status %d): %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
 // IsAuthError checks if an error indicates an authentication problem (401/403).
 func IsAuthError(err error) bool {
 	if err == nil {
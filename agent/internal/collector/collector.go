@@ -8,8 +8,9 @@ import (
 	"inventario/shared/dto"
 )
 
-// AgentVersion is the current version of the inventory agent.
-const AgentVersion = "1.0.0"
+// AgentVersion is the current version of the inventory agent. Release builds set it with
+// -ldflags "-X inventario/agent/internal/collector.AgentVersion=<version>".
+var AgentVersion = "1.0.0"
 
 // Collector orchestrates all inventory data collection.
 type Collector struct {
@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/yusufpapurcu/wmi"
+	"golang.org/x/sys/windows"
+
+	"inventario/shared/dto"
 )
 
 // systemInfo holds the collected operating system and machine information.
@@ -60,19 +63,10 @@ func (c *Collector) collectSystem() (*systemInfo, error) {
 		serial = bios[0].SerialNumber
 	}
 
-	var cs []win32CS
-	if err := wmi.Query("SELECT UserName FROM Win32_ComputerSystem", &cs); err != nil {
-		c.logger.Warn("failed to query logged-in user", "error", err)
-	}
-	user := ""
-	if len(cs) > 0 {
-		user = cs[0].UserName
-	}
-
 	info := &systemInfo{
 		Hostname:     hostname,
 		SerialNumber: serial,
-		LoggedInUser: user,
+		LoggedInUser: c.loggedInUser(),
 	}
 
 	if len(osResult) > 0 {
@@ -86,3 +80,38 @@ func (c *Collector) collectSystem() (*systemInfo, error) {
 
 	return info, nil
 }
+
+// loggedInUser returns the user logged in at the console, or "" if there is none.
+func (c *Collector) loggedInUser() string {
+	user, _ := c.queryLoggedInUser()
+	return user
+}
+
+// queryLoggedInUser returns the interactive user, empty when nobody is logged in, and
+// false when it could not be queried.
+func (c *Collector) queryLoggedInUser() (string, bool) {
+	var cs []win32CS
+	if err := wmi.Query("SELECT UserName FROM Win32_ComputerSystem", &cs); err != nil {
+		c.logger.Warn("failed to query logged-in user", "error", err)
+		return "", false
+	}
+	if len(cs) > 0 {
+		return cs[0].UserName, true
+	}
+	return "", true
+}
+
+// Heartbeat returns the uptime, logged-in user and agent version for a heartbeat. It is
+// cheap enough to call every few minutes; the caller fills in the interval and state.
+// The logged-in user is left out when it could not be queried, so that the server
+// keeps the last one it knows.
+func (c *Collector) Heartbeat() *dto.HeartbeatRequest {
+	hb := &dto.HeartbeatRequest{
+		UptimeSeconds: int64(windows.DurationSinceBoot() / time.Second),
+		AgentVersion:  AgentVersion,
+	}
+	if user, ok := c.queryLoggedInUser(); ok {
+		hb.LoggedInUser = &user
+	}
+	return hb
+}
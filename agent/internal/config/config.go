@@ -18,6 +18,15 @@ type Config struct {
 	LogLevel           string        `json:"log_level"`
 	InsecureSkipVerify bool          `json:"insecure_skip_verify"`
 	Interval           time.Duration `json:"-"`
+
+	// Heartbeats keep the device online between inventories.
+	HeartbeatMinutes  int           `json:"heartbeat_minutes"`
+	HeartbeatInterval time.Duration `json:"-"`
+
+	// Self-update: releases must be signed by one of these base64 Ed25519 keys.
+	// Without keys the agent never replaces itself.
+	UpdatePublicKeys []string `json:"update_public_keys"`
+	UpdateChannel    string   `json:"update_channel"` // release channel to follow (default "stable")
 }
 
 // Load reads and parses the configuration from a JSON file.
@@ -46,6 +55,7 @@ func Load(path string) (*Config, error) {
 	}
 
 	cfg.Interval = time.Duration(cfg.IntervalHours) * time.Hour
+	cfg.HeartbeatInterval = time.Duration(cfg.HeartbeatMinutes) * time.Minute
 
 	if cfg.DataDir == "" {
 		exe, _ := os.Executable()
@@ -65,8 +75,20 @@ func (c *Config) validate() error {
 	if c.IntervalHours <= 0 {
 		c.IntervalHours = 1
 	}
+	if c.IntervalHours > 744 {
+		return fmt.Errorf("interval_hours must be at most 744")
+	}
+	if c.HeartbeatMinutes <= 0 {
+		c.HeartbeatMinutes = 5
+	}
+	if c.HeartbeatMinutes > 1440 {
+		return fmt.Errorf("heartbeat_minutes must be at most 1440")
+	}
 	if c.LogLevel == "" {
 		c.LogLevel = "info"
 	}
+	if c.UpdateChannel == "" {
+		c.UpdateChannel = "stable"
+	}
 	return nil
 }
@@ -0,0 +1,457 @@
+// Package updater replaces the agent executable with a signed release offered by the API.
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/agent/internal/client"
+	"inventario/shared/dto"
+)
+
+const (
+	pendingFileName = "update.json"
+	backoffFileName = "update_backoff.json"
+	downloadTimeout = 10 * time.Minute
+	reportTimeout   = 30 * time.Second
+
+	// maxBoots is how many times the new executable may start, without reporting the
+	// update or running for HealthyAfter, before the previous one is restored.
+	maxBoots = 3
+
+	// A release that failed is not retried for backoffBase, doubled after each further
+	// failure up to backoffMax.
+	backoffBase = time.Hour
+	backoffMax  = 7 * 24 * time.Hour
+)
+
+// HealthyAfter is how long the new executable must run before its starts stop counting
+// towards a rollback, so that an agent that cannot reach the API is not rolled back.
+const HealthyAfter = 10 * time.Minute
+
+// pendingUpdate is saved before the executable is swapped and read by the new
+// executable after the restart, which reports the outcome.
+type pendingUpdate struct {
+	ReleaseID   *uuid.UUID `json:"release_id"`
+	FromVersion string     `json:"from_version"`
+	ToVersion   string     `json:"to_version"`
+	// Boots counts the starts of the new executable. Reaching maxBoots before it
+	// reported the update or ran for HealthyAfter (it keeps crashing) rolls the
+	// update back.
+	Boots int `json:"boots"`
+	// Healthy is set once the new executable ran for HealthyAfter; its starts are no
+	// longer counted, and the update is reported when the API is reachable.
+	Healthy bool `json:"healthy,omitempty"`
+	// Error is why the update was rolled back, reported by the previous executable.
+	Error string `json:"error,omitempty"`
+}
+
+// releaseBackoff holds the failed attempts at one release.
+type releaseBackoff struct {
+	Failures   int       `json:"failures"`
+	RetryAfter time.Time `json:"retry_after"`
+}
+
+// Updater checks for, installs and reports agent updates.
+type Updater struct {
+	client     *client.Client
+	logger     *slog.Logger
+	dataDir    string
+	channel    string
+	version    string
+	exePath    string
+	publicKeys []ed25519.PublicKey
+}
+
+// New creates an Updater for the running executable, which is at version. It fails if
+// a public key is not a base64 Ed25519 key.
+func New(apiClient *client.Client, dataDir, channel, version string, publicKeys []string, logger *slog.Logger) (*Updater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("get executable path: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, fmt.Errorf("resolve executable path: %w", err)
+	}
+
+	u := &Updater{
+		client:  apiClient,
+		logger:  logger,
+		dataDir: dataDir,
+		channel: channel,
+		version: version,
+		exePath: exe,
+	}
+	for _, k := range publicKeys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("update_public_keys: %q is not a base64 Ed25519 public key", k)
+		}
+		u.publicKeys = append(u.publicKeys, ed25519.PublicKey(key))
+	}
+	return u, nil
+}
+
+// Boot must be called when the agent starts, before anything that may crash. While an
+// update is pending and the new executable has not yet run for HealthyAfter, it counts
+// its starts and, at maxBoots, puts the previous executable back. It returns true when
+// it did and the agent must restart; the previous executable then reports the update
+// as failed.
+func (u *Updater) Boot() bool {
+	p, err := u.loadPending()
+	if err != nil || p == nil || p.ToVersion != u.version || p.Healthy {
+		return false
+	}
+
+	p.Boots++
+	if p.Boots < maxBoots {
+		if err := u.savePending(p); err != nil {
+			u.logger.Warn("failed to count the start of the updated agent", "error", err)
+		}
+		return false
+	}
+
+	p.Error = fmt.Sprintf("rolled back to version %s: version %s started %d times without reporting or running for %s",
+		p.FromVersion, p.ToVersion, p.Boots, HealthyAfter)
+	if err := u.savePending(p); err != nil {
+		u.logger.Error("failed to save the rollback", "error", err)
+		return false
+	}
+	if err := u.rollback(); err != nil {
+		u.logger.Error("failed to roll back the agent update", "to", p.FromVersion, "error", err)
+		return false
+	}
+	u.logger.Warn("agent update rolled back, restarting", "from", p.ToVersion, "to", p.FromVersion, "boots", p.Boots)
+	return true
+}
+
+// MarkHealthy must be called once the agent has run for HealthyAfter. It stops Boot
+// from counting the starts of a pending update, which is then only reported.
+func (u *Updater) MarkHealthy() {
+	p, err := u.loadPending()
+	if err != nil || p == nil || p.ToVersion != u.version || p.Healthy {
+		return
+	}
+	p.Healthy = true
+	if err := u.savePending(p); err != nil {
+		u.logger.Warn("failed to record that the updated agent is healthy", "error", err)
+		return
+	}
+	u.logger.Info("updated agent ran long enough, it is no longer rolled back", "version", u.version, "after", HealthyAfter.String())
+}
+
+// rollback restores the previous executable from .old. The one it replaces is kept as
+// .failed until the previous executable reports the update.
+func (u *Updater) rollback() error {
+	oldPath, failedPath := u.exePath+".old", u.exePath+".failed"
+	if _, err := os.Stat(oldPath); err != nil {
+		return fmt.Errorf("previous executable: %w", err)
+	}
+	if err := os.Remove(failedPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove previous failed executable: %w", err)
+	}
+	if err := os.Rename(u.exePath, failedPath); err != nil {
+		return fmt.Errorf("move current executable: %w", err)
+	}
+	if err := os.Rename(oldPath, u.exePath); err != nil {
+		if rerr := os.Rename(failedPath, u.exePath); rerr != nil {
+			u.logger.Error("failed to restore the updated executable", "error", rerr)
+		}
+		return fmt.Errorf("restore previous executable: %w", err)
+	}
+	return nil
+}
+
+// Run reports the outcome of the last update, then asks the API for the release this
+// device should run and installs it, unless the release failed recently. It returns
+// true when the executable was replaced and the agent must restart. Failures are
+// logged and reported to the API.
+func (u *Updater) Run(ctx context.Context) bool {
+	u.finishPending(ctx)
+
+	resp, err := u.client.CheckUpdate(ctx, runtime.GOOS, runtime.GOARCH, u.channel, u.version)
+	if err != nil {
+		u.logger.Warn("update check failed", "error", err)
+		return false
+	}
+	if !resp.Available {
+		return false
+	}
+	key := releaseKey(resp.ReleaseID, resp.Version)
+	if b, ok := u.loadBackoff()[key]; ok && time.Now().Before(b.RetryAfter) {
+		u.logger.Info("skipping agent update that failed recently", "to", resp.Version, "failures", b.Failures, "retry_after", b.RetryAfter)
+		return false
+	}
+
+	u.logger.Info("installing agent update", "from", u.version, "to", resp.Version)
+	if err := u.install(ctx, resp); err != nil {
+		u.logger.Error("agent update failed", "to", resp.Version, "error", err)
+		u.recordFailure(key)
+		u.report(ctx, &dto.AgentUpdateReportRequest{
+			ReleaseID:   resp.ReleaseID,
+			FromVersion: u.version,
+			ToVersion:   resp.Version,
+			Status:      "failed",
+			Error:       err.Error(),
+		})
+		return false
+	}
+	u.logger.Info("agent update installed, restarting", "to", resp.Version)
+	return true
+}
+
+// install downloads and verifies the release next to the executable, then swaps the
+// two. The running executable is renamed to .old (Windows allows renaming, not
+// overwriting, a running executable) and removed after a successful restart.
+func (u *Updater) install(ctx context.Context, rel *dto.AgentUpdateResponse) error {
+	if err := u.checkVersion(rel); err != nil {
+		return err
+	}
+
+	newPath, oldPath := u.exePath+".new", u.exePath+".old"
+	defer os.Remove(newPath)
+
+	if err := u.download(ctx, rel, newPath); err != nil {
+		return err
+	}
+
+	if err := u.savePending(&pendingUpdate{ReleaseID: rel.ReleaseID, FromVersion: u.version, ToVersion: rel.Version}); err != nil {
+		return err
+	}
+	if err := os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+		u.deletePending()
+		return fmt.Errorf("remove previous backup: %w", err)
+	}
+	if err := os.Rename(u.exePath, oldPath); err != nil {
+		u.deletePending()
+		return fmt.Errorf("move current executable: %w", err)
+	}
+	if err := os.Rename(newPath, u.exePath); err != nil {
+		if rerr := os.Rename(oldPath, u.exePath); rerr != nil {
+			u.logger.Error("failed to restore the previous executable", "error", rerr)
+		}
+		u.deletePending()
+		return fmt.Errorf("install new executable: %w", err)
+	}
+	return nil
+}
+
+// checkVersion refuses a release that is not newer than the running version, unless
+// its rollout is marked as a rollback: an agent only moves back when an administrator
+// asked for it, not because a rollout was pointed at an older build by mistake.
+func (u *Updater) checkVersion(rel *dto.AgentUpdateResponse) error {
+	if rel.Rollback {
+		return nil
+	}
+	c, err := compareVersions(rel.Version, u.version)
+	if err != nil {
+		return fmt.Errorf("cannot compare version %s with the running %s: %w", rel.Version, u.version, err)
+	}
+	if c <= 0 {
+		return fmt.Errorf("version %s is not newer than the running %s and its rollout is not a rollback", rel.Version, u.version)
+	}
+	return nil
+}
+
+// download writes the release to path and checks its size, SHA-256 and signature,
+// which covers the version and this platform too.
+func (u *Updater) download(ctx context.Context, rel *dto.AgentUpdateResponse, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("create download file: %w", err)
+	}
+	h := sha256.New()
+	n, err := u.client.Download(ctx, rel.DownloadURL, io.MultiWriter(f, h), rel.SizeBytes+1)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("write download file: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	if n != rel.SizeBytes {
+		return fmt.Errorf("downloaded %d bytes, expected %d", n, rel.SizeBytes)
+	}
+	if digest != rel.SHA256 {
+		return errors.New("checksum mismatch")
+	}
+	sig, err := base64.StdEncoding.DecodeString(rel.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	payload := dto.ReleaseSigningPayload(rel.Version, runtime.GOOS, runtime.GOARCH, digest)
+	if !slices.ContainsFunc(u.publicKeys, func(k ed25519.PublicKey) bool { return ed25519.Verify(k, payload, sig) }) {
+		return fmt.Errorf("signature of version %s for %s/%s does not match any update_public_keys", rel.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	return nil
+}
+
+// finishPending reports the update saved before the last restart: it succeeded if
+// the agent now runs the target version, which got an inventory through. The record
+// is kept until the API accepts it; a failure backs the release off.
+func (u *Updater) finishPending(ctx context.Context) {
+	p, err := u.loadPending()
+	if err != nil {
+		u.logger.Warn("failed to read pending update", "error", err)
+		u.deletePending()
+		return
+	}
+	if p == nil {
+		return
+	}
+
+	report := &dto.AgentUpdateReportRequest{
+		ReleaseID:   p.ReleaseID,
+		FromVersion: p.FromVersion,
+		ToVersion:   p.ToVersion,
+		Status:      "success",
+	}
+	if u.version != p.ToVersion {
+		report.Status = "failed"
+		report.Error = p.Error
+		if report.Error == "" {
+			report.Error = fmt.Sprintf("the agent still runs version %s after the restart", u.version)
+		}
+	}
+	if !u.report(ctx, report) {
+		return
+	}
+	u.deletePending()
+	if report.Status == "failed" {
+		u.recordFailure(releaseKey(p.ReleaseID, p.ToVersion))
+		if err := os.Remove(u.exePath + ".failed"); err != nil && !os.IsNotExist(err) {
+			u.logger.Warn("failed to remove the failed executable", "error", err)
+		}
+		return
+	}
+	if err := os.Remove(u.exePath + ".old"); err != nil && !os.IsNotExist(err) {
+		u.logger.Warn("failed to remove the previous executable", "error", err)
+	}
+	// The agent moved on: earlier failures no longer matter.
+	if err := os.Remove(u.backoffPath()); err != nil && !os.IsNotExist(err) {
+		u.logger.Warn("failed to delete update backoff", "error", err)
+	}
+	u.logger.Info("agent update completed", "from", p.FromVersion, "to", p.ToVersion)
+}
+
+func (u *Updater) report(ctx context.Context, report *dto.AgentUpdateReportRequest) bool {
+	ctx, cancel := context.WithTimeout(ctx, reportTimeout)
+	defer cancel()
+	if err := u.client.ReportUpdate(ctx, report); err != nil {
+		u.logger.Warn("failed to report update outcome", "error", err)
+		return false
+	}
+	return true
+}
+
+func (u *Updater) pendingPath() string {
+	return filepath.Join(u.dataDir, pendingFileName)
+}
+
+// loadPending returns the saved update, or nil if there is none.
+func (u *Updater) loadPending() (*pendingUpdate, error) {
+	data, err := os.ReadFile(u.pendingPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var p pendingUpdate
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (u *Updater) savePending(p *pendingUpdate) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("marshal pending update: %w", err)
+	}
+	if err := os.MkdirAll(u.dataDir, 0700); err != nil {
+		return fmt.Errorf("create data dir: %w", err)
+	}
+	if err := os.WriteFile(u.pendingPath(), data, 0600); err != nil {
+		return fmt.Errorf("write pending update: %w", err)
+	}
+	return nil
+}
+
+func (u *Updater) deletePending() {
+	if err := os.Remove(u.pendingPath()); err != nil && !os.IsNotExist(err) {
+		u.logger.Warn("failed to delete pending update", "error", err)
+	}
+}
+
+// releaseKey identifies a release in the backoff file.
+func releaseKey(id *uuid.UUID, version string) string {
+	if id != nil {
+		return id.String()
+	}
+	return version
+}
+
+func (u *Updater) backoffPath() string {
+	return filepath.Join(u.dataDir, backoffFileName)
+}
+
+// loadBackoff returns the failed attempts by release. A missing or unreadable file
+// counts as no failures.
+func (u *Updater) loadBackoff() map[string]releaseBackoff {
+	backoff := map[string]releaseBackoff{}
+	data, err := os.ReadFile(u.backoffPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			u.logger.Warn("failed to read update backoff", "error", err)
+		}
+		return backoff
+	}
+	if err := json.Unmarshal(data, &backoff); err != nil {
+		u.logger.Warn("failed to read update backoff", "error", err)
+		return map[string]releaseBackoff{}
+	}
+	return backoff
+}
+
+// recordFailure counts a failed attempt at a release and sets when to try it again.
+func (u *Updater) recordFailure(key string) {
+	backoff := u.loadBackoff()
+	b := backoff[key]
+	b.Failures++
+	delay := backoffMax
+	if b.Failures <= 10 {
+		delay = min(backoffBase<<(b.Failures-1), backoffMax)
+	}
+	b.RetryAfter = time.Now().Add(delay)
+	backoff[key] = b
+
+	data, err := json.Marshal(backoff)
+	if err == nil {
+		if err = os.MkdirAll(u.dataDir, 0700); err == nil {
+			err = os.WriteFile(u.backoffPath(), data, 0600)
+		}
+	}
+	if err != nil {
+		u.logger.Warn("failed to save update backoff", "error", err)
+	}
+}
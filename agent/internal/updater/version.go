@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version. A leading "v" is
+// accepted; build metadata does not take part in comparisons.
+type semver struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+func parseSemver(s string) (semver, error) {
+	var v semver
+	rest := strings.TrimPrefix(s, "v")
+	rest, _, _ = strings.Cut(rest, "+")
+	rest, pre, hasPre := strings.Cut(rest, "-")
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("%q is not a MAJOR.MINOR.PATCH version", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("%q is not a MAJOR.MINOR.PATCH version", s)
+		}
+		v.core[i] = n
+	}
+	if hasPre {
+		v.prerelease = strings.Split(pre, ".")
+		for _, id := range v.prerelease {
+			if id == "" {
+				return v, fmt.Errorf("%q has an empty pre-release identifier", s)
+			}
+		}
+	}
+	return v, nil
+}
+
+// compareVersions compares two semantic versions and returns -1, 0 or +1. A
+// pre-release sorts before its release (1.2.0-rc.1 < 1.2.0).
+func compareVersions(a, b string) (int, error) {
+	va, err := parseSemver(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseSemver(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range va.core {
+		if va.core[i] != vb.core[i] {
+			return cmp.Compare(va.core[i], vb.core[i]), nil
+		}
+	}
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0, nil
+	case len(va.prerelease) == 0:
+		return 1, nil
+	case len(vb.prerelease) == 0:
+		return -1, nil
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c, nil
+		}
+	}
+	return cmp.Compare(len(va.prerelease), len(vb.prerelease)), nil
+}
+
+// comparePrerelease compares pre-release identifiers: numeric ones numerically and
+// before alphanumeric ones, which compare as strings.
+func comparePrerelease(a, b string) int {
+	na, aErr := strconv.ParseUint(a, 10, 64)
+	nb, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return cmp.Compare(na, nb)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/database"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// Exit codes of the CLI commands.
+const (
+	exitOK       = 0 // success
+	exitFailure  = 1 // the command failed
+	exitUsage    = 2 // invalid command line
+	exitNotFound = 3 // the user, device, organization or department does not exist
+)
+
+// command is a command of the CLI, or a group of subcommands when run is nil.
+type command struct {
+	name        string
+	usage       string // arguments and flags, after the command's name
+	summary     string
+	run         func(ctx context.Context, c *command, args []string) error
+	subcommands []*command
+
+	path string // full command line up to the name ("server user list"), set on dispatch
+}
+
+// commands are the commands of the server binary; without one, it serves the API.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "migrate", summary: "Database migrations", subcommands: migrateCommands},
+		{name: "user", summary: "Dashboard users", subcommands: userCommands},
+		{name: "device", summary: "Devices", subcommands: deviceCommands},
+		{name: "enrollment-key", summary: "Per-organization enrollment keys", subcommands: enrollmentKeyCommands},
+		{name: "cleanup", summary: "Data retention cleanup", subcommands: cleanupCommands},
+		backupCommand,
+		restoreCommand,
+		archiveRestoreCommand,
+		siemTestCommand,
+		releaseKeygenCommand,
+		releaseSignCommand,
+		// create-user predates the user command group.
+		{name: "create-user", usage: userCreateUsage, summary: "Same as user create", run: runUserCreate},
+		{name: "help", summary: "Show this help", run: runHelp},
+	}
+}
+
+// runCLI runs the command args name and returns the process exit code.
+func runCLI(args []string) int {
+	cmds, path := commands, "server"
+	if isHelpFlag(args[0]) {
+		args[0] = "help"
+	}
+	for {
+		var c *command
+		for _, candidate := range cmds {
+			if candidate.name == args[0] {
+				c = candidate
+			}
+		}
+		if c == nil {
+			fmt.Fprintf(os.Stderr, "Error: unknown command %q\n\n", strings.TrimPrefix(path+" "+args[0], "server "))
+			printCommands(os.Stderr, path, cmds)
+			return exitUsage
+		}
+		c.path = path + " " + c.name
+		args = args[1:]
+
+		if c.run != nil {
+			return exitCode(c.run(context.Background(), c, args))
+		}
+		if len(args) == 0 || isHelpFlag(args[0]) {
+			printCommands(os.Stderr, c.path, c.subcommands)
+			if len(args) == 0 {
+				return exitUsage
+			}
+			return exitOK
+		}
+		cmds, path = c.subcommands, c.path
+	}
+}
+
+// runHelp prints the commands.
+func runHelp(_ context.Context, _ *command, _ []string) error {
+	fmt.Println("Usage: server [<command> [<subcommand>]] [flags]")
+	fmt.Println()
+	fmt.Println("Without a command (or with serve), the server runs the API. The commands use the same")
+	fmt.Println("environment variables (DATABASE_URL, ...) as the server.")
+	fmt.Println()
+	printCommands(os.Stdout, "server", commands)
+	fmt.Println()
+	fmt.Println("Run a command with --help for its flags. Listing commands take --output table|json.")
+	fmt.Println("Exit codes: 0 success, 1 failure, 2 invalid usage, 3 not found.")
+	return nil
+}
+
+// printCommands prints the names and summaries of cmds and their subcommands.
+func printCommands(w io.Writer, path string, cmds []*command) {
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	var walk func(prefix string, cmds []*command)
+	walk = func(prefix string, cmds []*command) {
+		for _, c := range cmds {
+			if c.run == nil {
+				walk(prefix+c.name+" ", c.subcommands)
+				continue
+			}
+			fmt.Fprintf(tw, "  %s\t%s\n", prefix+c.name, c.summary)
+		}
+	}
+	walk(strings.TrimPrefix(path+" ", "server "), cmds)
+	tw.Flush()
+}
+
+func isHelpFlag(arg string) bool {
+	return arg == "-h" || arg == "-help" || arg == "--help"
+}
+
+// cliError is an error that ends the process with code.
+type cliError struct {
+	code     int
+	err      error
+	reported bool // already printed, with the usage
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+// usageErrorf returns an invalid command line error.
+func usageErrorf(format string, args ...any) error {
+	return &cliError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// notFoundErrorf returns the error of a user, device, organization or department that
+// does not exist.
+func notFoundErrorf(format string, args ...any) error {
+	return &cliError{code: exitNotFound, err: fmt.Errorf(format, args...)}
+}
+
+// exitCode prints err, if any, and returns the exit code it ends the process with.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ce *cliError
+	if !errors.As(err, &ce) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitFailure
+	}
+	if !ce.reported {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", ce.err)
+	}
+	return ce.code
+}
+
+// newFlags returns the flag set of c, which prints c's usage.
+func newFlags(c *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.path, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n%s\n", c.path, c.usage, c.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(os.Stderr, "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args, in which flags and positional arguments may come in any
+// order, and returns the positional arguments: at least min, and at most max unless
+// max is negative.
+func parseFlags(fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, &cliError{code: exitOK, err: err, reported: true}
+			}
+			return nil, &cliError{code: exitUsage, err: err, reported: true}
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		fmt.Fprintln(os.Stderr, "Error: wrong number of arguments")
+		fs.Usage()
+		return nil, &cliError{code: exitUsage, err: errors.New("wrong number of arguments"), reported: true}
+	}
+	return positional, nil
+}
+
+// outputFormat is the --output flag of the commands that print data: table or json.
+type outputFormat string
+
+func (f *outputFormat) String() string { return string(*f) }
+
+func (f *outputFormat) Set(s string) error {
+	if s != "table" && s != "json" {
+		return errors.New("must be table or json")
+	}
+	*f = outputFormat(s)
+	return nil
+}
+
+// outputFlag adds the --output (-o) flag to fs.
+func outputFlag(fs *flag.FlagSet) *outputFormat {
+	format := outputFormat("table")
+	fs.Var(&format, "output", "output format: table or json")
+	fs.Var(&format, "o", "shorthand for --output")
+	return &format
+}
+
+// print writes v to stdout as JSON, or as the table rows writes (tab-separated cells).
+func (f outputFormat) print(v any, rows func(w io.Writer)) error {
+	if f == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	rows(tw)
+	return tw.Flush()
+}
+
+// cell formats an optional value of a table cell, "-" when absent.
+func cell[T any](v *T, format func(T) string) string {
+	if v == nil {
+		return "-"
+	}
+	return format(*v)
+}
+
+// formatTime formats a time of a table cell.
+func formatTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// readPassword returns password, or with fromStdin the first line of stdin, so that
+// scripts need not put the password on the command line.
+func readPassword(password string, fromStdin bool) (string, error) {
+	if fromStdin == (password != "") {
+		return "", usageErrorf("set one of --password and --password-stdin")
+	}
+	if !fromStdin {
+		return password, nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// loadConfig loads the server configuration and sends the logs to stderr, keeping
+// stdout for the command's output. Below LOG_LEVEL=debug, only warnings and errors
+// are logged.
+func loadConfig() *config.Config {
+	cfg := config.Load()
+
+	level := max(cfg.LogLevel, slog.LevelWarn)
+	if cfg.LogLevel == slog.LevelDebug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+	return cfg
+}
+
+// cliEnv is the configuration and the database of a command.
+type cliEnv struct {
+	cfg     *config.Config
+	db      *sqlx.DB
+	stores  *repository.Stores
+	command string
+}
+
+// openEnv loads the configuration and connects to the database, which must be at the
+// binary's latest migration.
+func openEnv(ctx context.Context, c *command) (*cliEnv, error) {
+	cfg := loadConfig()
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	version, err := database.MigrationVersion(ctx, db)
+	if err == nil {
+		var latest uint
+		latest, err = database.LatestMigration(migrationsFor(cfg.DatabaseURL))
+		if err == nil && version != latest {
+			err = fmt.Errorf("database is at migration %d, this server at %d; run server migrate up", version, latest)
+			if version > latest {
+				err = fmt.Errorf("database is at migration %d, newer than this server (%d)", version, latest)
+			}
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &cliEnv{cfg: cfg, db: db, stores: repository.NewStores(db, cfg.Audit.ChainKey), command: c.path}, nil
+}
+
+// Close closes the database.
+func (e *cliEnv) Close() {
+	e.db.Close()
+}
+
+// organization returns the organization ID ref, or the default organization when ref
+// is empty.
+func (e *cliEnv) organization(ctx context.Context, ref string) (uuid.UUID, error) {
+	if ref == "" {
+		return repository.DefaultOrganizationID, nil
+	}
+	id, err := uuid.Parse(ref)
+	if err != nil {
+		return uuid.Nil, usageErrorf("invalid organization ID %q", ref)
+	}
+	if _, err := e.stores.Organizations.GetByID(ctx, id); err != nil {
+		if isNoRows(err) {
+			return uuid.Nil, notFoundErrorf("organization %s not found", id)
+		}
+		return uuid.Nil, err
+	}
+	return id, nil
+}
+
+// audit records a change made by the command in the audit log, as the user "cli".
+func (e *cliEnv) audit(ctx context.Context, orgID *uuid.UUID, action, resourceType string, resourceID *uuid.UUID, details map[string]interface{}) {
+	var detailsJSON string
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			slog.Error("audit: cannot encode details", "error", err, "action", action)
+		} else {
+			detailsJSON = string(b)
+		}
+	}
+	err := e.stores.AuditLogs.Create(ctx, &models.AuditLog{
+		ID:           uuid.New(),
+		Username:     "cli",
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      detailsJSON,
+		UserAgent:    e.command,
+		CreatedAt:    time.Now(),
+
+		OrganizationID: orgID,
+	})
+	if err != nil {
+		slog.Error("audit: failed to record cli action", "error", err, "action", action)
+	}
+}
+
+// isNoRows reports whether err is the error of a lookup that found nothing.
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"inventario/server/internal/archive"
+	"inventario/server/internal/backup"
+	"inventario/server/internal/database"
+	"inventario/server/internal/repository"
+)
+
+var backupCommand = &command{
+	name: "backup", usage: "[--out <file>]",
+	summary: "Write a backup of all tables to a portable archive",
+	run:     runBackup,
+}
+
+var restoreCommand = &command{
+	name: "restore", usage: "[--remap-ids] <backup file>",
+	summary: "Load a backup into an empty database",
+	run:     runRestore,
+}
+
+var archiveRestoreCommand = &command{
+	name: "archive-restore", usage: "[--table " + strings.Join(repository.ArchiveTables, "|") + "] <archive id>",
+	summary: "Load an archive of purged history back into the database",
+	run:     runArchiveRestore,
+}
+
+// runBackup writes a backup of all tables to --out, by default to a file named after
+// the current time in the working directory.
+func runBackup(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	out := fs.String("out", "inventario-backup-"+time.Now().UTC().Format("20060102-150405")+".zip", "backup file to create")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	cfg := loadConfig()
+
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer db.Close()
+
+	version, err := database.MigrationVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return errors.New("database has no schema; run server migrate up")
+	}
+
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Write(ctx, db, version, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	for _, t := range manifest.Tables {
+		fmt.Printf("%s: %d rows\n", t.Name, t.Rows)
+	}
+	fmt.Printf("Backup of migration %d written to %s\n", version, *out)
+	return nil
+}
+
+// runRestore loads a backup into the empty database DATABASE_URL points to: it migrates
+// the database to the backup's migration version, loads the tables, then runs the
+// remaining migrations.
+func runRestore(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	remapIDs := fs.Bool("remap-ids", false, "give every row a new ID; the audit hash chain is verified and sealed again")
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	path := positional[0]
+	cfg := loadConfig()
+
+	r, err := backup.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer r.Close()
+
+	migrationsFS := migrationsFor(cfg.DatabaseURL)
+	latest, err := database.LatestMigration(migrationsFS)
+	if err != nil {
+		return err
+	}
+	if r.Manifest.MigrationVersion > latest {
+		return fmt.Errorf("backup is at migration %d, this server only knows migrations up to %d",
+			r.Manifest.MigrationVersion, latest)
+	}
+
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if r.Manifest.Driver != db.DriverName() {
+		return fmt.Errorf("backup of a %s database cannot be restored into a %s one", r.Manifest.Driver, db.DriverName())
+	}
+	version, err := database.MigrationVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version > 0 {
+		empty, err := backup.IsEmpty(ctx, db)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return errors.New("database is not empty; restore into a new database")
+		}
+	}
+
+	if err := database.MigrateTo(cfg.DatabaseURL, migrationsFS, r.Manifest.MigrationVersion); err != nil {
+		return err
+	}
+	tables, err := r.Restore(ctx, db, *remapIDs, cfg.Audit.ChainKey)
+	if err != nil {
+		return err
+	}
+	if err := database.MigrateTo(cfg.DatabaseURL, migrationsFS, latest); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		fmt.Printf("%s: %d rows restored\n", t.Name, t.Rows)
+	}
+	fmt.Printf("Backup of %s (migration %d) restored; database at migration %d\n",
+		r.Manifest.CreatedAt.Format(time.RFC3339), r.Manifest.MigrationVersion, latest)
+	return nil
+}
+
+// runArchiveRestore loads an archive of purged history back into the database, for
+// investigations. Rows already present are skipped, so it can be run again; restored
+// rows older than the retention are purged, and archived again, by the next cleanup.
+func runArchiveRestore(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	table := fs.String("table", "", "restore only this table")
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	id := positional[0]
+	if *table != "" && !slices.Contains(repository.ArchiveTables, *table) {
+		return usageErrorf("--table must be one of %s", strings.Join(repository.ArchiveTables, ", "))
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	if !env.cfg.Archive.Enabled() {
+		return errors.New("neither ARCHIVE_DIR nor ARCHIVE_S3_BUCKET is set")
+	}
+	store, err := archive.NewStore(env.cfg.Archive)
+	if err != nil {
+		return err
+	}
+	archiver := archive.New(store)
+
+	manifest, err := archiver.Manifest(ctx, id)
+	if err != nil {
+		return fmt.Errorf("archive %s: %w", id, err)
+	}
+
+	// Files are restored in the order of ArchiveTables, audit logs first.
+	for _, t := range repository.ArchiveTables {
+		if *table != "" && t != *table {
+			continue
+		}
+		for _, file := range manifest.Files {
+			if file.Table != t {
+				continue
+			}
+			var result *repository.RestoreResult
+			err := archiver.Read(ctx, id, file, func(decode func(any) error) error {
+				var err error
+				result, err = env.stores.Archives.Restore(ctx, t, decode)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", file.Name, err)
+			}
+			fmt.Printf("%s: %d rows restored, %d already present, %d of deleted devices skipped\n",
+				file.Name, result.Restored, result.Existing, result.Skipped)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"inventario/server/internal/archive"
+	"inventario/server/internal/service"
+)
+
+var cleanupCommands = []*command{
+	{name: "run", usage: "[--dry-run] [--output table|json]", summary: "Run the retention cleanup now, or with --dry-run count what it would do", run: runCleanupRun},
+}
+
+func runCleanupRun(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	dryRun := fs.Bool("dry-run", false, "only count the rows the cleanup would purge and the devices it would mark inactive")
+	format := outputFlag(fs)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	// Purged history is archived as by the server.
+	var archiver *archive.Archiver
+	if env.cfg.Archive.Enabled() && !*dryRun {
+		store, err := archive.NewStore(env.cfg.Archive)
+		if err != nil {
+			return fmt.Errorf("configure archiving: %w", err)
+		}
+		archiver = archive.New(store)
+	}
+	cleanupSvc := service.NewCleanupService(env.stores.Cleanup, env.stores.AuditLogs, env.stores.Retention, archiver, env.cfg.RetentionDays, env.cfg.InactiveDays)
+
+	if *dryRun {
+		preview, err := cleanupSvc.Preview(ctx)
+		if err != nil {
+			return err
+		}
+		return format.print(preview, func(w io.Writer) {
+			fmt.Fprintln(w, "DATASET\tWOULD PURGE")
+			fmt.Fprintf(w, "audit_logs\t%d\n", preview.AuditLogs)
+			fmt.Fprintf(w, "device_activity_log\t%d\n", preview.ActivityLogs)
+			fmt.Fprintf(w, "hardware_history\t%d\n", preview.HardwareHistory)
+			fmt.Fprintf(w, "user_sessions\t%d\n", preview.Sessions)
+			fmt.Fprintf(w, "agent_update_reports\t%d\n", preview.UpdateReports)
+			fmt.Fprintf(w, "\nDevices to mark inactive:\t%d\n", preview.DevicesMarkedInactive)
+		})
+	}
+
+	report, err := cleanupSvc.Run(ctx)
+	if report == nil {
+		return err
+	}
+	if perr := format.print(report, func(w io.Writer) {
+		fmt.Fprintln(w, "DATASET\tPURGED")
+		fmt.Fprintf(w, "audit_logs\t%d\n", report.AuditLogs)
+		fmt.Fprintf(w, "device_activity_log\t%d\n", report.ActivityLogs)
+		fmt.Fprintf(w, "hardware_history\t%d\n", report.HardwareHistory)
+		fmt.Fprintf(w, "user_sessions\t%d\n", report.Sessions)
+		fmt.Fprintf(w, "rate_limits\t%d\n", report.RateLimits)
+		fmt.Fprintf(w, "agent_update_reports\t%d\n", report.UpdateReports)
+		fmt.Fprintf(w, "\nDevices marked inactive:\t%d\n", report.InactiveDevices)
+		if report.Archive != "" {
+			fmt.Fprintf(w, "Archive:\t%s\n", report.Archive)
+		}
+	}); perr != nil {
+		return perr
+	}
+	return err
+}
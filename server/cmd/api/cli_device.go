@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/repository"
+	"inventario/server/internal/service"
+	"inventario/shared/models"
+)
+
+var deviceCommands = []*command{
+	{name: "list", usage: "[--organization <id>] [--hostname <text>] [--os <text>] [--status online|offline|inactive] [--department <id>] [--source <source>] [--limit <n>] [--output table|json]", summary: "List devices", run: runDeviceList},
+	{name: "delete", usage: "<device> [--organization <id>]", summary: "Delete a device, by ID or hostname, with all its data", run: runDeviceDelete},
+	{name: "set-department", usage: "<device> <department|none> [--organization <id>]", summary: "Assign a device to a department, by ID or name, or to none", run: runDeviceSetDepartment},
+}
+
+// listPageSize is the page size of device list, the largest the repository serves.
+const listPageSize = 100
+
+// deviceScope returns the scope of the organization ref, or of every organization when
+// ref is empty.
+func (e *cliEnv) deviceScope(ctx context.Context, ref string) (authz.Scope, error) {
+	if ref == "" {
+		return authz.Global, nil
+	}
+	orgID, err := e.organization(ctx, ref)
+	if err != nil {
+		return authz.Scope{}, err
+	}
+	return authz.Scope{All: true, OrganizationID: orgID}, nil
+}
+
+// device returns the device ref names, by ID or hostname, within scope.
+func (e *cliEnv) device(ctx context.Context, ref string, scope authz.Scope) (*models.Device, error) {
+	var device *models.Device
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		device, err = e.stores.Devices.GetByID(ctx, id, scope)
+	} else {
+		device, err = e.stores.Devices.GetByHostname(ctx, ref, scope)
+	}
+	if isNoRows(err) {
+		return nil, notFoundErrorf("device %s not found", ref)
+	}
+	return device, err
+}
+
+func runDeviceList(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	organization := fs.String("organization", "", "list the devices of this organization only (ID)")
+	var p repository.ListParams
+	fs.StringVar(&p.Hostname, "hostname", "", "hostname contains")
+	fs.StringVar(&p.OS, "os", "", "OS name or version contains")
+	fs.StringVar(&p.Status, "status", "", "online, offline or inactive (default: all active devices)")
+	fs.StringVar(&p.DepartmentID, "department", "", "department ID")
+	fs.StringVar(&p.Source, "source", "", "agent, manual, import or discovery")
+	limit := fs.Int("limit", 0, "list at most this many devices (0: all)")
+	format := outputFlag(fs)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return usageErrorf("--limit must not be negative")
+	}
+	if !slices.Contains([]string{"", "online", "offline", "inactive"}, p.Status) {
+		return usageErrorf("invalid status %q", p.Status)
+	}
+	if p.DepartmentID != "" {
+		if _, err := uuid.Parse(p.DepartmentID); err != nil {
+			return usageErrorf("invalid department ID %q", p.DepartmentID)
+		}
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	scope, err := env.deviceScope(ctx, *organization)
+	if err != nil {
+		return err
+	}
+	devices := []models.Device{}
+	for p.Page, p.Limit = 1, listPageSize; ; p.Page++ {
+		result, err := env.stores.Devices.List(ctx, p, scope)
+		if err != nil {
+			return err
+		}
+		devices = append(devices, result.Devices...)
+		if len(result.Devices) < listPageSize || len(devices) >= result.Total || (*limit > 0 && len(devices) >= *limit) {
+			break
+		}
+	}
+	if *limit > 0 && len(devices) > *limit {
+		devices = devices[:*limit]
+	}
+
+	return format.print(devices, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tHOSTNAME\tSERIAL\tOS\tSTATUS\tONLINE\tDEPARTMENT\tSOURCE\tLAST SEEN")
+		for _, d := range devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n", d.ID, d.Hostname, d.SerialNumber, strings.TrimSpace(d.OSName+" "+d.OSVersion),
+				d.Status, d.Online, cell(d.DepartmentName, func(s string) string { return s }), d.Source, formatTime(d.LastSeen))
+		}
+	})
+}
+
+func runDeviceDelete(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	organization := fs.String("organization", "", "look the device up in this organization only (ID)")
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	scope, err := env.deviceScope(ctx, *organization)
+	if err != nil {
+		return err
+	}
+	device, err := env.device(ctx, positional[0], scope)
+	if err != nil {
+		return err
+	}
+	deviceSvc := service.NewDeviceService(env.stores.Devices, env.stores.Departments)
+	if _, err := deviceSvc.DeleteDevice(ctx, device.ID, scope); err != nil {
+		return err
+	}
+	env.audit(ctx, &device.OrganizationID, "device.delete", "device", &device.ID, map[string]interface{}{
+		"hostname":      device.Hostname,
+		"serial_number": device.SerialNumber,
+	})
+	fmt.Printf("Device '%s' (%s) deleted\n", device.Hostname, device.ID)
+	return nil
+}
+
+func runDeviceSetDepartment(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	organization := fs.String("organization", "", "look the device up in this organization only (ID)")
+	positional, err := parseFlags(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	scope, err := env.deviceScope(ctx, *organization)
+	if err != nil {
+		return err
+	}
+	device, err := env.device(ctx, positional[0], scope)
+	if err != nil {
+		return err
+	}
+
+	// The department must belong to the device's organization.
+	var dept *models.Department
+	if ref := positional[1]; ref != "none" {
+		departments, err := env.stores.Departments.List(ctx, device.OrganizationID)
+		if err != nil {
+			return err
+		}
+		for i := range departments {
+			if departments[i].ID.String() == ref || strings.EqualFold(departments[i].Name, ref) {
+				dept = &departments[i]
+				break
+			}
+		}
+		if dept == nil {
+			return notFoundErrorf("department %s not found in the device's organization", ref)
+		}
+	}
+	var deptID *uuid.UUID
+	name := "none"
+	if dept != nil {
+		deptID, name = &dept.ID, dept.Name
+	}
+
+	deviceSvc := service.NewDeviceService(env.stores.Devices, env.stores.Departments)
+	scope = authz.Scope{All: true, OrganizationID: device.OrganizationID}
+	if err := deviceSvc.UpdateDepartment(ctx, device.ID, deptID, scope); err != nil {
+		if errors.Is(err, service.ErrDepartmentOutOfScope) || isNoRows(err) {
+			return notFoundErrorf("%v", err)
+		}
+		return err
+	}
+	env.audit(ctx, &device.OrganizationID, "device.department.update", "device", &device.ID, map[string]interface{}{"department_id": deptID})
+	fmt.Printf("Device '%s' assigned to department %s\n", device.Hostname, name)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/service"
+	"inventario/shared/models"
+)
+
+var enrollmentKeyCommands = []*command{
+	{name: "rotate", usage: "[--organization <id>] [--name <name>] [--output table|json]", summary: "Issue a new enrollment key for an organization and revoke its other keys", run: runEnrollmentKeyRotate},
+}
+
+// rotatedEnrollmentKey is the output of enrollment-key rotate.
+type rotatedEnrollmentKey struct {
+	Key     string                 `json:"key"` // shown only once
+	Created *models.EnrollmentKey  `json:"enrollment_key"`
+	Revoked []models.EnrollmentKey `json:"revoked"`
+}
+
+func runEnrollmentKeyRotate(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	organization := fs.String("organization", "", "organization ID (default: the Default organization)")
+	name := fs.String("name", "", "name of the new key (default: rotated <date>)")
+	format := outputFlag(fs)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		*name = "rotated " + time.Now().Format("2006-01-02")
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	orgID, err := env.organization(ctx, *organization)
+	if err != nil {
+		return err
+	}
+	orgSvc := service.NewOrganizationService(env.stores.Organizations, nil)
+	raw, key, revoked, err := orgSvc.RotateEnrollmentKey(ctx, orgID, uuid.Nil, *name)
+	if key != nil {
+		env.audit(ctx, &orgID, "enrollment_key.create", "enrollment_key", &key.ID, map[string]interface{}{
+			"name":       key.Name,
+			"key_prefix": key.KeyPrefix,
+		})
+	}
+	for i := range revoked {
+		env.audit(ctx, &orgID, "enrollment_key.revoke", "enrollment_key", &revoked[i].ID, nil)
+	}
+	if err != nil {
+		if key != nil {
+			fmt.Printf("New enrollment key: %s\n", raw)
+		}
+		return err
+	}
+
+	return format.print(rotatedEnrollmentKey{Key: raw, Created: key, Revoked: revoked}, func(w io.Writer) {
+		fmt.Fprintf(w, "Key:\t%s\n", raw)
+		fmt.Fprintf(w, "ID:\t%s\n", key.ID)
+		fmt.Fprintf(w, "Name:\t%s\n", key.Name)
+		fmt.Fprintf(w, "Revoked:\t%d\n", len(revoked))
+		fmt.Fprintln(w, "\nThe key is shown only once; set it as the agents' enrollment key.")
+	})
+}
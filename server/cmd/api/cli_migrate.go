@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"inventario/server/internal/database"
+)
+
+var migrateCommands = []*command{
+	{name: "up", usage: "[--to <version>]", summary: "Apply the pending migrations, or those up to a version", run: runMigrateUp},
+	{name: "down", usage: "[--steps <n> | --to <version>]", summary: "Roll back the last migrations (one by default)", run: runMigrateDown},
+	{name: "status", usage: "[--output table|json]", summary: "Show the applied and pending migrations", run: runMigrateStatus},
+	{name: "force", usage: "<version>", summary: "Mark a version as applied and clear the dirty flag, without running migrations", run: runMigrateForce},
+}
+
+// migrationStatus is the output of migrate status.
+type migrationStatus struct {
+	Version uint   `json:"version"` // 0 when no migration ran
+	Dirty   bool   `json:"dirty"`
+	Latest  uint   `json:"latest"`
+	Pending []uint `json:"pending"`
+}
+
+// migrationStatusOf returns the migration state of the database databaseURL selects.
+func migrationStatusOf(ctx context.Context, databaseURL string) (*migrationStatus, error) {
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	defer db.Close()
+
+	version, dirty, err := database.MigrationState(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := database.Migrations(migrationsFor(databaseURL))
+	if err != nil {
+		return nil, err
+	}
+	status := &migrationStatus{Version: version, Dirty: dirty, Pending: []uint{}}
+	for _, v := range versions {
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+		status.Latest = v
+	}
+	return status, nil
+}
+
+// migrationVersion parses a version given on the command line, which must be one of
+// the binary's migrations.
+func migrationVersion(databaseURL, arg string) (uint, error) {
+	v, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return 0, usageErrorf("invalid migration version %q", arg)
+	}
+	versions, err := database.Migrations(migrationsFor(databaseURL))
+	if err != nil {
+		return 0, err
+	}
+	for _, known := range versions {
+		if known == uint(v) {
+			return known, nil
+		}
+	}
+	return 0, usageErrorf("there is no migration %d", v)
+}
+
+func runMigrateUp(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	to := fs.String("to", "", "migrate up to this version instead of the latest")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	cfg := loadConfig()
+
+	status, err := migrationStatusOf(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	target := status.Latest
+	if *to != "" {
+		if target, err = migrationVersion(cfg.DatabaseURL, *to); err != nil {
+			return err
+		}
+		if target < status.Version {
+			return usageErrorf("database is at migration %d, past %d; use migrate down", status.Version, target)
+		}
+	}
+	if err := database.MigrateTo(cfg.DatabaseURL, migrationsFor(cfg.DatabaseURL), target); err != nil {
+		return err
+	}
+	fmt.Printf("Database migrated from %d to %d\n", status.Version, target)
+	return nil
+}
+
+func runMigrateDown(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	steps := fs.Int("steps", 1, "number of migrations to roll back")
+	to := fs.String("to", "", "roll back to this version (it stays applied)")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *steps < 1 {
+		return usageErrorf("--steps must be at least 1")
+	}
+	cfg := loadConfig()
+
+	status, err := migrationStatusOf(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	if status.Version == 0 {
+		return fmt.Errorf("no migration to roll back")
+	}
+	migrationsFS := migrationsFor(cfg.DatabaseURL)
+	if *to != "" {
+		target, err := migrationVersion(cfg.DatabaseURL, *to)
+		if err != nil {
+			return err
+		}
+		if target > status.Version {
+			return usageErrorf("database is at migration %d, before %d; use migrate up", status.Version, target)
+		}
+		err = database.MigrateTo(cfg.DatabaseURL, migrationsFS, target)
+	} else {
+		err = database.MigrateSteps(cfg.DatabaseURL, migrationsFS, -*steps)
+	}
+	if err != nil {
+		return err
+	}
+
+	after, err := migrationStatusOf(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Database migrated from %d to %d\n", status.Version, after.Version)
+	return nil
+}
+
+func runMigrateStatus(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	format := outputFlag(fs)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	cfg := loadConfig()
+
+	status, err := migrationStatusOf(ctx, cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	return format.print(status, func(w io.Writer) {
+		fmt.Fprintf(w, "Version:\t%d\n", status.Version)
+		fmt.Fprintf(w, "Dirty:\t%t\n", status.Dirty)
+		fmt.Fprintf(w, "Latest:\t%d\n", status.Latest)
+		fmt.Fprintf(w, "Pending:\t%d\n", len(status.Pending))
+	})
+}
+
+func runMigrateForce(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	cfg := loadConfig()
+
+	version, err := migrationVersion(cfg.DatabaseURL, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := database.ForceMigration(cfg.DatabaseURL, migrationsFor(cfg.DatabaseURL), version); err != nil {
+		return err
+	}
+	fmt.Printf("Database marked as migrated to %d\n", version)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"inventario/shared/dto"
+)
+
+// The release commands run offline and need no configuration.
+
+var releaseKeygenCommand = &command{
+	name: "release-keygen", usage: "--out <private key file>",
+	summary: "Create an Ed25519 key pair for signing agent releases",
+	run:     runReleaseKeygen,
+}
+
+var releaseSignCommand = &command{
+	name: "release-sign", usage: "--key <private key file> --version <version> [--os <os>] [--arch <arch>] <artifact>",
+	summary: "Print the SHA-256 and the signature of an agent build",
+	run:     runReleaseSign,
+}
+
+// runReleaseKeygen creates an Ed25519 key pair for signing agent releases. The private
+// key is written to --out; the public key goes to AGENT_RELEASE_PUBLIC_KEYS and to the
+// agents' update_public_keys.
+func runReleaseKeygen(_ context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	out := fs.String("out", "", "private key file to create (required)")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *out == "" {
+		return usageErrorf("--out is required")
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, base64.StdEncoding.EncodeToString(priv.Seed()))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Private key written to %s; keep it offline\n", *out)
+	fmt.Printf("Public key: %s\n", base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+// runReleaseSign prints the SHA-256 and the signature of an agent build, to be sent
+// with the upload to POST /api/v1/agent-releases. The signature covers the version and
+// platform too, which must match the upload.
+func runReleaseSign(_ context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	keyFile := fs.String("key", "", "private key file created by release-keygen (required)")
+	version := fs.String("version", "", "release version (required)")
+	goos := fs.String("os", "windows", "release operating system")
+	arch := fs.String("arch", "amd64", "release architecture")
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *keyFile == "" {
+		return usageErrorf("--key is required")
+	}
+	if *version == "" {
+		return usageErrorf("--version is required")
+	}
+
+	raw, err := os.ReadFile(*keyFile)
+	if err != nil {
+		return err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return errors.New("the key file does not hold a key created by release-keygen")
+	}
+
+	f, err := os.Open(positional[0])
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+
+	sig := ed25519.Sign(ed25519.NewKeyFromSeed(seed), dto.ReleaseSigningPayload(*version, *goos, *arch, digest))
+	fmt.Printf("sha256:    %s\n", digest)
+	fmt.Printf("signature: %s\n", base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"inventario/server/internal/siem"
+)
+
+var siemTestCommand = &command{
+	name: "siem-test", summary: "Send a test message to the SIEM receiver (SIEM_* variables)",
+	run: runSIEMTest,
+}
+
+// runSIEMTest sends one test message to the configured SIEM receiver (SIEM_* variables).
+func runSIEMTest(_ context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	cfg := loadConfig()
+
+	if !cfg.SIEM.Enabled() {
+		return errors.New("SIEM_ADDRESS is not set")
+	}
+	forwarder, err := siem.NewForwarder(nil, cfg.SIEM)
+	if err != nil {
+		return err
+	}
+	if err := forwarder.SendTest(); err != nil {
+		return err
+	}
+	fmt.Printf("Test message sent to %s over %s (%s)\n", cfg.SIEM.Address, cfg.SIEM.Protocol, cfg.SIEM.Format)
+	return nil
+}
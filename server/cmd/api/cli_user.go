@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/service"
+	"inventario/shared/models"
+)
+
+const userCreateUsage = "--username <user> (--password <pass> | --password-stdin) [--role <role>] [--organization <id>] [--super-admin]"
+
+var userCommands = []*command{
+	{name: "create", usage: userCreateUsage, summary: "Create a local user, who chooses a new password at the first login", run: runUserCreate},
+	{name: "list", usage: "[--organization <id>] [--output table|json]", summary: "List the users", run: runUserList},
+	{name: "reset-password", usage: "<user> (--password <pass> | --password-stdin)", summary: "Set a temporary password, unlock the user and end their sessions", run: runUserResetPassword},
+	{name: "set-role", usage: "<user> <role> [--super-admin=true|false]", summary: "Change the base role (and the super-admin flag) of a user", run: runUserSetRole},
+	{name: "delete", usage: "<user>", summary: "Delete a user", run: runUserDelete},
+}
+
+// optionalBool is a boolean flag that tells whether it was set.
+type optionalBool struct {
+	value *bool
+}
+
+func (b *optionalBool) String() string {
+	if b == nil || b.value == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b.value)
+}
+
+func (b *optionalBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.value = &v
+	return nil
+}
+
+func (b *optionalBool) IsBoolFlag() bool { return true }
+
+// authService returns the AuthService of the commands, without LDAP.
+func (e *cliEnv) authService() (*service.AuthService, error) {
+	policy, err := service.NewPasswordPolicy(e.cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("load password policy: %w", err)
+	}
+	sessions := service.NewSessionService(e.stores.Sessions, e.stores.Users, e.cfg.Session, e.cfg.JWTSecret)
+	return service.NewAuthService(e.db, e.stores.Users, e.stores.Organizations, e.stores.Tokens, e.stores.MFA, e.stores.Roles, sessions, nil, policy, e.cfg.MFA, e.cfg.Lockout, e.cfg.JWTSecret), nil
+}
+
+// user returns the user ref names, by ID or username.
+func (e *cliEnv) user(ctx context.Context, ref string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = e.stores.Users.GetByID(ctx, id)
+	} else {
+		user, err = e.stores.Users.GetByUsername(ctx, ref)
+	}
+	if isNoRows(err) {
+		return nil, notFoundErrorf("user %s not found", ref)
+	}
+	return user, err
+}
+
+func runUserCreate(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	username := fs.String("username", "", "username (required)")
+	password := fs.String("password", "", "initial password; must meet the password policy")
+	passwordStdin := fs.Bool("password-stdin", false, "read the initial password from the first line of stdin")
+	role := fs.String("role", "admin", "base role: admin, viewer, auditor or a custom role")
+	organization := fs.String("organization", "", "organization ID (default: the Default organization)")
+	superAdmin := fs.Bool("super-admin", false, "make the user a super-admin")
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *username == "" {
+		return usageErrorf("--username is required")
+	}
+	pass, err := readPassword(*password, *passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	orgID, err := env.organization(ctx, *organization)
+	if err != nil {
+		return err
+	}
+	authSvc, err := env.authService()
+	if err != nil {
+		return err
+	}
+	// CLI-created users pick their own password at the first login.
+	if err := authSvc.CreateUser(ctx, orgID, *username, *username, pass, *role, true, *superAdmin); err != nil {
+		return err
+	}
+	env.audit(ctx, &orgID, "user.create", "user", nil, map[string]interface{}{"username": *username, "name": *username, "role": *role, "super_admin": *superAdmin})
+	fmt.Printf("User '%s' created successfully with role '%s'; a new password must be chosen at first login\n", *username, *role)
+	return nil
+}
+
+func runUserList(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	organization := fs.String("organization", "", "list the users of this organization only (ID)")
+	format := outputFlag(fs)
+	if _, err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	var orgID uuid.UUID
+	if *organization != "" {
+		if orgID, err = env.organization(ctx, *organization); err != nil {
+			return err
+		}
+	}
+	orgs, err := env.stores.Organizations.List(ctx)
+	if err != nil {
+		return err
+	}
+	names := map[uuid.UUID]string{}
+	users := []models.User{}
+	for _, org := range orgs {
+		names[org.ID] = org.Name
+		if orgID != uuid.Nil && org.ID != orgID {
+			continue
+		}
+		list, err := env.stores.Users.List(ctx, org.ID)
+		if err != nil {
+			return err
+		}
+		users = append(users, list...)
+	}
+
+	return format.print(users, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSERNAME\tNAME\tROLE\tSUPER ADMIN\tPROVIDER\tMFA\tORGANIZATION\tLOCKED UNTIL")
+		for _, u := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%t\t%s\t%s\n", u.ID, u.Username, u.Name, u.Role, u.SuperAdmin,
+				u.AuthProvider, u.TOTPEnabled, names[u.OrganizationID], cell(u.LockedUntil, formatTime))
+		}
+	})
+}
+
+func runUserResetPassword(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	password := fs.String("password", "", "temporary password; must meet the password policy")
+	passwordStdin := fs.Bool("password-stdin", false, "read the temporary password from the first line of stdin")
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	pass, err := readPassword(*password, *passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	user, err := env.user(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	authSvc, err := env.authService()
+	if err != nil {
+		return err
+	}
+	if err := authSvc.ResetPassword(ctx, user.ID, pass); err != nil {
+		return err
+	}
+	env.audit(ctx, &user.OrganizationID, "user.password_reset", "user", &user.ID, map[string]interface{}{"target_user_id": user.ID, "username": user.Username})
+	fmt.Printf("Password of '%s' reset; a new password must be chosen at the next login\n", user.Username)
+	return nil
+}
+
+func runUserSetRole(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	var superAdmin optionalBool
+	fs.Var(&superAdmin, "super-admin", "also set (or with =false, clear) the super-admin flag")
+	positional, err := parseFlags(fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	user, err := env.user(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	authSvc, err := env.authService()
+	if err != nil {
+		return err
+	}
+	role := positional[1]
+	if err := authSvc.UpdateUser(ctx, user.OrganizationID, uuid.Nil, user.ID, "", "", "", role, superAdmin.value); err != nil {
+		return err
+	}
+	details := map[string]interface{}{"target_user_id": user.ID, "username": user.Username, "role": role}
+	if superAdmin.value != nil {
+		details["super_admin"] = *superAdmin.value
+	}
+	env.audit(ctx, &user.OrganizationID, "user.update", "user", &user.ID, details)
+	fmt.Printf("Role of '%s' set to '%s'\n", user.Username, role)
+	return nil
+}
+
+func runUserDelete(ctx context.Context, c *command, args []string) error {
+	fs := newFlags(c)
+	positional, err := parseFlags(fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	env, err := openEnv(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer env.Close()
+
+	user, err := env.user(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	authSvc, err := env.authService()
+	if err != nil {
+		return err
+	}
+	if err := authSvc.DeleteUser(ctx, user.OrganizationID, uuid.Nil, user.ID); err != nil {
+		if isNoRows(err) {
+			return notFoundErrorf("user %s not found", positional[0])
+		}
+		return err
+	}
+	env.audit(ctx, &user.OrganizationID, "user.delete", "user", &user.ID, map[string]interface{}{"target_user_id": user.ID})
+	fmt.Printf("User '%s' deleted\n", user.Username)
+	return nil
+}
@@ -3,7 +3,7 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
@@ -11,31 +11,38 @@ import (
 	"syscall"
 	"time"
 
+	"inventario/server/internal/archive"
+	"inventario/server/internal/auditlog"
 	"inventario/server/internal/config"
 	"inventario/server/internal/database"
+	"inventario/server/internal/events"
 	"inventario/server/internal/handler"
 	"inventario/server/internal/middleware"
+	"inventario/server/internal/ratelimit"
 	"inventario/server/internal/repository"
 	"inventario/server/internal/router"
+	"inventario/server/internal/scheduler"
 	"inventario/server/internal/service"
+	"inventario/server/internal/siem"
 	"inventario/server/migrations"
 )
 
 func main() {
-	// Sub-command: create-user
-	if len(os.Args) > 1 && os.Args[1] == "create-user" {
-		runCreateUser()
+	// Without a command the binary serves the API; the commands are in cli.go.
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		runServer()
 		return
 	}
-
-	runServer()
+	os.Exit(runCLI(os.Args[1:]))
 }
 
 func runServer() {
 	// ── Configuration ────────────────────────────────────────────────
 	cfg := config.Load()
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	var logLevel slog.LevelVar
+	logLevel.Set(cfg.LogLevel)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel}))
 	slog.SetDefault(logger)
 
 	slog.Info("starting inventory API server", "port", cfg.ServerPort)
@@ -44,45 +51,136 @@ func runServer() {
 	db := database.Connect(cfg.DatabaseURL)
 	defer db.Close()
 
-	database.RunMigrations(cfg.DatabaseURL, migrations.FS)
+	database.RunMigrations(cfg.DatabaseURL, migrationsFor(cfg.DatabaseURL))
 
 	// ── Repositories ─────────────────────────────────────────────────
-	tokenRepo := repository.NewTokenRepository(db)
-	userRepo := repository.NewUserRepository(db)
-	deviceRepo := repository.NewDeviceRepository(db)
-	activityRepo := repository.NewDeviceActivityRepository(db)
-	inventoryRepo := repository.NewInventoryRepository(db, activityRepo)
-	dashboardRepo := repository.NewDashboardRepository(db)
-	departmentRepo := repository.NewDepartmentRepository(db)
-	auditRepo := repository.NewAuditLogRepository(db)
-	cleanupRepo := repository.NewCleanupRepository(db)
+	stores := repository.NewStores(db, cfg.Audit.ChainKey)
+	if err := stores.AuditLogs.SealMarkers(context.Background()); err != nil {
+		slog.Error("failed to record the audit chain markers", "error", err)
+		os.Exit(1)
+	}
 
 	// ── Audit Logger ─────────────────────────────────────────────────
-	auditLogger := middleware.NewAuditLogger(auditRepo)
+	auditWriter := auditlog.NewWriter(stores.AuditLogs, cfg.Audit)
+	auditLogger := middleware.NewAuditLogger(auditWriter)
 
 	// ── Services ─────────────────────────────────────────────────────
-	authSvc := service.NewAuthService(db, userRepo, tokenRepo, cfg.JWTSecret)
-	inventorySvc := service.NewInventoryService(inventoryRepo)
-	deviceSvc := service.NewDeviceService(deviceRepo)
-	dashboardSvc := service.NewDashboardService(dashboardRepo)
-	departmentSvc := service.NewDepartmentService(departmentRepo)
-	cleanupSvc := service.NewCleanupService(cleanupRepo, cfg.RetentionDays, cfg.InactiveDays, cfg.CleanupInterval)
+	var ldapAuth *service.LDAPAuthenticator
+	if cfg.LDAP.Enabled() {
+		ldapAuth = service.NewLDAPAuthenticator(cfg.LDAP)
+		slog.Info("ldap authentication enabled", "url", cfg.LDAP.URL, "local_fallback", cfg.LDAP.LocalFallback)
+	}
+	passwordPolicy, err := service.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		slog.Error("failed to load password policy", "error", err)
+		os.Exit(1)
+	}
+	sessionSvc := service.NewSessionService(stores.Sessions, stores.Users, cfg.Session, cfg.JWTSecret)
+	authSvc := service.NewAuthService(db, stores.Users, stores.Organizations, stores.Tokens, stores.MFA, stores.Roles, sessionSvc, ldapAuth, passwordPolicy, cfg.MFA, cfg.Lockout, cfg.JWTSecret)
+	inventorySvc := service.NewInventoryService(stores.Inventory)
+	deviceSvc := service.NewDeviceService(stores.Devices, stores.Departments)
+	dashboardSvc := service.NewDashboardService(stores.Dashboard)
+	departmentSvc := service.NewDepartmentService(stores.Departments)
+	apiTokenSvc := service.NewAPITokenService(stores.APITokens)
+	roleSvc := service.NewRoleService(stores.Roles, stores.Users, stores.Departments)
+	organizationSvc := service.NewOrganizationService(stores.Organizations, sessionSvc)
+	agentUpdateSvc, err := service.NewAgentUpdateService(stores.AgentUpdates, stores.Devices, cfg.AgentUpdate)
+	if err != nil {
+		slog.Error("failed to configure agent updates", "error", err)
+		os.Exit(1)
+	}
+	var archiver *archive.Archiver
+	if cfg.Archive.Enabled() {
+		store, err := archive.NewStore(cfg.Archive)
+		if err != nil {
+			slog.Error("failed to configure archiving", "error", err)
+			os.Exit(1)
+		}
+		archiver = archive.New(store)
+		slog.Info("purged history is archived", "location", archiver.String())
+	}
+	cleanupSvc := service.NewCleanupService(stores.Cleanup, stores.AuditLogs, stores.Retention, archiver, cfg.RetentionDays, cfg.InactiveDays)
+	presenceSvc := service.NewPresenceService(stores.Devices)
+
+	// ── Jobs ─────────────────────────────────────────────────────────
+	jobs := scheduler.New(stores.Jobs)
+	if err := jobs.Register(scheduler.Job{Name: "cleanup", Schedule: cfg.CleanupSchedule, Timeout: cfg.CleanupTimeout, Run: cleanupSvc.RunJob}); err != nil {
+		slog.Error("failed to register job", "error", err)
+		os.Exit(1)
+	}
 
 	// ── Handlers ─────────────────────────────────────────────────────
 	healthHandler := handler.NewHealthHandler(db)
-	authHandler := handler.NewAuthHandler(authSvc, cfg.EnrollmentKey, auditLogger)
+	authHandler := handler.NewAuthHandler(authSvc, sessionSvc, cfg.EnrollmentKey, auditLogger)
 	inventoryHandler := handler.NewInventoryHandler(inventorySvc)
-	deviceHandler := handler.NewDeviceHandler(deviceSvc, auditLogger, activityRepo)
+	deviceHandler := handler.NewDeviceHandler(deviceSvc, auditLogger, stores.Activity)
 	dashboardHandler := handler.NewDashboardHandler(dashboardSvc)
 	departmentHandler := handler.NewDepartmentHandler(departmentSvc, auditLogger)
 	userHandler := handler.NewUserHandler(authSvc, auditLogger)
-	auditHandler := handler.NewAuditLogHandler(auditRepo)
+	mfaHandler := handler.NewMFAHandler(authSvc, auditLogger)
+	apiTokenHandler := handler.NewAPITokenHandler(apiTokenSvc, auditLogger)
+	roleHandler := handler.NewRoleHandler(roleSvc, auditLogger)
+	sessionHandler := handler.NewSessionHandler(sessionSvc, auditLogger)
+	auditHandler := handler.NewAuditLogHandler(stores.AuditLogs, auditWriter)
+	agentUpdateHandler := handler.NewAgentUpdateHandler(agentUpdateSvc, auditLogger)
+	eventHub := events.NewHub(db, cfg.DatabaseURL, cfg.Events.ReplaySize)
+	eventHandler := handler.NewEventHandler(eventHub)
+	organizationHandler := handler.NewOrganizationHandler(organizationSvc, auditLogger)
+	archiveHandler := handler.NewArchiveHandler(archiver)
+	retentionHandler := handler.NewRetentionHandler(cleanupSvc, auditLogger)
+	jobHandler := handler.NewJobHandler(jobs, auditLogger)
+
+	var oidcHandler *handler.OIDCHandler
+	if cfg.OIDC.Enabled() {
+		oidcSvc := service.NewOIDCService(cfg.OIDC, authSvc, cfg.JWTSecret, nil)
+		oidcHandler = handler.NewOIDCHandler(oidcSvc, cfg.OIDC, auditLogger)
+		slog.Info("oidc single sign-on enabled", "issuer", cfg.OIDC.IssuerURL)
+	}
+
+	var siemForwarder *siem.Forwarder
+	if cfg.SIEM.Enabled() {
+		siemForwarder, err = siem.NewForwarder(stores.SIEM, cfg.SIEM)
+		if err != nil {
+			slog.Error("failed to configure siem forwarding", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// ── Rate Limiting ────────────────────────────────────────────────
+	var limiter ratelimit.Limiter = ratelimit.NewMemory()
+	if cfg.RateLimit.Backend == "postgres" {
+		limiter = ratelimit.NewPostgres(db)
+	}
+	rateLimits := middleware.NewRateLimits(cfg.RateLimit)
+	slog.Info("rate limiter configured", "backend", cfg.RateLimit.Backend)
 
 	// ── Router ───────────────────────────────────────────────────
-	r := router.Setup(cfg, healthHandler, inventoryHandler, authHandler, deviceHandler, dashboardHandler, userHandler, departmentHandler, auditHandler, tokenRepo)
+	origins := middleware.NewOrigins(cfg.CORSOrigins)
+
+	r := router.Setup(cfg, healthHandler, inventoryHandler, authHandler, deviceHandler, dashboardHandler, userHandler, departmentHandler, auditHandler, oidcHandler, mfaHandler, apiTokenHandler, roleHandler, sessionHandler, agentUpdateHandler, eventHandler, organizationHandler, archiveHandler, retentionHandler, jobHandler, stores.Tokens, stores.APITokens, stores.Roles, stores.Users, stores.Sessions, limiter, rateLimits, origins, auditLogger)
+
+	// ── Configuration Reload ─────────────────────────────────────────
+	// SIGHUP or a change to CONFIG_FILE applies the settings below without a restart.
+	reloader := config.NewReloader(cfg)
+	reloader.OnReload(func(cfg *config.Config) {
+		logLevel.Set(cfg.LogLevel)
+		origins.Set(cfg.CORSOrigins)
+		rateLimits.Set(cfg.RateLimit)
+		cleanupSvc.Configure(cfg.RetentionDays, cfg.InactiveDays)
+		if err := jobs.Configure("cleanup", cfg.CleanupSchedule, cfg.CleanupTimeout); err != nil {
+			slog.Error("failed to reschedule job", "error", err)
+		}
+	})
 
 	// ── Background Services ─────────────────────────────────────────
-	cleanupSvc.Start()
+	auditWriter.Start()
+	jobs.Start()
+	presenceSvc.Start()
+	eventHub.Start()
+	if siemForwarder != nil {
+		siemForwarder.Start()
+	}
+	reloader.Start()
 
 	// ── HTTP Server ──────────────────────────────────────────────────
 	srv := &http.Server{
@@ -108,7 +206,14 @@ func runServer() {
 
 	slog.Info("shutting down server...")
 
-	cleanupSvc.Stop()
+	reloader.Stop()
+	jobs.Stop()
+	presenceSvc.Stop()
+	if siemForwarder != nil {
+		siemForwarder.Stop()
+	}
+	// Ending the event streams lets Shutdown below drain the connections.
+	eventHub.Stop()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -117,68 +222,19 @@ func runServer() {
 		slog.Error("server forced to shutdown", "error", err)
 	}
 
+	// Audit events from the requests drained above are flushed last; whatever the
+	// database does not take in time is kept in the fallback file for the next start.
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer flushCancel()
+	auditWriter.Stop(flushCtx)
+
 	slog.Info("server stopped")
 }
 
-func runCreateUser() {
-	var username, password, role string
-	for i := 2; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "--username":
-			if i+1 < len(os.Args) {
-				username = os.Args[i+1]
-				i++
-			}
-		case "--password":
-			if i+1 < len(os.Args) {
-				password = os.Args[i+1]
-				i++
-			}
-		case "--role":
-			if i+1 < len(os.Args) {
-				role = os.Args[i+1]
-				i++
-			}
-		}
-	}
-
-	if username == "" || password == "" {
-		fmt.Println("Usage: server create-user --username <user> --password <pass> [--role admin|viewer]")
-		os.Exit(1)
-	}
-
-	if len(password) < 8 {
-		fmt.Println("Error: password must be at least 8 characters")
-		os.Exit(1)
-	}
-
-	// Default to admin for CLI-created users
-	if role == "" {
-		role = "admin"
-	}
-
-	if role != "admin" && role != "viewer" {
-		fmt.Println("Error: role must be 'admin' or 'viewer'")
-		os.Exit(1)
-	}
-
-	cfg := config.Load()
-
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
-	slog.SetDefault(logger)
-
-	db := database.Connect(cfg.DatabaseURL)
-
-	userRepo := repository.NewUserRepository(db)
-	tokenRepo := repository.NewTokenRepository(db)
-	authSvc := service.NewAuthService(db, userRepo, tokenRepo, cfg.JWTSecret)
-
-	if err := authSvc.CreateUser(context.Background(), username, username, password, role); err != nil {
-		slog.Error("failed to create user", "error", err)
-		db.Close()
-		os.Exit(1)
+// migrationsFor returns the migrations of the backend databaseURL selects.
+func migrationsFor(databaseURL string) fs.FS {
+	if database.IsSQLite(databaseURL) {
+		return migrations.SQLite
 	}
-
-	db.Close()
-	fmt.Printf("User '%s' created successfully with role '%s'\n", username, role)
+	return migrations.FS
 }
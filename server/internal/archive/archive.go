@@ -0,0 +1,262 @@
+// Package archive keeps the history that the retention cleanup purges. Each cleanup
+// run that deletes rows writes an archive: one gzip-compressed NDJSON file per table
+// (audit_logs.ndjson.gz, ...) and a manifest.json with the row count, size and SHA-256
+// of each file, under the run's ID in a Store (a local directory or an S3-compatible
+// bucket). A table's file is stored before the deletion of its rows commits.
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestName is the name of the manifest within an archive.
+const manifestName = "manifest.json"
+
+// idPattern matches archive IDs: the UTC start time of the run and a random suffix.
+var idPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{6}$`)
+
+// ErrInvalidID is returned for an archive ID that idPattern does not match.
+var ErrInvalidID = errors.New("invalid archive ID")
+
+// Manifest describes an archive.
+type Manifest struct {
+	ID            string    `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	RetentionDays int       `json:"retention_days"` // the default retention of the cleanup run
+	Files         []File    `json:"files"`
+}
+
+// File is one table's file within an archive.
+type File struct {
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"` // of the compressed file
+}
+
+// Archiver writes archives to and reads them from a Store.
+type Archiver struct {
+	store Store
+}
+
+// New creates an Archiver on store.
+func New(store Store) *Archiver {
+	return &Archiver{store: store}
+}
+
+// String describes where the archives are.
+func (a *Archiver) String() string {
+	return a.store.String()
+}
+
+// Begin starts the archive of a cleanup run. The returned Run implements
+// repository.Archiver; nothing is stored until it archives a row.
+func (a *Archiver) Begin(retentionDays int) *Run {
+	suffix := make([]byte, 3)
+	rand.Read(suffix) //nolint:errcheck // never fails
+	now := time.Now().UTC()
+	return &Run{
+		store: a.store,
+		manifest: Manifest{
+			ID:            now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+			CreatedAt:     now,
+			RetentionDays: retentionDays,
+			Files:         []File{},
+		},
+	}
+}
+
+// Run is the archive of one cleanup run.
+type Run struct {
+	store Store
+
+	mu       sync.Mutex
+	manifest Manifest
+}
+
+// ID returns the ID of the archive.
+func (r *Run) ID() string {
+	return r.manifest.ID
+}
+
+// Archive writes the rows to a compressed NDJSON file and stores it together with the
+// updated manifest. A table without rows adds nothing. A table archived twice in one
+// run (which the cleanup does not do) gets a numbered second file.
+func (r *Run) Archive(ctx context.Context, table string, rows func(emit func(row any) error) error) error {
+	tmp, err := os.CreateTemp("", "archive-*.ndjson.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, sum)}
+	zw := gzip.NewWriter(counter)
+	enc := json.NewEncoder(zw)
+	var n int64
+	err = rows(func(row any) error {
+		n++
+		return enc.Encode(row)
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := table + ".ndjson.gz"
+	for i := 2; r.hasFile(name); i++ {
+		name = fmt.Sprintf("%s.%d.ndjson.gz", table, i)
+	}
+	if err := r.store.Put(ctx, r.manifest.ID+"/"+name, tmp); err != nil {
+		return fmt.Errorf("store %s: %w", name, err)
+	}
+	r.manifest.Files = append(r.manifest.Files, File{
+		Table:  table,
+		Name:   name,
+		Rows:   n,
+		Bytes:  counter.n,
+		SHA256: hex.EncodeToString(sum.Sum(nil)),
+	})
+	body, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := r.store.Put(ctx, r.manifest.ID+"/"+manifestName, strings.NewReader(string(body))); err != nil {
+		r.manifest.Files = r.manifest.Files[:len(r.manifest.Files)-1]
+		return fmt.Errorf("store manifest: %w", err)
+	}
+	return nil
+}
+
+// Empty reports whether nothing was archived yet.
+func (r *Run) Empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.manifest.Files) == 0
+}
+
+func (r *Run) hasFile(name string) bool {
+	for _, f := range r.manifest.Files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the manifests of all archives, newest first.
+func (a *Archiver) List(ctx context.Context) ([]Manifest, error) {
+	names, err := a.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list archives: %w", err)
+	}
+	manifests := []Manifest{}
+	for _, name := range names {
+		id, file, ok := strings.Cut(name, "/")
+		if !ok || file != manifestName || !idPattern.MatchString(id) {
+			continue
+		}
+		m, err := a.Manifest(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, *m)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].ID > manifests[j].ID })
+	return manifests, nil
+}
+
+// Manifest returns the manifest of the archive id; ErrNotFound if there is none.
+func (a *Archiver) Manifest(ctx context.Context, id string) (*Manifest, error) {
+	if !idPattern.MatchString(id) {
+		return nil, ErrInvalidID
+	}
+	rc, err := a.store.Get(ctx, id+"/"+manifestName)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var m Manifest
+	if err := json.NewDecoder(rc).Decode(&m); err != nil {
+		return nil, fmt.Errorf("read manifest of %s: %w", id, err)
+	}
+	return &m, nil
+}
+
+// Read downloads file of archive id, checks it against the manifest and calls fn with
+// a decoder of its rows, which returns io.EOF after the last row.
+func (a *Archiver) Read(ctx context.Context, id string, file File, fn func(decode func(dest any) error) error) error {
+	if !idPattern.MatchString(id) {
+		return ErrInvalidID
+	}
+	rc, err := a.store.Get(ctx, id+"/"+file.Name)
+	if err != nil {
+		return fmt.Errorf("get %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "archive-*.ndjson.gz")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, sum), rc)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", file.Name, err)
+	}
+	if size != file.Bytes || hex.EncodeToString(sum.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%s does not match the checksum in the manifest", file.Name)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	zr, err := gzip.NewReader(tmp)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.Name, err)
+	}
+	defer zr.Close()
+	return fn(json.NewDecoder(zr).Decode)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"inventario/server/internal/config"
+)
+
+// ErrNotFound is returned by Store.Get for a name that was never stored.
+var ErrNotFound = errors.New("archive object not found")
+
+// Store keeps archive files under slash-separated names.
+type Store interface {
+	// Put stores body under name, replacing what was there.
+	Put(ctx context.Context, name string, body io.ReadSeeker) error
+	// Get opens what is stored under name.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// List returns the names of everything stored.
+	List(ctx context.Context) ([]string, error)
+	// String describes where the archives are, for logs.
+	String() string
+}
+
+// NewStore creates the Store cfg selects.
+func NewStore(cfg config.ArchiveConfig) (Store, error) {
+	if cfg.S3Bucket != "" {
+		return newS3Store(cfg)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0750); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+	return dirStore(cfg.Dir), nil
+}
+
+// dirStore keeps archive files in a local directory.
+type dirStore string
+
+func (d dirStore) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Put writes body to a temporary file next to name and renames it into place, so
+// that a partial file is never seen under name.
+func (d dirStore) Put(_ context.Context, name string, body io.ReadSeeker) error {
+	path := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (d dirStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	f, err := os.Open(d.path(name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (d dirStore) List(_ context.Context) ([]string, error) {
+	var names []string
+	err := fs.WalkDir(os.DirFS(string(d)), ".", func(name string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if e.Type().IsRegular() && filepath.Base(name)[0] != '.' {
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
+
+func (d dirStore) String() string {
+	return string(d)
+}
@@ -0,0 +1,87 @@
+// Package auditchain computes the keyed hashes that chain audit log entries together
+// and sign purge checkpoints, so that edited, reordered or deleted entries in
+// audit_logs can be detected. Without the key the chain cannot be recomputed.
+package auditchain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/shared/models"
+)
+
+// Versions of EntryHash. Entries keep the version they were written with; the chain
+// records where each version starts.
+const (
+	HashV1 = 1 // entries written before the hash covered the organization
+	HashV2 = 2 // also covers OrganizationID
+)
+
+// EntryHash returns the hash of an audit entry, covering its content and PrevHash.
+// Details must be the JSON text as returned by PostgreSQL, which normalizes JSONB.
+func EntryHash(key []byte, e *models.AuditLog, version int) string {
+	fields := []string{
+		strconv.FormatInt(e.Seq, 10),
+		e.ID.String(),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		uuidString(e.UserID),
+		e.Username,
+		e.Action,
+		e.ResourceType,
+		uuidString(e.ResourceID),
+		e.Details,
+		e.IPAddress,
+		e.UserAgent,
+		stringValue(e.PrevHash),
+	}
+	if version >= HashV2 {
+		fields = append(fields, uuidString(e.OrganizationID))
+	}
+	return sum(key, fields)
+}
+
+// CheckpointSignature returns the signature of a purge checkpoint.
+func CheckpointSignature(key []byte, cp *models.AuditCheckpoint) string {
+	return sum(key, []string{
+		"checkpoint",
+		cp.ID.String(),
+		cp.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(cp.LastSeq, 10),
+		cp.LastHash,
+		strconv.FormatInt(cp.Purged, 10),
+		cp.Reason,
+	})
+}
+
+// Equal compares two hashes in constant time.
+func Equal(a, b string) bool {
+	return hmac.Equal([]byte(a), []byte(b))
+}
+
+// sum is HMAC-SHA256 over the JSON encoding of fields, which keeps field boundaries unambiguous.
+func sum(key []byte, fields []string) string {
+	b, _ := json.Marshal(fields)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func uuidString(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,388 @@
+// Package auditlog writes audit events to the database off the request path. Events
+// are queued in a bounded in-memory buffer and inserted in batches with retries; events
+// the database does not accept (or that do not fit in the buffer) are appended to a
+// local NDJSON fallback file and replayed once the database is reachable again. Events
+// the database refuses outright are set aside in <file>.rejected instead.
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+const (
+	writeAttempts = 4                // per batch before spilling it to the fallback file
+	writeTimeout  = 10 * time.Second // per attempt
+	firstBackoff  = 200 * time.Millisecond
+)
+
+// Stats counts what happened to audit events since the writer started.
+type Stats struct {
+	Queued   int   // events waiting in memory
+	Written  int64 // events stored in the database, including replayed ones
+	Retries  int64 // failed batch writes that were retried
+	Spilled  int64 // events appended to the fallback file
+	Replayed int64 // events moved from the fallback file to the database
+	Dropped  int64 // events lost: neither the database nor the fallback file took them
+	Rejected int64 // replayed events the database refused, moved to the .rejected file
+	Pending  bool  // the fallback file holds events not yet replayed
+}
+
+// Writer is the buffered audit pipeline. Call Start once and Stop during shutdown.
+type Writer struct {
+	repo     repository.AuditLogStore
+	batch    int
+	interval time.Duration
+	file     string
+
+	queue  chan *models.AuditLog
+	mu     sync.RWMutex // guards closed so Enqueue never sends on a closed queue
+	closed bool
+	fileMu sync.Mutex // serializes appends to the fallback file and its rotation for replay
+
+	ctx    context.Context // cancelled when Stop gives up waiting, aborting database writes
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	written, retries, spilled, replayed, dropped, rejected atomic.Int64
+	pending                                                atomic.Bool
+}
+
+// NewWriter creates a Writer with the buffer, batch and fallback settings in cfg.
+func NewWriter(repo repository.AuditLogStore, cfg config.AuditConfig) *Writer {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Writer{
+		repo:     repo,
+		batch:    cfg.BatchSize,
+		interval: cfg.FlushInterval,
+		file:     cfg.FallbackFile,
+		queue:    make(chan *models.AuditLog, cfg.BufferSize),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	w.pending.Store(true) // a previous run may have left events behind
+	return w
+}
+
+// Enqueue hands an event to the pipeline without blocking on the database. When the
+// buffer is full or the writer has stopped, the event goes straight to the fallback file.
+func (w *Writer) Enqueue(entry *models.AuditLog) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if !w.closed {
+		select {
+		case w.queue <- entry:
+			return
+		default:
+		}
+	}
+	w.spill([]*models.AuditLog{entry})
+}
+
+// Start replays the fallback file and begins writing queued events in the background.
+func (w *Writer) Start() {
+	go w.run()
+	slog.Info("audit writer started",
+		"buffer_size", cap(w.queue),
+		"batch_size", w.batch,
+		"flush_interval", w.interval.String(),
+		"fallback_file", w.file,
+	)
+}
+
+// Stop stops accepting events and flushes the queue. If ctx ends first, writes in
+// progress are abandoned and the remaining events go to the fallback file.
+func (w *Writer) Stop(ctx context.Context) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+	}
+	w.cancel()
+
+	st := w.Stats()
+	slog.Info("audit writer stopped",
+		"written", st.Written, "spilled", st.Spilled, "replayed", st.Replayed, "dropped", st.Dropped, "rejected", st.Rejected)
+}
+
+// Stats returns the pipeline counters.
+func (w *Writer) Stats() Stats {
+	return Stats{
+		Queued:   len(w.queue),
+		Written:  w.written.Load(),
+		Retries:  w.retries.Load(),
+		Spilled:  w.spilled.Load(),
+		Replayed: w.replayed.Load(),
+		Dropped:  w.dropped.Load(),
+		Rejected: w.rejected.Load(),
+		Pending:  w.pending.Load(),
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.done)
+
+	w.replay()
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AuditLog, 0, w.batch)
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.batch {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+			if w.pending.Load() {
+				w.replay()
+			}
+		}
+	}
+}
+
+// flush writes batch to the database, spilling it to the fallback file if that fails.
+func (w *Writer) flush(batch []*models.AuditLog) {
+	if len(batch) == 0 {
+		return
+	}
+	if _, err := w.write(batch); err != nil {
+		slog.Error("audit writer: database write failed, using fallback file", "error", err, "events", len(batch))
+		w.spill(batch)
+	}
+}
+
+// write inserts batch with exponential backoff between attempts. It returns the number
+// of events stored; events already in the database are skipped. Errors for which
+// repository.IsRejected holds are returned without retrying.
+func (w *Writer) write(batch []*models.AuditLog) (int, error) {
+	backoff := firstBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(w.ctx, writeTimeout)
+		n, err := w.repo.CreateBatch(ctx, batch)
+		cancel()
+		if err == nil {
+			w.written.Add(int64(n))
+			return n, nil
+		}
+		if attempt == writeAttempts || w.ctx.Err() != nil || repository.IsRejected(err) {
+			return 0, err
+		}
+
+		w.retries.Add(1)
+		slog.Warn("audit writer: retrying batch", "error", err, "attempt", attempt, "events", len(batch))
+		select {
+		case <-time.After(backoff):
+		case <-w.ctx.Done():
+			return 0, err
+		}
+		backoff *= 2
+	}
+}
+
+// spill appends entries to the fallback file, one JSON object per line.
+func (w *Writer) spill(entries []*models.AuditLog) {
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+
+	if err := appendEntries(w.file, entries); err != nil {
+		w.dropped.Add(int64(len(entries)))
+		slog.Error("audit writer: events dropped", "error", err, "events", len(entries), "dropped_total", w.dropped.Load())
+		return
+	}
+	w.spilled.Add(int64(len(entries)))
+	w.pending.Store(true)
+}
+
+func appendEntries(path string, entries []*models.AuditLog) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("open fallback file: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return fmt.Errorf("write fallback file: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync fallback file: %w", err)
+	}
+	return f.Close()
+}
+
+// replay moves the events in the fallback file to the database. The file is first
+// renamed to <file>.replay so that events spilled meanwhile start a new file; a
+// .replay file left by an interrupted replay is finished before the next rename.
+func (w *Writer) replay() {
+	path := w.file + ".replay"
+
+	w.fileMu.Lock()
+	w.pending.Store(false)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.Rename(w.file, path); err != nil {
+			w.fileMu.Unlock()
+			if !errors.Is(err, fs.ErrNotExist) {
+				slog.Error("audit writer: cannot rotate fallback file", "error", err)
+				w.pending.Store(true)
+			}
+			return
+		}
+	}
+	w.fileMu.Unlock()
+
+	entries, err := w.readEntries(path)
+	if err != nil {
+		slog.Error("audit writer: cannot read fallback file", "error", err, "path", path)
+		w.pending.Store(true)
+		return
+	}
+
+	replayed, rejected := 0, 0
+	for start := 0; start < len(entries); start += w.batch {
+		chunk := entries[start:min(start+w.batch, len(entries))]
+		n, err := w.write(chunk)
+		done := 0
+		if err == nil {
+			done = len(chunk)
+		} else if repository.IsRejected(err) {
+			// The database refuses some entry of the chunk: write the entries one at a
+			// time so that it does not hold back the others.
+			var r int
+			n, r, done, err = w.replayEach(chunk)
+			rejected += r
+		}
+		replayed += n
+		if err != nil {
+			// Entries written so far are skipped next time by their ID; rejected ones
+			// must not be read again, so the file is cut down to what is left.
+			slog.Warn("audit writer: replay postponed", "error", err, "remaining", len(entries)-start-done)
+			w.replayed.Add(int64(replayed))
+			w.pending.Store(true)
+			if rejected > 0 {
+				if err := rewriteEntries(path, entries[start+done:]); err != nil {
+					slog.Error("audit writer: cannot rewrite fallback file", "error", err, "path", path)
+				}
+			}
+			return
+		}
+	}
+	w.replayed.Add(int64(replayed))
+
+	if err := os.Remove(path); err != nil {
+		slog.Error("audit writer: cannot remove replayed fallback file", "error", err, "path", path)
+		w.pending.Store(true)
+		return
+	}
+	if replayed > 0 || rejected > 0 {
+		slog.Info("audit writer: replayed fallback file", "events", replayed, "rejected", rejected)
+	}
+	if _, err := os.Stat(w.file); err == nil {
+		w.pending.Store(true) // a leftover .replay was finished; the current file is next
+	}
+}
+
+// replayEach writes entries one at a time, moving those the database refuses to the
+// .rejected file. It returns how many were written and rejected and how many were
+// handled before a write failed for another reason, with that error.
+func (w *Writer) replayEach(entries []*models.AuditLog) (written, rejected, done int, err error) {
+	path := w.file + ".rejected"
+	for _, entry := range entries {
+		n, err := w.write([]*models.AuditLog{entry})
+		if repository.IsRejected(err) {
+			if ferr := appendEntries(path, []*models.AuditLog{entry}); ferr != nil {
+				return written, rejected, done, fmt.Errorf("set aside rejected entry: %w", ferr)
+			}
+			rejected++
+			w.rejected.Add(1)
+			slog.Error("audit writer: database rejected a fallback entry, moved it aside",
+				"error", err, "id", entry.ID, "action", entry.Action, "path", path)
+		} else if err != nil {
+			return written, rejected, done, err
+		}
+		written += n
+		done++
+	}
+	return written, rejected, done, nil
+}
+
+// rewriteEntries replaces the fallback file at path with entries.
+func rewriteEntries(path string, entries []*models.AuditLog) error {
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := appendEntries(tmp, entries); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readEntries decodes an NDJSON fallback file. Lines that cannot be decoded (a write
+// cut short by a crash) are skipped and counted as dropped.
+func (w *Writer) readEntries(path string) ([]*models.AuditLog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*models.AuditLog
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var entry models.AuditLog
+			if jerr := json.Unmarshal(line, &entry); jerr != nil {
+				w.dropped.Add(1)
+				slog.Error("audit writer: skipping unreadable fallback entry", "error", jerr)
+			} else {
+				entries = append(entries, &entry)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
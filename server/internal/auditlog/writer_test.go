@@ -0,0 +1,96 @@
+package auditlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/database"
+	"inventario/server/internal/repository"
+	"inventario/server/migrations"
+	"inventario/shared/models"
+)
+
+// newTestWriter returns a Writer over a new SQLite database, with batches of 2 and
+// a fallback file holding entries, and the stores it writes to.
+func newTestWriter(t *testing.T, entries []*models.AuditLog) (*Writer, *repository.Stores, func()) {
+	t.Helper()
+	dir := t.TempDir()
+	url := "sqlite://" + filepath.Join(dir, "inventario.db")
+	database.RunMigrations(url, migrations.SQLite)
+	db, err := database.Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	stores := repository.NewStores(db, "test-chain-key")
+	w := NewWriter(stores.AuditLogs, config.AuditConfig{
+		BufferSize:    10,
+		BatchSize:     2,
+		FlushInterval: time.Second,
+		FallbackFile:  filepath.Join(dir, "audit-fallback.ndjson"),
+	})
+	if err := appendEntries(w.file, entries); err != nil {
+		t.Fatal(err)
+	}
+	return w, stores, func() { db.Close() }
+}
+
+func testEntries(actions ...string) []*models.AuditLog {
+	entries := make([]*models.AuditLog, len(actions))
+	for i, action := range actions {
+		entries[i] = &models.AuditLog{ID: uuid.New(), Username: "ana", Action: action, ResourceType: "user",
+			Details: `{"n": 1}`, CreatedAt: time.Date(2026, 3, 2, 14, 5, i, 0, time.UTC)}
+	}
+	return entries
+}
+
+func TestReplayRejected(t *testing.T) {
+	entries := testEntries("user.create", "user.update", "user.delete", "user.unlock", "user.create")
+	entries[1].Details = "not json" // refused by the database on every attempt
+	w, stores, _ := newTestWriter(t, entries)
+
+	w.replay()
+
+	st := w.Stats()
+	if st.Replayed != 4 || st.Rejected != 1 || st.Pending {
+		t.Errorf("stats = %+v; want 4 replayed, 1 rejected, nothing pending", st)
+	}
+	if _, total, err := stores.AuditLogs.List(context.Background(), map[string]interface{}{}, 10, 0); err != nil || total != 4 {
+		t.Errorf("stored %d entries, %v; want 4", total, err)
+	}
+	rejected, err := w.readEntries(w.file + ".rejected")
+	if err != nil || len(rejected) != 1 || rejected[0].ID != entries[1].ID {
+		t.Errorf("rejected file = %v, %v; want entry %s", rejected, err, entries[1].ID)
+	}
+	if _, err := os.Stat(w.file + ".replay"); !os.IsNotExist(err) {
+		t.Errorf("replay file left behind: %v", err)
+	}
+}
+
+func TestReplayUnavailable(t *testing.T) {
+	entries := testEntries("user.create", "user.update", "user.delete")
+	entries[0].Details = "not json"
+	w, _, closeDB := newTestWriter(t, entries)
+	closeDB()
+
+	w.replay()
+
+	st := w.Stats()
+	if st.Replayed != 0 || st.Rejected != 0 || !st.Pending {
+		t.Errorf("stats = %+v; want nothing replayed or rejected and the replay pending", st)
+	}
+	left, err := w.readEntries(w.file + ".replay")
+	if err != nil || len(left) != 3 {
+		t.Errorf("replay file holds %d entries, %v; want 3", len(left), err)
+	}
+	if _, err := os.Stat(w.file + ".rejected"); !os.IsNotExist(err) {
+		t.Errorf("entries rejected while the database was unavailable: %v", err)
+	}
+}
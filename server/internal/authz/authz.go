@@ -0,0 +1,162 @@
+// Package authz defines the permission model: roles bundle permissions, and a
+// role bound to a user either globally or for a set of departments yields the
+// user's Grants. Grants are confined to the organization (tenant) the user is
+// working in. Scopes are passed explicitly to services and repositories.
+package authz
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Permission is a single action a user may perform.
+type Permission string
+
+// Known permissions.
+const (
+	DeviceRead      Permission = "device.read"      // list, view and export devices
+	DeviceWrite     Permission = "device.write"     // change device status and department
+	DeviceDelete    Permission = "device.delete"    // delete devices
+	DepartmentWrite Permission = "department.write" // create, rename and delete departments
+	UserManage      Permission = "user.manage"      // manage users, role bindings and API tokens; custom roles need a super-admin
+	AuditRead       Permission = "audit.read"       // read audit logs
+	AgentManage     Permission = "agent.manage"     // manage enrollment keys; releases and rollouts need a super-admin
+)
+
+// AllPermissions lists every known permission.
+var AllPermissions = []Permission{DeviceRead, DeviceWrite, DeviceDelete, DepartmentWrite, UserManage, AuditRead, AgentManage}
+
+// Scopable reports whether the permission can be limited to departments.
+// Other permissions only take effect from global bindings.
+func (p Permission) Scopable() bool {
+	switch p {
+	case DeviceRead, DeviceWrite, DeviceDelete:
+		return true
+	}
+	return false
+}
+
+// ParsePermissions parses a space-separated permission list, rejecting unknown names.
+func ParsePermissions(s string) ([]Permission, error) {
+	var out []Permission
+	for _, name := range strings.Fields(s) {
+		p := Permission(name)
+		if !slices.Contains(AllPermissions, p) {
+			return nil, fmt.Errorf("unknown permission %q", name)
+		}
+		if !slices.Contains(out, p) {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// FormatPermissions joins permissions into the space-separated storage format.
+func FormatPermissions(perms []Permission) string {
+	names := make([]string, len(perms))
+	for i, p := range perms {
+		names[i] = string(p)
+	}
+	return strings.Join(names, " ")
+}
+
+// Scope is the set of departments a permission applies to, within one organization.
+// The zero value grants nothing.
+type Scope struct {
+	All            bool        // every device, including those without a department
+	DepartmentIDs  []uuid.UUID // departments covered when All is false
+	OrganizationID uuid.UUID   // tenant the scope is confined to; uuid.Nil only in Global
+}
+
+// Global is the unrestricted scope of background jobs and agent requests. It spans
+// every organization and is never derived from a user's grants.
+var Global = Scope{All: true}
+
+// Empty reports whether the scope covers nothing.
+func (s Scope) Empty() bool {
+	return !s.All && len(s.DepartmentIDs) == 0
+}
+
+// InOrganization reports whether the scope reaches into the organization.
+func (s Scope) InOrganization(id uuid.UUID) bool {
+	return s.OrganizationID == uuid.Nil || s.OrganizationID == id
+}
+
+// Allows reports whether a device in the given department (nil = unassigned) of the
+// scope's organization is covered.
+func (s Scope) Allows(departmentID *uuid.UUID) bool {
+	if s.All {
+		return true
+	}
+	if departmentID == nil {
+		return false
+	}
+	return slices.Contains(s.DepartmentIDs, *departmentID)
+}
+
+// Binding is one role granted to a user, globally or for a single department.
+type Binding struct {
+	Permissions  string     // space-separated, as stored on the role
+	DepartmentID *uuid.UUID // nil = global
+}
+
+// Grants maps each permission a user holds to the scope it applies to.
+type Grants map[Permission]Scope
+
+// NewGrants merges role bindings into the user's effective grants.
+// Unknown permission names are ignored so a stale role never breaks login.
+func NewGrants(bindings []Binding) Grants {
+	g := Grants{}
+	for _, b := range bindings {
+		for _, name := range strings.Fields(b.Permissions) {
+			p := Permission(name)
+			if !slices.Contains(AllPermissions, p) {
+				continue
+			}
+			scope := g[p]
+			switch {
+			case b.DepartmentID == nil:
+				scope = Global
+			case scope.All || !p.Scopable():
+				continue
+			case !slices.Contains(scope.DepartmentIDs, *b.DepartmentID):
+				scope.DepartmentIDs = append(scope.DepartmentIDs, *b.DepartmentID)
+			}
+			g[p] = scope
+		}
+	}
+	return g
+}
+
+// SuperAdmin returns the grants of a super-admin: every permission, for every
+// department of the organization they work in.
+func SuperAdmin() Grants {
+	g := Grants{}
+	for _, p := range AllPermissions {
+		g[p] = Global
+	}
+	return g
+}
+
+// In confines the grants to an organization.
+func (g Grants) In(organizationID uuid.UUID) Grants {
+	out := make(Grants, len(g))
+	for p, scope := range g {
+		scope.OrganizationID = organizationID
+		out[p] = scope
+	}
+	return out
+}
+
+// Has reports whether the permission is held for at least one department.
+func (g Grants) Has(p Permission) bool {
+	return !g[p].Empty()
+}
+
+// Scope returns the scope of a permission; the zero Scope if it is not held.
+func (g Grants) Scope(p Permission) Scope {
+	return g[p]
+}
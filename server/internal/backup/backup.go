@@ -0,0 +1,250 @@
+// Package backup writes all of the inventory's data to a portable archive and loads it
+// back into an empty database: the server backup and server restore commands.
+//
+// An archive is a zip file holding manifest.json and one tables/<name>.ndjson file per
+// table, one JSON array of column values per row, in the order of the manifest's
+// columns. All tables are read from one snapshot of the database.
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/database"
+)
+
+const (
+	// Format identifies backup archives in their manifest.
+	Format = "inventario-backup"
+	// FormatVersion is the version of the archive layout this package writes and reads.
+	FormatVersion = 1
+
+	manifestName = "manifest.json"
+	tablesDir    = "tables/"
+)
+
+// Tables are the tables a backup holds, each after the tables it references.
+var Tables = []string{
+	"organizations", "roles", "users", "departments", "enrollment_keys",
+	"user_role_bindings", "user_sessions", "user_recovery_codes", "password_history", "api_tokens",
+	"devices", "device_tokens", "hardware", "disks", "network_interfaces", "installed_software",
+	"remote_tools", "hardware_history", "device_activity_log", "device_metrics",
+	"agent_releases", "agent_release_chunks", "agent_rollouts", "agent_update_reports",
+	"audit_logs", "audit_checkpoints", "siem_cursors", "retention_policies", "job_runs",
+}
+
+// skipped are the tables a backup leaves out: the migration state, which the restore
+// recreates, and the event outbox, whose events are only of use to running servers.
+var skipped = []string{"schema_migrations", "event_outbox"}
+
+// Manifest describes a backup archive.
+type Manifest struct {
+	Format           string    `json:"format"`
+	FormatVersion    int       `json:"format_version"`
+	CreatedAt        time.Time `json:"created_at"`
+	Driver           string    `json:"driver"`
+	MigrationVersion uint      `json:"migration_version"`
+	Tables           []Table   `json:"tables"`
+}
+
+// Table describes the file of a table in a backup archive.
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+}
+
+// queryer reads the snapshot of the database a backup is written from.
+type queryer interface {
+	QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error)
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// Write writes a backup of db, whose migration version is version, to w and returns its
+// manifest.
+func Write(ctx context.Context, db *sqlx.DB, version uint, w io.Writer) (*Manifest, error) {
+	snap, done, err := snapshot(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	names, err := tableNames(ctx, snap, db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.Contains(Tables, name) && !slices.Contains(skipped, name) {
+			return nil, fmt.Errorf("table %s is not covered by backups", name)
+		}
+	}
+
+	manifest := &Manifest{
+		Format:           Format,
+		FormatVersion:    FormatVersion,
+		CreatedAt:        time.Now().UTC(),
+		Driver:           db.DriverName(),
+		MigrationVersion: version,
+		Tables:           []Table{},
+	}
+	zw := zip.NewWriter(w)
+	for _, name := range Tables {
+		if !slices.Contains(names, name) {
+			continue
+		}
+		table, err := writeTable(ctx, snap, zw, name, manifest.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("back up %s: %w", name, err)
+		}
+		manifest.Tables = append(manifest.Tables, *table)
+	}
+
+	f, err := create(zw, manifestName, manifest.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("write manifest: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// snapshot starts a read-only transaction on db, so that all tables are read as of the
+// same moment, and returns it with the function that ends it.
+func snapshot(ctx context.Context, db *sqlx.DB) (queryer, func(), error) {
+	if db.DriverName() != database.DriverSQLite {
+		tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+		if err != nil {
+			return nil, nil, fmt.Errorf("begin transaction: %w", err)
+		}
+		return tx, func() { tx.Rollback() }, nil //nolint:errcheck
+	}
+
+	// SQLite connections begin their transactions IMMEDIATE, taking the write lock;
+	// a DEFERRED one reads a snapshot without holding up the server's writes.
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get connection: %w", err)
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN DEFERRED"); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	return conn, func() {
+		conn.ExecContext(context.Background(), "ROLLBACK") //nolint:errcheck
+		conn.Close()
+	}, nil
+}
+
+// tableNames returns the names of the tables of the database.
+func tableNames(ctx context.Context, q queryer, driverName string) ([]string, error) {
+	query := "SELECT tablename FROM pg_tables WHERE schemaname = current_schema()"
+	if driverName == database.DriverSQLite {
+		query = "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'"
+	}
+	var names []string
+	if err := q.SelectContext(ctx, &names, query); err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	return names, nil
+}
+
+// create adds the file name, modified at modified, to zw.
+func create(zw *zip.Writer, name string, modified time.Time) (io.Writer, error) {
+	return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+}
+
+// writeTable writes the rows of the table name to its file in zw.
+func writeTable(ctx context.Context, q queryer, zw *zip.Writer, name string, modified time.Time) (*Table, error) {
+	rows, err := q.QueryxContext(ctx, "SELECT * FROM "+name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	table := &Table{Name: name, Columns: make([]string, len(types))}
+	for i, t := range types {
+		table.Columns[i] = t.Name()
+	}
+
+	f, err := create(zw, tablesDir+name+".ndjson", modified)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			values[i] = encodeValue(types[i].DatabaseTypeName(), v)
+		}
+		if err := enc.Encode(values); err != nil {
+			return nil, err
+		}
+		table.Rows++
+	}
+	return table, rows.Err()
+}
+
+// encodeValue returns the value to encode in JSON for v, a value of a column of the
+// database type typeName. JSON columns are kept as JSON; other binary values are
+// encoded in base64, and times in RFC 3339 in UTC.
+func encodeValue(typeName string, v any) any {
+	switch v := v.(type) {
+	case []byte:
+		if isJSON(typeName) && json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		return v
+	case string:
+		if isJSON(typeName) && json.Valid([]byte(v)) {
+			return json.RawMessage(v)
+		}
+		return v
+	case [16]byte:
+		return uuid.UUID(v).String()
+	case time.Time:
+		return v.UTC()
+	default:
+		return v
+	}
+}
+
+// isJSON reports whether typeName is a JSON column type.
+func isJSON(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return typeName == "JSON" || typeName == "JSONB"
+}
+
+// isBinary reports whether typeName is a binary column type.
+func isBinary(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return typeName == "BYTEA" || typeName == "BLOB"
+}
+
+// isTime reports whether typeName is a date or time column type.
+func isTime(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return strings.HasPrefix(typeName, "TIMESTAMP") || typeName == "DATETIME" || typeName == "DATE"
+}
@@ -0,0 +1,324 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/database"
+	"inventario/server/internal/repository"
+)
+
+// sequences are the columns filled from a PostgreSQL sequence, by table. A restore
+// moves each sequence past the restored values.
+var sequences = map[string]string{"device_activity_log": "seq"}
+
+// Reader reads a backup archive.
+type Reader struct {
+	Manifest Manifest
+	zip      *zip.ReadCloser
+}
+
+// Open opens the backup archive at path and reads its manifest.
+func Open(path string) (*Reader, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{zip: zr}
+	if err := r.readJSON(manifestName, &r.Manifest); err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	if r.Manifest.Format != Format {
+		zr.Close()
+		return nil, errors.New("not a backup archive")
+	}
+	if r.Manifest.FormatVersion != FormatVersion {
+		zr.Close()
+		return nil, fmt.Errorf("unsupported backup format version %d", r.Manifest.FormatVersion)
+	}
+	return r, nil
+}
+
+// Close closes the archive.
+func (r *Reader) Close() error {
+	return r.zip.Close()
+}
+
+// readJSON decodes the file name of the archive into v.
+func (r *Reader) readJSON(name string, v any) error {
+	f, err := r.zip.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewDecoder(f).Decode(v)
+}
+
+// IsEmpty reports whether db holds no users, devices or audit logs: whether a backup
+// may be restored into it.
+func IsEmpty(ctx context.Context, db *sqlx.DB) (bool, error) {
+	var count int
+	err := db.GetContext(ctx, &count,
+		"SELECT (SELECT COUNT(*) FROM users) + (SELECT COUNT(*) FROM devices) + (SELECT COUNT(*) FROM audit_logs)")
+	if err != nil {
+		return false, fmt.Errorf("count rows: %w", err)
+	}
+	return count == 0, nil
+}
+
+// Restore loads the backup into db, which must be empty, of the backend the backup was
+// taken from, and migrated to the backup's migration version. The rows db was seeded
+// with by its migrations are replaced. With remapIDs, every row gets a new ID, except
+// the default organization, and every reference to it follows; the audit hash chain,
+// which covers IDs, is then verified with the old IDs and sealed again with chainKey,
+// which must be the key it was written with. Restore returns the number of rows
+// restored by table.
+func (r *Reader) Restore(ctx context.Context, db *sqlx.DB, remapIDs bool, chainKey string) ([]Table, error) {
+	if r.Manifest.Driver != db.DriverName() {
+		return nil, fmt.Errorf("backup of a %s database cannot be restored into a %s one", r.Manifest.Driver, db.DriverName())
+	}
+	version, err := database.MigrationVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if version != r.Manifest.MigrationVersion {
+		return nil, fmt.Errorf("database is at migration %d, backup at %d", version, r.Manifest.MigrationVersion)
+	}
+	empty, err := IsEmpty(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return nil, errors.New("database is not empty")
+	}
+
+	var ids map[string]string
+	if remapIDs {
+		if ids, err = r.newIDs(); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for i := len(r.Manifest.Tables) - 1; i >= 0; i-- {
+		name := r.Manifest.Tables[i].Name
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+name); err != nil {
+			return nil, fmt.Errorf("clear %s: %w", name, err)
+		}
+	}
+
+	restored := make([]Table, 0, len(r.Manifest.Tables))
+	for _, table := range r.Manifest.Tables {
+		rows, err := r.restoreTable(ctx, tx, table, ids)
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", table.Name, err)
+		}
+		if rows != table.Rows {
+			return nil, fmt.Errorf("restore %s: %d rows read, manifest lists %d", table.Name, rows, table.Rows)
+		}
+		restored = append(restored, Table{Name: table.Name, Columns: table.Columns, Rows: rows})
+
+		if column, ok := sequences[table.Name]; ok && db.DriverName() != database.DriverSQLite {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(
+				"SELECT setval(pg_get_serial_sequence('%[1]s', '%[2]s'), COALESCE(MAX(%[2]s), 0) + 1, false) FROM %[1]s",
+				table.Name, column))
+			if err != nil {
+				return nil, fmt.Errorf("reset sequence of %s: %w", table.Name, err)
+			}
+		}
+	}
+
+	if ids != nil {
+		originals := make(map[uuid.UUID]uuid.UUID, len(ids))
+		for old, id := range ids {
+			originals[uuid.MustParse(id)] = uuid.MustParse(old)
+		}
+		originalID := func(id uuid.UUID) uuid.UUID {
+			if old, ok := originals[id]; ok {
+				return old
+			}
+			return id
+		}
+		if err := repository.ResealAuditChain(ctx, tx, chainKey, originalID); err != nil {
+			return nil, fmt.Errorf("%w; restore without --remap-ids to keep the chain as it is, or check AUDIT_CHAIN_KEY", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return restored, nil
+}
+
+// restoreTable inserts the rows of table and returns how many it inserted.
+func (r *Reader) restoreTable(ctx context.Context, tx *sqlx.Tx, table Table, ids map[string]string) (int64, error) {
+	types, err := columnTypes(ctx, tx, table.Name)
+	if err != nil {
+		return 0, err
+	}
+	placeholders := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		if _, ok := types[column]; !ok {
+			return 0, fmt.Errorf("column %s does not exist", column)
+		}
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	stmt, err := tx.PreparexContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		table.Name, strings.Join(table.Columns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var count int64
+	err = r.readRows(table, func(row []json.RawMessage) error {
+		args := make([]any, len(row))
+		for i, raw := range row {
+			v, err := decodeValue(types[table.Columns[i]], raw, ids)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", table.Columns[i], err)
+			}
+			args[i] = v
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// readRows calls fn with each row of the file of table.
+func (r *Reader) readRows(table Table, fn func(row []json.RawMessage) error) error {
+	f, err := r.zip.Open(tablesDir + table.Name + ".ndjson")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for n := 1; ; n++ {
+		var row []json.RawMessage
+		if err := dec.Decode(&row); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+		if len(row) != len(table.Columns) {
+			return fmt.Errorf("row %d: %d values for %d columns", n, len(row), len(table.Columns))
+		}
+		if err := fn(row); err != nil {
+			return fmt.Errorf("row %d: %w", n, err)
+		}
+	}
+}
+
+// newIDs returns a new ID for the ID of every row of the backup, by old ID. The default
+// organization keeps its ID, which the migrations refer to.
+func (r *Reader) newIDs() (map[string]string, error) {
+	ids := map[string]string{}
+	for _, table := range r.Manifest.Tables {
+		column := -1
+		for i, name := range table.Columns {
+			if name == "id" {
+				column = i
+			}
+		}
+		if column < 0 {
+			continue
+		}
+		err := r.readRows(table, func(row []json.RawMessage) error {
+			var id string
+			if json.Unmarshal(row[column], &id) != nil {
+				return nil
+			}
+			if parsed, err := uuid.Parse(id); err == nil && parsed != repository.DefaultOrganizationID {
+				ids[id] = uuid.NewString()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("read IDs of %s: %w", table.Name, err)
+		}
+	}
+	return ids, nil
+}
+
+// columnTypes returns the database types of the columns of the table name, by column.
+func columnTypes(ctx context.Context, tx *sqlx.Tx, name string) (map[string]string, error) {
+	rows, err := tx.QueryxContext(ctx, "SELECT * FROM "+name+" WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(columns))
+	for _, c := range columns {
+		types[c.Name()] = c.DatabaseTypeName()
+	}
+	return types, rows.Err()
+}
+
+// decodeValue returns the value to insert for raw, the JSON value of a column of the
+// database type typeName, replacing IDs found in ids. It reverses encodeValue.
+func decodeValue(typeName string, raw json.RawMessage, ids map[string]string) (any, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	switch {
+	case isBinary(typeName):
+		var b []byte
+		err := json.Unmarshal(raw, &b)
+		return b, err
+	case isJSON(typeName):
+		return string(raw), nil
+	case isTime(typeName):
+		var t time.Time
+		err := json.Unmarshal(raw, &t)
+		return t, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case string:
+		if id, ok := ids[v]; ok {
+			return id, nil
+		}
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case bool:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("unexpected value %s", raw)
+	}
+}
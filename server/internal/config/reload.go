@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// reloadable are the settings a running server applies on reload; the others need a
+// restart.
+var reloadable = []string{
+	"CORS_ORIGINS", "LOG_LEVEL",
+	"RETENTION_DAYS", "INACTIVE_DAYS", "CLEANUP_INTERVAL", "CLEANUP_SCHEDULE", "CLEANUP_TIMEOUT",
+	"RATE_LIMIT_ENROLL", "RATE_LIMIT_AGENT", "RATE_LIMIT_AGENT_DOWNLOAD", "RATE_LIMIT_LOGIN",
+	"RATE_LIMIT_SSO", "RATE_LIMIT_MFA", "RATE_LIMIT_EVENTS",
+}
+
+// watchInterval is how often the config file is checked for changes.
+const watchInterval = 5 * time.Second
+
+// Reloader reads the configuration again on SIGHUP and when the config file changes,
+// and hands the reloadable settings to the functions registered with OnReload. An
+// invalid configuration is logged and leaves the running one in place.
+type Reloader struct {
+	mu        sync.Mutex
+	current   *Config
+	listeners []func(*Config)
+	file      os.FileInfo // config file as last read; nil without one
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+}
+
+// NewReloader creates a Reloader of the running configuration cfg.
+func NewReloader(cfg *Config) *Reloader {
+	r := &Reloader{current: cfg, stopCh: make(chan struct{}), doneCh: make(chan struct{})}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		r.file, _ = os.Stat(path)
+	}
+	return r
+}
+
+// OnReload registers fn to be called with the configuration after each reload that
+// changed a reloadable setting. Register before Start.
+func (r *Reloader) OnReload(fn func(*Config)) {
+	r.listeners = append(r.listeners, fn)
+}
+
+// Start begins watching for SIGHUP and config file changes in a background goroutine.
+// Call Stop() to terminate it.
+func (r *Reloader) Start() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	path := os.Getenv("CONFIG_FILE")
+
+	go func() {
+		defer close(r.doneCh)
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-hup:
+				slog.Info("reloading configuration", "trigger", "SIGHUP")
+				r.Reload()
+			case <-ticker.C:
+				if path != "" && r.fileChanged(path) {
+					slog.Info("reloading configuration", "trigger", "file change", "file", path)
+					r.Reload()
+				}
+			case <-r.stopCh:
+				return
+			}
+		}
+	}()
+
+	slog.Info("configuration reload enabled", "config_file", path)
+}
+
+// Stop stops watching for changes.
+func (r *Reloader) Stop() {
+	close(r.stopCh)
+	<-r.doneCh
+}
+
+// fileChanged reports whether the config file differs from the one last read.
+func (r *Reloader) fileChanged(path string) bool {
+	info, err := os.Stat(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		// A file that went away is reported once, by the reload that fails to read it.
+		changed := r.file != nil
+		r.file = nil
+		return changed
+	}
+	if r.file != nil && info.ModTime().Equal(r.file.ModTime()) && info.Size() == r.file.Size() {
+		return false
+	}
+	r.file = info
+	return true
+}
+
+// Reload reads the configuration and applies the reloadable settings that changed.
+// Changes to other settings are logged and ignored until the next restart.
+func (r *Reloader) Reload() {
+	next, err := Read()
+	if err != nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			for _, p := range verr.Problems {
+				slog.Error("configuration not reloaded", "problem", p)
+			}
+		} else {
+			slog.Error("configuration not reloaded", "error", err)
+		}
+		return
+	}
+
+	r.mu.Lock()
+	var applied, ignored []string
+	for _, key := range changedSettings(r.current.settings, next.settings) {
+		if slices.Contains(reloadable, key) {
+			applied = append(applied, key)
+		} else {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) > 0 {
+		slog.Warn("configuration changes need a restart and were ignored", "settings", ignored)
+	}
+	if len(applied) == 0 {
+		r.mu.Unlock()
+		slog.Info("configuration reloaded, no change to apply")
+		return
+	}
+
+	// The running configuration takes only the reloadable settings, so the ignored
+	// changes are reported again on each reload until a restart applies them.
+	cfg := *r.current
+	cfg.CORSOrigins = next.CORSOrigins
+	cfg.LogLevel = next.LogLevel
+	cfg.RetentionDays, cfg.InactiveDays, cfg.CleanupInterval = next.RetentionDays, next.InactiveDays, next.CleanupInterval
+	cfg.CleanupSchedule, cfg.CleanupTimeout = next.CleanupSchedule, next.CleanupTimeout
+	backend := cfg.RateLimit.Backend
+	cfg.RateLimit = next.RateLimit
+	cfg.RateLimit.Backend = backend
+	cfg.settings = make(map[string]string, len(r.current.settings))
+	for key, value := range r.current.settings {
+		if !slices.Contains(reloadable, key) {
+			cfg.settings[key] = value
+		}
+	}
+	for key, value := range next.settings {
+		if slices.Contains(reloadable, key) {
+			cfg.settings[key] = value
+		}
+	}
+	r.current = &cfg
+	r.mu.Unlock()
+
+	for _, fn := range r.listeners {
+		fn(&cfg)
+	}
+	slog.Info("configuration reloaded", "settings", applied)
+}
+
+// changedSettings returns the names of the settings set differently in a and b, sorted.
+func changedSettings(a, b map[string]string) []string {
+	var keys []string
+	for key, value := range a {
+		if v, ok := b[key]; !ok || v != value {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// source looks settings up in the environment, then in the config file CONFIG_FILE
+// names, and records every invalid value instead of stopping at the first.
+//
+// The config file, YAML (.yaml, .yml) or TOML (.toml), uses the names of the
+// environment variables, in any case, either flat or nested by prefix:
+//
+//	retention_days: 90
+//	oidc:
+//	  issuer_url: https://sso.example.com
+//	  admin_values: [inventario-admins]
+type source struct {
+	path     string
+	file     map[string]any // string, or []string for lists, by variable name
+	used     map[string]bool
+	values   map[string]string // value of every setting read, for reload diffs
+	problems []string
+}
+
+// newSource reads the config file CONFIG_FILE names, if any.
+func newSource() (*source, error) {
+	s := &source{path: os.Getenv("CONFIG_FILE"), file: map[string]any{}, used: map[string]bool{}, values: map[string]string{}}
+	if s.path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("CONFIG_FILE: %w", err)
+	}
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		err = fmt.Errorf("unknown format %q, use .yaml, .yml or .toml", filepath.Ext(s.path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.flatten("", doc)
+	return s, nil
+}
+
+// flatten stores the settings of doc by variable name: nested keys are joined with "_".
+func (s *source) flatten(prefix string, doc map[string]any) {
+	for k, v := range doc {
+		key := strings.ToUpper(prefix + k)
+		switch v := v.(type) {
+		case map[string]any:
+			s.flatten(key+"_", v)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			s.file[key] = items
+		case nil:
+			s.file[key] = ""
+		default:
+			s.file[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+func (s *source) problemf(format string, args ...any) {
+	s.problems = append(s.problems, fmt.Sprintf(format, args...))
+}
+
+// unknown records the settings of the config file no one read, mostly typos.
+func (s *source) unknown() {
+	var keys []string
+	for key := range s.file {
+		if !s.used[key] {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s.problemf("%s: unknown setting %s", s.path, key)
+	}
+}
+
+// lookup returns the value of a setting and whether it is set. A list in the config
+// file is joined with sep.
+func (s *source) lookup(key, sep string) (string, bool) {
+	s.used[key] = true
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		var v any
+		if v, ok = s.file[key]; ok {
+			switch v := v.(type) {
+			case []string:
+				if sep == "" {
+					s.problemf("%s: %s must be a single value, not a list", s.path, key)
+					return "", false
+				}
+				value = strings.Join(v, sep)
+			case string:
+				value = v
+			}
+		}
+	}
+	if ok {
+		s.values[key] = value
+	}
+	return value, ok
+}
+
+func (s *source) get(key, fallback string) string {
+	if value, ok := s.lookup(key, ""); ok {
+		return value
+	}
+	return fallback
+}
+
+// getList reads a comma-separated list, dropping empty items.
+func (s *source) getList(key, fallback string) []string {
+	if value, ok := s.lookup(key, ","); ok {
+		return splitList(value, ",")
+	}
+	return splitList(fallback, ",")
+}
+
+// getListSep reads a list with a custom separator (e.g. ";" for values that contain commas, like DNs).
+func (s *source) getListSep(key, sep string) []string {
+	value, _ := s.lookup(key, sep)
+	return splitList(value, sep)
+}
+
+func splitList(value, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(value, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *source) getBool(key string, fallback bool) bool {
+	if value, ok := s.lookup(key, ""); ok {
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			s.problemf("%s must be true or false, not %q", key, value)
+			return fallback
+		}
+		return v
+	}
+	return fallback
+}
+
+func (s *source) getInt(key string, fallback int) int {
+	if value, ok := s.lookup(key, ""); ok {
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			s.problemf("%s must be an integer, not %q", key, value)
+			return fallback
+		}
+		return v
+	}
+	return fallback
+}
+
+func (s *source) getDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := s.lookup(key, ""); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			s.problemf("%s must be a duration like 30s, 15m or 24h, not %q", key, value)
+			return fallback
+		}
+		return d
+	}
+	return fallback
+}
+
+// getRate reads a rate limit written as <requests>/<window>, like 10/1m.
+func (s *source) getRate(key string, fallback Rate) Rate {
+	value, ok := s.lookup(key, "")
+	if !ok {
+		return fallback
+	}
+	limit, window, found := strings.Cut(value, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	d, derr := time.ParseDuration(strings.TrimSpace(window))
+	if !found || err != nil || derr != nil || n < 1 || d < time.Second {
+		s.problemf("%s must be <requests>/<window> with at least 1 request and a window of 1s or more, like 10/1m, not %q", key, value)
+		return fallback
+	}
+	return Rate{Limit: n, Window: d}
+}
@@ -0,0 +1,220 @@
+// Package cron parses the schedules of background jobs: standard five-field cron
+// expressions (minute, hour, day of month, month, day of week), the descriptors
+// @hourly, @daily, @weekly, @monthly and @yearly, and @every <duration>.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the activation times of a job.
+type Schedule interface {
+	// Next returns the first activation time after t, in t's location.
+	Next(t time.Time) time.Time
+}
+
+// descriptors are the shorthands of common expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field is the range and the names of one field of an expression.
+type field struct {
+	name     string
+	min, max int
+	names    []string // names of min, min+1, ...
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is Sunday too.
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Parse parses a cron expression or descriptor.
+func Parse(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid @every duration %q", rest)
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("@every duration must be 1s or more, not %s", d)
+		}
+		return every(d), nil
+	}
+	if strings.HasPrefix(expr, "@") {
+		e, ok := descriptors[strings.ToLower(expr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown descriptor %q", expr)
+		}
+		expr = e
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expected 5 fields (minute hour day-of-month month day-of-week), got %d", len(parts))
+	}
+	var s spec
+	for i, part := range parts {
+		bits, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		s.bits[i] = bits
+	}
+	// Sunday is both 0 and 7.
+	if s.bits[4]&(1<<7) != 0 {
+		s.bits[4] |= 1
+	}
+	s.domStar, s.dowStar = parts[2] == "*", parts[4] == "*"
+	return &s, nil
+}
+
+// parseField parses a comma-separated list of *, values, ranges and steps (*/15, 1-5/2)
+// into a bit set of the values it matches.
+func parseField(part string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, f.name)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loText); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(hiText); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// 5/10 is 5-max/10.
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q in %s field", rng, f.name)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of f.
+func (f field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	n, err := strconv.Atoi(text)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, must be %d-%d", text, f.name, f.min, f.max)
+	}
+	return n, nil
+}
+
+// every activates at the multiples of a duration, so that all replicas agree on the
+// activation times whenever they started.
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+// allHours is the hour bits of an expression that matches every hour.
+const allHours = 1<<24 - 1
+
+// spec is a parsed five-field expression.
+type spec struct {
+	bits             [5]uint64 // minute, hour, day of month, month, day of week
+	domStar, dowStar bool
+}
+
+// Next walks forward from t field by field, largest first, skipping whole months,
+// days and hours that do not match. It gives up after five years, for expressions
+// that never match (like February 30th), and returns the zero time.
+//
+// Across daylight saving time changes, times that do not exist (the hour skipped in
+// spring) are not activations, and a time that occurs twice (the hour repeated in
+// autumn) is an activation once, the first time, unless the expression matches every
+// hour.
+func (s *spec) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.bits[3]&(1<<uint(t.Month())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+		if s.bits[1]&(1<<uint(t.Hour())) == 0 {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+		if s.bits[0]&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		if s.bits[1] != allHours && time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Before(t) {
+			// The second occurrence of a repeated wall time.
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// forward returns next, the start of a later month, day or hour than t, unless it is
+// not after t: time.Date may resolve a start that falls in a daylight saving gap to a
+// time before the gap. forward then returns the start of the next hour after t.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Duration(60-t.Minute()) * time.Minute)
+}
+
+// dayMatches applies the cron rule for days: when both the day of month and the day of
+// week are restricted, a day matching either is enough.
+func (s *spec) dayMatches(t time.Time) bool {
+	dom := s.bits[2]&(1<<uint(t.Day())) != 0
+	dow := s.bits[4]&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,213 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"* * * *", "expected 5 fields"},
+		{"* * * * * *", "expected 5 fields"},
+		{"60 * * * *", `invalid value "60" in minute field`},
+		{"* 24 * * *", `invalid value "24" in hour field`},
+		{"* * 0 * *", `invalid value "0" in day of month field`},
+		{"* * * 13 *", `invalid value "13" in month field`},
+		{"* * * * 8", `invalid value "8" in day of week field`},
+		{"* * * foo *", `invalid value "foo" in month field`},
+		{"5-1 * * * *", `invalid range "5-1" in minute field`},
+		{"*/0 * * * *", `invalid step "0" in minute field`},
+		{"*/x * * * *", `invalid step "x" in minute field`},
+		{"@fortnightly", "unknown descriptor"},
+		{"@every 10", "invalid @every duration"},
+		{"@every 500ms", "@every duration must be 1s or more"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want error containing %q", tt.expr, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) error = %q, want it to contain %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := time.UTC
+	date := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, utc)
+	}
+	// 2026-03-02 is a Monday.
+	from := date(2026, 3, 2, 10, 17)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time // the next activations, in order
+	}{
+		{"every minute", "* * * * *", from,
+			[]time.Time{date(2026, 3, 2, 10, 18), date(2026, 3, 2, 10, 19)}},
+		{"seconds are dropped", "* * * * *", from.Add(59 * time.Second),
+			[]time.Time{date(2026, 3, 2, 10, 18)}},
+		{"fixed time", "30 3 * * *", from,
+			[]time.Time{date(2026, 3, 3, 3, 30), date(2026, 3, 4, 3, 30)}},
+		{"list", "0 8,12,18 * * *", from,
+			[]time.Time{date(2026, 3, 2, 12, 0), date(2026, 3, 2, 18, 0), date(2026, 3, 3, 8, 0)}},
+		{"range", "0 9-11 * * *", from,
+			[]time.Time{date(2026, 3, 2, 11, 0), date(2026, 3, 3, 9, 0)}},
+		{"step", "*/15 * * * *", from,
+			[]time.Time{date(2026, 3, 2, 10, 30), date(2026, 3, 2, 10, 45), date(2026, 3, 2, 11, 0)}},
+		{"range with step", "0 1-9/4 * * *", from,
+			[]time.Time{date(2026, 3, 3, 1, 0), date(2026, 3, 3, 5, 0), date(2026, 3, 3, 9, 0)}},
+		{"value with step", "50/5 * * * *", from,
+			[]time.Time{date(2026, 3, 2, 10, 50), date(2026, 3, 2, 10, 55), date(2026, 3, 2, 11, 50)}},
+		{"month and day names", "0 0 * jun-jul SAT", from,
+			[]time.Time{date(2026, 6, 6, 0, 0), date(2026, 6, 13, 0, 0)}},
+		{"sunday is 7", "0 0 * * 7", from,
+			[]time.Time{date(2026, 3, 8, 0, 0)}},
+		{"day of month only", "0 0 15 * *", from,
+			[]time.Time{date(2026, 3, 15, 0, 0), date(2026, 4, 15, 0, 0)}},
+		{"day of week only", "0 0 * * fri", from,
+			[]time.Time{date(2026, 3, 6, 0, 0), date(2026, 3, 13, 0, 0)}},
+		// Both restricted: the 15th or any Friday.
+		{"day of month or day of week", "0 0 15 * 5", from,
+			[]time.Time{date(2026, 3, 6, 0, 0), date(2026, 3, 13, 0, 0), date(2026, 3, 15, 0, 0), date(2026, 3, 20, 0, 0)}},
+		// Only a literal * leaves a day field unrestricted: */1 matches every day of the
+		// week, so with the OR rule every day matches.
+		{"day of week step is restricted", "0 0 13 * */1", from,
+			[]time.Time{date(2026, 3, 3, 0, 0), date(2026, 3, 4, 0, 0)}},
+		{"31st skips short months", "0 0 31 * *", from,
+			[]time.Time{date(2026, 3, 31, 0, 0), date(2026, 5, 31, 0, 0), date(2026, 7, 31, 0, 0)}},
+		{"leap day", "0 0 29 2 *", from,
+			[]time.Time{date(2028, 2, 29, 0, 0)}},
+		{"never", "0 0 30 2 *", from,
+			[]time.Time{{}}},
+		{"hourly", "@hourly", from,
+			[]time.Time{date(2026, 3, 2, 11, 0), date(2026, 3, 2, 12, 0)}},
+		{"daily", "@daily", from,
+			[]time.Time{date(2026, 3, 3, 0, 0)}},
+		{"weekly", "@weekly", from,
+			[]time.Time{date(2026, 3, 8, 0, 0)}},
+		{"monthly", "@monthly", from,
+			[]time.Time{date(2026, 4, 1, 0, 0)}},
+		{"yearly", "@YEARLY", from,
+			[]time.Time{date(2027, 1, 1, 0, 0)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				got := schedule.Next(at)
+				if !got.Equal(want) {
+					t.Fatalf("%q activation %d after %s = %s, want %s", tt.expr, i+1, tt.from, got, want)
+				}
+				at = got
+			}
+		})
+	}
+}
+
+func TestNextDaylightSaving(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+	// Clocks go from 02:00 EST to 03:00 EDT on 2026-03-08, and from 02:00 EDT back to
+	// 01:00 EST on 2026-11-01.
+	spring := time.Date(2026, 3, 7, 12, 0, 0, 0, ny)
+	autumn := time.Date(2026, 10, 31, 12, 0, 0, 0, ny)
+	est := time.FixedZone("EST", -5*3600)
+	edt := time.FixedZone("EDT", -4*3600)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{"skipped time does not run", "30 2 * * *", spring,
+			[]time.Time{time.Date(2026, 3, 9, 2, 30, 0, 0, ny)}},
+		{"time after the gap", "30 3 * * *", spring,
+			[]time.Time{time.Date(2026, 3, 8, 3, 30, 0, 0, ny), time.Date(2026, 3, 9, 3, 30, 0, 0, ny)}},
+		{"hourly across the gap", "0 * * * *", time.Date(2026, 3, 8, 0, 30, 0, 0, ny),
+			[]time.Time{time.Date(2026, 3, 8, 1, 0, 0, 0, ny), time.Date(2026, 3, 8, 3, 0, 0, 0, ny)}},
+		{"repeated time runs once", "30 1 * * *", autumn,
+			[]time.Time{time.Date(2026, 11, 1, 1, 30, 0, 0, edt), time.Date(2026, 11, 2, 1, 30, 0, 0, ny)}},
+		{"hourly runs in both repeated hours", "0 * * * *", time.Date(2026, 11, 1, 0, 30, 0, 0, ny),
+			[]time.Time{time.Date(2026, 11, 1, 1, 0, 0, 0, edt), time.Date(2026, 11, 1, 1, 0, 0, 0, est), time.Date(2026, 11, 1, 2, 0, 0, 0, est)}},
+		{"daily at midnight keeps local time", "@daily", autumn,
+			[]time.Time{time.Date(2026, 11, 1, 0, 0, 0, 0, ny), time.Date(2026, 11, 2, 0, 0, 0, 0, ny)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			at := tt.from
+			for i, want := range tt.want {
+				got := schedule.Next(at)
+				if !got.Equal(want) {
+					t.Fatalf("%q activation %d after %s = %s, want %s", tt.expr, i+1, tt.from, got, want)
+				}
+				if got.Location() != ny {
+					t.Errorf("%q activation %d is in %s, want %s", tt.expr, i+1, got.Location(), ny)
+				}
+				at = got
+			}
+		})
+	}
+}
+
+func TestEveryAlignment(t *testing.T) {
+	sp := time.FixedZone("BRT", -3*3600)
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"minutes", "@every 15m", time.Date(2026, 3, 2, 10, 17, 3, 0, time.UTC), time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC)},
+		{"on an activation", "@every 15m", time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC), time.Date(2026, 3, 2, 10, 45, 0, 0, time.UTC)},
+		{"seconds", "@every 10s", time.Date(2026, 3, 2, 10, 17, 3, 500, time.UTC), time.Date(2026, 3, 2, 10, 17, 10, 0, time.UTC)},
+		{"hours", "@every 6h", time.Date(2026, 3, 2, 10, 17, 0, 0, time.UTC), time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)},
+		// Multiples of the duration are absolute: 24h is midnight UTC in any zone.
+		{"day in another zone", "@every 24h", time.Date(2026, 3, 2, 10, 0, 0, 0, sp), time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("%q after %s = %s, want %s", tt.expr, tt.from, got, tt.want)
+			}
+		})
+	}
+
+	// Replicas started at different times within an interval agree on the activation.
+	schedule, _ := Parse("@every 7m")
+	first := schedule.Next(time.Date(2026, 3, 2, 10, 0, 1, 0, time.UTC))
+	for offset := time.Duration(0); offset < 7*time.Minute; offset += 13 * time.Second {
+		at := first.Add(-7 * time.Minute).Add(offset)
+		if got := schedule.Next(at); !got.Equal(first) {
+			t.Fatalf("@every 7m after %s = %s, want %s", at, got, first)
+		}
+	}
+	if got := schedule.Next(first); got.Sub(first) != 7*time.Minute {
+		t.Errorf("@every 7m after %s = %s, want %s", first, got, first.Add(7*time.Minute))
+	}
+}
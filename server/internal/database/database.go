@@ -1,26 +1,124 @@
-// Package database handles PostgreSQL connection and migration execution.
+// Package database handles the database connection and migration execution.
+// DATABASE_URL selects the backend: postgres:// (or postgresql://) for PostgreSQL,
+// sqlite:// for a single-file SQLite database.
 package database
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
 	"io/fs"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	migratesqlite "github.com/golang-migrate/migrate/v4/database/sqlite"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/google/uuid"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"modernc.org/sqlite"
 )
 
-// Connect establishes a connection to PostgreSQL and verifies it with a ping.
+// Driver names of the two backends, as reported by sqlx.DB.DriverName.
+const (
+	DriverPostgres = "pgx"
+	DriverSQLite   = "sqlite"
+)
+
+// sqliteScheme is the DATABASE_URL prefix of the SQLite backend, followed by the
+// database file path (sqlite:///var/lib/inventario/inventario.db).
+const sqliteScheme = "sqlite://"
+
+// sqliteParams configures every SQLite connection. Timestamps are stored as Unix
+// milliseconds, so they compare and sort as integers; WAL and the busy timeout let
+// readers proceed while one writer holds the lock, and transactions take the write
+// lock when they begin instead of failing when a read turns into a write.
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)" +
+	"&_pragma=synchronous(NORMAL)&_txlock=immediate&_time_integer_format=unix_milli&_inttotime=1"
+
+func init() {
+	// The PostgreSQL functions the shared SQL calls on both backends. NOW() and
+	// clock_timestamp() return the current time in Unix milliseconds like the stored
+	// timestamps.
+	now := func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return time.Now().UnixMilli(), nil
+	}
+	sqlite.MustRegisterScalarFunction("now", 0, now)
+	sqlite.MustRegisterScalarFunction("clock_timestamp", 0, now)
+	sqlite.MustRegisterScalarFunction("uuid_generate_v4", 0, func(*sqlite.FunctionContext, []driver.Value) (driver.Value, error) {
+		return uuid.NewString(), nil
+	})
+	sqlite.MustRegisterScalarFunction("least", -1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return extreme(args, -1), nil
+	})
+	sqlite.MustRegisterScalarFunction("greatest", -1, func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		return extreme(args, 1), nil
+	})
+}
+
+// extreme implements LEAST (sign -1) and GREATEST (sign 1) on numbers: like
+// PostgreSQL's, they ignore NULL arguments.
+func extreme(args []driver.Value, sign float64) driver.Value {
+	var best driver.Value
+	var bestNum float64
+	for _, arg := range args {
+		var num float64
+		switch v := arg.(type) {
+		case int64:
+			num = float64(v)
+		case float64:
+			num = v
+		default:
+			continue
+		}
+		if best == nil || (num-bestNum)*sign > 0 {
+			best, bestNum = arg, num
+		}
+	}
+	return best
+}
+
+// IsSQLite reports whether databaseURL selects the SQLite backend.
+func IsSQLite(databaseURL string) bool {
+	return strings.HasPrefix(databaseURL, sqliteScheme)
+}
+
+// sqliteDSN turns a sqlite:// URL into the driver's file name with sqliteParams.
+func sqliteDSN(databaseURL string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(databaseURL, sqliteScheme), "?")
+	dsn := "file:" + path + "?" + sqliteParams
+	if query != "" {
+		dsn += "&" + query
+	}
+	return dsn
+}
+
+// Connect establishes a connection to the database and verifies it with a ping.
 func Connect(databaseURL string) *sqlx.DB {
-	db, err := sqlx.Connect("pgx", databaseURL)
+	db, err := Open(databaseURL)
 	if err != nil {
 		slog.Error("failed to connect to database", "error", err)
 		panic(err)
 	}
+	return db
+}
+
+// Open is Connect returning the error instead of panicking, for the CLI.
+func Open(databaseURL string) (*sqlx.DB, error) {
+	driverName, dsn := DriverPostgres, databaseURL
+	if IsSQLite(databaseURL) {
+		driverName, dsn = DriverSQLite, sqliteDSN(databaseURL)
+	}
+
+	db, err := sqlx.Connect(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
 
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(5)
@@ -30,27 +128,46 @@ func Connect(databaseURL string) *sqlx.DB {
 	defer cancel()
 
 	if err := db.PingContext(ctx); err != nil {
-		slog.Error("failed to ping database", "error", err)
-		panic(err)
+		db.Close()
+		return nil, fmt.Errorf("ping: %w", err)
 	}
 
-	slog.Info("database connected successfully")
-	return db
+	slog.Info("database connected successfully", "driver", driverName)
+	return db, nil
 }
 
-// RunMigrations applies all pending database migrations from the embedded filesystem.
-func RunMigrations(databaseURL string, migrationsFS fs.FS) {
+// newMigrate creates the migrate instance of the database databaseURL selects, with the
+// migrations of migrationsFS. Closing it closes its connection.
+func newMigrate(databaseURL string, migrationsFS fs.FS) (*migrate.Migrate, error) {
 	source, err := iofs.New(migrationsFS, ".")
 	if err != nil {
-		slog.Error("failed to create migration source", "error", err)
-		panic(err)
+		return nil, fmt.Errorf("create migration source: %w", err)
 	}
 
-	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if !IsSQLite(databaseURL) {
+		return migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	}
+	db, err := sqlx.Open(DriverSQLite, sqliteDSN(databaseURL))
+	if err != nil {
+		return nil, fmt.Errorf("open database for migrations: %w", err)
+	}
+	instance, err := migratesqlite.WithInstance(db.DB, &migratesqlite.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return migrate.NewWithInstance("iofs", source, DriverSQLite, instance)
+}
+
+// RunMigrations applies all pending database migrations from the embedded filesystem,
+// which must hold the migrations of the backend databaseURL selects.
+func RunMigrations(databaseURL string, migrationsFS fs.FS) {
+	m, err := newMigrate(databaseURL, migrationsFS)
 	if err != nil {
 		slog.Error("failed to create migrate instance", "error", err)
 		panic(err)
 	}
+	defer m.Close()
 
 	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
 		slog.Error("failed to run migrations", "error", err)
@@ -59,3 +176,121 @@ func RunMigrations(databaseURL string, migrationsFS fs.FS) {
 
 	slog.Info("database migrations completed")
 }
+
+// MigrateTo migrates the database up or down to version, one of the migrations of
+// migrationsFS.
+func MigrateTo(databaseURL string, migrationsFS fs.FS, version uint) error {
+	m, err := newMigrate(databaseURL, migrationsFS)
+	if err != nil {
+		return fmt.Errorf("create migrate instance: %w", err)
+	}
+	defer m.Close()
+
+	if err := m.Migrate(version); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migrate to version %d: %w", version, err)
+	}
+	return nil
+}
+
+// MigrateSteps applies the next n migrations, or rolls back the last -n when n is
+// negative.
+func MigrateSteps(databaseURL string, migrationsFS fs.FS, n int) error {
+	m, err := newMigrate(databaseURL, migrationsFS)
+	if err != nil {
+		return fmt.Errorf("create migrate instance: %w", err)
+	}
+	defer m.Close()
+
+	if err := m.Steps(n); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migrate %d steps: %w", n, err)
+	}
+	return nil
+}
+
+// ForceMigration records version as the applied migration and clears the dirty flag,
+// without running any migration: the way out of a migration that failed halfway, once
+// the database has been repaired by hand.
+func ForceMigration(databaseURL string, migrationsFS fs.FS, version uint) error {
+	m, err := newMigrate(databaseURL, migrationsFS)
+	if err != nil {
+		return fmt.Errorf("create migrate instance: %w", err)
+	}
+	defer m.Close()
+
+	if err := m.Force(int(version)); err != nil {
+		return fmt.Errorf("force version %d: %w", version, err)
+	}
+	return nil
+}
+
+// Migrations returns the versions of the migrations of migrationsFS, in order.
+func Migrations(migrationsFS fs.FS) ([]uint, error) {
+	source, err := iofs.New(migrationsFS, ".")
+	if err != nil {
+		return nil, fmt.Errorf("create migration source: %w", err)
+	}
+	defer source.Close()
+
+	var versions []uint
+	version, err := source.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = source.Next(version)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// LatestMigration returns the version of the last migration of migrationsFS.
+func LatestMigration(migrationsFS fs.FS) (uint, error) {
+	versions, err := Migrations(migrationsFS)
+	if err != nil || len(versions) == 0 {
+		return 0, err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// MigrationVersion returns the version of the last migration applied to db; 0 for a
+// database no migration has run on. A migration that failed halfway leaves the
+// database dirty, which is an error.
+func MigrationVersion(ctx context.Context, db *sqlx.DB) (uint, error) {
+	version, dirty, err := MigrationState(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("migration %d failed halfway (dirty database)", version)
+	}
+	return version, nil
+}
+
+// MigrationState returns the version of the last migration applied to db, 0 if none,
+// and whether it failed halfway.
+func MigrationState(ctx context.Context, db *sqlx.DB) (version uint, dirty bool, err error) {
+	var exists bool
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if db.DriverName() == DriverSQLite {
+		query = "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'"
+	}
+	if err := db.GetContext(ctx, &exists, query); err != nil {
+		return 0, false, fmt.Errorf("find migrations table: %w", err)
+	}
+	if !exists {
+		return 0, false, nil
+	}
+
+	var state struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	err = db.GetContext(ctx, &state, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read migration version: %w", err)
+	}
+	return uint(state.Version), state.Dirty, nil
+}
@@ -0,0 +1,116 @@
+// Package events carries device events to the live event stream (GET /api/v1/events/stream).
+// Repositories publish an event inside the transaction that makes the change; PostgreSQL
+// delivers it (NOTIFY) on commit to every API replica, where the Hub keeps a bounded
+// replay buffer and fans it out to the connected streams. On SQLite the event is written
+// to the event_outbox table instead, which the Hub polls.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/database"
+)
+
+// channel is the PostgreSQL notification channel events travel on.
+const channel = "inventario_events"
+
+// maxPayload keeps notifications under PostgreSQL's 8000-byte limit.
+const maxPayload = 7500
+
+// Event types.
+const (
+	TypeInventorySaved    = "inventory.saved"
+	TypeDeviceEnrolled    = "device.enrolled"
+	TypeDeviceOnline      = "device.online"
+	TypeDeviceOffline     = "device.offline"
+	TypeStatusChanged     = "device.status_changed"
+	TypeDepartmentChanged = "device.department_changed"
+	TypeDeviceActivity    = "device.activity"
+
+	// TypeReset tells a stream that events were lost (the replay buffer no longer holds
+	// its Last-Event-ID, or the hub lost its database connection); clients refetch.
+	TypeReset = "reset"
+	// TypeReady follows the replay when a stream starts.
+	TypeReady = "ready"
+)
+
+// Event is one published event. ID is the position in the stream, assigned from the
+// event_stream_seq sequence (the event_outbox row ID on SQLite).
+type Event struct {
+	ID   string          `json:"-"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	// Departments the event concerns, used to filter it by the reader's device.read
+	// scope: the device's department, or both the old and new one when it moves.
+	// A nil entry stands for devices without a department.
+	Departments []*uuid.UUID `json:"departments"`
+	// OrganizationID is the device's organization; streams of other organizations
+	// never receive the event.
+	OrganizationID uuid.UUID `json:"organization_id"`
+}
+
+// Device is the data of device events.
+type Device struct {
+	DeviceID     uuid.UUID  `json:"device_id" db:"device_id"`
+	Hostname     string     `json:"hostname" db:"hostname"`
+	DepartmentID *uuid.UUID `json:"department_id" db:"department_id"`
+	// OrganizationID routes the event; it is not part of the data.
+	OrganizationID uuid.UUID `json:"-" db:"organization_id"`
+
+	Status          string     `json:"status,omitempty" db:"status"`                       // device.status_changed
+	OldDepartmentID *uuid.UUID `json:"old_department_id,omitempty" db:"old_department_id"` // device.department_changed
+	Activity        []Activity `json:"activity,omitempty"`                                 // device.activity
+	ActivityCount   int        `json:"activity_count,omitempty"`                           // device.activity, may exceed len(Activity)
+}
+
+// Activity is one device activity entry in a device.activity event.
+type Activity struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// maxActivity bounds the entries carried by one device.activity event; the rest are
+// only counted.
+const maxActivity = 20
+
+// PublishDevice publishes a device event through exec, usually the transaction that
+// made the change: the event is delivered only if it commits.
+func PublishDevice(ctx context.Context, exec sqlx.ExecerContext, eventType string, d Device) error {
+	departments := []*uuid.UUID{d.DepartmentID}
+	if eventType == TypeDepartmentChanged {
+		departments = append(departments, d.OldDepartmentID)
+	}
+	if len(d.Activity) > maxActivity {
+		d.Activity = d.Activity[:maxActivity]
+	}
+
+	for {
+		data, err := json.Marshal(d)
+		if err != nil {
+			return fmt.Errorf("marshal event: %w", err)
+		}
+		payload, err := json.Marshal(Event{Type: eventType, Data: data, Departments: departments, OrganizationID: d.OrganizationID})
+		if err != nil {
+			return fmt.Errorf("marshal event: %w", err)
+		}
+		if len(payload) > maxPayload && len(d.Activity) > 0 {
+			d.Activity = d.Activity[:len(d.Activity)/2]
+			continue
+		}
+		if db, ok := exec.(interface{ DriverName() string }); ok && db.DriverName() == database.DriverSQLite {
+			_, err = exec.ExecContext(ctx, "INSERT INTO event_outbox (payload) VALUES ($1)", string(payload))
+		} else {
+			_, err = exec.ExecContext(ctx,
+				"SELECT pg_notify($1, nextval('event_stream_seq') || ' ' || $2)", channel, string(payload))
+		}
+		if err != nil {
+			return fmt.Errorf("publish %s event: %w", eventType, err)
+		}
+		return nil
+	}
+}
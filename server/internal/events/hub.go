@@ -0,0 +1,315 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/database"
+)
+
+// subscriberBuffer is how many events a stream may fall behind before it is dropped;
+// the client reconnects and catches up from the replay buffer.
+const subscriberBuffer = 256
+
+// pollInterval is how often a hub on SQLite reads new rows from event_outbox, and
+// outboxRetention how long the rows are kept; a single process reads them, so they
+// only need to outlive one poll.
+const (
+	pollInterval    = 500 * time.Millisecond
+	outboxRetention = time.Minute
+)
+
+// Hub listens for events on a dedicated database connection and fans them out to
+// subscribers. It keeps the last events in a ring buffer so that a client reconnecting
+// with Last-Event-ID gets what it missed. On SQLite it polls event_outbox through db
+// instead.
+type Hub struct {
+	db          *sqlx.DB
+	databaseURL string
+
+	mu     sync.Mutex
+	ring   []Event
+	start  int // index of the oldest event in ring
+	count  int
+	origin string // position of a stream that started with an empty, untruncated buffer
+	subs   map[*Subscription]struct{}
+	closed bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Subscription receives the events published after it was created. C is closed when
+// the subscriber falls too far behind or the hub stops.
+type Subscription struct {
+	C  <-chan Event
+	ch chan Event
+}
+
+// NewHub creates a Hub that keeps up to replaySize events.
+func NewHub(db *sqlx.DB, databaseURL string, replaySize int) *Hub {
+	return &Hub{
+		db:          db,
+		databaseURL: databaseURL,
+		ring:        make([]Event, replaySize),
+		origin:      newOrigin(),
+		subs:        make(map[*Subscription]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// newOrigin returns a position that only the hub that created it recognizes.
+func newOrigin() string {
+	return "0-" + uuid.NewString()
+}
+
+// Start begins listening in a background goroutine. Call Stop() to terminate it.
+func (h *Hub) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	go func() {
+		defer close(h.done)
+		h.listen(ctx)
+	}()
+	slog.Info("event hub started", "replay_size", len(h.ring))
+}
+
+// Stop closes the database connection and every subscription.
+func (h *Hub) Stop() {
+	h.cancel()
+	<-h.done
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		close(sub.ch)
+		delete(h.subs, sub)
+	}
+	slog.Info("event hub stopped")
+}
+
+// Subscribe registers a subscriber. When lastEventID is not empty, replay holds the
+// buffered events after it and resumed reports whether it was found; if not, events
+// were lost and the client must refetch. position is the stream position right after
+// replay, to be sent to the client so that it can resume from there.
+func (h *Hub) Subscribe(lastEventID string) (sub *Subscription, replay []Event, resumed bool, position string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lastEventID != "" {
+		if lastEventID == h.origin {
+			replay, resumed = h.since(-1), true
+		} else {
+			for i := range h.count {
+				if h.at(i).ID == lastEventID {
+					replay, resumed = h.since(i), true
+					break
+				}
+			}
+		}
+	}
+
+	position = h.origin
+	if h.count > 0 {
+		position = h.at(h.count - 1).ID
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, ch: ch}
+	if h.closed {
+		close(ch)
+	} else {
+		h.subs[sub] = struct{}{}
+	}
+	return sub, replay, resumed, position
+}
+
+// Unsubscribe removes a subscriber.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		close(sub.ch)
+		delete(h.subs, sub)
+	}
+}
+
+// at returns the i-th oldest buffered event. Callers hold h.mu.
+func (h *Hub) at(i int) Event {
+	return h.ring[(h.start+i)%len(h.ring)]
+}
+
+// since returns the buffered events after the i-th oldest. Callers hold h.mu.
+func (h *Hub) since(i int) []Event {
+	out := make([]Event, 0, h.count-i-1)
+	for j := i + 1; j < h.count; j++ {
+		out = append(out, h.at(j))
+	}
+	return out
+}
+
+// dispatch buffers an event and hands it to every subscriber, dropping those whose
+// channel is full.
+func (h *Hub) dispatch(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count < len(h.ring) {
+		h.ring[(h.start+h.count)%len(h.ring)] = ev
+		h.count++
+	} else {
+		// The oldest event is dropped, so a stream that started before it can no
+		// longer resume from the origin.
+		h.ring[h.start] = ev
+		h.start = (h.start + 1) % len(h.ring)
+		h.origin = newOrigin()
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- ev:
+		default:
+			close(sub.ch)
+			delete(h.subs, sub)
+		}
+	}
+}
+
+// reset empties the buffer and tells every subscriber that events may have been lost.
+// The reset event carries the new origin as its position.
+func (h *Hub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.start, h.count = 0, 0
+	h.origin = newOrigin()
+	for sub := range h.subs {
+		select {
+		case sub.ch <- Event{ID: h.origin, Type: TypeReset}:
+		default:
+			close(sub.ch)
+			delete(h.subs, sub)
+		}
+	}
+}
+
+// listen receives notifications until ctx is done, reconnecting with backoff. Events
+// published while the connection is down are lost, so every reconnection resets.
+func (h *Hub) listen(ctx context.Context) {
+	backoff := time.Second
+	for connected := false; ; {
+		err := h.receive(ctx, func() {
+			if connected {
+				h.reset()
+			}
+			connected = true
+			backoff = time.Second
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Error("event hub: connection lost", "error", err, "retry_in", backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+// receive opens a connection, calls onListen once it listens and dispatches
+// notifications until the connection fails.
+func (h *Hub) receive(ctx context.Context, onListen func()) error {
+	if h.db.DriverName() == database.DriverSQLite {
+		return h.poll(ctx, onListen)
+	}
+
+	conn, err := pgx.Connect(ctx, h.databaseURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return err
+	}
+	onListen()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, payload, ok := strings.Cut(n.Payload, " ")
+		if !ok {
+			continue
+		}
+		h.deliver(id, payload)
+	}
+}
+
+// poll is receive on SQLite: it dispatches the event_outbox rows written after it
+// started, in ID order, and prunes the old ones. SQLite serializes writers, so rows
+// commit in ID order and none is skipped.
+func (h *Hub) poll(ctx context.Context, onListen func()) error {
+	var last int64
+	if err := h.db.GetContext(ctx, &last, "SELECT COALESCE(MAX(id), 0) FROM event_outbox"); err != nil {
+		return err
+	}
+	onListen()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	pruned := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var rows []struct {
+			ID      int64  `db:"id"`
+			Payload string `db:"payload"`
+		}
+		if err := h.db.SelectContext(ctx, &rows,
+			"SELECT id, payload FROM event_outbox WHERE id > $1 ORDER BY id", last); err != nil {
+			return err
+		}
+		for _, row := range rows {
+			last = row.ID
+			h.deliver(strconv.FormatInt(row.ID, 10), row.Payload)
+		}
+
+		if time.Since(pruned) >= outboxRetention {
+			if _, err := h.db.ExecContext(ctx, "DELETE FROM event_outbox WHERE created_at < $1",
+				time.Now().Add(-outboxRetention)); err != nil {
+				return err
+			}
+			pruned = time.Now()
+		}
+	}
+}
+
+// deliver decodes a published event and dispatches it with the given stream position.
+func (h *Hub) deliver(id, payload string) {
+	var ev Event
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		slog.Warn("event hub: malformed event", "error", err)
+		return
+	}
+	ev.ID = id
+	h.dispatch(ev)
+}
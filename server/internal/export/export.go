@@ -0,0 +1,94 @@
+// Package export writes tabular data as CSV, NDJSON or XLSX one row at a time, so large
+// exports are streamed to the client instead of being built in memory.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Formats supported by NewWriter.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatXLSX   = "xlsx"
+)
+
+// ErrRowLimit is returned by WriteRow once a format cannot hold more rows (XLSX sheets
+// end at 1,048,576 rows). The file written so far is still valid after Close.
+var ErrRowLimit = errors.New("export: row limit of the format reached")
+
+// MaxRows returns the number of data rows format can hold, header excluded, or 0 when
+// it has no limit.
+func MaxRows(format string) int {
+	if format == FormatXLSX {
+		return xlsxMaxRows - 1
+	}
+	return 0
+}
+
+// Writer receives the column names once and then each row. Values are string, int64,
+// float64, bool, time.Time or nil; other types are written with fmt.
+type Writer interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []any) error
+	// Close completes the file. The underlying io.Writer is not closed.
+	Close() error
+}
+
+// NewWriter creates a Writer for format writing to w. sheet names the XLSX worksheet.
+func NewWriter(format string, w io.Writer, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatXLSX:
+		x, err := newXLSXWriter(w, sheet)
+		if err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// Valid reports whether format is supported.
+func Valid(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON || format == FormatXLSX
+}
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv"
+}
+
+// text formats a value for the text-only formats.
+func text(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type ndjsonWriter struct {
+	w       *bufio.Writer
+	columns [][]byte // JSON-encoded keys
+	value   bytes.Buffer
+	enc     *json.Encoder // encodes into value, without HTML escaping
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	n := &ndjsonWriter{w: bufio.NewWriter(w)}
+	n.enc = json.NewEncoder(&n.value)
+	n.enc.SetEscapeHTML(false)
+	return n
+}
+
+func (n *ndjsonWriter) WriteHeader(columns []string) error {
+	n.columns = make([][]byte, len(columns))
+	for i, col := range columns {
+		n.value.Reset()
+		if err := n.enc.Encode(col); err != nil {
+			return err
+		}
+		n.columns[i] = bytes.Clone(bytes.TrimSuffix(n.value.Bytes(), []byte("\n")))
+	}
+	return nil
+}
+
+// WriteRow writes one JSON object with the columns in header order.
+func (n *ndjsonWriter) WriteRow(values []any) error {
+	n.w.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			n.w.WriteByte(',')
+		}
+		n.w.Write(n.columns[i])
+		n.w.WriteByte(':')
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().Format(time.RFC3339)
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		n.value.Reset()
+		if err := n.enc.Encode(v); err != nil {
+			return err
+		}
+		n.w.Write(bytes.TrimSuffix(n.value.Bytes(), []byte("\n")))
+	}
+	n.w.WriteByte('}')
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,174 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxMaxRows is the number of rows an XLSX worksheet can hold, header included.
+const xlsxMaxRows = 1_048_576
+
+// xlsxMaxCell is the number of characters a cell can hold.
+const xlsxMaxCell = 32_767
+
+// excelEpoch is day zero of Excel's 1900 date system, as used for serial dates.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxWriter streams a single-sheet workbook: the fixed package parts are written
+// up front and the worksheet XML is written row by row into the last zip entry.
+// Strings are inline, numbers numeric and times UTC dates.
+type xlsxWriter struct {
+	zip  *zip.Writer
+	w    *bufio.Writer
+	rows int
+}
+
+func newXLSXWriter(w io.Writer, sheet string) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookHead + xmlAttr(sheetName(sheet)) + xlsxWorkbookTail},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, xml.Header+p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &xlsxWriter{zip: zw, w: bufio.NewWriter(f)}
+	x.w.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x, nil
+}
+
+func (x *xlsxWriter) WriteHeader(columns []string) error {
+	values := make([]any, len(columns))
+	for i, col := range columns {
+		values[i] = col
+	}
+	return x.WriteRow(values)
+}
+
+func (x *xlsxWriter) WriteRow(values []any) error {
+	if x.rows == xlsxMaxRows {
+		return ErrRowLimit
+	}
+	x.rows++
+
+	x.w.WriteString(`<row r="`)
+	x.w.WriteString(strconv.Itoa(x.rows))
+	x.w.WriteString(`">`)
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			x.w.WriteString(`<c/>`)
+		case int64:
+			x.w.WriteString(`<c><v>` + strconv.FormatInt(v, 10) + `</v></c>`)
+		case float64:
+			x.w.WriteString(`<c><v>` + strconv.FormatFloat(v, 'f', -1, 64) + `</v></c>`)
+		case bool:
+			b := "0"
+			if v {
+				b = "1"
+			}
+			x.w.WriteString(`<c t="b"><v>` + b + `</v></c>`)
+		case time.Time:
+			serial := v.UTC().Sub(excelEpoch).Seconds() / 86400
+			x.w.WriteString(`<c s="1"><v>` + strconv.FormatFloat(serial, 'f', -1, 64) + `</v></c>`)
+		default:
+			s := text(v)
+			if len(s) > xlsxMaxCell {
+				s = strings.ToValidUTF8(s[:xlsxMaxCell], "")
+			}
+			x.w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(x.w, []byte(s)); err != nil {
+				return err
+			}
+			x.w.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := x.w.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	x.w.WriteString(`</sheetData></worksheet>`)
+	if err := x.w.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// sheetName trims name to Excel's 31 characters without the characters it forbids.
+func sheetName(name string) string {
+	out := make([]rune, 0, len(name))
+	for _, r := range name {
+		switch r {
+		case '\\', '/', '?', '*', '[', ']', ':':
+			continue
+		}
+		if len(out) == 31 {
+			break
+		}
+		out = append(out, r)
+	}
+	if len(out) == 0 {
+		return "Sheet1"
+	}
+	return string(out)
+}
+
+func xmlAttr(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const (
+	xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	xlsxRootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbookHead = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="`
+	xlsxWorkbookTail = `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	// Style 1 formats date cells as yyyy-mm-dd hh:mm:ss.
+	xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`
+)
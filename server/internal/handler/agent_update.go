@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/repository"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+)
+
+// releaseTransferTimeout replaces the server read and write timeouts while a release
+// artifact is uploaded or downloaded.
+const releaseTransferTimeout = 10 * time.Minute
+
+// AgentUpdateHandler handles agent releases, rollouts and the agent update endpoints.
+type AgentUpdateHandler struct {
+	service     *service.AgentUpdateService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewAgentUpdateHandler creates a new AgentUpdateHandler.
+func NewAgentUpdateHandler(svc *service.AgentUpdateService, auditLogger *middleware.AuditLogger) *AgentUpdateHandler {
+	return &AgentUpdateHandler{service: svc, auditLogger: auditLogger}
+}
+
+// authenticatedDevice returns the device ID set by middleware.DeviceAuth.
+// It writes an error response and returns false if there is none.
+func authenticatedDevice(c *gin.Context) (uuid.UUID, bool) {
+	raw, _ := c.Get("device_id")
+	deviceID, ok := raw.(uuid.UUID)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "device not authenticated"})
+	}
+	return deviceID, ok
+}
+
+// Check tells an agent which release it should run.
+// Query params: os, arch, channel (default stable) and version (the running version).
+func (h *AgentUpdateHandler) Check(c *gin.Context) {
+	deviceID, ok := authenticatedDevice(c)
+	if !ok {
+		return
+	}
+	goos, arch, version := c.Query("os"), c.Query("arch"), c.Query("version")
+	if goos == "" || arch == "" || version == "" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "os, arch and version are required"})
+		return
+	}
+
+	resp, err := h.service.Check(c.Request.Context(), deviceID, goos, arch, c.Query("channel"), version)
+	if err != nil {
+		slog.Error("failed to check agent update", "error", err, "device_id", deviceID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to check for updates"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Download streams a release artifact to an agent.
+func (h *AgentUpdateHandler) Download(c *gin.Context) {
+	deviceID, ok := authenticatedDevice(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid release ID"})
+		return
+	}
+	rel, err := h.service.GetRelease(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "release not found"})
+		return
+	}
+
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(releaseTransferTimeout)); err != nil {
+		slog.Debug("release download: cannot extend write deadline", "error", err)
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(rel.SizeBytes, 10))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=agent-%s-%s-%s", rel.Version, rel.OS, rel.Arch))
+	c.Status(http.StatusOK)
+	// The status line has already been sent: a failed download leaves the file short,
+	// which the agent detects from the size and checksum.
+	if err := h.service.WriteArtifact(c.Request.Context(), id, c.Writer); err != nil {
+		slog.Error("failed to send release", "error", err, "release_id", id, "device_id", deviceID)
+	}
+}
+
+// Report records the outcome of an agent update.
+func (h *AgentUpdateHandler) Report(c *gin.Context) {
+	deviceID, ok := authenticatedDevice(c)
+	if !ok {
+		return
+	}
+	var req dto.AgentUpdateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := h.service.Report(c.Request.Context(), deviceID, &req); err != nil {
+		slog.Error("failed to record update report", "error", err, "device_id", deviceID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to record report"})
+		return
+	}
+
+	if req.Status == "failed" {
+		slog.Warn("agent update failed", "device_id", deviceID, "from", req.FromVersion, "to", req.ToVersion, "error", req.Error)
+	} else {
+		slog.Info("agent updated", "device_id", deviceID, "from", req.FromVersion, "to", req.ToVersion)
+	}
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "report received"})
+}
+
+// ListReleases returns all agent releases.
+func (h *AgentUpdateHandler) ListReleases(c *gin.Context) {
+	resp, err := h.service.ListReleases(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list releases", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list releases"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UploadRelease publishes a signed agent build, sent as the multipart field "file" with
+// the form fields version, os, arch, channel, signature and notes.
+func (h *AgentUpdateHandler) UploadRelease(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	if err := http.NewResponseController(c.Writer).SetReadDeadline(time.Now().Add(releaseTransferTimeout)); err != nil {
+		slog.Debug("release upload: cannot extend read deadline", "error", err)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "a file is required in the multipart field \"file\""})
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		slog.Error("failed to open release file", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to read file"})
+		return
+	}
+	defer f.Close()
+
+	rel, err := h.service.CreateRelease(c.Request.Context(), service.ReleaseUpload{
+		Version:   c.PostForm("version"),
+		OS:        c.PostForm("os"),
+		Arch:      c.PostForm("arch"),
+		Channel:   c.PostForm("channel"),
+		Signature: c.PostForm("signature"),
+		Notes:     c.PostForm("notes"),
+		CreatedBy: &userID,
+	}, f)
+	switch {
+	case errors.Is(err, service.ErrInvalidRelease), errors.Is(err, service.ErrReleaseSigningDisabled):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, repository.ErrReleaseExists):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "this version was already published for the platform and channel"})
+		return
+	case err != nil:
+		slog.Error("failed to create release", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to create release"})
+		return
+	}
+
+	h.auditLogger.Log(c, "agent_release.create", "agent_release", &rel.ID, map[string]interface{}{
+		"version": rel.Version,
+		"os":      rel.OS,
+		"arch":    rel.Arch,
+		"channel": rel.Channel,
+		"sha256":  rel.SHA256,
+	})
+	c.JSON(http.StatusCreated, rel)
+}
+
+// DeleteRelease removes a release and its rollouts.
+func (h *AgentUpdateHandler) DeleteRelease(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid release ID"})
+		return
+	}
+
+	if err := h.service.DeleteRelease(c.Request.Context(), id); err != nil {
+		slog.Error("failed to delete release", "error", err, "release_id", id)
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "release not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "agent_release.delete", "agent_release", &id, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "release deleted"})
+}
+
+// ListRollouts returns all rollouts.
+func (h *AgentUpdateHandler) ListRollouts(c *gin.Context) {
+	resp, err := h.service.ListRollouts(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list rollouts", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list rollouts"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateRollout starts offering a release to a device, a department or every device.
+func (h *AgentUpdateHandler) CreateRollout(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	var req dto.AgentRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	ro, err := h.service.CreateRollout(c.Request.Context(), &req, &userID)
+	if err != nil {
+		h.rolloutError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "agent_rollout.create", "agent_rollout", &ro.ID, rolloutAuditDetails(&req))
+	c.JSON(http.StatusCreated, ro)
+}
+
+// UpdateRollout changes a rollout; devices that failed to install it are offered it again.
+func (h *AgentUpdateHandler) UpdateRollout(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid rollout ID"})
+		return
+	}
+	var req dto.AgentRolloutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	ro, err := h.service.UpdateRollout(c.Request.Context(), id, &req)
+	if err != nil {
+		h.rolloutError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "agent_rollout.update", "agent_rollout", &id, rolloutAuditDetails(&req))
+	c.JSON(http.StatusOK, ro)
+}
+
+// DeleteRollout stops offering a rollout's release.
+func (h *AgentUpdateHandler) DeleteRollout(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid rollout ID"})
+		return
+	}
+
+	if err := h.service.DeleteRollout(c.Request.Context(), id); err != nil {
+		slog.Error("failed to delete rollout", "error", err, "rollout_id", id)
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "rollout not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "agent_rollout.delete", "agent_rollout", &id, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "rollout deleted"})
+}
+
+// rolloutError writes the response for a failed rollout create or update.
+func (h *AgentUpdateHandler) rolloutError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidRollout), errors.Is(err, repository.ErrRolloutReference):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	case err.Error() == "rollout not found":
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	default:
+		slog.Error("failed to save rollout", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to save rollout"})
+	}
+}
+
+// rolloutAuditDetails returns the audit details of a rollout request.
+func rolloutAuditDetails(req *dto.AgentRolloutRequest) map[string]interface{} {
+	details := map[string]interface{}{"release_id": req.ReleaseID, "paused": req.Paused}
+	if req.Percentage != nil {
+		details["percentage"] = *req.Percentage
+	}
+	if req.DepartmentID != nil {
+		details["department_id"] = *req.DepartmentID
+	}
+	if req.DeviceID != nil {
+		details["device_id"] = *req.DeviceID
+	}
+	return details
+}
+
+// ListReports returns agent update reports.
+// Query params: status (success or failed), device_id, page, limit.
+func (h *AgentUpdateHandler) ListReports(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit > maxPaginationLimit {
+		limit = maxPaginationLimit
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	status := c.Query("status")
+	if status != "" && status != "success" && status != "failed" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid status, must be success or failed"})
+		return
+	}
+	var deviceID *uuid.UUID
+	if raw := c.Query("device_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid device_id"})
+			return
+		}
+		deviceID = &id
+	}
+
+	resp, err := h.service.ListReports(c.Request.Context(), status, deviceID, page, limit)
+	if err != nil {
+		slog.Error("failed to list update reports", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list update reports"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
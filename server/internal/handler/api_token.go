@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// APITokenHandler handles personal API token management.
+type APITokenHandler struct {
+	service     *service.APITokenService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewAPITokenHandler creates a new APITokenHandler.
+func NewAPITokenHandler(svc *service.APITokenService, auditLogger *middleware.AuditLogger) *APITokenHandler {
+	return &APITokenHandler{service: svc, auditLogger: auditLogger}
+}
+
+// ListOwn returns the current user's API tokens.
+func (h *APITokenHandler) ListOwn(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.service.ListOwn(c.Request.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list api tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list api tokens"})
+		return
+	}
+
+	resp := dto.APITokenListResponse{Tokens: make([]dto.APITokenResponse, 0, len(tokens)), Total: len(tokens)}
+	for i := range tokens {
+		resp.Tokens = append(resp.Tokens, apiTokenResponse(&tokens[i], ""))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Create issues a new API token for the current user. The secret is returned only once.
+func (h *APITokenHandler) Create(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var req dto.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	raw, token, err := h.service.Create(c.Request.Context(), userID, middleware.GrantsFrom(c), middleware.IsSuperAdmin(c), req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.auditLogger.Log(c, "api_token.create", "api_token", &token.ID, map[string]interface{}{
+		"name":       token.Name,
+		"scopes":     token.Scopes,
+		"expires_at": token.ExpiresAt,
+	})
+	c.JSON(http.StatusCreated, dto.CreateAPITokenResponse{Token: raw, APITokenResponse: apiTokenResponse(token, "")})
+}
+
+// RevokeOwn revokes one of the current user's API tokens.
+func (h *APITokenHandler) RevokeOwn(c *gin.Context) {
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid token ID"})
+		return
+	}
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeOwn(c.Request.Context(), userID, tokenID); err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "api token not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "api_token.revoke", "api_token", &tokenID, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "api token revoked"})
+}
+
+// ListAll returns the API tokens of every user of the organization (requires user.manage).
+func (h *APITokenHandler) ListAll(c *gin.Context) {
+	tokens, err := h.service.ListAll(c.Request.Context(), middleware.OrganizationFrom(c))
+	if err != nil {
+		slog.Error("failed to list api tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list api tokens"})
+		return
+	}
+
+	resp := dto.APITokenListResponse{Tokens: make([]dto.APITokenResponse, 0, len(tokens)), Total: len(tokens)}
+	for i := range tokens {
+		resp.Tokens = append(resp.Tokens, apiTokenResponse(&tokens[i].APIToken, tokens[i].Username))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke revokes the API token of any user of the organization (requires user.manage).
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid token ID"})
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), tokenID, middleware.OrganizationFrom(c)); err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "api token not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "api_token.revoke", "api_token", &tokenID, map[string]interface{}{"by_admin": true})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "api token revoked"})
+}
+
+func apiTokenResponse(t *models.APIToken, username string) dto.APITokenResponse {
+	return dto.APITokenResponse{
+		ID:          t.ID,
+		Name:        t.Name,
+		TokenPrefix: t.TokenPrefix,
+		Scopes:      strings.Fields(t.Scopes),
+		UserID:      t.UserID,
+		Username:    username,
+		ExpiresAt:   t.ExpiresAt,
+		LastUsedAt:  t.LastUsedAt,
+		LastUsedIP:  t.LastUsedIP,
+		RevokedAt:   t.RevokedAt,
+		CreatedAt:   t.CreatedAt,
+	}
+}
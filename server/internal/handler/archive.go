@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"inventario/server/internal/archive"
+	"inventario/shared/dto"
+)
+
+// ArchiveHandler lists the archives of purged history.
+type ArchiveHandler struct {
+	archiver *archive.Archiver // nil when purged history is not archived
+}
+
+// NewArchiveHandler creates a new ArchiveHandler.
+func NewArchiveHandler(archiver *archive.Archiver) *ArchiveHandler {
+	return &ArchiveHandler{archiver: archiver}
+}
+
+// List returns the manifests of the archives, newest first. They are restored with
+// the archive-restore command.
+func (h *ArchiveHandler) List(c *gin.Context) {
+	resp := dto.ArchiveListResponse{Archives: []dto.Archive{}}
+	if h.archiver == nil {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	manifests, err := h.archiver.List(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list archives", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list archives"})
+		return
+	}
+	resp.Enabled = true
+	resp.Location = h.archiver.String()
+	for _, m := range manifests {
+		a := dto.Archive{ID: m.ID, CreatedAt: m.CreatedAt, RetentionDays: m.RetentionDays, Files: []dto.ArchiveFile{}}
+		for _, f := range m.Files {
+			a.Files = append(a.Files, dto.ArchiveFile{Table: f.Table, Name: f.Name, Rows: f.Rows, Bytes: f.Bytes, SHA256: f.SHA256})
+		}
+		resp.Archives = append(resp.Archives, a)
+	}
+	c.JSON(http.StatusOK, resp)
+}
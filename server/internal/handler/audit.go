@@ -1,30 +1,38 @@
 package handler
 
 import (
+	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"inventario/server/internal/auditlog"
+	"inventario/server/internal/middleware"
 	"inventario/server/internal/repository"
 	"inventario/shared/dto"
 )
 
 // AuditLogHandler handles audit log queries.
 type AuditLogHandler struct {
-	repo *repository.AuditLogRepository
+	repo   repository.AuditLogStore
+	writer *auditlog.Writer
 }
 
 // NewAuditLogHandler creates a new AuditLogHandler.
-func NewAuditLogHandler(repo *repository.AuditLogRepository) *AuditLogHandler {
-	return &AuditLogHandler{repo: repo}
+func NewAuditLogHandler(repo repository.AuditLogStore, writer *auditlog.Writer) *AuditLogHandler {
+	return &AuditLogHandler{repo: repo, writer: writer}
 }
 
-// ListAuditLogs returns audit logs with optional filtering.
+// ListAuditLogs returns the audit logs of the organization with optional filtering.
+// Super-admins also see entries without an organization.
 // Query params: user_id, action, resource_type, resource_id, limit, offset
 func (h *AuditLogHandler) ListAuditLogs(c *gin.Context) {
-	filters := make(map[string]interface{})
+	filters := map[string]interface{}{
+		"organization_id":    middleware.OrganizationFrom(c),
+		"include_unassigned": middleware.IsSuperAdmin(c),
+	}
 
 	// Parse filters
 	if userIDStr := c.Query("user_id"); userIDStr != "" {
@@ -79,6 +87,7 @@ func (h *AuditLogHandler) ListAuditLogs(c *gin.Context) {
 			IPAddress:    log.IPAddress,
 			UserAgent:    log.UserAgent,
 			CreatedAt:    log.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			Seq:          log.Seq,
 		})
 	}
 
@@ -101,7 +110,7 @@ func (h *AuditLogHandler) GetResourceAuditLogs(c *gin.Context) {
 		limit = 20
 	}
 
-	logs, err := h.repo.GetByResourceID(c.Request.Context(), resourceType, resourceID, limit)
+	logs, err := h.repo.GetByResourceID(c.Request.Context(), middleware.OrganizationFrom(c), resourceType, resourceID, limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to fetch audit logs"})
 		return
@@ -125,8 +134,49 @@ func (h *AuditLogHandler) GetResourceAuditLogs(c *gin.Context) {
 			IPAddress:    log.IPAddress,
 			UserAgent:    log.UserAgent,
 			CreatedAt:    log.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			Seq:          log.Seq,
 		})
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// VerifyChain walks the audit hash chain and reports the first broken link.
+func (h *AuditLogHandler) VerifyChain(c *gin.Context) {
+	report, err := h.repo.Verify(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to verify audit chain", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to verify audit logs"})
+		return
+	}
+
+	resp := dto.AuditVerifyResponse{
+		Valid:       report.Valid,
+		Checked:     report.Checked,
+		Unchained:   report.Unchained,
+		Checkpoints: report.Checkpoints,
+	}
+	if report.Anchor != nil {
+		resp.AnchorSeq = report.Anchor.LastSeq
+	}
+	if report.Broken != nil {
+		slog.Warn("audit chain broken", "seq", report.Broken.Seq, "id", report.Broken.ID, "reason", report.Broken.Reason)
+		resp.Broken = &dto.AuditChainBreak{Seq: report.Broken.Seq, ID: report.Broken.ID, Reason: report.Broken.Reason}
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PipelineStats reports the audit writer counters of this API instance.
+func (h *AuditLogHandler) PipelineStats(c *gin.Context) {
+	st := h.writer.Stats()
+	c.JSON(http.StatusOK, dto.AuditPipelineStatsResponse{
+		Queued:   st.Queued,
+		Written:  st.Written,
+		Retries:  st.Retries,
+		Spilled:  st.Spilled,
+		Replayed: st.Replayed,
+		Dropped:  st.Dropped,
+		Rejected: st.Rejected,
+		Pending:  st.Pending,
+	})
+}
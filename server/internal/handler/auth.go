@@ -2,12 +2,17 @@ package handler
 
 import (
 	"crypto/subtle"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"inventario/server/internal/middleware"
+	"inventario/server/internal/repository"
 	"inventario/server/internal/service"
 	"inventario/shared/dto"
 )
@@ -25,25 +30,49 @@ func setSessionCookie(c *gin.Context, value string, maxAge int) {
 	})
 }
 
+// secondsUntil returns the cookie Max-Age for a token that expires at t.
+func secondsUntil(t time.Time) int {
+	return int(time.Until(t).Seconds())
+}
+
+// clientInfo describes the client a session is issued to.
+func clientInfo(c *gin.Context) service.ClientInfo {
+	return service.ClientInfo{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
 // AuthHandler handles enrollment, login, and logout.
 type AuthHandler struct {
 	service       *service.AuthService
+	sessions      *service.SessionService
 	enrollmentKey string
 	auditLogger   *middleware.AuditLogger
 }
 
 // NewAuthHandler creates a new AuthHandler.
-func NewAuthHandler(svc *service.AuthService, enrollmentKey string, auditLogger *middleware.AuditLogger) *AuthHandler {
-	return &AuthHandler{service: svc, enrollmentKey: enrollmentKey, auditLogger: auditLogger}
+func NewAuthHandler(svc *service.AuthService, sessions *service.SessionService, enrollmentKey string, auditLogger *middleware.AuditLogger) *AuthHandler {
+	return &AuthHandler{service: svc, sessions: sessions, enrollmentKey: enrollmentKey, auditLogger: auditLogger}
 }
 
-// Enroll registers a new agent or re-enrolls an existing one.
+// Enroll registers a new agent or re-enrolls an existing one. The enrollment key
+// chooses the organization: ENROLLMENT_KEY enrolls into the default organization,
+// organization keys into their own.
 func (h *AuthHandler) Enroll(c *gin.Context) {
 	key := c.GetHeader("X-Enrollment-Key")
-	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(h.enrollmentKey)) != 1 {
+	if key == "" {
 		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid enrollment key"})
 		return
 	}
+	orgID := repository.DefaultOrganizationID
+	if h.enrollmentKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(h.enrollmentKey)) != 1 {
+		var err error
+		if orgID, err = h.service.EnrollmentOrganization(c.Request.Context(), key); err != nil {
+			if !errors.Is(err, service.ErrInvalidEnrollmentKey) {
+				slog.Error("enrollment key lookup failed", "error", err)
+			}
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid enrollment key"})
+			return
+		}
+	}
 
 	var req dto.EnrollRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -51,7 +80,7 @@ func (h *AuthHandler) Enroll(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.service.Enroll(c.Request.Context(), &req)
+	resp, err := h.service.Enroll(c.Request.Context(), orgID, &req)
 	if err != nil {
 		slog.Error("enrollment failed", "error", err, "hostname", req.Hostname)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "enrollment failed"})
@@ -70,22 +99,125 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	tokenString, err := h.service.Login(c.Request.Context(), &req)
+	result, err := h.service.Login(c.Request.Context(), &req, clientInfo(c))
 	if err != nil {
 		slog.Warn("login failed", "username", req.Username, "ip", c.ClientIP())
-		h.auditLogger.LogAuth(c, "auth.login", req.Username, false, nil)
+		// A locked account gets the same answer as a wrong password or an unknown user,
+		// so that the lockout does not reveal which usernames exist; the audit log has
+		// the reason.
+		var locked *service.AccountLockedError
+		if errors.As(err, &locked) {
+			auditLocked(c, h.auditLogger, "auth.login", req.Username, locked)
+		} else {
+			h.auditLogger.LogAuth(c, "auth.login", req.Username, false, nil)
+		}
 		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid credentials"})
 		return
 	}
 
-	setSessionCookie(c, tokenString, 86400)
-	slog.Info("user logged in", "username", req.Username)
-	h.auditLogger.LogAuth(c, "auth.login", req.Username, true, nil)
-	c.JSON(http.StatusOK, dto.MessageResponse{Message: "login successful"})
+	h.finishLogin(c, result)
 }
 
-// Logout clears the session cookie.
+// ChangePassword sets a new password for a user who must change it before signing in,
+// then continues the login like Login.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req dto.PasswordChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	result, err := h.service.ChangeExpiredPassword(c.Request.Context(), req.Challenge, req.NewPassword, clientInfo(c))
+	if err != nil {
+		username := ""
+		if result != nil && result.User != nil {
+			username = result.User.Username
+		}
+		switch {
+		case errors.Is(err, service.ErrPasswordPolicy):
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, service.ErrInvalidMFAChallenge):
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+		default:
+			slog.Error("password change failed", "error", err, "username", username)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to change password"})
+		}
+		return
+	}
+
+	h.auditLogger.LogAuth(c, "auth.password_change", result.User.Username, true, map[string]interface{}{"forced": true})
+	h.finishLogin(c, result)
+}
+
+// finishLogin answers a successful password step: it either hands out the challenge for the
+// next step or sets the session cookie.
+func (h *AuthHandler) finishLogin(c *gin.Context, result *service.LoginResult) {
+	username := result.User.Username
+	c.Set("user_id", result.User.ID.String())
+	c.Set("organization_id", result.User.OrganizationID)
+
+	// Password accepted, but a new password must be chosen before anything else.
+	if result.PasswordChange != "" {
+		slog.Info("password change required", "username", username)
+		h.auditLogger.LogAuth(c, "auth.password_change_required", username, true, nil)
+		c.JSON(http.StatusOK, dto.LoginResponse{
+			Message:                "password change required",
+			PasswordChangeRequired: true,
+			Challenge:              result.PasswordChange,
+		})
+		return
+	}
+
+	// Password accepted, but the session is only issued after the second factor.
+	if result.MFA != nil {
+		slog.Info("second factor required", "username", username, "setup_required", result.MFA.SetupRequired)
+		h.auditLogger.LogAuth(c, "auth.mfa.challenge", username, true, map[string]interface{}{"setup_required": result.MFA.SetupRequired})
+		c.JSON(http.StatusOK, dto.LoginResponse{
+			Message:          "second factor required",
+			MFARequired:      true,
+			MFASetupRequired: result.MFA.SetupRequired,
+			Challenge:        result.MFA.Token,
+		})
+		return
+	}
+
+	setSessionCookie(c, result.Token, secondsUntil(result.ExpiresAt))
+	slog.Info("user logged in", "username", username)
+	h.auditLogger.LogAuth(c, "auth.login", username, true, nil)
+	c.JSON(http.StatusOK, dto.LoginResponse{Message: "login successful"})
+}
+
+// auditLocked audits a login attempt refused by an account lockout. The attempt that
+// triggers the lockout is additionally audited as auth.lockout.
+func auditLocked(c *gin.Context, auditLogger *middleware.AuditLogger, action, username string, locked *service.AccountLockedError) {
+	details := map[string]interface{}{"reason": "locked", "locked_until": locked.Until}
+	auditLogger.LogAuth(c, action, username, false, details)
+	if locked.New {
+		auditLogger.LogAuth(c, "auth.lockout", username, true, map[string]interface{}{"locked_until": locked.Until})
+	}
+}
+
+// respondLocked answers a second-factor attempt refused by an account lockout and
+// audits it. The caller already proved the password, so the lockout is no longer a
+// secret.
+func respondLocked(c *gin.Context, auditLogger *middleware.AuditLogger, action, username string, locked *service.AccountLockedError) {
+	auditLocked(c, auditLogger, action, username, locked)
+	c.Header("Retry-After", strconv.Itoa(max(secondsUntil(locked.Until), 1)))
+	c.JSON(http.StatusLocked, dto.ErrorResponse{Error: "account temporarily locked, try again later"})
+}
+
+// Logout ends the current session server-side and clears the session cookie.
 func (h *AuthHandler) Logout(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	if id := currentSessionID(c); id != uuid.Nil {
+		if err := h.sessions.Revoke(c.Request.Context(), userID, id, service.SessionRevokedLogout); err != nil {
+			slog.Warn("failed to revoke session on logout", "error", err, "session_id", id)
+		}
+	}
+
 	username := ""
 	if val, exists := c.Get("username"); exists {
 		if u, ok := val.(string); ok {
@@ -99,7 +231,23 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "logout successful"})
 }
 
-// Me returns the currently authenticated user's information.
+// Refresh extends the current session's idle expiry and re-issues the session cookie
+// with the user's current username and role.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	token, session, err := h.sessions.Refresh(c.Request.Context(), currentSessionID(c), clientInfo(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "session expired or revoked"})
+		return
+	}
+
+	setSessionCookie(c, token, secondsUntil(session.AbsoluteExpiresAt))
+	c.JSON(http.StatusOK, dto.SessionRefreshResponse{
+		ExpiresAt:         session.ExpiresAt,
+		AbsoluteExpiresAt: session.AbsoluteExpiresAt,
+	})
+}
+
+// Me returns the currently authenticated user's information and effective permissions.
 func (h *AuthHandler) Me(c *gin.Context) {
 	sub, _ := c.Get("user_id")
 	username, _ := c.Get("username")
@@ -121,9 +269,27 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
+	grants := middleware.GrantsFrom(c)
+	permissions := make(map[string]dto.PermissionScope, len(grants))
+	for p, scope := range grants {
+		permissions[string(p)] = dto.PermissionScope{All: scope.All, DepartmentIDs: scope.DepartmentIDs}
+	}
+
+	orgID := middleware.OrganizationFrom(c)
+	org, err := h.service.GetOrganization(c.Request.Context(), orgID)
+	if err != nil {
+		slog.Error("failed to load organization", "error", err, "organization_id", orgID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to load organization"})
+		return
+	}
+
 	c.JSON(http.StatusOK, dto.MeResponse{
-		ID:       subStr,
-		Username: usernameStr,
-		Role:     roleStr,
+		ID:               subStr,
+		Username:         usernameStr,
+		Role:             roleStr,
+		Permissions:      permissions,
+		OrganizationID:   org.ID,
+		OrganizationName: org.Name,
+		SuperAdmin:       middleware.IsSuperAdmin(c),
 	})
 }
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"inventario/server/internal/authz"
+	"inventario/server/internal/middleware"
 	"inventario/server/internal/service"
 	"inventario/shared/dto"
 )
@@ -20,9 +22,10 @@ func NewDashboardHandler(svc *service.DashboardService) *DashboardHandler {
 	return &DashboardHandler{service: svc}
 }
 
-// GetStats returns aggregated device statistics (total, online, offline).
+// GetStats returns aggregated device statistics (total, online, offline) for the
+// devices the caller may read.
 func (h *DashboardHandler) GetStats(c *gin.Context) {
-	resp, err := h.service.GetStats(c.Request.Context())
+	resp, err := h.service.GetStats(c.Request.Context(), middleware.GrantsFrom(c).Scope(authz.DeviceRead))
 	if err != nil {
 		slog.Error("failed to get dashboard stats", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to get dashboard stats"})
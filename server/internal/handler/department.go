@@ -23,9 +23,9 @@ func NewDepartmentHandler(svc *service.DepartmentService, auditLogger *middlewar
 	return &DepartmentHandler{service: svc, auditLogger: auditLogger}
 }
 
-// ListDepartments returns all departments.
+// ListDepartments returns the departments of the organization.
 func (h *DepartmentHandler) ListDepartments(c *gin.Context) {
-	resp, err := h.service.List(c.Request.Context())
+	resp, err := h.service.List(c.Request.Context(), middleware.OrganizationFrom(c))
 	if err != nil {
 		slog.Error("failed to list departments", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list departments"})
@@ -42,18 +42,21 @@ func (h *DepartmentHandler) CreateDepartment(c *gin.Context) {
 		return
 	}
 
-	dept, err := h.service.Create(c.Request.Context(), req.Name)
+	dept, err := h.service.Create(c.Request.Context(), middleware.OrganizationFrom(c), req.Name, req.InactiveDays)
 	if err != nil {
 		slog.Error("failed to create department", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to create department"})
 		return
 	}
 
-	h.auditLogger.Log(c, "department.create", "department", &dept.ID, map[string]interface{}{"name": dept.Name})
+	h.auditLogger.Log(c, "department.create", "department", &dept.ID, map[string]interface{}{
+		"name":          dept.Name,
+		"inactive_days": dept.InactiveDays,
+	})
 	c.JSON(http.StatusCreated, dept)
 }
 
-// UpdateDepartment renames an existing department.
+// UpdateDepartment renames an existing department and replaces its inactive threshold.
 func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 	id, err := uuid.Parse(c.Param("id"))
 	if err != nil {
@@ -67,14 +70,17 @@ func (h *DepartmentHandler) UpdateDepartment(c *gin.Context) {
 		return
 	}
 
-	dept, err := h.service.Update(c.Request.Context(), id, req.Name)
+	dept, err := h.service.Update(c.Request.Context(), id, middleware.OrganizationFrom(c), req.Name, req.InactiveDays)
 	if err != nil {
 		slog.Error("failed to update department", "error", err, "department_id", id)
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "department not found"})
 		return
 	}
 
-	h.auditLogger.Log(c, "department.update", "department", &id, map[string]interface{}{"new_name": req.Name})
+	h.auditLogger.Log(c, "department.update", "department", &id, map[string]interface{}{
+		"new_name":      req.Name,
+		"inactive_days": dept.InactiveDays,
+	})
 	c.JSON(http.StatusOK, dept)
 }
 
@@ -86,7 +92,7 @@ func (h *DepartmentHandler) DeleteDepartment(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+	if err := h.service.Delete(c.Request.Context(), id, middleware.OrganizationFrom(c)); err != nil {
 		slog.Error("failed to delete department", "error", err, "department_id", id)
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "department not found"})
 		return
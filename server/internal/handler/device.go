@@ -2,45 +2,46 @@ package handler
 
 import (
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
+	"inventario/server/internal/authz"
+	"inventario/server/internal/export"
+	"inventario/server/internal/importer"
 	"inventario/server/internal/middleware"
 	"inventario/server/internal/repository"
 	"inventario/server/internal/service"
 	"inventario/shared/dto"
+	"inventario/shared/models"
 )
 
 const maxPaginationLimit = 200 // caps ?limit= for all paginated endpoints
 
+const maxMetricsDays = 90 // caps ?days= of the device metrics
+
 // DeviceHandler handles device listing and detail endpoints.
 type DeviceHandler struct {
 	service      *service.DeviceService
 	auditLogger  *middleware.AuditLogger
-	activityRepo *repository.DeviceActivityRepository
+	activityRepo repository.DeviceActivityStore
 }
 
-// resolveDeviceID tries to parse the :id param as UUID; if it fails, treats it as a hostname.
-func (h *DeviceHandler) resolveDeviceID(c *gin.Context) (uuid.UUID, error) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err == nil {
-		return id, nil
-	}
-	// Fallback: treat as hostname
-	return h.service.ResolveDeviceID(c.Request.Context(), idStr)
+// resolveDeviceID resolves the :id param (UUID or hostname) to a device within the
+// caller's scope for the given permission.
+func (h *DeviceHandler) resolveDeviceID(c *gin.Context, p authz.Permission) (uuid.UUID, error) {
+	return h.service.ResolveDeviceID(c.Request.Context(), c.Param("id"), middleware.GrantsFrom(c).Scope(p))
 }
 
 // NewDeviceHandler creates a new DeviceHandler.
-func NewDeviceHandler(svc *service.DeviceService, auditLogger *middleware.AuditLogger, activityRepo *repository.DeviceActivityRepository) *DeviceHandler {
+func NewDeviceHandler(svc *service.DeviceService, auditLogger *middleware.AuditLogger, activityRepo repository.DeviceActivityStore) *DeviceHandler {
 	return &DeviceHandler{service: svc, auditLogger: auditLogger, activityRepo: activityRepo}
 }
 
@@ -60,13 +61,15 @@ func (h *DeviceHandler) ListDevices(c *gin.Context) {
 		OS:           c.Query("os"),
 		Status:       c.Query("status"),
 		DepartmentID: c.Query("department_id"),
+		Source:       c.Query("source"),
+		AssetType:    c.Query("asset_type"),
 		Sort:         c.Query("sort"),
 		Order:        c.Query("order"),
 		Page:         page,
 		Limit:        limit,
 	}
 
-	resp, err := h.service.ListDevices(c.Request.Context(), params)
+	resp, err := h.service.ListDevices(c.Request.Context(), params, middleware.GrantsFrom(c).Scope(authz.DeviceRead))
 	if err != nil {
 		slog.Error("failed to list devices", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list devices"})
@@ -79,11 +82,12 @@ func (h *DeviceHandler) ListDevices(c *gin.Context) {
 // GetDevice returns full details for a single device, including hardware, disks, NICs, and software.
 func (h *DeviceHandler) GetDevice(c *gin.Context) {
 	idStr := c.Param("id")
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceRead)
 
 	// Try UUID first
 	id, err := uuid.Parse(idStr)
 	if err == nil {
-		detail, err := h.service.GetDeviceDetail(c.Request.Context(), id)
+		detail, err := h.service.GetDeviceDetail(c.Request.Context(), id, scope)
 		if err != nil {
 			slog.Error("failed to get device detail", "error", err, "device_id", id)
 			if isNotFound(err) {
@@ -98,7 +102,7 @@ func (h *DeviceHandler) GetDevice(c *gin.Context) {
 	}
 
 	// Fallback: treat as hostname
-	detail, err := h.service.GetDeviceDetailByHostname(c.Request.Context(), idStr)
+	detail, err := h.service.GetDeviceDetailByHostname(c.Request.Context(), idStr, scope)
 	if err != nil {
 		slog.Error("failed to get device detail by hostname", "error", err, "hostname", idStr)
 		if isNotFound(err) {
@@ -113,7 +117,8 @@ func (h *DeviceHandler) GetDevice(c *gin.Context) {
 
 // UpdateStatus changes a device's status (active / inactive).
 func (h *DeviceHandler) UpdateStatus(c *gin.Context) {
-	id, err := h.resolveDeviceID(c)
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceWrite)
+	id, err := h.resolveDeviceID(c, authz.DeviceWrite)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
 		return
@@ -125,7 +130,7 @@ func (h *DeviceHandler) UpdateStatus(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateStatus(c.Request.Context(), id, req.Status); err != nil {
+	if err := h.service.UpdateStatus(c.Request.Context(), id, req.Status, scope); err != nil {
 		slog.Error("failed to update device status", "error", err, "device_id", id)
 		if isNotFound(err) {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
@@ -141,7 +146,8 @@ func (h *DeviceHandler) UpdateStatus(c *gin.Context) {
 
 // UpdateDepartment assigns or removes a department from a device.
 func (h *DeviceHandler) UpdateDepartment(c *gin.Context) {
-	id, err := h.resolveDeviceID(c)
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceWrite)
+	id, err := h.resolveDeviceID(c, authz.DeviceWrite)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
 		return
@@ -153,7 +159,11 @@ func (h *DeviceHandler) UpdateDepartment(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateDepartment(c.Request.Context(), id, req.DepartmentID); err != nil {
+	if err := h.service.UpdateDepartment(c.Request.Context(), id, req.DepartmentID, scope); err != nil {
+		if errors.Is(err, service.ErrDepartmentOutOfScope) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
 		slog.Error("failed to update device department", "error", err, "device_id", id)
 		if isNotFound(err) {
 			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
@@ -167,15 +177,83 @@ func (h *DeviceHandler) UpdateDepartment(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "department updated"})
 }
 
+// CreateManualAsset creates an agentless device record (printer, monitor, switch, ...).
+func (h *DeviceHandler) CreateManualAsset(c *gin.Context) {
+	var req dto.ManualAssetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	detail, err := h.service.CreateManualAsset(c.Request.Context(), &req, middleware.GrantsFrom(c).Scope(authz.DeviceWrite))
+	if err != nil {
+		h.manualAssetError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "device.create", "device", &detail.Device.ID, map[string]interface{}{
+		"hostname":      detail.Device.Hostname,
+		"serial_number": detail.Device.SerialNumber,
+		"asset_type":    detail.Device.AssetType,
+	})
+	c.JSON(http.StatusCreated, detail)
+}
+
+// UpdateManualAsset replaces the fields, hardware and network interfaces of an agentless device.
+func (h *DeviceHandler) UpdateManualAsset(c *gin.Context) {
+	id, err := h.resolveDeviceID(c, authz.DeviceWrite)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
+		return
+	}
+
+	var req dto.ManualAssetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	detail, err := h.service.UpdateManualAsset(c.Request.Context(), id, &req, middleware.GrantsFrom(c).Scope(authz.DeviceWrite))
+	if err != nil {
+		h.manualAssetError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "device.update", "device", &id, map[string]interface{}{
+		"hostname":      detail.Device.Hostname,
+		"serial_number": detail.Device.SerialNumber,
+		"asset_type":    detail.Device.AssetType,
+	})
+	c.JSON(http.StatusOK, detail)
+}
+
+// manualAssetError writes the response for a failed manual asset create or update.
+func (h *DeviceHandler) manualAssetError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidAsset):
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrDepartmentOutOfScope):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrAgentDevice), errors.Is(err, repository.ErrSerialNumberInUse):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case isNotFound(err):
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
+	default:
+		slog.Error("failed to save manual asset", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to save asset"})
+	}
+}
+
 // DeleteDevice deletes a device and all related data.
 func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
-	id, err := h.resolveDeviceID(c)
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceDelete)
+	id, err := h.resolveDeviceID(c, authz.DeviceDelete)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
 		return
 	}
 
-	device, err := h.service.DeleteDevice(c.Request.Context(), id)
+	device, err := h.service.DeleteDevice(c.Request.Context(), id, scope)
 	if err != nil {
 		slog.Error("failed to delete device", "error", err, "device_id", id)
 		if isNotFound(err) {
@@ -201,7 +279,7 @@ func (h *DeviceHandler) BulkUpdateStatus(c *gin.Context) {
 		return
 	}
 
-	affected, err := h.service.BulkUpdateStatus(c.Request.Context(), req.DeviceIDs, req.Status)
+	affected, err := h.service.BulkUpdateStatus(c.Request.Context(), req.DeviceIDs, req.Status, middleware.GrantsFrom(c).Scope(authz.DeviceWrite))
 	if err != nil {
 		slog.Error("failed to bulk update status", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to update devices"})
@@ -223,8 +301,12 @@ func (h *DeviceHandler) BulkUpdateDepartment(c *gin.Context) {
 		return
 	}
 
-	affected, err := h.service.BulkUpdateDepartment(c.Request.Context(), req.DeviceIDs, req.DepartmentID)
+	affected, err := h.service.BulkUpdateDepartment(c.Request.Context(), req.DeviceIDs, req.DepartmentID, middleware.GrantsFrom(c).Scope(authz.DeviceWrite))
 	if err != nil {
+		if errors.Is(err, service.ErrDepartmentOutOfScope) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
 		slog.Error("failed to bulk update department", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to update devices"})
 		return
@@ -245,7 +327,7 @@ func (h *DeviceHandler) BulkDelete(c *gin.Context) {
 		return
 	}
 
-	affected, err := h.service.BulkDelete(c.Request.Context(), req.DeviceIDs)
+	affected, err := h.service.BulkDelete(c.Request.Context(), req.DeviceIDs, middleware.GrantsFrom(c).Scope(authz.DeviceDelete))
 	if err != nil {
 		slog.Error("failed to bulk delete devices", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to delete devices"})
@@ -262,7 +344,7 @@ func (h *DeviceHandler) BulkDelete(c *gin.Context) {
 // GetHardwareHistory returns hardware change records for a device.
 // Supports filtering by component (?component=cpu|ram|disk|...) and pagination (?page=1&limit=50).
 func (h *DeviceHandler) GetHardwareHistory(c *gin.Context) {
-	id, err := h.resolveDeviceID(c)
+	id, err := h.resolveDeviceID(c, authz.DeviceRead)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
 		return
@@ -294,9 +376,33 @@ func (h *DeviceHandler) GetHardwareHistory(c *gin.Context) {
 	})
 }
 
+// GetMetrics returns the metrics samples of a device from the last ?days=7 days (at most
+// maxMetricsDays), oldest first.
+func (h *DeviceHandler) GetMetrics(c *gin.Context) {
+	id, err := h.resolveDeviceID(c, authz.DeviceRead)
+	if err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
+		return
+	}
+
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days < 1 || days > maxMetricsDays {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: fmt.Sprintf("days must be between 1 and %d", maxMetricsDays)})
+		return
+	}
+
+	metrics, err := h.service.GetMetrics(c.Request.Context(), id, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		slog.Error("failed to get device metrics", "error", err, "device_id", id)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to get device metrics"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"metrics": metrics})
+}
+
 // GetDeviceActivity returns the activity log for a device.
 func (h *DeviceHandler) GetDeviceActivity(c *gin.Context) {
-	id, err := h.resolveDeviceID(c)
+	id, err := h.resolveDeviceID(c, authz.DeviceRead)
 	if err != nil {
 		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "device not found"})
 		return
@@ -324,59 +430,154 @@ func (h *DeviceHandler) GetDeviceActivity(c *gin.Context) {
 	})
 }
 
-// ExportCSV streams a CSV file of devices matching the current filters.
-func (h *DeviceHandler) ExportCSV(c *gin.Context) {
+// exportTimeout replaces the server write timeout for exports, which stream for as
+// long as the dataset takes.
+const exportTimeout = 30 * time.Minute
+
+// Export streams devices, or one of their related datasets, matching the list filters.
+// Query params: format (csv, ndjson, xlsx; default csv), dataset (default devices) and
+// the ListDevices filters hostname, os, status, department_id, source, asset_type, sort, order.
+// An export with more rows than the format can hold is refused with 422 before anything
+// is written.
+func (h *DeviceHandler) Export(c *gin.Context) {
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if !export.Valid(format) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid format, must be csv, ndjson or xlsx"})
+		return
+	}
+	dataset := c.DefaultQuery("dataset", "devices")
+	columns, ok := repository.ExportColumns(dataset)
+	if !ok {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{
+			Error: "invalid dataset, must be one of: " + strings.Join(repository.ExportDatasets, ", "),
+		})
+		return
+	}
+
 	params := repository.ListParams{
 		Hostname:     c.Query("hostname"),
 		OS:           c.Query("os"),
 		Status:       c.Query("status"),
 		DepartmentID: c.Query("department_id"),
+		Source:       c.Query("source"),
+		AssetType:    c.Query("asset_type"),
 		Sort:         c.DefaultQuery("sort", "hostname"),
 		Order:        c.DefaultQuery("order", "asc"),
 	}
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceRead)
+
+	if limit := export.MaxRows(format); limit > 0 {
+		n, err := h.service.ExportCount(c.Request.Context(), dataset, params, scope)
+		if err != nil {
+			slog.Error("failed to count export rows", "error", err, "dataset", dataset)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to export devices"})
+			return
+		}
+		if n > limit {
+			c.JSON(http.StatusUnprocessableEntity, dto.ErrorResponse{
+				Error: fmt.Sprintf("the export has %d rows, more than the %d a %s file can hold: narrow the filters or use csv or ndjson", n, limit, format),
+			})
+			return
+		}
+	}
 
-	devices, err := h.service.ListForExport(c.Request.Context(), params)
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(exportTimeout)); err != nil {
+		slog.Debug("export: cannot extend write deadline", "error", err)
+	}
+
+	filename := fmt.Sprintf("%s_%s.%s", dataset, time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	w, err := export.NewWriter(format, c.Writer, dataset)
 	if err != nil {
-		slog.Error("failed to export devices", "error", err)
+		slog.Error("failed to start export", "error", err, "format", format)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to export devices"})
 		return
 	}
 
-	filename := fmt.Sprintf("devices_%s.csv", time.Now().Format("20060102_150405"))
-	c.Header("Content-Type", "text/csv")
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	if format == export.FormatCSV {
+		columns = repository.ExportCSVHeader(dataset)
+	}
+	err = w.WriteHeader(columns)
+	if err == nil {
+		err = h.service.Export(c.Request.Context(), dataset, params, scope, w.WriteRow)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	// The status line has already been sent: a failed export leaves the file incomplete,
+	// as does an export that grew past the row limit after it was counted.
+	if err != nil {
+		slog.Error("failed to export devices", "error", err, "dataset", dataset, "format", format)
+	}
+}
+
+// Import applies a CSV or XLSX file of device metadata, sent as the multipart field "file".
+// Query params: mode (dry_run or commit; default dry_run), create_missing (create import
+// records for rows that match no device) and format (default: from the file extension).
+// A commit with failing rows writes nothing and returns the report with 422.
+func (h *DeviceHandler) Import(c *gin.Context) {
+	mode := c.DefaultQuery("mode", "dry_run")
+	if mode != "dry_run" && mode != "commit" {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid mode, must be dry_run or commit"})
+		return
+	}
 
-	w := csv.NewWriter(c.Writer)
-	defer w.Flush()
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "a file is required in the multipart field \"file\""})
+		return
+	}
+	format := c.DefaultQuery("format", importer.FormatOf(fh.Filename))
+	if format != importer.FormatCSV && format != importer.FormatXLSX {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "unsupported file type, must be csv or xlsx"})
+		return
+	}
 
-	// Header row
-	_ = w.Write([]string{
-		"Hostname", "Serial Number", "OS", "OS Version", "OS Build", "Architecture",
-		"Logged In User", "Agent Version", "License Status", "Status", "Department",
-		"Last Seen", "Created At",
-	})
+	f, err := fh.Open()
+	if err != nil {
+		slog.Error("failed to open import file", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to read file"})
+		return
+	}
+	defer f.Close()
 
-	for _, d := range devices {
-		deptName := ""
-		if d.DepartmentName != nil {
-			deptName = *d.DepartmentName
-		}
-		_ = w.Write([]string{
-			d.Hostname,
-			d.SerialNumber,
-			d.OSName,
-			d.OSVersion,
-			d.OSBuild,
-			d.OSArch,
-			d.LoggedInUser,
-			d.AgentVersion,
-			d.LicenseStatus,
-			d.Status,
-			deptName,
-			d.LastSeen.Format(time.RFC3339),
-			d.CreatedAt.Format(time.RFC3339),
-		})
+	rows, err := importer.Read(format, f, fh.Size, service.ImportMaxRows)
+	if errors.Is(err, importer.ErrTooManyRows) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: fmt.Sprintf("the file has more than %d rows", service.ImportMaxRows)})
+		return
 	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	opts := service.ImportOptions{
+		DryRun:        mode == "dry_run",
+		CreateMissing: c.Query("create_missing") == "true",
+		Audit: func(details map[string]interface{}) *models.AuditLog {
+			details["file"] = fh.Filename
+			details["format"] = format
+			return h.auditLogger.Entry(c, "device.import", "device", nil, details)
+		},
+	}
+	resp, err := h.service.Import(c.Request.Context(), rows, opts, middleware.GrantsFrom(c).Scope(authz.DeviceWrite))
+	if errors.Is(err, service.ErrInvalidImport) {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		slog.Error("failed to import devices", "error", err, "file", fh.Filename)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to import devices"})
+		return
+	}
+
+	if !resp.DryRun && !resp.Committed {
+		c.JSON(http.StatusUnprocessableEntity, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // isNotFound returns true if the error indicates a not-found condition.
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/events"
+	"inventario/server/internal/middleware"
+)
+
+const (
+	// streamKeepAlive is how often an idle stream gets a comment, so that proxies keep it
+	// open and the client's position advances past events it was not allowed to see.
+	streamKeepAlive = 20 * time.Second
+	// maxStreamDuration ends each stream; the client reconnects with Last-Event-ID and
+	// passes authentication again, so revoked sessions and permission changes apply.
+	maxStreamDuration = 15 * time.Minute
+	// streamWriteTimeout bounds each write to a stream.
+	streamWriteTimeout = 30 * time.Second
+	// streamRetry is the reconnection delay suggested to the client, in milliseconds.
+	streamRetry = 3000
+)
+
+// EventHandler serves the live event stream.
+type EventHandler struct {
+	hub *events.Hub
+}
+
+// NewEventHandler creates a new EventHandler.
+func NewEventHandler(hub *events.Hub) *EventHandler {
+	return &EventHandler{hub: hub}
+}
+
+// Stream sends device events as Server-Sent Events, limited to the devices the caller
+// may read. A client reconnecting with Last-Event-ID gets the events it missed from the
+// replay buffer, or a reset event when they are no longer there.
+func (h *EventHandler) Stream(c *gin.Context) {
+	scope := middleware.GrantsFrom(c).Scope(authz.DeviceRead)
+	lastEventID := c.GetHeader("Last-Event-ID")
+
+	sub, replay, resumed, position := h.hub.Subscribe(lastEventID)
+	defer h.hub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+
+	rc := http.NewResponseController(c.Writer)
+	write := func(format string, args ...any) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+			slog.Debug("event stream: cannot extend write deadline", "error", err)
+		}
+		if _, err := fmt.Fprintf(c.Writer, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !write("retry: %d\n\n", streamRetry) {
+		return
+	}
+	if lastEventID != "" && !resumed {
+		if !write("event: %s\ndata: {}\n\n", events.TypeReset) {
+			return
+		}
+	}
+	for _, ev := range replay {
+		if eventAllowed(scope, ev) && !write("id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data) {
+			return
+		}
+	}
+	if !write("id: %s\nevent: %s\ndata: {\"resumed\":%t}\n\n", position, events.TypeReady, resumed) {
+		return
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	deadline := time.NewTimer(maxStreamDuration)
+	defer deadline.Stop()
+
+	// sent is the position the client last received; position advances past filtered
+	// events too and is handed over with the next keep-alive.
+	sent := position
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-deadline.C:
+			return
+		case <-keepAlive.C:
+			// An id without data moves the client's Last-Event-ID without dispatching an event.
+			msg := ": keep-alive\n\n"
+			if position != sent {
+				msg = ": keep-alive\nid: " + position + "\n\n"
+				sent = position
+			}
+			if !write("%s", msg) {
+				return
+			}
+		case ev, ok := <-sub.C:
+			if !ok {
+				// Dropped for falling behind, or shutting down: the client reconnects
+				// and resumes from the replay buffer.
+				return
+			}
+			if ev.Type == events.TypeReset {
+				position, sent = ev.ID, ev.ID
+				if !write("id: %s\nevent: %s\ndata: {}\n\n", ev.ID, events.TypeReset) {
+					return
+				}
+				continue
+			}
+			position = ev.ID
+			if !eventAllowed(scope, ev) {
+				continue
+			}
+			if !write("id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data) {
+				return
+			}
+			sent = position
+		}
+	}
+}
+
+// eventAllowed reports whether the scope covers the event's organization and one of the
+// departments the event concerns.
+func eventAllowed(scope authz.Scope, ev events.Event) bool {
+	return scope.InOrganization(ev.OrganizationID) && slices.ContainsFunc(ev.Departments, func(id *uuid.UUID) bool { return scope.Allows(id) })
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"log/slog"
 	"net/http"
 
@@ -50,3 +52,29 @@ func (h *InventoryHandler) SubmitInventory(c *gin.Context) {
 	slog.Info("inventory processed", "device_id", deviceID, "hostname", req.Hostname)
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "inventory received"})
 }
+
+// Heartbeat records a heartbeat from an authenticated agent, which keeps the device
+// online between inventories.
+func (h *InventoryHandler) Heartbeat(c *gin.Context) {
+	deviceID, ok := authenticatedDevice(c)
+	if !ok {
+		return
+	}
+
+	var req dto.HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body: " + err.Error()})
+		return
+	}
+
+	if err := h.service.Heartbeat(c.Request.Context(), deviceID, &req); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "device not found"})
+			return
+		}
+		slog.Error("failed to record heartbeat", "error", err, "device_id", deviceID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to record heartbeat"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "heartbeat received"})
+}
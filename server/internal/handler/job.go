@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/scheduler"
+	"inventario/shared/dto"
+)
+
+// JobHandler exposes the background jobs of the scheduler and their run history.
+type JobHandler struct {
+	scheduler   *scheduler.Scheduler
+	auditLogger *middleware.AuditLogger
+}
+
+// NewJobHandler creates a new JobHandler.
+func NewJobHandler(s *scheduler.Scheduler, auditLogger *middleware.AuditLogger) *JobHandler {
+	return &JobHandler{scheduler: s, auditLogger: auditLogger}
+}
+
+// List returns the jobs with their schedule, next activation and last run.
+func (h *JobHandler) List(c *gin.Context) {
+	resp, err := h.scheduler.Jobs(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list jobs", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Runs returns the run history of a job, newest first.
+func (h *JobHandler) Runs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit > maxPaginationLimit {
+		limit = maxPaginationLimit
+	}
+	if limit < 1 {
+		limit = 50
+	}
+
+	resp, err := h.scheduler.Runs(c.Request.Context(), c.Param("name"), page, limit)
+	if err != nil {
+		if errors.Is(err, scheduler.ErrUnknownJob) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "job not found"})
+			return
+		}
+		slog.Error("failed to list job runs", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list job runs"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Run starts a run of a job now. The job runs in the background; the response is the
+// run as recorded when it started, to follow in the run history.
+func (h *JobHandler) Run(c *gin.Context) {
+	name := c.Param("name")
+	run, err := h.scheduler.RunNow(c.Request.Context(), name, c.GetString("username"))
+	if err != nil {
+		switch {
+		case errors.Is(err, scheduler.ErrUnknownJob):
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "job not found"})
+		case errors.Is(err, scheduler.ErrJobRunning):
+			c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, scheduler.ErrStopped):
+			c.JSON(http.StatusServiceUnavailable, dto.ErrorResponse{Error: "server is shutting down"})
+		default:
+			slog.Error("failed to start job", "job", name, "error", err)
+			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to start job"})
+		}
+		return
+	}
+
+	h.auditLogger.Log(c, "job.run", "job", &run.ID, map[string]interface{}{
+		"job": name,
+	})
+	c.JSON(http.StatusAccepted, run)
+}
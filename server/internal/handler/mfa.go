@@ -0,0 +1,279 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+)
+
+// MFAHandler handles TOTP two-factor authentication: the second login step,
+// self-service enrollment and recovery codes.
+type MFAHandler struct {
+	service     *service.AuthService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewMFAHandler creates a new MFAHandler.
+func NewMFAHandler(svc *service.AuthService, auditLogger *middleware.AuditLogger) *MFAHandler {
+	return &MFAHandler{service: svc, auditLogger: auditLogger}
+}
+
+// Verify completes a login with a TOTP code or a recovery code and sets the JWT session cookie.
+func (h *MFAHandler) Verify(c *gin.Context) {
+	var req dto.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	result, method, err := h.service.VerifyMFA(c.Request.Context(), req.Challenge, req.Code, clientInfo(c))
+	if err != nil {
+		username := ""
+		if result != nil && result.User != nil {
+			username = result.User.Username
+		}
+		slog.Warn("second factor failed", "username", username, "method", method, "ip", c.ClientIP(), "error", err)
+		var locked *service.AccountLockedError
+		if errors.As(err, &locked) {
+			respondLocked(c, h.auditLogger, "auth.mfa.verify", username, locked)
+			return
+		}
+		h.auditLogger.LogAuth(c, "auth.mfa.verify", username, false, map[string]interface{}{"method": method})
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.Set("user_id", result.User.ID.String())
+	c.Set("organization_id", result.User.OrganizationID)
+	setSessionCookie(c, result.Token, secondsUntil(result.ExpiresAt))
+	slog.Info("user logged in", "username", result.User.Username, "mfa_method", method)
+	h.auditLogger.LogAuth(c, "auth.mfa.verify", result.User.Username, true, map[string]interface{}{"method": method})
+	if method == service.MFAMethodRecoveryCode {
+		h.auditLogger.LogAuth(c, "auth.mfa.recovery_code_used", result.User.Username, true, nil)
+	}
+	h.auditLogger.LogAuth(c, "auth.login", result.User.Username, true, map[string]interface{}{"mfa": method})
+	c.JSON(http.StatusOK, dto.LoginResponse{Message: "login successful"})
+}
+
+// Setup starts the mandatory TOTP enrollment for a user who has passed the password step.
+func (h *MFAHandler) Setup(c *gin.Context) {
+	var req dto.MFASetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	enrollment, _, err := h.service.BeginMFASetup(c.Request.Context(), req.Challenge)
+	if err != nil {
+		slog.Warn("mfa setup failed", "error", err, "ip", c.ClientIP())
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TOTPEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+// SetupActivate confirms the mandatory TOTP enrollment, sets the JWT session cookie
+// and returns the recovery codes.
+func (h *MFAHandler) SetupActivate(c *gin.Context) {
+	var req dto.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	result, codes, err := h.service.CompleteMFASetup(c.Request.Context(), req.Challenge, req.Code, clientInfo(c))
+	if err != nil {
+		username := ""
+		if result != nil && result.User != nil {
+			username = result.User.Username
+		}
+		slog.Warn("mfa setup activation failed", "username", username, "error", err, "ip", c.ClientIP())
+		h.auditLogger.LogAuth(c, "auth.mfa.enroll", username, false, nil)
+		h.respondMFAError(c, err)
+		return
+	}
+
+	c.Set("user_id", result.User.ID.String())
+	c.Set("organization_id", result.User.OrganizationID)
+	setSessionCookie(c, result.Token, secondsUntil(result.ExpiresAt))
+	slog.Info("user enrolled in two-factor authentication", "username", result.User.Username)
+	h.auditLogger.LogAuth(c, "auth.mfa.enroll", result.User.Username, true, nil)
+	h.auditLogger.LogAuth(c, "auth.login", result.User.Username, true, map[string]interface{}{"mfa": service.MFAMethodTOTP})
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{Message: "login successful", RecoveryCodes: codes})
+}
+
+// Status returns the current user's two-factor state.
+func (h *MFAHandler) Status(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.service.GetMFAStatus(c.Request.Context(), userID)
+	if err != nil {
+		slog.Error("failed to get mfa status", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to get two-factor status"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.MFAStatusResponse{
+		Enabled:                status.Enabled,
+		Required:               status.Required,
+		RecoveryCodesRemaining: status.RecoveryCodesRemaining,
+	})
+}
+
+// Enroll generates a pending TOTP secret for the current user.
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	enrollment, err := h.service.BeginTOTPEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.TOTPEnrollmentResponse{
+		Secret:          enrollment.Secret,
+		ProvisioningURI: enrollment.ProvisioningURI,
+	})
+}
+
+// Activate enables TOTP for the current user and returns the recovery codes.
+func (h *MFAHandler) Activate(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTPEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.auditLogger.LogAuth(c, "auth.mfa.enroll", c.GetString("username"), false, nil)
+		h.respondMFAError(c, err)
+		return
+	}
+
+	h.auditLogger.LogAuth(c, "auth.mfa.enroll", c.GetString("username"), true, nil)
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{Message: "two-factor authentication enabled", RecoveryCodes: codes})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes.
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		h.auditLogger.LogAuth(c, "auth.mfa.recovery_codes", c.GetString("username"), false, nil)
+		h.respondMFAError(c, err)
+		return
+	}
+
+	h.auditLogger.LogAuth(c, "auth.mfa.recovery_codes", c.GetString("username"), true, nil)
+	c.JSON(http.StatusOK, dto.RecoveryCodesResponse{Message: "recovery codes regenerated", RecoveryCodes: codes})
+}
+
+// Disable turns off TOTP for the current user.
+func (h *MFAHandler) Disable(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var req dto.MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.service.DisableTOTP(c.Request.Context(), userID, req.Code); err != nil {
+		h.auditLogger.LogAuth(c, "auth.mfa.disable", c.GetString("username"), false, nil)
+		h.respondMFAError(c, err)
+		return
+	}
+
+	h.auditLogger.LogAuth(c, "auth.mfa.disable", c.GetString("username"), true, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "two-factor authentication disabled"})
+}
+
+// Reset removes another user's second factor (requires user.manage), e.g. after a lost phone.
+func (h *MFAHandler) Reset(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	requestingUserID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ResetMFA(c.Request.Context(), middleware.OrganizationFrom(c), requestingUserID, targetID); err != nil {
+		if errors.Is(err, service.ErrSuperAdminTarget) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		slog.Error("failed to reset mfa", "error", err, "target_id", targetID)
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.auditLogger.LogAuth(c, "auth.mfa.reset", c.GetString("username"), true, map[string]interface{}{"target_user_id": targetID})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "two-factor authentication reset"})
+}
+
+// respondMFAError maps second-factor errors to HTTP responses.
+func (h *MFAHandler) respondMFAError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFAChallenge), errors.Is(err, service.ErrInvalidMFACode):
+		c.JSON(http.StatusUnauthorized, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+// sessionUserID returns the authenticated user's ID set by middleware.JWTAuth.
+// It writes an error response and returns false if the session is malformed.
+func sessionUserID(c *gin.Context) (uuid.UUID, bool) {
+	sub, _ := c.Get("user_id")
+	subStr, ok := sub.(string)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "invalid session"})
+		return uuid.Nil, false
+	}
+	userID, err := uuid.Parse(subStr)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "invalid session"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+)
+
+const (
+	oidcFlowCookie     = "oidc_flow"
+	oidcFlowCookiePath = "/api/v1/auth/oidc"
+)
+
+// OIDCHandler handles the OpenID Connect single sign-on endpoints.
+type OIDCHandler struct {
+	service     *service.OIDCService
+	cfg         config.OIDCConfig
+	auditLogger *middleware.AuditLogger
+}
+
+// NewOIDCHandler creates a new OIDCHandler.
+func NewOIDCHandler(svc *service.OIDCService, cfg config.OIDCConfig, auditLogger *middleware.AuditLogger) *OIDCHandler {
+	return &OIDCHandler{service: svc, cfg: cfg, auditLogger: auditLogger}
+}
+
+// Login redirects the browser to the identity provider.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	authURL, flowToken, err := h.service.AuthCodeURL(c.Request.Context())
+	if err != nil {
+		slog.Error("oidc login failed", "error", err)
+		c.Redirect(http.StatusFound, h.cfg.ErrorRedirect)
+		return
+	}
+
+	setOIDCFlowCookie(c, flowToken, 600)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the login started by Login and sets the JWT session cookie. When
+// the user must still present a second factor, the browser is sent to MFARedirect with
+// the challenge in the URL fragment, which browsers never send to a server, to finish
+// the login with /auth/mfa/verify or /auth/mfa/setup.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	flowToken, _ := c.Cookie(oidcFlowCookie)
+	setOIDCFlowCookie(c, "", -1)
+
+	if errCode := c.Query("error"); errCode != "" {
+		slog.Warn("oidc provider returned an error", "error", errCode, "description", c.Query("error_description"))
+		h.auditLogger.LogAuth(c, "auth.login", "", false, map[string]interface{}{"provider": service.AuthProviderOIDC, "error": errCode})
+		c.Redirect(http.StatusFound, h.cfg.ErrorRedirect)
+		return
+	}
+
+	result, err := h.service.Callback(c.Request.Context(), flowToken, c.Query("state"), c.Query("code"), clientInfo(c))
+	if err != nil {
+		slog.Warn("oidc login failed", "error", err, "ip", c.ClientIP())
+		h.auditLogger.LogAuth(c, "auth.login", "", false, map[string]interface{}{"provider": service.AuthProviderOIDC})
+		c.Redirect(http.StatusFound, h.cfg.ErrorRedirect)
+		return
+	}
+
+	user := result.User
+	c.Set("user_id", user.ID.String())
+	c.Set("organization_id", user.OrganizationID)
+
+	if result.MFA != nil {
+		slog.Info("second factor required", "username", user.Username, "provider", service.AuthProviderOIDC, "setup_required", result.MFA.SetupRequired)
+		h.auditLogger.LogAuth(c, "auth.mfa.challenge", user.Username, true, map[string]interface{}{"provider": service.AuthProviderOIDC, "setup_required": result.MFA.SetupRequired})
+		fragment := url.Values{
+			"challenge":          {result.MFA.Token},
+			"mfa_setup_required": {strconv.FormatBool(result.MFA.SetupRequired)},
+		}
+		c.Redirect(http.StatusFound, h.cfg.MFARedirect+"#"+fragment.Encode())
+		return
+	}
+
+	setSessionCookie(c, result.Token, secondsUntil(result.ExpiresAt))
+	slog.Info("user logged in", "username", user.Username, "provider", service.AuthProviderOIDC)
+	h.auditLogger.LogAuth(c, "auth.login", user.Username, true, map[string]interface{}{"provider": service.AuthProviderOIDC, "role": user.Role})
+	c.Redirect(http.StatusFound, h.cfg.SuccessRedirect)
+}
+
+// setOIDCFlowCookie stores the signed login state for the duration of the redirect round trip.
+func setOIDCFlowCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     oidcFlowCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+)
+
+// OrganizationHandler handles organizations (super-admin), the current organization
+// and its enrollment keys.
+type OrganizationHandler struct {
+	service     *service.OrganizationService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewOrganizationHandler creates a new OrganizationHandler.
+func NewOrganizationHandler(svc *service.OrganizationService, auditLogger *middleware.AuditLogger) *OrganizationHandler {
+	return &OrganizationHandler{service: svc, auditLogger: auditLogger}
+}
+
+// List returns all organizations.
+func (h *OrganizationHandler) List(c *gin.Context) {
+	orgs, err := h.service.List(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list organizations", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list organizations"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.OrganizationListResponse{Organizations: orgs, Total: len(orgs)})
+}
+
+// Current returns the organization the request works in.
+func (h *OrganizationHandler) Current(c *gin.Context) {
+	org, err := h.service.Get(c.Request.Context(), middleware.OrganizationFrom(c))
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// Create adds an organization.
+func (h *OrganizationHandler) Create(c *gin.Context) {
+	var req dto.OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	org, err := h.service.Create(c.Request.Context(), req.Name, req.RetentionDays, req.InactiveDays)
+	if err != nil {
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.auditLogger.Log(c, "organization.create", "organization", &org.ID, map[string]interface{}{
+		"name":           org.Name,
+		"retention_days": org.RetentionDays,
+		"inactive_days":  org.InactiveDays,
+	})
+	c.JSON(http.StatusCreated, org)
+}
+
+// Update renames an organization and replaces its settings.
+func (h *OrganizationHandler) Update(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid organization ID"})
+		return
+	}
+
+	var req dto.OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	org, err := h.service.Update(c.Request.Context(), id, req.Name, req.RetentionDays, req.InactiveDays)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "organization.update", "organization", &id, map[string]interface{}{
+		"name":           org.Name,
+		"retention_days": org.RetentionDays,
+		"inactive_days":  org.InactiveDays,
+	})
+	c.JSON(http.StatusOK, org)
+}
+
+// Delete removes an organization without devices or users.
+func (h *OrganizationHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid organization ID"})
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), id); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "organization.delete", "organization", &id, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "organization deleted"})
+}
+
+// Switch moves the current session to another organization.
+func (h *OrganizationHandler) Switch(c *gin.Context) {
+	var req dto.SwitchOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	org, err := h.service.Switch(c.Request.Context(), currentSessionID(c), req.OrganizationID)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	from := middleware.OrganizationFrom(c)
+	c.Set("organization_id", org.ID)
+	h.auditLogger.Log(c, "auth.organization_switch", "organization", &org.ID, map[string]interface{}{
+		"from_organization_id": from,
+		"name":                 org.Name,
+	})
+	c.JSON(http.StatusOK, org)
+}
+
+// ListEnrollmentKeys returns the enrollment keys of the organization.
+func (h *OrganizationHandler) ListEnrollmentKeys(c *gin.Context) {
+	keys, err := h.service.ListEnrollmentKeys(c.Request.Context(), middleware.OrganizationFrom(c))
+	if err != nil {
+		slog.Error("failed to list enrollment keys", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list enrollment keys"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.EnrollmentKeyListResponse{Keys: keys, Total: len(keys)})
+}
+
+// CreateEnrollmentKey issues an enrollment key for the organization. The key is
+// returned only once.
+func (h *OrganizationHandler) CreateEnrollmentKey(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	var req dto.CreateEnrollmentKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	raw, key, err := h.service.CreateEnrollmentKey(c.Request.Context(), middleware.OrganizationFrom(c), userID, req.Name)
+	if err != nil {
+		slog.Error("failed to create enrollment key", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to create enrollment key"})
+		return
+	}
+
+	h.auditLogger.Log(c, "enrollment_key.create", "enrollment_key", &key.ID, map[string]interface{}{
+		"name":       key.Name,
+		"key_prefix": key.KeyPrefix,
+	})
+	c.JSON(http.StatusCreated, dto.CreateEnrollmentKeyResponse{Key: raw, EnrollmentKey: *key})
+}
+
+// RevokeEnrollmentKey revokes one of the organization's enrollment keys.
+func (h *OrganizationHandler) RevokeEnrollmentKey(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid enrollment key ID"})
+		return
+	}
+
+	if err := h.service.RevokeEnrollmentKey(c.Request.Context(), id, middleware.OrganizationFrom(c)); err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "enrollment key not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "enrollment_key.revoke", "enrollment_key", &id, nil)
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "enrollment key revoked"})
+}
+
+func (h *OrganizationHandler) respondError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDefaultOrganization):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrOrganizationInUse):
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	case err.Error() == "organization not found":
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	case err.Error() == "organization name already exists":
+		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+	default:
+		slog.Error("organization request failed", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "organization request failed"})
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// RetentionHandler handles the retention policies of the cleanup and its preview.
+type RetentionHandler struct {
+	service     *service.CleanupService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewRetentionHandler creates a new RetentionHandler.
+func NewRetentionHandler(svc *service.CleanupService, auditLogger *middleware.AuditLogger) *RetentionHandler {
+	return &RetentionHandler{service: svc, auditLogger: auditLogger}
+}
+
+// List returns the retention policies and the defaults.
+func (h *RetentionHandler) List(c *gin.Context) {
+	resp, err := h.service.Policies(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list retention policies", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list retention policies"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Replace replaces all retention policies.
+func (h *RetentionHandler) Replace(c *gin.Context) {
+	var req dto.RetentionPoliciesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	policies := make([]models.RetentionPolicy, len(req.Policies))
+	for i, p := range req.Policies {
+		policies[i] = models.RetentionPolicy{Dataset: p.Dataset, ActivityType: p.ActivityType, RetentionDays: p.RetentionDays}
+	}
+	stored, err := h.service.ReplacePolicies(c.Request.Context(), policies)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRetentionPolicy) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		slog.Error("failed to replace retention policies", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to replace retention policies"})
+		return
+	}
+
+	h.auditLogger.Log(c, "retention.update", "retention_policy", nil, map[string]interface{}{
+		"policies": stored,
+	})
+	resp, err := h.service.Policies(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list retention policies", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list retention policies"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Preview counts what the cleanup would delete if it ran now.
+func (h *RetentionHandler) Preview(c *gin.Context) {
+	resp, err := h.service.Preview(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to preview cleanup", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to preview cleanup"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
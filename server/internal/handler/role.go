@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// RoleHandler handles role and role binding management endpoints.
+type RoleHandler struct {
+	service     *service.RoleService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewRoleHandler creates a new RoleHandler.
+func NewRoleHandler(svc *service.RoleService, auditLogger *middleware.AuditLogger) *RoleHandler {
+	return &RoleHandler{service: svc, auditLogger: auditLogger}
+}
+
+// ListRoles returns all roles and the permissions that can be assigned to them.
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.service.List(c.Request.Context())
+	if err != nil {
+		slog.Error("failed to list roles", "error", err)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list roles"})
+		return
+	}
+
+	resp := dto.RoleListResponse{
+		Roles:       make([]dto.RoleResponse, 0, len(roles)),
+		Total:       len(roles),
+		Permissions: make([]string, 0, len(authz.AllPermissions)),
+	}
+	for i := range roles {
+		resp.Roles = append(resp.Roles, roleResponse(&roles[i]))
+	}
+	for _, p := range authz.AllPermissions {
+		resp.Permissions = append(resp.Permissions, string(p))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateRole creates a custom role.
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var req dto.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	role, err := h.service.Create(c.Request.Context(), req.Name, req.Description, req.Permissions)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.auditLogger.Log(c, "role.create", "role", &role.ID, map[string]interface{}{
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
+	c.JSON(http.StatusCreated, roleResponse(role))
+}
+
+// UpdateRole renames a custom role or replaces its permissions.
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid role ID"})
+		return
+	}
+
+	var req dto.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	role, err := h.service.Update(c.Request.Context(), id, req.Name, req.Description, req.Permissions)
+	if err != nil {
+		h.respondRoleError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "role.update", "role", &id, map[string]interface{}{
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
+	c.JSON(http.StatusOK, roleResponse(role))
+}
+
+// DeleteRole removes a custom role and its bindings.
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid role ID"})
+		return
+	}
+
+	role, err := h.service.Delete(c.Request.Context(), id)
+	if err != nil {
+		h.respondRoleError(c, err)
+		return
+	}
+
+	h.auditLogger.Log(c, "role.delete", "role", &id, map[string]interface{}{"name": role.Name})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "role deleted"})
+}
+
+// ListBindings returns a user's role bindings.
+func (h *RoleHandler) ListBindings(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	bindings, err := h.service.ListBindings(c.Request.Context(), middleware.OrganizationFrom(c), userID)
+	if err != nil {
+		if isNotFound(err) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+			return
+		}
+		slog.Error("failed to list role bindings", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list role bindings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.RoleBindingListResponse{Bindings: bindings, Total: len(bindings)})
+}
+
+// CreateBinding grants a role to a user, globally or for a single department.
+func (h *RoleHandler) CreateBinding(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	var req dto.CreateRoleBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid request: " + err.Error()})
+		return
+	}
+
+	bindingID, err := h.service.CreateBinding(c.Request.Context(), middleware.OrganizationFrom(c), userID, req.RoleID, req.DepartmentID)
+	if err != nil {
+		if errors.Is(err, service.ErrDepartmentNotFound) {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.auditLogger.Log(c, "user.role_binding.create", "user", &userID, map[string]interface{}{
+		"binding_id":    bindingID,
+		"role_id":       req.RoleID,
+		"department_id": req.DepartmentID,
+	})
+	c.JSON(http.StatusCreated, gin.H{"id": bindingID})
+}
+
+// DeleteBinding removes one of a user's role bindings.
+func (h *RoleHandler) DeleteBinding(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+	bindingID, err := uuid.Parse(c.Param("bindingId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid binding ID"})
+		return
+	}
+
+	if err := h.service.DeleteBinding(c.Request.Context(), middleware.OrganizationFrom(c), userID, bindingID); err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "role binding not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "user.role_binding.delete", "user", &userID, map[string]interface{}{"binding_id": bindingID})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "role binding deleted"})
+}
+
+// respondRoleError maps role service errors to HTTP responses.
+func (h *RoleHandler) respondRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrBuiltinRole):
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+	case err.Error() == "role not found":
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	}
+}
+
+func roleResponse(r *models.Role) dto.RoleResponse {
+	return dto.RoleResponse{
+		ID:          r.ID,
+		Name:        r.Name,
+		Description: r.Description,
+		Permissions: strings.Fields(r.Permissions),
+		Builtin:     r.Builtin,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+}
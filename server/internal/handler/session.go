@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/service"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// SessionHandler lists and revokes server-side dashboard sessions.
+type SessionHandler struct {
+	service     *service.SessionService
+	auditLogger *middleware.AuditLogger
+}
+
+// NewSessionHandler creates a new SessionHandler.
+func NewSessionHandler(svc *service.SessionService, auditLogger *middleware.AuditLogger) *SessionHandler {
+	return &SessionHandler{service: svc, auditLogger: auditLogger}
+}
+
+// ListOwn returns the current user's active sessions.
+func (h *SessionHandler) ListOwn(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	h.list(c, userID)
+}
+
+// RevokeOwn ends one of the current user's sessions.
+func (h *SessionHandler) RevokeOwn(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+	h.revoke(c, userID, service.SessionRevokedByUser)
+}
+
+// RevokeOthers ends every session of the current user except the one making the request.
+func (h *SessionHandler) RevokeOthers(c *gin.Context) {
+	userID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.service.RevokeAll(c.Request.Context(), userID, currentSessionID(c), service.SessionRevokedByUser)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to revoke sessions"})
+		return
+	}
+
+	h.auditLogger.Log(c, "session.revoke_all", "user", &userID, map[string]interface{}{"revoked": count, "kept_current": true})
+	c.JSON(http.StatusOK, dto.BulkActionResponse{Affected: int(count), Message: "other sessions revoked"})
+}
+
+// ListForUser returns another user's active sessions (requires user.manage).
+func (h *SessionHandler) ListForUser(c *gin.Context) {
+	userID, ok := h.organizationUserID(c)
+	if !ok {
+		return
+	}
+	h.list(c, userID)
+}
+
+// RevokeForUser ends one of another user's sessions (requires user.manage).
+func (h *SessionHandler) RevokeForUser(c *gin.Context) {
+	userID, ok := h.organizationUserID(c)
+	if !ok {
+		return
+	}
+	h.revoke(c, userID, service.SessionRevokedByAdmin)
+}
+
+// RevokeAllForUser ends every session of another user (requires user.manage).
+func (h *SessionHandler) RevokeAllForUser(c *gin.Context) {
+	userID, ok := h.organizationUserID(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.service.RevokeAll(c.Request.Context(), userID, uuid.Nil, service.SessionRevokedByAdmin)
+	if err != nil {
+		slog.Error("failed to revoke sessions", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to revoke sessions"})
+		return
+	}
+
+	h.auditLogger.Log(c, "session.revoke_all", "user", &userID, map[string]interface{}{"revoked": count, "by_admin": true})
+	c.JSON(http.StatusOK, dto.BulkActionResponse{Affected: int(count), Message: "sessions revoked"})
+}
+
+// organizationUserID parses the user ID of the path and checks that the user belongs
+// to the organization of the request.
+func (h *SessionHandler) organizationUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return uuid.Nil, false
+	}
+	if !h.service.InOrganization(c.Request.Context(), userID, middleware.OrganizationFrom(c)) {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+func (h *SessionHandler) list(c *gin.Context, userID uuid.UUID) {
+	sessions, err := h.service.List(c.Request.Context(), userID)
+	if err != nil {
+		slog.Error("failed to list sessions", "error", err, "user_id", userID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list sessions"})
+		return
+	}
+
+	current := currentSessionID(c)
+	resp := dto.SessionListResponse{Sessions: make([]dto.SessionResponse, 0, len(sessions)), Total: len(sessions)}
+	for i := range sessions {
+		resp.Sessions = append(resp.Sessions, sessionResponse(&sessions[i], current))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *SessionHandler) revoke(c *gin.Context, userID uuid.UUID, reason string) {
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid session ID"})
+		return
+	}
+
+	if err := h.service.Revoke(c.Request.Context(), userID, sessionID, reason); err != nil {
+		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "session not found"})
+		return
+	}
+
+	h.auditLogger.Log(c, "session.revoke", "user", &userID, map[string]interface{}{"session_id": sessionID, "reason": reason})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "session revoked"})
+}
+
+// currentSessionID returns the session of the request, or uuid.Nil for API tokens.
+func currentSessionID(c *gin.Context) uuid.UUID {
+	val, _ := c.Get("session_id")
+	id, _ := val.(uuid.UUID)
+	return id
+}
+
+func sessionResponse(s *models.UserSession, current uuid.UUID) dto.SessionResponse {
+	return dto.SessionResponse{
+		ID:                s.ID,
+		IP:                s.IP,
+		UserAgent:         s.UserAgent,
+		CreatedAt:         s.CreatedAt,
+		LastActivityAt:    s.LastActivityAt,
+		ExpiresAt:         s.ExpiresAt,
+		AbsoluteExpiresAt: s.AbsoluteExpiresAt,
+		Current:           s.ID == current,
+	}
+}
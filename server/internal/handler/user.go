@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -23,9 +25,9 @@ func NewUserHandler(authSvc *service.AuthService, auditLogger *middleware.AuditL
 	return &UserHandler{authService: authSvc, auditLogger: auditLogger}
 }
 
-// ListUsers returns all dashboard users.
+// ListUsers returns the dashboard users of the organization.
 func (h *UserHandler) ListUsers(c *gin.Context) {
-	users, err := h.authService.ListUsers(c.Request.Context())
+	users, err := h.authService.ListUsers(c.Request.Context(), middleware.OrganizationFrom(c))
 	if err != nil {
 		slog.Error("failed to list users", "error", err)
 		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to list users"})
@@ -38,24 +40,35 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 	}
 	for _, u := range users {
 		resp.Users = append(resp.Users, dto.UserResponse{
-			ID:        u.ID,
-			Username:  u.Username,
-			Name:      u.Name,
-			Role:      u.Role,
-			CreatedAt: u.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			ID:           u.ID,
+			Username:     u.Username,
+			Name:         u.Name,
+			Role:         u.Role,
+			AuthProvider: u.AuthProvider,
+			TOTPEnabled:  u.TOTPEnabled,
+			SuperAdmin:   u.SuperAdmin,
+			CreatedAt:    u.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+			FailedLoginAttempts: u.FailedLoginAttempts,
+			LockedUntil:         lockedUntil(u.LockedUntil),
+			MustChangePassword:  u.MustChangePassword,
 		})
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
-// CreateUser creates a new dashboard user.
+// CreateUser creates a new dashboard user in the organization.
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	var req dto.CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
+	if req.SuperAdmin && !middleware.IsSuperAdmin(c) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "super-admin required"})
+		return
+	}
 
 	// Default to viewer if role not specified
 	role := req.Role
@@ -63,13 +76,17 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		role = "viewer"
 	}
 
-	if err := h.authService.CreateUser(c.Request.Context(), req.Username, req.Name, req.Password, role); err != nil {
+	if err := h.authService.CreateUser(c.Request.Context(), middleware.OrganizationFrom(c), req.Username, req.Name, req.Password, role, false, req.SuperAdmin); err != nil {
+		if errors.Is(err, service.ErrPasswordPolicy) {
+			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
 		slog.Error("failed to create user", "error", err)
 		c.JSON(http.StatusConflict, dto.ErrorResponse{Error: "username already exists or invalid role"})
 		return
 	}
 
-	h.auditLogger.Log(c, "user.create", "user", nil, map[string]interface{}{"username": req.Username, "name": req.Name, "role": role})
+	h.auditLogger.Log(c, "user.create", "user", nil, map[string]interface{}{"username": req.Username, "name": req.Name, "role": role, "super_admin": req.SuperAdmin})
 	c.JSON(http.StatusCreated, dto.MessageResponse{Message: "user created successfully"})
 }
 
@@ -87,10 +104,14 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	if req.Username == "" && req.Name == "" && req.Password == "" && req.Role == "" {
+	if req.Username == "" && req.Name == "" && req.Password == "" && req.Role == "" && req.SuperAdmin == nil {
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "at least one field must be provided"})
 		return
 	}
+	if req.SuperAdmin != nil && !middleware.IsSuperAdmin(c) {
+		c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: "super-admin required"})
+		return
+	}
 
 	sub, _ := c.Get("user_id")
 	subStr, ok := sub.(string)
@@ -104,16 +125,51 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.UpdateUser(c.Request.Context(), requestingUserID, targetID, req.Username, req.Name, req.Password, req.Role); err != nil {
+	if err := h.authService.UpdateUser(c.Request.Context(), middleware.OrganizationFrom(c), requestingUserID, targetID, req.Username, req.Name, req.Password, req.Role, req.SuperAdmin); err != nil {
+		if errors.Is(err, service.ErrSuperAdminTarget) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
 		slog.Error("failed to update user", "error", err, "target_id", targetID)
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	h.auditLogger.Log(c, "user.update", "user", &targetID, map[string]interface{}{"target_user_id": targetID, "username": req.Username, "role": req.Role})
+	h.auditLogger.Log(c, "user.update", "user", &targetID, map[string]interface{}{"target_user_id": targetID, "username": req.Username, "role": req.Role, "super_admin": req.SuperAdmin})
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "user updated successfully"})
 }
 
+// UnlockUser lifts a lockout caused by failed logins.
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	targetID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	requestingUserID, ok := sessionUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.UnlockUser(c.Request.Context(), middleware.OrganizationFrom(c), requestingUserID, targetID); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "user not found"})
+			return
+		}
+		if errors.Is(err, service.ErrSuperAdminTarget) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		slog.Error("failed to unlock user", "error", err, "target_id", targetID)
+		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to unlock user"})
+		return
+	}
+
+	h.auditLogger.Log(c, "user.unlock", "user", &targetID, map[string]interface{}{"target_user_id": targetID})
+	c.JSON(http.StatusOK, dto.MessageResponse{Message: "user unlocked"})
+}
+
 // DeleteUser deletes a dashboard user by ID.
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	targetID, err := uuid.Parse(c.Param("id"))
@@ -135,7 +191,11 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.DeleteUser(c.Request.Context(), requestingUserID, targetID); err != nil {
+	if err := h.authService.DeleteUser(c.Request.Context(), middleware.OrganizationFrom(c), requestingUserID, targetID); err != nil {
+		if errors.Is(err, service.ErrSuperAdminTarget) {
+			c.JSON(http.StatusForbidden, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
 		slog.Error("failed to delete user", "error", err, "target_id", targetID)
 		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
@@ -144,3 +204,11 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 	h.auditLogger.Log(c, "user.delete", "user", &targetID, map[string]interface{}{"target_user_id": targetID})
 	c.JSON(http.StatusOK, dto.MessageResponse{Message: "user deleted successfully"})
 }
+
+// lockedUntil hides lockouts that have already expired.
+func lockedUntil(t *time.Time) *time.Time {
+	if t == nil || !t.After(time.Now()) {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readCSV parses comma- or semicolon-separated values; the separator is the one the
+// header line uses (Excel in pt-BR saves CSV with semicolons). A UTF-8 BOM is skipped.
+func readCSV(r io.Reader, add func(int, []string) error) error {
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3) //nolint:errcheck
+	}
+
+	cr := csv.NewReader(br)
+	cr.FieldsPerRecord = -1
+	if line, _ := br.Peek(4096); isSemicolonSeparated(line) {
+		cr.Comma = ';'
+	}
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		if err := add(line, record); err != nil {
+			return err
+		}
+	}
+}
+
+// isSemicolonSeparated reports whether the first line of data has more semicolons
+// than commas outside quotes.
+func isSemicolonSeparated(data []byte) bool {
+	commas, semicolons := 0, 0
+	quoted := false
+	for _, b := range data {
+		switch {
+		case b == '"':
+			quoted = !quoted
+		case quoted:
+		case b == '\n':
+			return semicolons > commas
+		case b == ',':
+			commas++
+		case b == ';':
+			semicolons++
+		}
+	}
+	return semicolons > commas
+}
@@ -0,0 +1,75 @@
+// Package importer reads uploaded CSV and XLSX files into rows of strings. It is the
+// counterpart of package export for imports: it only parses, validation is up to the caller.
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Formats supported by Read.
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ErrTooManyRows is returned when a file has more data rows than the caller allows.
+var ErrTooManyRows = errors.New("too many rows")
+
+// Row is a non-blank row of a file.
+type Row struct {
+	Number int // 1-based line (CSV) or row number (XLSX) in the file
+	Cells  []string
+}
+
+// FormatOf returns the format named by a file's extension, or "" if it is not supported.
+func FormatOf(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".txt":
+		return FormatCSV
+	case ".xlsx":
+		return FormatXLSX
+	}
+	return ""
+}
+
+// Read returns the rows of a file, header first, with surrounding spaces trimmed and
+// blank rows skipped. XLSX files are read from their first worksheet. More than
+// maxRows rows after the header yield ErrTooManyRows.
+func Read(format string, r io.ReaderAt, size int64, maxRows int) ([]Row, error) {
+	var rows []Row
+	add := func(number int, cells []string) error {
+		blank := true
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+			if cells[i] != "" {
+				blank = false
+			}
+		}
+		if blank {
+			return nil
+		}
+		if len(rows) > maxRows {
+			return ErrTooManyRows
+		}
+		rows = append(rows, Row{Number: number, Cells: cells})
+		return nil
+	}
+
+	var err error
+	switch format {
+	case FormatCSV:
+		err = readCSV(io.NewSectionReader(r, 0, size), add)
+	case FormatXLSX:
+		err = readXLSX(r, size, add)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,274 @@
+package importer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// xlsxMaxPart caps how much of a zip entry is decompressed, so a small upload cannot
+// expand into gigabytes of XML.
+const xlsxMaxPart = 256 << 20
+
+// readXLSX streams the first worksheet of a workbook. Shared, inline and formula
+// strings are read as text, numbers without exponent or trailing zeros, booleans as
+// TRUE/FALSE. Dates are not converted: they arrive as Excel serial numbers.
+func readXLSX(r io.ReaderAt, size int64, add func(int, []string) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return errors.New("invalid XLSX: not a zip file")
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheet, err := firstSheetPath(files)
+	if err != nil {
+		return err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(f); err != nil {
+			return err
+		}
+	}
+
+	f, ok := files[sheet]
+	if !ok {
+		return fmt.Errorf("invalid XLSX: missing %s", sheet)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer rc.Close()
+	return readSheet(io.LimitReader(rc, xlsxMaxPart), shared, add)
+}
+
+// firstSheetPath resolves the zip path of the first sheet listed in the workbook.
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(files, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", errors.New("invalid XLSX: workbook has no sheets")
+	}
+
+	var rels struct {
+		Rels []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Rels {
+		if rel.ID != workbook.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "", errors.New("invalid XLSX: first sheet not found")
+}
+
+func decodePart(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("invalid XLSX: missing %s", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(io.LimitReader(rc, xlsxMaxPart)).Decode(v); err != nil {
+		return fmt.Errorf("invalid XLSX: %s: %w", name, err)
+	}
+	return nil
+}
+
+// readSharedStrings returns the shared string table. Rich text runs are concatenated;
+// phonetic hints (rPh) are left out.
+func readSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX: %w", err)
+	}
+	defer rc.Close()
+
+	var (
+		table    []string
+		current  strings.Builder
+		inText   bool
+		phonetic int
+	)
+	dec := xml.NewDecoder(io.LimitReader(rc, xlsxMaxPart))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return table, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX: shared strings: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "rPh":
+				phonetic++
+			case "t":
+				inText = phonetic == 0
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				table = append(table, current.String())
+			case "rPh":
+				phonetic--
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(t)
+			}
+		}
+	}
+}
+
+// readSheet streams the rows of a worksheet, placing cells by their reference so
+// that skipped empty cells keep the following ones in the right column.
+func readSheet(r io.Reader, shared []string, add func(int, []string) error) error {
+	var (
+		row      []string
+		number   int
+		col      int
+		cellType string
+		value    strings.Builder
+		inValue  bool
+		inRow    bool
+	)
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid XLSX: worksheet: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row, col, inRow = nil, 0, true
+				number++
+				for _, a := range t.Attr {
+					if a.Name.Local == "r" {
+						if n, err := strconv.Atoi(a.Value); err == nil {
+							number = n
+						}
+					}
+				}
+			case "c":
+				cellType = ""
+				value.Reset()
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "t":
+						cellType = a.Value
+					case "r":
+						if c, ok := columnIndex(a.Value); ok {
+							col = c
+						}
+					}
+				}
+			case "v", "t":
+				inValue = inRow
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				if !inRow {
+					continue
+				}
+				if col >= 1<<14 {
+					return errors.New("invalid XLSX: column out of range")
+				}
+				for len(row) <= col {
+					row = append(row, "")
+				}
+				row[col] = cellValue(value.String(), cellType, shared)
+				col++
+			case "row":
+				inRow = false
+				if err := add(number, row); err != nil {
+					return err
+				}
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(t)
+			}
+		}
+	}
+}
+
+func cellValue(v, cellType string, shared []string) string {
+	switch cellType {
+	case "s":
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return shared[i]
+	case "b":
+		if v == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "", "n":
+		// Numbers such as serials typed into a cell are stored as 1.2345E+10.
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f == math.Trunc(f) && math.Abs(f) < 1e15 {
+			return strconv.FormatInt(int64(f), 10)
+		}
+	}
+	return v
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12".
+func columnIndex(ref string) (int, bool) {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+	if n == 0 || n > 3 {
+		return 0, false
+	}
+	return col - 1, true
+}
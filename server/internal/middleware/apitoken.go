@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/repository"
+	"inventario/shared/dto"
+)
+
+// APITokenPrefix starts every personal API token so they are easy to recognize in secret scanners.
+const APITokenPrefix = "inv_"
+
+// API token scopes. Apart from read, each scope is named after the permission it
+// unlocks; a token can never do more than its owner's current permissions allow.
+const (
+	ScopeRead            = "read"                        // all read-only dashboard endpoints
+	ScopeDeviceWrite     = string(authz.DeviceWrite)     // change device status and department
+	ScopeDeviceDelete    = string(authz.DeviceDelete)    // delete devices
+	ScopeDepartmentWrite = string(authz.DepartmentWrite) // create, rename and delete departments
+	ScopeUserManage      = string(authz.UserManage)      // manage users, roles and role bindings
+	ScopeAuditRead       = string(authz.AuditRead)       // read audit logs
+	ScopeAgentManage     = string(authz.AgentManage)     // publish agent releases and manage rollouts
+	ScopeSuperAdmin      = "super_admin"                 // manage organizations, shared roles, retention and jobs (super-admins only)
+)
+
+// APITokenScopes lists every valid scope.
+var APITokenScopes = []string{
+	ScopeRead, ScopeDeviceWrite, ScopeDeviceDelete, ScopeDepartmentWrite, ScopeUserManage, ScopeAuditRead,
+	ScopeAgentManage, ScopeSuperAdmin,
+}
+
+// authenticateAPIToken validates a Bearer API token and sets the same context keys as a session,
+// plus "api_token_id" (uuid.UUID) and "api_token_scopes" ([]string). Tokens work in their
+// owner's organization, also for super-admins. "organization_id" is set early so that
+// the api_token.use audit entry carries it.
+func authenticateAPIToken(c *gin.Context, repo repository.APITokenStore, auditLogger *AuditLogger, rawToken string) {
+	if !strings.HasPrefix(rawToken, APITokenPrefix) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid api token"})
+		return
+	}
+
+	token, err := repo.GetActiveByHash(c.Request.Context(), SHA256Hex(rawToken))
+	if err != nil {
+		slog.Warn("api token auth failed", "ip", c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid or expired api token"})
+		return
+	}
+
+	c.Set("user_id", token.UserID.String())
+	c.Set("username", token.Username)
+	c.Set("user_role", token.Role)
+	c.Set("api_token_id", token.ID)
+	c.Set("api_token_scopes", strings.Fields(token.Scopes))
+	c.Set("organization_id", token.OrganizationID)
+
+	// Reads are audited at most once a minute per token; every mutation is audited.
+	touched, err := repo.TouchLastUsed(c.Request.Context(), token.ID, c.ClientIP())
+	if err != nil {
+		slog.Warn("failed to record api token use", "error", err, "token_id", token.ID)
+	}
+	if auditLogger != nil && (touched || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead)) {
+		auditLogger.Log(c, "api_token.use", "api_token", &token.ID, map[string]interface{}{
+			"name":   token.Name,
+			"method": c.Request.Method,
+			"path":   c.FullPath(),
+		})
+	}
+
+	c.Next()
+}
+
+// RequireScope ensures a request authenticated with an API token carries the given scope.
+// Session (cookie) requests are not restricted. Must be used after JWTAuth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokenAllows(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "api token lacks scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// tokenAllows reports whether the request may use the scope: always for session
+// requests, and for API token requests only if the token carries it.
+func tokenAllows(c *gin.Context, scope string) bool {
+	val, exists := c.Get("api_token_scopes")
+	if !exists {
+		return true
+	}
+	scopes, ok := val.([]string)
+	return ok && slices.Contains(scopes, scope)
+}
+
+// RequireSession rejects requests authenticated with an API token.
+// Used for account management (MFA, API tokens) that must stay interactive.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("api_token_id"); exists {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "this endpoint requires a browser session"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// APITokenID returns the ID of the API token that authenticated the request, if any.
+func APITokenID(c *gin.Context) (uuid.UUID, bool) {
+	val, exists := c.Get("api_token_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	id, ok := val.(uuid.UUID)
+	return id, ok
+}
@@ -1,26 +1,36 @@
 package middleware
 
 import (
-	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 
-	"inventario/server/internal/repository"
+	"inventario/server/internal/auditlog"
+	"inventario/shared/models"
 )
 
 // AuditLogger provides a convenient way to log audit events from handlers.
 type AuditLogger struct {
-	repo *repository.AuditLogRepository
+	writer *auditlog.Writer
 }
 
-// NewAuditLogger creates a new AuditLogger.
-func NewAuditLogger(repo *repository.AuditLogRepository) *AuditLogger {
-	return &AuditLogger{repo: repo}
+// NewAuditLogger creates a new AuditLogger that hands events to writer.
+func NewAuditLogger(writer *auditlog.Writer) *AuditLogger {
+	return &AuditLogger{writer: writer}
 }
 
 // Log creates an audit log entry with information extracted from the Gin context.
 func (a *AuditLogger) Log(c *gin.Context, action, resourceType string, resourceID *uuid.UUID, details interface{}) {
+	// Queued for the audit writer to avoid blocking the response
+	a.writer.Enqueue(a.Entry(c, action, resourceType, resourceID, details))
+}
+
+// Entry builds the audit log entry Log would write, for changes that write their entry
+// in their own transaction.
+func (a *AuditLogger) Entry(c *gin.Context, action, resourceType string, resourceID *uuid.UUID, details interface{}) *models.AuditLog {
 	// Extract user information from context (set by JWTAuth middleware)
 	var userID *uuid.UUID
 	var username string
@@ -53,13 +63,7 @@ func (a *AuditLogger) Log(c *gin.Context, action, resourceType string, resourceI
 		username = "anonymous"
 	}
 
-	ipAddress := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
-
-	// Log asynchronously to avoid blocking the response
-	go func() {
-		_ = a.repo.CreateWithDetails(context.Background(), userID, username, action, resourceType, resourceID, details, ipAddress, userAgent)
-	}()
+	return newEntry(userID, organizationID(c), username, action, resourceType, resourceID, details, c.ClientIP(), c.GetHeader("User-Agent"))
 }
 
 // LogAuth is a specialized method for authentication events.
@@ -69,8 +73,9 @@ func (a *AuditLogger) LogAuth(c *gin.Context, action string, username string, su
 	}
 	details["success"] = success
 
-	var userID *uuid.UUID
+	var userID, orgID *uuid.UUID
 	if success {
+		orgID = organizationID(c)
 		if userIDStr, exists := c.Get("user_id"); exists {
 			if uid, ok := userIDStr.(string); ok {
 				if parsed, err := uuid.Parse(uid); err == nil {
@@ -83,7 +88,41 @@ func (a *AuditLogger) LogAuth(c *gin.Context, action string, username string, su
 	ipAddress := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
 
-	go func() {
-		_ = a.repo.CreateWithDetails(context.Background(), userID, username, action, "session", nil, details, ipAddress, userAgent)
-	}()
+	a.writer.Enqueue(newEntry(userID, orgID, username, action, "session", nil, details, ipAddress, userAgent))
+}
+
+// organizationID returns the organization the request works in, nil if there is none.
+func organizationID(c *gin.Context) *uuid.UUID {
+	if id := OrganizationFrom(c); id != uuid.Nil {
+		return &id
+	}
+	return nil
+}
+
+// newEntry builds an audit entry timestamped now.
+func newEntry(userID, orgID *uuid.UUID, username, action, resourceType string, resourceID *uuid.UUID, details interface{}, ipAddress, userAgent string) *models.AuditLog {
+	var detailsJSON string
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			slog.Error("audit: cannot encode details", "error", err, "action", action)
+		} else {
+			detailsJSON = string(b)
+		}
+	}
+
+	return &models.AuditLog{
+		ID:           uuid.New(),
+		UserID:       userID,
+		Username:     username,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      detailsJSON,
+		IPAddress:    ipAddress,
+		UserAgent:    userAgent,
+		CreatedAt:    time.Now(),
+
+		OrganizationID: orgID,
+	}
 }
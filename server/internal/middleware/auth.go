@@ -11,6 +11,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 
 	"inventario/server/internal/repository"
 	"inventario/shared/dto"
@@ -18,7 +19,7 @@ import (
 
 // DeviceAuth validates the device token from the Authorization header.
 // On success it sets "device_id" (uuid.UUID) in the Gin context.
-func DeviceAuth(tokenRepo *repository.TokenRepository) gin.HandlerFunc {
+func DeviceAuth(tokenRepo repository.TokenStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if !strings.HasPrefix(header, "Bearer ") {
@@ -42,9 +43,19 @@ func DeviceAuth(tokenRepo *repository.TokenRepository) gin.HandlerFunc {
 }
 
 // JWTAuth validates the JWT cookie and extracts user claims.
-// On success it sets "user_id" and "username" in the Gin context.
-func JWTAuth(jwtSecret string) gin.HandlerFunc {
+// The token's "jti" must name an active server-side session, whose expiry slides
+// forward by idleTimeout on activity. On success it sets "user_id", "username",
+// "user_role", "session_id" (uuid.UUID) and, when the session has one,
+// "session_organization_id" (uuid.UUID) in the Gin context.
+// A personal API token sent as "Authorization: Bearer inv_..." is accepted instead
+// of the cookie when apiTokenRepo is not nil; see RequireScope.
+func JWTAuth(jwtSecret string, sessionRepo repository.SessionStore, idleTimeout time.Duration, apiTokenRepo repository.APITokenStore, auditLogger *AuditLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if header := c.GetHeader("Authorization"); apiTokenRepo != nil && strings.HasPrefix(header, "Bearer ") {
+			authenticateAPIToken(c, apiTokenRepo, auditLogger, strings.TrimPrefix(header, "Bearer "))
+			return
+		}
+
 		cookie, err := c.Cookie("session")
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "authentication required"})
@@ -75,8 +86,29 @@ func JWTAuth(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
+		// The session must still exist server-side: logout, revocation and
+		// password or role changes end it before the JWT expires.
+		jti, _ := claims["jti"].(string)
+		sessionID, err := uuid.Parse(jti)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid or expired token"})
+			return
+		}
+		session, err := sessionRepo.GetActive(c.Request.Context(), sessionID)
+		if err != nil || session.UserID.String() != claims["sub"] {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "session expired or revoked"})
+			return
+		}
+		if _, err := sessionRepo.Touch(c.Request.Context(), sessionID, c.ClientIP(), idleTimeout); err != nil {
+			slog.Warn("failed to record session activity", "error", err, "session_id", sessionID)
+		}
+
 		c.Set("user_id", claims["sub"])
 		c.Set("username", claims["username"])
+		c.Set("session_id", sessionID)
+		if session.OrganizationID != nil {
+			c.Set("session_organization_id", *session.OrganizationID)
+		}
 
 		// Extract role from claims (with fallback to viewer for older tokens)
 		role, _ := claims["role"].(string)
@@ -1,17 +1,28 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// rawBodyKey holds the request body before the first MaxBodySize wrapped it.
+const rawBodyKey = "raw_body"
+
 // MaxBodySize limits the size of the request body to prevent OOM attacks.
-// size is the maximum allowed body size in bytes.
+// size is the maximum allowed body size in bytes. On a route, it replaces the limit
+// set by an earlier MaxBodySize (e.g. the global DefaultMaxBodySize).
 func MaxBodySize(size int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Body != nil {
-			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, size)
+			body := c.Request.Body
+			if raw, ok := c.Get(rawBodyKey); ok {
+				body = raw.(io.ReadCloser)
+			} else {
+				c.Set(rawBodyKey, body)
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, body, size)
 		}
 		c.Next()
 	}
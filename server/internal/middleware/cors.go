@@ -3,23 +3,50 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORS handles Cross-Origin Resource Sharing headers for the given allowed origins.
-func CORS(origins []string) gin.HandlerFunc {
-	allowed := make(map[string]bool, len(origins))
-	for _, o := range origins {
-		allowed[strings.TrimSpace(o)] = true
+// Origins holds the origins allowed to call the API from a browser. Set replaces them
+// while the server runs, on configuration reloads.
+type Origins struct {
+	current atomic.Pointer[originSet]
+}
+
+type originSet struct {
+	allowed map[string]bool
+	csp     string // Content-Security-Policy of SecurityHeaders
+}
+
+// NewOrigins creates an Origins holding origins.
+func NewOrigins(origins []string) *Origins {
+	o := &Origins{}
+	o.Set(origins)
+	return o
+}
+
+// Set replaces the allowed origins.
+func (o *Origins) Set(origins []string) {
+	set := &originSet{allowed: make(map[string]bool, len(origins))}
+	list := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		list = append(list, origin)
+		set.allowed[origin] = true
 	}
+	set.csp = contentSecurityPolicy(list)
+	o.current.Store(set)
+}
 
+// CORS handles Cross-Origin Resource Sharing headers for the allowed origins.
+func CORS(origins *Origins) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
-		if allowed[origin] {
+		if origins.current.Load().allowed[origin] {
 			c.Header("Access-Control-Allow-Origin", origin)
 			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Enrollment-Key")
+			c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-Enrollment-Key, Last-Event-ID")
 			c.Header("Access-Control-Allow-Credentials", "true")
 			c.Header("Access-Control-Max-Age", "86400")
 		}
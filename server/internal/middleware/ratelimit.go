@@ -2,71 +2,109 @@
 package middleware
 
 import (
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"inventario/server/internal/config"
+	"inventario/server/internal/ratelimit"
 	"inventario/shared/dto"
 )
 
-// rateLimiter tracks request counts per IP within a sliding window.
-type rateLimiter struct {
-	mu       sync.Mutex
-	visitors map[string]*visitor
-	limit    int
-	window   time.Duration
-}
+// RateLimitKey derives the key a request is counted under; an empty key skips the limit.
+type RateLimitKey func(c *gin.Context) string
 
-type visitor struct {
-	count   int
-	resetAt time.Time
+// ByIP counts requests per client IP.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
 }
 
-func newRateLimiter(limit int, window time.Duration) *rateLimiter {
-	rl := &rateLimiter{
-		visitors: make(map[string]*visitor),
-		limit:    limit,
-		window:   window,
+// ByUser counts requests per authenticated user (session or API token), falling back
+// to the client IP. Must be used after JWTAuth.
+func ByUser(c *gin.Context) string {
+	if id := c.GetString("user_id"); id != "" {
+		return "user:" + id
 	}
-	// Cleanup expired entries every minute.
-	go func() {
-		for {
-			time.Sleep(time.Minute)
-			rl.mu.Lock()
-			now := time.Now()
-			for ip, v := range rl.visitors {
-				if now.After(v.resetAt) {
-					delete(rl.visitors, ip)
-				}
-			}
-			rl.mu.Unlock()
+	return ByIP(c)
+}
+
+// ByDevice counts requests per enrolled device, falling back to the client IP.
+// Must be used after DeviceAuth.
+func ByDevice(c *gin.Context) string {
+	if val, exists := c.Get("device_id"); exists {
+		if id, ok := val.(uuid.UUID); ok {
+			return "device:" + id.String()
 		}
-	}()
-	return rl
+	}
+	return ByIP(c)
+}
+
+// Rate is the rate of a group of rate-limited routes. Set changes it while the server
+// runs, on configuration reloads.
+type Rate struct {
+	current atomic.Pointer[config.Rate]
 }
 
-func (rl *rateLimiter) allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// Set replaces the rate.
+func (r *Rate) Set(rate config.Rate) {
+	r.current.Store(&rate)
+}
 
-	now := time.Now()
-	v, exists := rl.visitors[ip]
-	if !exists || now.After(v.resetAt) {
-		rl.visitors[ip] = &visitor{count: 1, resetAt: now.Add(rl.window)}
-		return true
-	}
-	v.count++
-	return v.count <= rl.limit
+// RateLimits are the rates of the rate-limited route groups (see config.RateLimitConfig).
+type RateLimits struct {
+	Enroll, Agent, AgentDownload, Login, SSO, MFA, EventStream Rate
+}
+
+// NewRateLimits creates the RateLimits of cfg.
+func NewRateLimits(cfg config.RateLimitConfig) *RateLimits {
+	r := &RateLimits{}
+	r.Set(cfg)
+	return r
 }
 
-// RateLimit returns a Gin middleware that limits requests per IP.
-// limit is the max number of requests allowed within the given window duration.
-func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
-	rl := newRateLimiter(limit, window)
+// Set replaces the rates with those of cfg.
+func (r *RateLimits) Set(cfg config.RateLimitConfig) {
+	r.Enroll.Set(cfg.Enroll)
+	r.Agent.Set(cfg.Agent)
+	r.AgentDownload.Set(cfg.AgentDownload)
+	r.Login.Set(cfg.Login)
+	r.SSO.Set(cfg.SSO)
+	r.MFA.Set(cfg.MFA)
+	r.EventStream.Set(cfg.EventStream)
+}
+
+// RateLimit allows the current rate of requests for each route and key, counted by
+// limiter. It sets X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset
+// (seconds until the full limit is available again) and answers 429 with Retry-After
+// once exhausted. Requests are let through when the limiter itself fails.
+func RateLimit(limiter ratelimit.Limiter, rate *Rate, key RateLimitKey) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !rl.allow(c.ClientIP()) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		r := rate.current.Load()
+		res, err := limiter.Allow(c.Request.Context(), c.Request.Method+" "+c.FullPath()+" "+k, r.Limit, r.Window)
+		if err != nil {
+			slog.Error("rate limiter unavailable", "error", err, "path", c.FullPath())
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if !res.Allowed {
+			header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, dto.ErrorResponse{
 				Error: "too many requests, please try again later",
 			})
@@ -75,3 +113,7 @@ func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
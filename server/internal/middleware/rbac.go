@@ -1,37 +1,131 @@
 package middleware
 
 import (
+	"log/slog"
 	"net/http"
+	"slices"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
+	"inventario/server/internal/authz"
+	"inventario/server/internal/repository"
 	"inventario/shared/dto"
 )
 
-// RequireRole ensures the authenticated user has one of the specified roles.
-// Must be used after JWTAuth middleware.
-func RequireRole(allowedRoles ...string) gin.HandlerFunc {
+// LoadGrants resolves the organization the request works in and the authenticated
+// user's permissions there, and stores them as "organization_id" (uuid.UUID),
+// "super_admin" (bool) and "grants" (authz.Grants) in the Gin context.
+// Users work in their own organization; super-admins in the one their session switched
+// to, where they hold every permission. Must be used after JWTAuth.
+func LoadGrants(roleRepo repository.RoleStore, userRepo repository.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("user_role")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "role information not found"})
+		userID, err := uuid.Parse(c.GetString("user_id"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid session"})
 			return
 		}
 
-		role, ok := userRole.(string)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "invalid role format"})
+		user, err := userRepo.GetByID(c.Request.Context(), userID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid session"})
 			return
 		}
 
-		// Check if user's role is in allowed roles
-		for _, allowedRole := range allowedRoles {
-			if role == allowedRole {
-				c.Next()
+		orgID := user.OrganizationID
+		var grants authz.Grants
+		if user.SuperAdmin {
+			if val, exists := c.Get("session_organization_id"); exists {
+				if id, ok := val.(uuid.UUID); ok {
+					orgID = id
+				}
+			}
+			grants = authz.SuperAdmin()
+		} else {
+			bindings, err := roleRepo.BindingsForUser(c.Request.Context(), userID)
+			if err != nil {
+				slog.Error("failed to load permissions", "error", err, "user_id", userID)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "failed to load permissions"})
+				return
+			}
+			grants = authz.NewGrants(bindings)
+		}
+
+		c.Set("organization_id", orgID)
+		c.Set("super_admin", user.SuperAdmin)
+		c.Set("grants", grants.In(orgID))
+		c.Next()
+	}
+}
+
+// RequireSuperAdmin restricts deployment-wide endpoints (organizations, shared roles,
+// agent releases) to super-admins. Requests made with an API token also need the
+// given token scope. Must be used after LoadGrants.
+func RequireSuperAdmin(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !IsSuperAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "super-admin required"})
+			return
+		}
+		if !tokenAllows(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "api token lacks scope " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// IsSuperAdmin reports whether LoadGrants found the user to be a super-admin.
+func IsSuperAdmin(c *gin.Context) bool {
+	return c.GetBool("super_admin")
+}
+
+// OrganizationFrom returns the organization set by LoadGrants, or by the login
+// handlers for the user signing in; uuid.Nil if there is none.
+func OrganizationFrom(c *gin.Context) uuid.UUID {
+	if val, exists := c.Get("organization_id"); exists {
+		if id, ok := val.(uuid.UUID); ok {
+			return id
+		}
+	}
+	return uuid.Nil
+}
+
+// RequirePermission ensures the user holds the permission for at least one department.
+// Requests made with an API token also need the matching token scope.
+// Must be used after LoadGrants; handlers narrow the work to GrantsFrom(c).Scope(p).
+func RequirePermission(p authz.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GrantsFrom(c).Has(p) {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "insufficient permissions"})
+			return
+		}
+
+		if val, exists := c.Get("api_token_scopes"); exists {
+			scopes, _ := val.([]string)
+			if !slices.Contains(scopes, ScopeFor(p)) {
+				c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "api token lacks scope " + ScopeFor(p)})
 				return
 			}
 		}
+		c.Next()
+	}
+}
+
+// GrantsFrom returns the grants loaded by LoadGrants; empty if there are none.
+func GrantsFrom(c *gin.Context) authz.Grants {
+	if val, exists := c.Get("grants"); exists {
+		if g, ok := val.(authz.Grants); ok {
+			return g
+		}
+	}
+	return authz.Grants{}
+}
 
-		c.AbortWithStatusJSON(http.StatusForbidden, dto.ErrorResponse{Error: "insufficient permissions"})
+// ScopeFor returns the API token scope that unlocks a permission.
+func ScopeFor(p authz.Permission) string {
+	if p == authz.DeviceRead {
+		return ScopeRead
 	}
+	return string(p)
 }
@@ -7,15 +7,29 @@ import (
 )
 
 // SecurityHeaders adds standard security headers to every response.
-// corsOrigins is used to dynamically build the CSP connect-src directive
-// so that allowed API origins don't need to be hardcoded.
-func SecurityHeaders(corsOrigins []string) gin.HandlerFunc {
+// The allowed CORS origins are used to dynamically build the CSP connect-src
+// directive so that allowed API origins don't need to be hardcoded.
+func SecurityHeaders(origins *Origins) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-Frame-Options", "DENY")
+		c.Header("X-XSS-Protection", "1; mode=block")
+		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
+		c.Header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
+		c.Header("Content-Security-Policy", origins.current.Load().csp)
+		c.Next()
+	}
+}
+
+// contentSecurityPolicy returns the Content-Security-Policy allowing connections to
+// the CORS origins.
+func contentSecurityPolicy(corsOrigins []string) string {
 	connectSrc := "'self'"
 	if len(corsOrigins) > 0 {
 		connectSrc += " " + strings.Join(corsOrigins, " ")
 	}
 
-	csp := strings.Join([]string{
+	return strings.Join([]string{
 		"default-src 'self'",
 		"script-src 'self'",
 		"style-src 'self' 'unsafe-inline'",
@@ -23,14 +37,4 @@ func SecurityHeaders(corsOrigins []string) gin.HandlerFunc {
 		"font-src 'self'",
 		"connect-src " + connectSrc,
 	}, "; ")
-
-	return func(c *gin.Context) {
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-Frame-Options", "DENY")
-		c.Header("X-XSS-Protection", "1; mode=block")
-		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-		c.Header("Permissions-Policy", "camera=(), microphone=(), geolocation=()")
-		c.Header("Content-Security-Policy", csp)
-		c.Next()
-	}
 }
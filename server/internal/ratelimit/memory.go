@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps rate limit state in process memory. Limits apply per API replica and
+// reset on restart.
+type Memory struct {
+	mu   sync.Mutex
+	tats map[string]time.Time
+}
+
+// NewMemory creates a Memory limiter and starts removing idle keys every minute.
+func NewMemory() *Memory {
+	m := &Memory{tats: make(map[string]time.Time)}
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			m.mu.Lock()
+			now := time.Now()
+			for key, tat := range m.tats {
+				if tat.Before(now) {
+					delete(m.tats, key)
+				}
+			}
+			m.mu.Unlock()
+		}
+	}()
+	return m
+}
+
+// Allow implements Limiter.
+func (m *Memory) Allow(_ context.Context, key string, limit int, window time.Duration) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res, tat := decide(time.Now(), m.tats[key], limit, window)
+	m.tats[key] = tat
+	return res, nil
+}
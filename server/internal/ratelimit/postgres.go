@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres keeps rate limit state in the rate_limits table so that every API replica
+// shares the same limits. The database clock is used, so replicas need not agree on time.
+type Postgres struct {
+	db *sqlx.DB
+}
+
+// NewPostgres creates a Postgres limiter.
+func NewPostgres(db *sqlx.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+type tatRow struct {
+	TAT time.Time `db:"tat"`
+	Now time.Time `db:"now"`
+}
+
+// Allow implements Limiter. An allowed request advances the key's tat in a single
+// statement; a refused one leaves the row untouched and reads it back for the headers.
+func (p *Postgres) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	interval := window / time.Duration(limit)
+
+	var row tatRow
+	err := p.db.GetContext(ctx, &row,
+		`INSERT INTO rate_limits (key, tat) VALUES ($1, NOW() + $2 * INTERVAL '1 microsecond')
+		 ON CONFLICT (key) DO UPDATE
+		 SET tat = GREATEST(rate_limits.tat, NOW()) + $2 * INTERVAL '1 microsecond'
+		 WHERE GREATEST(rate_limits.tat, NOW()) + $2 * INTERVAL '1 microsecond' <= NOW() + $3 * INTERVAL '1 microsecond'
+		 RETURNING tat, NOW() AS now`,
+		key, interval.Microseconds(), window.Microseconds())
+	if err == nil {
+		return result(row.Now, row.TAT, limit, window), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, fmt.Errorf("rate limit: %w", err)
+	}
+
+	if err := p.db.GetContext(ctx, &row, "SELECT tat, NOW() AS now FROM rate_limits WHERE key = $1", key); err != nil {
+		return Result{}, fmt.Errorf("rate limit: %w", err)
+	}
+	res, _ := decide(row.Now, row.TAT, limit, window)
+	res.Allowed, res.Remaining = false, 0
+	return res, nil
+}
@@ -0,0 +1,54 @@
+// Package ratelimit limits request rates per key with the generic cell rate algorithm
+// (GCRA), a token bucket that stores a single timestamp per key: a key may make limit
+// requests in a burst and then one request every window/limit. State lives either in
+// process memory or in PostgreSQL so that several API replicas share the same limits.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter decides whether another request may be made for a key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+}
+
+// Result is the outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int           // requests that may still be made right now
+	ResetAfter time.Duration // until the full burst is available again
+	RetryAfter time.Duration // until the next request is allowed; zero when Allowed
+}
+
+// decide applies GCRA given the key's theoretical arrival time (tat) and returns the
+// result and the new tat to store. A zero tat means the key has no state yet.
+func decide(now, tat time.Time, limit int, window time.Duration) (Result, time.Time) {
+	interval := window / time.Duration(limit)
+	if tat.Before(now) {
+		tat = now
+	}
+	next := tat.Add(interval)
+
+	if next.Sub(now) > window {
+		return Result{
+			Limit:      limit,
+			ResetAfter: tat.Sub(now),
+			RetryAfter: next.Sub(now) - window,
+		}, tat
+	}
+	return result(now, next, limit, window), next
+}
+
+// result describes an allowed request that moved the key's tat to next.
+func result(now, next time.Time, limit int, window time.Duration) Result {
+	interval := window / time.Duration(limit)
+	return Result{
+		Allowed:    true,
+		Limit:      limit,
+		Remaining:  int((window - next.Sub(now)) / interval),
+		ResetAfter: next.Sub(now),
+	}
+}
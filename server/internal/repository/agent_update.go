@@ -0,0 +1,288 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// releaseChunkSize is the size of the agent_release_chunks rows an artifact is split into.
+const releaseChunkSize = 1 << 20 // 1 MB
+
+// ErrReleaseExists is returned when a release with the same version, platform and
+// channel was already published.
+var ErrReleaseExists = errors.New("release already exists")
+
+// ErrRolloutReference is returned when a rollout names a release, department or
+// device that does not exist.
+var ErrRolloutReference = errors.New("release, department or device not found")
+
+// AgentUpdateRepository handles agent releases, rollouts and update reports.
+type AgentUpdateRepository struct {
+	db           *sqlx.DB
+	activityRepo *DeviceActivityRepository
+}
+
+// NewAgentUpdateRepository creates a new AgentUpdateRepository.
+func NewAgentUpdateRepository(db *sqlx.DB, activityRepo *DeviceActivityRepository) *AgentUpdateRepository {
+	return &AgentUpdateRepository{db: db, activityRepo: activityRepo}
+}
+
+// CreateRelease stores a release and its artifact, read from artifact in chunks,
+// in one transaction. rel.CreatedAt is set from the database.
+func (r *AgentUpdateRepository) CreateRelease(ctx context.Context, rel *models.AgentRelease, artifact io.Reader) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	err = tx.GetContext(ctx, &rel.CreatedAt,
+		`INSERT INTO agent_releases (id, version, os, arch, channel, sha256, signature, size_bytes, notes, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING created_at`,
+		rel.ID, rel.Version, rel.OS, rel.Arch, rel.Channel, rel.SHA256, rel.Signature, rel.SizeBytes, rel.Notes, rel.CreatedBy)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrReleaseExists
+		}
+		return fmt.Errorf("insert release: %w", err)
+	}
+
+	buf := make([]byte, releaseChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(artifact, buf)
+		if n > 0 {
+			if _, err := tx.ExecContext(ctx,
+				"INSERT INTO agent_release_chunks (release_id, seq, data) VALUES ($1, $2, $3)",
+				rel.ID, seq, buf[:n]); err != nil {
+				return fmt.Errorf("insert release chunk: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read artifact: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListReleases returns all releases, newest first.
+func (r *AgentUpdateRepository) ListReleases(ctx context.Context) ([]models.AgentRelease, error) {
+	var releases []models.AgentRelease
+	if err := r.db.SelectContext(ctx, &releases, "SELECT * FROM agent_releases ORDER BY created_at DESC"); err != nil {
+		return nil, fmt.Errorf("list releases: %w", err)
+	}
+	if releases == nil {
+		releases = []models.AgentRelease{}
+	}
+	return releases, nil
+}
+
+// GetRelease returns a single release.
+func (r *AgentUpdateRepository) GetRelease(ctx context.Context, id uuid.UUID) (*models.AgentRelease, error) {
+	var rel models.AgentRelease
+	if err := r.db.GetContext(ctx, &rel, "SELECT * FROM agent_releases WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+// DeleteRelease removes a release with its artifact and rollouts. Update reports keep
+// their versions but lose the reference.
+func (r *AgentUpdateRepository) DeleteRelease(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM agent_releases WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete release: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// WriteArtifact copies the artifact of a release to w, one chunk at a time.
+func (r *AgentUpdateRepository) WriteArtifact(ctx context.Context, id uuid.UUID, w io.Writer) error {
+	rows, err := r.db.QueryContext(ctx, "SELECT data FROM agent_release_chunks WHERE release_id = $1 ORDER BY seq", id)
+	if err != nil {
+		return fmt.Errorf("read release chunks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("scan release chunk: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+const rolloutSelect = `SELECT ro.*, rel.version, rel.os, rel.arch, rel.channel
+	FROM agent_rollouts ro
+	JOIN agent_releases rel ON rel.id = ro.release_id`
+
+// ListRollouts returns all rollouts with their release, newest first.
+func (r *AgentUpdateRepository) ListRollouts(ctx context.Context) ([]models.AgentRollout, error) {
+	var rollouts []models.AgentRollout
+	if err := r.db.SelectContext(ctx, &rollouts, rolloutSelect+" ORDER BY ro.created_at DESC"); err != nil {
+		return nil, fmt.Errorf("list rollouts: %w", err)
+	}
+	if rollouts == nil {
+		rollouts = []models.AgentRollout{}
+	}
+	return rollouts, nil
+}
+
+// GetRollout returns a single rollout with its release.
+func (r *AgentUpdateRepository) GetRollout(ctx context.Context, id uuid.UUID) (*models.AgentRollout, error) {
+	var ro models.AgentRollout
+	if err := r.db.GetContext(ctx, &ro, rolloutSelect+" WHERE ro.id = $1", id); err != nil {
+		return nil, err
+	}
+	return &ro, nil
+}
+
+// CreateRollout inserts a rollout with ro.ID.
+func (r *AgentUpdateRepository) CreateRollout(ctx context.Context, ro *models.AgentRollout) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO agent_rollouts (id, release_id, percentage, department_id, device_id, paused, rollback, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		ro.ID, ro.ReleaseID, ro.Percentage, ro.DepartmentID, ro.DeviceID, ro.Paused, ro.Rollback, ro.CreatedBy)
+	return rolloutError("create rollout", err)
+}
+
+// UpdateRollout replaces the target and state of a rollout. Devices whose update to
+// the previous target failed are offered the rollout again.
+func (r *AgentUpdateRepository) UpdateRollout(ctx context.Context, ro *models.AgentRollout) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE agent_rollouts SET release_id = $2, percentage = $3, department_id = $4, device_id = $5,
+			paused = $6, rollback = $7, updated_at = NOW()
+		 WHERE id = $1`,
+		ro.ID, ro.ReleaseID, ro.Percentage, ro.DepartmentID, ro.DeviceID, ro.Paused, ro.Rollback)
+	if err != nil {
+		return rolloutError("update rollout", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteRollout removes a rollout.
+func (r *AgentUpdateRepository) DeleteRollout(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM agent_rollouts WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete rollout: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func rolloutError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if IsForeignKeyViolation(err) {
+		return ErrRolloutReference
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// RolloutsFor returns the active rollouts that apply to a device on the given platform
+// and channel, most specific first: pins of the device (on any channel), then rollouts
+// of its department, then global ones, newest first within each group. Rollouts whose
+// release the device failed to install since the rollout last changed are left out.
+func (r *AgentUpdateRepository) RolloutsFor(ctx context.Context, deviceID uuid.UUID, departmentID *uuid.UUID, os, arch, channel string) ([]models.AgentRollout, error) {
+	var rollouts []models.AgentRollout
+	err := r.db.SelectContext(ctx, &rollouts, rolloutSelect+`
+		WHERE NOT ro.paused AND rel.os = $2 AND rel.arch = $3
+		  AND (ro.device_id = $1
+		       OR (ro.device_id IS NULL AND rel.channel = $4 AND (ro.department_id IS NULL OR ro.department_id = $5)))
+		  AND NOT EXISTS (
+		      SELECT 1 FROM agent_update_reports rep
+		      WHERE rep.device_id = $1 AND rep.release_id = ro.release_id
+		        AND rep.status = 'failed' AND rep.reported_at > ro.updated_at)
+		ORDER BY ro.device_id IS NULL, ro.department_id IS NULL, ro.created_at DESC`,
+		deviceID, os, arch, channel, departmentID)
+	if err != nil {
+		return nil, fmt.Errorf("find rollouts: %w", err)
+	}
+	return rollouts, nil
+}
+
+// InsertReport records the outcome of an update attempt and adds it to the device's
+// activity log. A release that no longer exists is not referenced.
+func (r *AgentUpdateRepository) InsertReport(ctx context.Context, deviceID uuid.UUID, req *dto.AgentUpdateReportRequest) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO agent_update_reports (device_id, release_id, from_version, to_version, status, error)
+		 VALUES ($1, (SELECT id FROM agent_releases WHERE id = $2), $3, $4, $5, $6)`,
+		deviceID, req.ReleaseID, req.FromVersion, req.ToVersion, req.Status, req.Error); err != nil {
+		return fmt.Errorf("insert update report: %w", err)
+	}
+
+	entry := ActivityEntry{
+		DeviceID:     deviceID,
+		ActivityType: "agent_updated",
+		Description:  fmt.Sprintf("Agent updated from %s to %s", req.FromVersion, req.ToVersion),
+		OldValue:     &req.FromVersion,
+		NewValue:     &req.ToVersion,
+	}
+	if req.Status == "failed" {
+		entry.ActivityType = "agent_update_failed"
+		entry.Description = fmt.Sprintf("Agent update from %s to %s failed", req.FromVersion, req.ToVersion)
+		meta, _ := json.Marshal(map[string]string{"error": req.Error})
+		metaStr := string(meta)
+		entry.Metadata = &metaStr
+	}
+	if err := r.activityRepo.InsertBatch(ctx, tx, []ActivityEntry{entry}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListReports returns update reports, newest first, optionally filtered by status and device.
+func (r *AgentUpdateRepository) ListReports(ctx context.Context, status string, deviceID *uuid.UUID, limit, offset int) ([]models.AgentUpdateReport, int, error) {
+	where := " WHERE ($1 = '' OR rep.status = $1) AND (" + cast(r.db, "$2", "uuid") + " IS NULL OR rep.device_id = $2)"
+
+	var total int
+	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM agent_update_reports rep"+where, status, deviceID); err != nil {
+		return nil, 0, fmt.Errorf("count update reports: %w", err)
+	}
+
+	var reports []models.AgentUpdateReport
+	if err := r.db.SelectContext(ctx, &reports,
+		`SELECT rep.*, d.hostname FROM agent_update_reports rep
+		 JOIN devices d ON d.id = rep.device_id`+where+`
+		 ORDER BY rep.reported_at DESC LIMIT $3 OFFSET $4`,
+		status, deviceID, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("list update reports: %w", err)
+	}
+	if reports == nil {
+		reports = []models.AgentUpdateReport{}
+	}
+	return reports, total, nil
+}
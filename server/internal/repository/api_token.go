@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// APITokenWithOwner is an API token joined with its owner's current username, role
+// and organization.
+type APITokenWithOwner struct {
+	models.APIToken
+	Username       string    `db:"username"`
+	Role           string    `db:"role"`
+	OrganizationID uuid.UUID `db:"organization_id"`
+}
+
+// APITokenRepository handles personal API token persistence.
+type APITokenRepository struct {
+	db *sqlx.DB
+}
+
+// NewAPITokenRepository creates a new APITokenRepository.
+func NewAPITokenRepository(db *sqlx.DB) *APITokenRepository {
+	return &APITokenRepository{db: db}
+}
+
+// Create inserts a new API token.
+func (r *APITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO api_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		token.ID, token.UserID, token.Name, token.TokenPrefix, token.TokenHash, token.Scopes, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create api token: %w", err)
+	}
+	return nil
+}
+
+// GetActiveByHash returns a token that is neither revoked nor expired, with its owner.
+func (r *APITokenRepository) GetActiveByHash(ctx context.Context, hash string) (*APITokenWithOwner, error) {
+	var token APITokenWithOwner
+	err := r.db.GetContext(ctx, &token,
+		`SELECT t.*, u.username, u.role, u.organization_id
+		 FROM api_tokens t
+		 JOIN users u ON u.id = t.user_id
+		 WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND t.expires_at > NOW()`, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// ListByUser returns all tokens of a user, newest first, including revoked and expired ones.
+func (r *APITokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	var tokens []models.APIToken
+	err := r.db.SelectContext(ctx, &tokens,
+		"SELECT * FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	if tokens == nil {
+		tokens = []models.APIToken{}
+	}
+	return tokens, nil
+}
+
+// ListAll returns the tokens of every user of an organization with their owner, newest first.
+func (r *APITokenRepository) ListAll(ctx context.Context, orgID uuid.UUID) ([]APITokenWithOwner, error) {
+	var tokens []APITokenWithOwner
+	err := r.db.SelectContext(ctx, &tokens,
+		`SELECT t.*, u.username, u.role, u.organization_id
+		 FROM api_tokens t
+		 JOIN users u ON u.id = t.user_id
+		 WHERE u.organization_id = $1
+		 ORDER BY t.created_at DESC`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list api tokens: %w", err)
+	}
+	if tokens == nil {
+		tokens = []APITokenWithOwner{}
+	}
+	return tokens, nil
+}
+
+// Revoke marks a token as revoked. When ownerID is not nil the token must belong to that
+// user; otherwise its owner must belong to the organization orgID.
+func (r *APITokenRepository) Revoke(ctx context.Context, id uuid.UUID, ownerID *uuid.UUID, orgID uuid.UUID) error {
+	query := "UPDATE api_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL"
+	args := []interface{}{id}
+	if ownerID != nil {
+		query += " AND user_id = $2"
+		args = append(args, *ownerID)
+	} else {
+		query += " AND user_id IN (SELECT id FROM users WHERE organization_id = $2)"
+		args = append(args, orgID)
+	}
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("revoke api token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("api token not found")
+	}
+	return nil
+}
+
+// TouchLastUsed records a use of the token. Writes are throttled to one per minute;
+// it returns true when the row was updated.
+func (r *APITokenRepository) TouchLastUsed(ctx context.Context, id uuid.UUID, ip string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE api_tokens SET last_used_at = NOW(), last_used_ip = $1
+		 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < NOW() - `+seconds(r.db, "60")+`)`,
+		ip, id)
+	if err != nil {
+		return false, fmt.Errorf("touch api token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
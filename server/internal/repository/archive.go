@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// Archiver stores the rows a purge deletes. Archive is called with the rows of one
+// table before their deletion commits: rows runs the deletion and calls emit for each
+// deleted row. When Archive fails, the purge of that table is rolled back.
+type Archiver interface {
+	Archive(ctx context.Context, table string, rows func(emit func(row any) error) error) error
+}
+
+// ArchiveTables are the tables whose purged rows are archived, in restore order.
+var ArchiveTables = []string{"audit_logs", "device_activity_log", "hardware_history"}
+
+// The columns of the archived rows, as the RETURNING clause of each purge.
+var (
+	auditArchiveColumns = []string{"id", "seq", "organization_id", "user_id", "username", "action", "resource_type",
+		"resource_id", "COALESCE(CAST(details AS TEXT), '') AS details", "COALESCE(ip_address, '') AS ip_address",
+		"COALESCE(user_agent, '') AS user_agent", "created_at", "prev_hash", "hash"}
+	activityArchiveColumns = []string{"id", "seq", "device_id", "activity_type", "description", "old_value",
+		"new_value", "metadata", "detected_at"}
+	hardwareArchiveColumns = []string{"id", "device_id", "snapshot", "component", "change_type", "field",
+		"old_value", "new_value", "changed_at"}
+)
+
+// ArchivedActivity is a device_activity_log row as archived.
+type ArchivedActivity struct {
+	models.DeviceActivityLog
+	Seq int64 `json:"seq" db:"seq"`
+}
+
+// returning renders columns as a RETURNING list, qualified with the table alias of
+// the DELETE if there is one; columns must then be bare column names.
+func returning(alias string, columns []string) string {
+	if alias == "" {
+		return strings.Join(columns, ", ")
+	}
+	return alias + "." + strings.Join(columns, ", "+alias+".")
+}
+
+// purgeTable runs the DELETE statement query in its own transaction; see purgeRows.
+func purgeTable(ctx context.Context, db *sqlx.DB, ar Archiver, table, query, cols string, newRow func() any, args ...interface{}) (int64, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	n, err := purgeRows(ctx, tx, ar, table, query, cols, newRow, args...)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// purgeRows runs the DELETE statement query on tx and returns the number of rows
+// deleted. With an Archiver, the statement returns cols, scanned into the rows newRow
+// creates, and the deleted rows are archived under table.
+func purgeRows(ctx context.Context, tx *sqlx.Tx, ar Archiver, table, query, cols string, newRow func() any, args ...interface{}) (int64, error) {
+	if ar == nil {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	var n int64
+	err := ar.Archive(ctx, table, func(emit func(any) error) error {
+		rows, err := tx.QueryxContext(ctx, query+" RETURNING "+cols, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			row := newRow()
+			if err := rows.StructScan(row); err != nil {
+				return err
+			}
+			if err := emit(row); err != nil {
+				return err
+			}
+			n++
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("archive %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// ArchiveRepository loads archived rows back into their tables.
+type ArchiveRepository struct {
+	db *sqlx.DB
+}
+
+// NewArchiveRepository creates a new ArchiveRepository.
+func NewArchiveRepository(db *sqlx.DB) *ArchiveRepository {
+	return &ArchiveRepository{db: db}
+}
+
+// RestoreResult counts the rows of a restored archive file.
+type RestoreResult struct {
+	Restored int64 // rows inserted
+	Existing int64 // rows that were already in the table
+	Skipped  int64 // rows of devices that no longer exist
+}
+
+// Restore inserts the archived rows of table that decode returns, until it returns
+// io.EOF, in one transaction. Rows already present are left as they are; device rows
+// are skipped when the device was deleted, and audit entries of deleted users lose
+// their user_id like the entries that were never purged.
+func (r *ArchiveRepository) Restore(ctx context.Context, table string, decode func(dest any) error) (*RestoreResult, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	devices := map[uuid.UUID]bool{}
+	if table != "audit_logs" {
+		var ids []uuid.UUID
+		if err := tx.SelectContext(ctx, &ids, "SELECT id FROM devices"); err != nil {
+			return nil, fmt.Errorf("list devices: %w", err)
+		}
+		for _, id := range ids {
+			devices[id] = true
+		}
+	}
+
+	result := &RestoreResult{}
+	for {
+		var query string
+		var args []interface{}
+		switch table {
+		case "audit_logs":
+			var e models.AuditLog
+			if err = decode(&e); err != nil {
+				break
+			}
+			query = `INSERT INTO audit_logs (id, seq, organization_id, user_id, username, action, resource_type,
+					resource_id, details, ip_address, user_agent, created_at, prev_hash, hash)
+				VALUES ($1, $2, $3, (SELECT id FROM users WHERE id = $4), $5, $6, $7, $8, ` +
+				cast(tx, "NULLIF($9, '')", "jsonb") + `, $10, $11, $12, $13, $14)
+				ON CONFLICT DO NOTHING`
+			args = []interface{}{e.ID, e.Seq, e.OrganizationID, e.UserID, e.Username, e.Action, e.ResourceType,
+				e.ResourceID, e.Details, e.IPAddress, e.UserAgent, e.CreatedAt, e.PrevHash, e.Hash}
+		case "device_activity_log":
+			var a ArchivedActivity
+			if err = decode(&a); err != nil {
+				break
+			}
+			if !devices[a.DeviceID] {
+				result.Skipped++
+				continue
+			}
+			query = `INSERT INTO device_activity_log (id, seq, device_id, activity_type, description, old_value,
+					new_value, metadata, detected_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				ON CONFLICT DO NOTHING`
+			args = []interface{}{a.ID, a.Seq, a.DeviceID, a.ActivityType, a.Description, a.OldValue, a.NewValue,
+				a.Metadata, a.DetectedAt}
+		case "hardware_history":
+			var h models.HardwareHistory
+			if err = decode(&h); err != nil {
+				break
+			}
+			if !devices[h.DeviceID] {
+				result.Skipped++
+				continue
+			}
+			query = `INSERT INTO hardware_history (id, device_id, snapshot, component, change_type, field,
+					old_value, new_value, changed_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				ON CONFLICT DO NOTHING`
+			args = []interface{}{h.ID, h.DeviceID, h.Snapshot, h.Component, h.ChangeType, h.Field, h.OldValue,
+				h.NewValue, h.ChangedAt}
+		default:
+			return nil, fmt.Errorf("table %s is not archived", table)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", table, err)
+		}
+
+		res, execErr := tx.ExecContext(ctx, query, args...)
+		if execErr != nil {
+			return nil, fmt.Errorf("restore %s: %w", table, execErr)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Restored++
+		} else {
+			result.Existing++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
@@ -2,37 +2,240 @@ package repository
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
+	"inventario/server/internal/auditchain"
 	"inventario/shared/models"
 )
 
-// AuditLogRepository handles audit log persistence.
+// auditChainLock is the advisory lock that serializes writes to the audit hash chain.
+const auditChainLock = 0x61756474 // "audt"
+
+// Reasons of the checkpoints that mark the chain rather than record a purge. Every
+// entry after the genesis' last_seq must be chained; entries after the hash_v2 one
+// are hashed with auditchain.HashV2, the ones before it with HashV1.
+const (
+	auditGenesisReason = "genesis"
+	auditHashV2Reason  = "hash_v2"
+)
+
+// AuditLogRepository handles audit log persistence. Entries form a hash chain keyed
+// with chainKey; see package auditchain.
 type AuditLogRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	chainKey []byte
 }
 
 // NewAuditLogRepository creates a new AuditLogRepository.
-func NewAuditLogRepository(db *sqlx.DB) *AuditLogRepository {
-	return &AuditLogRepository{db: db}
+func NewAuditLogRepository(db *sqlx.DB, chainKey string) *AuditLogRepository {
+	return &AuditLogRepository{db: db, chainKey: []byte(chainKey)}
 }
 
-// Create inserts a new audit log entry.
+// Create appends an audit log entry to the hash chain.
 func (r *AuditLogRepository) Create(ctx context.Context, log *models.AuditLog) error {
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO audit_logs 
-		(id, user_id, username, action, resource_type, resource_id, details, ip_address, user_agent, created_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())`,
-		log.ID, log.UserID, log.Username, log.Action, log.ResourceType, log.ResourceID, log.Details, log.IPAddress, log.UserAgent,
-	)
+	_, err := r.CreateBatch(ctx, []*models.AuditLog{log})
 	return err
 }
 
-// List returns audit logs with filtering and pagination.
+// CreateBatch appends entries to the hash chain, in order, in a single transaction.
+// Entries keep a non-zero CreatedAt (the time the event happened); the others are
+// stamped by the database. Entries whose ID is already stored — a batch retried after
+// an ambiguous commit — are skipped. It returns the number of entries written.
+func (r *AuditLogRepository) CreateBatch(ctx context.Context, logs []*models.AuditLog) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	written, err := appendAuditLogs(ctx, tx, r.chainKey, logs)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return written, nil
+}
+
+// appendAuditLogs appends entries to the hash chain keyed with chainKey within tx, for
+// CreateBatch and for changes audited in their own transaction. The chain stays locked
+// until tx ends.
+func appendAuditLogs(ctx context.Context, tx *sqlx.Tx, chainKey []byte, logs []*models.AuditLog) (int, error) {
+	if err := lockAuditChain(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	lastSeq, lastHash, err := chainHead(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	if err := sealAuditMarkers(ctx, tx, chainKey, lastSeq); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, log := range logs {
+		var createdAt *time.Time
+		if !log.CreatedAt.IsZero() {
+			createdAt = &log.CreatedAt
+		}
+		prevHash := lastHash
+		log.Seq = lastSeq + 1
+		log.PrevHash = &prevHash
+
+		// user_id, created_at and details are read back as stored so the hash matches what
+		// verification reads; a user deleted since the event is stored as NULL, as ON DELETE SET NULL would.
+		err := tx.QueryRowxContext(ctx,
+			`INSERT INTO audit_logs
+			(id, user_id, username, action, resource_type, resource_id, details, ip_address, user_agent, created_at, seq, prev_hash, organization_id)
+			VALUES ($1, (SELECT id FROM users WHERE id = $2), $3, $4, $5, $6, `+cast(tx, "COALESCE(NULLIF($7, ''), '{}')", "jsonb")+`, $8, $9,
+			        COALESCE(`+cast(tx, "$10", "timestamptz")+`, clock_timestamp()), $11, $12, $13)
+			ON CONFLICT (id) DO NOTHING
+			RETURNING user_id, created_at, details`,
+			log.ID, log.UserID, log.Username, log.Action, log.ResourceType, log.ResourceID, log.Details, log.IPAddress, log.UserAgent,
+			createdAt, log.Seq, prevHash, log.OrganizationID,
+		).Scan(&log.UserID, &log.CreatedAt, &log.Details)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("insert audit log: %w", err)
+		}
+
+		hash := auditchain.EntryHash(chainKey, log, auditchain.HashV2)
+		log.Hash = &hash
+		if _, err := tx.ExecContext(ctx, "UPDATE audit_logs SET hash = $1 WHERE id = $2", hash, log.ID); err != nil {
+			return 0, fmt.Errorf("hash audit log: %w", err)
+		}
+		lastSeq, lastHash = log.Seq, hash
+		written++
+	}
+	return written, nil
+}
+
+// lockAuditChain serializes writes to the hash chain until tx ends. SQLite
+// transactions take the database write lock when they begin, which already does.
+func lockAuditChain(ctx context.Context, tx *sqlx.Tx) error {
+	if isSQLite(tx) {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", auditChainLock); err != nil {
+		return fmt.Errorf("lock audit chain: %w", err)
+	}
+	return nil
+}
+
+// SealMarkers records where the hash chain started and where the current hash version
+// starts, if that is not recorded yet, so that verification can tell entries written
+// before the chain from entries whose hashes were removed and hash each entry the way
+// it was written. Appending entries records them too; calling it at start-up covers
+// chains that started before the markers existed.
+func (r *AuditLogRepository) SealMarkers(ctx context.Context) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := lockAuditChain(ctx, tx); err != nil {
+		return err
+	}
+	lastSeq, _, err := chainHead(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := sealAuditMarkers(ctx, tx, r.chainKey, lastSeq); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// sealAuditMarkers records the signed genesis and hash_v2 checkpoints within tx, which
+// must hold the chain lock, unless they exist already. The chain starts after headSeq,
+// or before the oldest chained entry of a chain that started before genesis checkpoints
+// existed; entries after headSeq are hashed with the current version.
+func sealAuditMarkers(ctx context.Context, tx *sqlx.Tx, chainKey []byte, headSeq int64) error {
+	var reasons []string
+	if err := tx.SelectContext(ctx, &reasons,
+		"SELECT reason FROM audit_checkpoints WHERE reason IN ($1, $2)", auditGenesisReason, auditHashV2Reason); err != nil {
+		return fmt.Errorf("read audit chain markers: %w", err)
+	}
+
+	if !slices.Contains(reasons, auditGenesisReason) {
+		var firstChained sql.NullInt64
+		if err := tx.GetContext(ctx, &firstChained, "SELECT MIN(seq) FROM audit_logs WHERE hash IS NOT NULL"); err != nil {
+			return fmt.Errorf("read audit genesis: %w", err)
+		}
+		genesisSeq := headSeq
+		if firstChained.Valid {
+			genesisSeq = firstChained.Int64 - 1
+		}
+		if err := insertAuditMarker(ctx, tx, chainKey, auditGenesisReason, genesisSeq); err != nil {
+			return err
+		}
+	}
+	if !slices.Contains(reasons, auditHashV2Reason) {
+		if err := insertAuditMarker(ctx, tx, chainKey, auditHashV2Reason, headSeq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertAuditMarker records a signed checkpoint that marks the chain at seq.
+func insertAuditMarker(ctx context.Context, tx *sqlx.Tx, chainKey []byte, reason string, seq int64) error {
+	cp := &models.AuditCheckpoint{
+		ID:        uuid.New(),
+		LastSeq:   seq,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC().Truncate(timestampPrecision(tx)),
+	}
+	cp.Signature = auditchain.CheckpointSignature(chainKey, cp)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_checkpoints (id, last_seq, last_hash, purged, reason, signature, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		cp.ID, cp.LastSeq, cp.LastHash, cp.Purged, cp.Reason, cp.Signature, cp.CreatedAt); err != nil {
+		return fmt.Errorf("record audit %s checkpoint: %w", reason, err)
+	}
+	return nil
+}
+
+// chainHead returns the sequence number and hash the next entry chains to: the newest
+// entry, or the newest checkpoint when every entry has been purged.
+func chainHead(ctx context.Context, tx *sqlx.Tx) (int64, string, error) {
+	var head struct {
+		Seq  int64          `db:"seq"`
+		Hash sql.NullString `db:"hash"`
+	}
+	err := tx.GetContext(ctx, &head, "SELECT seq, hash FROM audit_logs ORDER BY seq DESC LIMIT 1")
+	if errors.Is(err, sql.ErrNoRows) {
+		err = tx.GetContext(ctx, &head,
+			"SELECT last_seq AS seq, last_hash AS hash FROM audit_checkpoints WHERE reason NOT IN ($1, $2) ORDER BY last_seq DESC LIMIT 1",
+			auditGenesisReason, auditHashV2Reason)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("read audit chain head: %w", err)
+	}
+	return head.Seq, head.Hash.String, nil
+}
+
+// List returns audit logs with filtering and pagination. The "organization_id" filter
+// restricts them to one organization; with "include_unassigned" it also returns
+// entries without an organization (failed logins, system events).
 func (r *AuditLogRepository) List(ctx context.Context, filters map[string]interface{}, limit, offset int) ([]models.AuditLog, int, error) {
 	query := "SELECT * FROM audit_logs WHERE 1=1"
 	countQuery := "SELECT COUNT(*) FROM audit_logs WHERE 1=1"
@@ -40,6 +243,17 @@ func (r *AuditLogRepository) List(ctx context.Context, filters map[string]interf
 	argIndex := 1
 
 	// Apply filters
+	if orgID, ok := filters["organization_id"].(uuid.UUID); ok {
+		cond := fmt.Sprintf(" AND organization_id = $%d", argIndex)
+		if unassigned, _ := filters["include_unassigned"].(bool); unassigned {
+			cond = fmt.Sprintf(" AND (organization_id = $%d OR organization_id IS NULL)", argIndex)
+		}
+		query += cond
+		countQuery += cond
+		args = append(args, orgID)
+		argIndex++
+	}
+
 	if userID, ok := filters["user_id"].(uuid.UUID); ok {
 		query += fmt.Sprintf(" AND user_id = $%d", argIndex)
 		countQuery += fmt.Sprintf(" AND user_id = $%d", argIndex)
@@ -93,14 +307,14 @@ func (r *AuditLogRepository) List(ctx context.Context, filters map[string]interf
 	return logs, total, nil
 }
 
-// GetByResourceID returns all audit logs for a specific resource.
-func (r *AuditLogRepository) GetByResourceID(ctx context.Context, resourceType string, resourceID uuid.UUID, limit int) ([]models.AuditLog, error) {
+// GetByResourceID returns the audit logs of an organization for a specific resource.
+func (r *AuditLogRepository) GetByResourceID(ctx context.Context, orgID uuid.UUID, resourceType string, resourceID uuid.UUID, limit int) ([]models.AuditLog, error) {
 	var logs []models.AuditLog
 	err := r.db.SelectContext(ctx, &logs,
 		`SELECT * FROM audit_logs 
-		WHERE resource_type = $1 AND resource_id = $2 
-		ORDER BY created_at DESC LIMIT $3`,
-		resourceType, resourceID, limit,
+		WHERE resource_type = $1 AND resource_id = $2 AND organization_id = $3
+		ORDER BY created_at DESC LIMIT $4`,
+		resourceType, resourceID, orgID, limit,
 	)
 	if err != nil {
 		return nil, err
@@ -111,28 +325,238 @@ func (r *AuditLogRepository) GetByResourceID(ctx context.Context, resourceType s
 	return logs, nil
 }
 
-// CreateWithDetails is a helper that marshals details to JSON and creates the log.
-func (r *AuditLogRepository) CreateWithDetails(ctx context.Context, userID *uuid.UUID, username, action, resourceType string, resourceID *uuid.UUID, details interface{}, ipAddress, userAgent string) error {
-	var detailsJSON string
-	if details != nil {
-		b, err := json.Marshal(details)
-		if err != nil {
-			return err
+// AuditChainReport is the result of walking the audit hash chain.
+type AuditChainReport struct {
+	Valid       bool
+	Checked     int64                   // chained entries whose hashes were verified
+	Unchained   int64                   // entries written before the chain existed
+	Genesis     *int64                  // seq after which every entry must be chained, if recorded
+	HashV2      *int64                  // seq after which entries are hashed with auditchain.HashV2, if recorded
+	Checkpoints int                     // purge checkpoints whose signatures were verified
+	Anchor      *models.AuditCheckpoint // checkpoint the walk started from, if any
+	Broken      *AuditChainBreak        // first broken link, when not Valid
+}
+
+// hashVersion returns the auditchain version the entry at seq was hashed with.
+func (r *AuditChainReport) hashVersion(seq int64) int {
+	if r.HashV2 != nil && seq > *r.HashV2 {
+		return auditchain.HashV2
+	}
+	return auditchain.HashV1
+}
+
+// AuditChainBreak describes the first entry (or checkpoint) that fails verification.
+type AuditChainBreak struct {
+	Seq    int64
+	ID     uuid.UUID
+	Reason string
+}
+
+// Verify walks the audit hash chain from the latest purge checkpoint and reports the
+// first broken link: a modified entry, a missing or reordered entry, an unchained
+// entry after the chain started (per the genesis checkpoint), or a checkpoint with an
+// invalid signature.
+func (r *AuditLogRepository) Verify(ctx context.Context) (*AuditChainReport, error) {
+	return verifyAuditChain(ctx, r.db, r.chainKey, nil)
+}
+
+// verifyAuditChain is Verify on q. originalID, when not nil, maps the IDs stored in the
+// entries and checkpoints back to those they were hashed with, for a chain whose IDs
+// were replaced by ResealAuditChain's caller.
+func verifyAuditChain(ctx context.Context, q sqlx.QueryerContext, chainKey []byte, originalID func(uuid.UUID) uuid.UUID) (*AuditChainReport, error) {
+	report := &AuditChainReport{}
+	original := func(id *uuid.UUID) *uuid.UUID {
+		if id == nil || originalID == nil {
+			return id
+		}
+		o := originalID(*id)
+		return &o
+	}
+
+	var checkpoints []models.AuditCheckpoint
+	if err := sqlx.SelectContext(ctx, q, &checkpoints, "SELECT * FROM audit_checkpoints ORDER BY last_seq"); err != nil {
+		return nil, fmt.Errorf("list audit checkpoints: %w", err)
+	}
+	for i := range checkpoints {
+		cp := checkpoints[i]
+		cp.ID = *original(&cp.ID)
+		if !auditchain.Equal(cp.Signature, auditchain.CheckpointSignature(chainKey, &cp)) {
+			report.Broken = &AuditChainBreak{Seq: cp.LastSeq, ID: cp.ID, Reason: "checkpoint signature is invalid"}
+			return report, nil
 		}
-		detailsJSON = string(b)
+		switch cp.Reason {
+		case auditGenesisReason:
+			report.Genesis = &checkpoints[i].LastSeq
+			continue
+		case auditHashV2Reason:
+			report.HashV2 = &checkpoints[i].LastSeq
+			continue
+		}
+		report.Checkpoints++
+		report.Anchor = &checkpoints[i]
+	}
+
+	var afterSeq int64
+	prevHash := ""
+	if report.Anchor != nil {
+		afterSeq, prevHash = report.Anchor.LastSeq, report.Anchor.LastHash
 	}
 
-	log := &models.AuditLog{
-		ID:           uuid.New(),
-		UserID:       userID,
-		Username:     username,
-		Action:       action,
-		ResourceType: resourceType,
-		ResourceID:   resourceID,
-		Details:      detailsJSON,
-		IPAddress:    ipAddress,
-		UserAgent:    userAgent,
+	rows, err := q.QueryxContext(ctx, "SELECT * FROM audit_logs WHERE seq > $1 ORDER BY seq", afterSeq)
+	if err != nil {
+		return nil, fmt.Errorf("read audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	expectedSeq := afterSeq + 1
+	chained := afterSeq > 0 && prevHash != ""
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := rows.StructScan(&entry); err != nil {
+			return nil, fmt.Errorf("scan audit log: %w", err)
+		}
+		brk := func(reason string) (*AuditChainReport, error) {
+			report.Broken = &AuditChainBreak{Seq: entry.Seq, ID: entry.ID, Reason: reason}
+			return report, nil
+		}
+
+		if entry.Seq != expectedSeq {
+			return brk(fmt.Sprintf("entries %d to %d are missing", expectedSeq, entry.Seq-1))
+		}
+		expectedSeq++
+
+		if entry.Hash == nil {
+			if chained || (report.Genesis != nil && entry.Seq > *report.Genesis) {
+				return brk("entry is not chained")
+			}
+			report.Unchained++
+			continue
+		}
+		if report.Genesis == nil {
+			return brk("the chain has no genesis checkpoint")
+		}
+		chained = true
+
+		if entry.PrevHash == nil || !auditchain.Equal(*entry.PrevHash, prevHash) {
+			return brk("previous hash does not match the preceding entry")
+		}
+		hashed := entry
+		hashed.ID, hashed.UserID, hashed.ResourceID = *original(&entry.ID), original(entry.UserID), original(entry.ResourceID)
+		hashed.OrganizationID = original(entry.OrganizationID)
+		if !auditchain.Equal(*entry.Hash, auditchain.EntryHash(chainKey, &hashed, report.hashVersion(entry.Seq))) {
+			return brk("hash does not match the entry content")
+		}
+		prevHash = *entry.Hash
+		report.Checked++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read audit logs: %w", err)
 	}
 
-	return r.Create(ctx, log)
+	report.Valid = true
+	return report, nil
+}
+
+// ResealAuditChain recomputes the hashes of the audit chain and the signatures of its
+// checkpoints within tx, after the IDs of the entries and of the rows they refer to
+// were replaced, as restoring a backup with new IDs does. originalID maps a new ID back
+// to the old one. The chain must first verify with the old IDs: a chain that was
+// already broken is not sealed again.
+func ResealAuditChain(ctx context.Context, tx *sqlx.Tx, chainKey string, originalID func(uuid.UUID) uuid.UUID) error {
+	key := []byte(chainKey)
+	report, err := verifyAuditChain(ctx, tx, key, originalID)
+	if err != nil {
+		return err
+	}
+	if !report.Valid {
+		return fmt.Errorf("audit chain does not verify at entry %d: %s", report.Broken.Seq, report.Broken.Reason)
+	}
+
+	var checkpoints []models.AuditCheckpoint
+	if err := tx.SelectContext(ctx, &checkpoints, "SELECT * FROM audit_checkpoints ORDER BY last_seq"); err != nil {
+		return fmt.Errorf("list audit checkpoints: %w", err)
+	}
+	for i := range checkpoints {
+		cp := &checkpoints[i]
+		if _, err := tx.ExecContext(ctx, "UPDATE audit_checkpoints SET signature = $1 WHERE id = $2",
+			auditchain.CheckpointSignature(key, cp), cp.ID); err != nil {
+			return fmt.Errorf("sign audit checkpoint: %w", err)
+		}
+	}
+
+	var afterSeq int64
+	prevHash := ""
+	if report.Anchor != nil {
+		afterSeq, prevHash = report.Anchor.LastSeq, report.Anchor.LastHash
+	}
+	var entries []*models.AuditLog
+	if err := tx.SelectContext(ctx, &entries,
+		"SELECT * FROM audit_logs WHERE seq > $1 AND hash IS NOT NULL ORDER BY seq", afterSeq); err != nil {
+		return fmt.Errorf("read audit logs: %w", err)
+	}
+	for _, entry := range entries {
+		entry.PrevHash = &prevHash
+		hash := auditchain.EntryHash(key, entry, report.hashVersion(entry.Seq))
+		if _, err := tx.ExecContext(ctx, "UPDATE audit_logs SET prev_hash = $1, hash = $2 WHERE id = $3",
+			prevHash, hash, entry.ID); err != nil {
+			return fmt.Errorf("hash audit log: %w", err)
+		}
+		prevHash = hash
+	}
+	return nil
+}
+
+// PurgeBefore deletes the audit entries created before cutoff — always a prefix of the
+// chain — and records a signed checkpoint so verification can resume after them. With
+// an Archiver, the entries are archived first.
+func (r *AuditLogRepository) PurgeBefore(ctx context.Context, cutoff time.Time, reason string, ar Archiver) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := lockAuditChain(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	var last struct {
+		Seq  int64          `db:"seq"`
+		Hash sql.NullString `db:"hash"`
+	}
+	err = tx.GetContext(ctx, &last,
+		"SELECT seq, hash FROM audit_logs WHERE created_at < $1 ORDER BY seq DESC LIMIT 1", cutoff)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("find purge boundary: %w", err)
+	}
+
+	purged, err := purgeRows(ctx, tx, ar, "audit_logs", "DELETE FROM audit_logs WHERE seq <= $1",
+		returning("", auditArchiveColumns), func() any { return &models.AuditLog{} }, last.Seq)
+	if err != nil {
+		return 0, fmt.Errorf("purge audit_logs: %w", err)
+	}
+
+	cp := &models.AuditCheckpoint{
+		ID:        uuid.New(),
+		LastSeq:   last.Seq,
+		LastHash:  last.Hash.String,
+		Purged:    purged,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC().Truncate(timestampPrecision(tx)),
+	}
+	cp.Signature = auditchain.CheckpointSignature(r.chainKey, cp)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_checkpoints (id, last_seq, last_hash, purged, reason, signature, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		cp.ID, cp.LastSeq, cp.LastHash, cp.Purged, cp.Reason, cp.Signature, cp.CreatedAt); err != nil {
+		return 0, fmt.Errorf("record audit checkpoint: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return purged, nil
 }
@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/events"
+	"inventario/shared/models"
 )
 
 // CleanupRepository handles data retention operations — purging old logs and history records.
@@ -20,44 +24,116 @@ func NewCleanupRepository(db *sqlx.DB) *CleanupRepository {
 
 // CleanupResult holds the number of rows deleted for each table.
 type CleanupResult struct {
-	AuditLogs       int64
 	ActivityLogs    int64
 	HardwareHistory int64
+	Sessions        int64
+	Metrics         int64
+	Snapshots       int64 // hardware_history rows whose snapshot was cleared
+	RateLimits      int64
+	UpdateReports   int64
 }
 
-// PurgeOldData removes records older than the specified retention days from log/history tables.
-func (r *CleanupRepository) PurgeOldData(ctx context.Context, retentionDays int) (*CleanupResult, error) {
+// The retention in days of the rows of each dataset (see retention): for device data,
+// the organization's retention_days comes before the dataset's policy. Device data is
+// joined with its device d and the device's organization o; activity rows are a.
+// Snapshots have no default: they are kept as long as their hardware_history row.
+var (
+	activityRetention     = retention("device_activity_log", "a.activity_type", "o.retention_days", "$1")
+	hardwareRetention     = retention("hardware_history", "", "o.retention_days", "$1")
+	metricsRetention      = retention("device_metrics", "", "o.retention_days", "$1")
+	snapshotRetention     = retention("snapshots", "", "", "NULL")
+	sessionRetention      = retention("user_sessions", "", "", "$1")
+	updateReportRetention = retention("agent_update_reports", "", "", "$1")
+)
+
+// emptySnapshot replaces the snapshots the cleanup clears.
+const emptySnapshot = "{}"
+
+// inactiveThreshold is the inactive threshold in days of a row of devices: its
+// department's inactive_days, its organization's, then $1 (INACTIVE_DAYS).
+const inactiveThreshold = `COALESCE(
+	(SELECT dp.inactive_days FROM departments dp WHERE dp.id = devices.department_id),
+	(SELECT o.inactive_days FROM organizations o WHERE o.id = devices.organization_id), $1)`
+
+// PurgeOldData removes records older than their retention from log/history tables other
+// than audit_logs (see the retention expressions above). With an Archiver, purged device
+// history is archived first.
+func (r *CleanupRepository) PurgeOldData(ctx context.Context, retentionDays int, ar Archiver) (*CleanupResult, error) {
 	result := &CleanupResult{}
 
-	interval := fmt.Sprintf("%d days", retentionDays)
+	// audit_logs are purged by AuditLogRepository.PurgeBefore, which keeps the hash chain verifiable.
 
-	// Purge audit_logs
+	// Purge device_activity_log
+	var err error
+	result.ActivityLogs, err = purgeTable(ctx, r.db, ar, "device_activity_log",
+		`DELETE FROM device_activity_log a USING devices d JOIN organizations o ON o.id = d.organization_id
+		 WHERE d.id = a.device_id AND a.detected_at < NOW() - `+days(r.db, activityRetention),
+		returning("a", activityArchiveColumns), func() any { return &ArchivedActivity{} }, retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge device_activity_log: %w", err)
+	}
+
+	// Purge hardware_history
+	result.HardwareHistory, err = purgeTable(ctx, r.db, ar, "hardware_history",
+		`DELETE FROM hardware_history h USING devices d JOIN organizations o ON o.id = d.organization_id
+		 WHERE d.id = h.device_id AND h.changed_at < NOW() - `+days(r.db, hardwareRetention),
+		returning("h", hardwareArchiveColumns), func() any { return &models.HardwareHistory{} }, retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge hardware_history: %w", err)
+	}
+
+	// Purge device_metrics
 	res, err := r.db.ExecContext(ctx,
-		"DELETE FROM audit_logs WHERE created_at < NOW() - $1::interval", interval)
+		`DELETE FROM device_metrics m USING devices d JOIN organizations o ON o.id = d.organization_id
+		 WHERE d.id = m.device_id AND m.recorded_at < NOW() - `+days(r.db, metricsRetention), retentionDays)
 	if err != nil {
-		return nil, fmt.Errorf("purge audit_logs: %w", err)
+		return nil, fmt.Errorf("purge device_metrics: %w", err)
 	}
-	result.AuditLogs, _ = res.RowsAffected()
+	result.Metrics, _ = res.RowsAffected()
 
-	// Purge device_activity_log
+	// Clear old hardware snapshots
+	if result.Snapshots, err = clearSnapshots(ctx, r.db); err != nil {
+		return nil, err
+	}
+
+	// Purge ended sessions (expired or revoked)
 	res, err = r.db.ExecContext(ctx,
-		"DELETE FROM device_activity_log WHERE detected_at < NOW() - $1::interval", interval)
+		"DELETE FROM user_sessions WHERE LEAST(expires_at, COALESCE(revoked_at, expires_at)) < NOW() - "+
+			days(r.db, sessionRetention), retentionDays)
 	if err != nil {
-		return nil, fmt.Errorf("purge device_activity_log: %w", err)
+		return nil, fmt.Errorf("purge user_sessions: %w", err)
 	}
-	result.ActivityLogs, _ = res.RowsAffected()
+	result.Sessions, _ = res.RowsAffected()
 
-	// Purge hardware_history (keep longer — snapshots are more valuable)
+	// Purge agent update reports
 	res, err = r.db.ExecContext(ctx,
-		"DELETE FROM hardware_history WHERE changed_at < NOW() - $1::interval", interval)
+		"DELETE FROM agent_update_reports WHERE reported_at < NOW() - "+days(r.db, updateReportRetention), retentionDays)
 	if err != nil {
-		return nil, fmt.Errorf("purge hardware_history: %w", err)
+		return nil, fmt.Errorf("purge agent_update_reports: %w", err)
+	}
+	result.UpdateReports, _ = res.RowsAffected()
+
+	// Drop rate limit state of keys that have fully recovered
+	res, err = r.db.ExecContext(ctx, "DELETE FROM rate_limits WHERE tat < NOW()")
+	if err != nil {
+		return nil, fmt.Errorf("purge rate_limits: %w", err)
 	}
-	result.HardwareHistory, _ = res.RowsAffected()
+	result.RateLimits, _ = res.RowsAffected()
 
 	return result, nil
 }
 
+// clearSnapshots replaces the snapshots of the hardware_history rows older than the
+// snapshots policy with an empty object and returns how many it cleared.
+func clearSnapshots(ctx context.Context, db *sqlx.DB) (int64, error) {
+	res, err := db.ExecContext(ctx, "UPDATE hardware_history SET snapshot = "+cast(db, "$1", "jsonb")+
+		" WHERE changed_at < NOW() - "+days(db, snapshotRetention)+" AND snapshot <> "+cast(db, "$1", "jsonb"), emptySnapshot)
+	if err != nil {
+		return 0, fmt.Errorf("clear hardware snapshots: %w", err)
+	}
+	return res.RowsAffected()
+}
+
 // CountRecords returns the current row counts for each log/history table.
 func (r *CleanupRepository) CountRecords(ctx context.Context) (audit, activity, hardware int, err error) {
 	if err = r.db.GetContext(ctx, &audit, "SELECT COUNT(*) FROM audit_logs"); err != nil {
@@ -70,16 +146,97 @@ func (r *CleanupRepository) CountRecords(ctx context.Context) (audit, activity,
 	return
 }
 
-// MarkInactiveDevices marks devices as inactive if they haven't been seen for the specified number of days.
+// inactiveCondition selects the agent devices that are active but were not seen within
+// their inactive threshold. Agentless devices are never seen and keep the status set by
+// their owner.
+func inactiveCondition(db driverNamer) string {
+	return "status = 'active' AND source = 'agent' AND last_seen < NOW() - " + days(db, inactiveThreshold)
+}
+
+// MarkInactiveDevices marks devices as inactive if they haven't been seen for the specified number
+// of days, or for the inactive_days of their department or organization when it overrides the default.
 func (r *CleanupRepository) MarkInactiveDevices(ctx context.Context, inactiveDays int) (int64, error) {
-	interval := fmt.Sprintf("%d days", inactiveDays)
-	res, err := r.db.ExecContext(ctx,
-		"UPDATE devices SET status = 'inactive' WHERE status = 'active' AND last_seen < NOW() - $1::interval",
-		interval)
+	n, err := updateAndPublish(ctx, r.db, events.TypeStatusChanged,
+		"UPDATE devices SET status = 'inactive' WHERE "+inactiveCondition(r.db)+statusReturning,
+		[]interface{}{inactiveDays})
 	if err != nil {
 		return 0, fmt.Errorf("mark inactive devices: %w", err)
 	}
-	return res.RowsAffected()
+	return int64(n), nil
+}
+
+// PurgePreview counts the rows the cleanup would delete and the devices it would mark
+// inactive if it ran now.
+type PurgePreview struct {
+	AuditLogs       int64
+	ActivityLogs    map[string]int64 // by activity type
+	HardwareHistory int64
+	Metrics         int64
+	Snapshots       int64
+	Sessions        int64
+	UpdateReports   int64
+	InactiveDevices int64
+}
+
+// PreviewPurge counts what PurgeOldData, MarkInactiveDevices and a purge of the audit
+// entries created before auditCutoff would change, with the same conditions.
+func (r *CleanupRepository) PreviewPurge(ctx context.Context, retentionDays, inactiveDays int, auditCutoff time.Time) (*PurgePreview, error) {
+	p := &PurgePreview{ActivityLogs: map[string]int64{}}
+
+	// The audit purge removes a prefix of the chain: everything up to the last expired entry.
+	if err := r.db.GetContext(ctx, &p.AuditLogs,
+		"SELECT COUNT(*) FROM audit_logs WHERE seq <= (SELECT MAX(seq) FROM audit_logs WHERE created_at < $1)",
+		auditCutoff); err != nil {
+		return nil, fmt.Errorf("count expired audit_logs: %w", err)
+	}
+
+	var activity []struct {
+		ActivityType string `db:"activity_type"`
+		Count        int64  `db:"count"`
+	}
+	if err := r.db.SelectContext(ctx, &activity,
+		`SELECT a.activity_type, COUNT(*) AS count
+		 FROM device_activity_log a JOIN devices d ON d.id = a.device_id JOIN organizations o ON o.id = d.organization_id
+		 WHERE a.detected_at < NOW() - `+days(r.db, activityRetention)+`
+		 GROUP BY a.activity_type`, retentionDays); err != nil {
+		return nil, fmt.Errorf("count expired device_activity_log: %w", err)
+	}
+	for _, a := range activity {
+		p.ActivityLogs[a.ActivityType] = a.Count
+	}
+
+	if err := r.db.GetContext(ctx, &p.Snapshots,
+		"SELECT COUNT(*) FROM hardware_history WHERE changed_at < NOW() - "+days(r.db, snapshotRetention)+
+			" AND snapshot <> "+cast(r.db, "$1", "jsonb"), emptySnapshot); err != nil {
+		return nil, fmt.Errorf("count expired snapshots: %w", err)
+	}
+
+	counts := []struct {
+		dest  *int64
+		table string
+		query string
+		arg   int
+	}{
+		{&p.HardwareHistory, "hardware_history",
+			`SELECT COUNT(*) FROM hardware_history h JOIN devices d ON d.id = h.device_id JOIN organizations o ON o.id = d.organization_id
+			 WHERE h.changed_at < NOW() - ` + days(r.db, hardwareRetention), retentionDays},
+		{&p.Metrics, "device_metrics",
+			`SELECT COUNT(*) FROM device_metrics m JOIN devices d ON d.id = m.device_id JOIN organizations o ON o.id = d.organization_id
+			 WHERE m.recorded_at < NOW() - ` + days(r.db, metricsRetention), retentionDays},
+		{&p.Sessions, "user_sessions",
+			"SELECT COUNT(*) FROM user_sessions WHERE LEAST(expires_at, COALESCE(revoked_at, expires_at)) < NOW() - " +
+				days(r.db, sessionRetention), retentionDays},
+		{&p.UpdateReports, "agent_update_reports",
+			"SELECT COUNT(*) FROM agent_update_reports WHERE reported_at < NOW() - " + days(r.db, updateReportRetention), retentionDays},
+		{&p.InactiveDevices, "inactive devices",
+			"SELECT COUNT(*) FROM devices WHERE " + inactiveCondition(r.db), inactiveDays},
+	}
+	for _, c := range counts {
+		if err := r.db.GetContext(ctx, c.dest, c.query, c.arg); err != nil {
+			return nil, fmt.Errorf("count %s: %w", c.table, err)
+		}
+	}
+	return p, nil
 }
 
 // VacuumAnalyze runs VACUUM ANALYZE on log tables to reclaim space.
@@ -0,0 +1,734 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/auditchain"
+	"inventario/server/internal/authz"
+	"inventario/server/internal/database"
+	"inventario/server/migrations"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// The tests in this file are the conformance suite of the Stores: each runs against a
+// new, migrated database of every backend, so that a statement one backend runs
+// differently from the other fails here rather than in production.
+
+// testChainKey keys the audit hash chain of the stores under test.
+const testChainKey = "test-chain-key"
+
+// forEachBackend runs fn against new Stores on SQLite and, when DATABASE_URL points at
+// a PostgreSQL database (as in CI), on PostgreSQL. The PostgreSQL stores work in a
+// schema of their own, dropped afterwards, so the tables of that database are left alone.
+func forEachBackend(t *testing.T, fn func(t *testing.T, db *sqlx.DB, s *Stores)) {
+	t.Run("sqlite", func(t *testing.T) {
+		databaseURL := "sqlite://" + filepath.Join(t.TempDir(), "inventario.db")
+		database.RunMigrations(databaseURL, migrations.SQLite)
+		db := openTestDB(t, databaseURL)
+		fn(t, db, NewStores(db, testChainKey))
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		databaseURL := os.Getenv("DATABASE_URL")
+		if databaseURL == "" || database.IsSQLite(databaseURL) {
+			t.Skip("DATABASE_URL does not point at a PostgreSQL database")
+		}
+		admin := openTestDB(t, databaseURL)
+		suffix := make([]byte, 6)
+		_, _ = rand.Read(suffix)
+		schema := "conformance_" + hex.EncodeToString(suffix)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+				t.Errorf("drop schema %s: %v", schema, err)
+			}
+		})
+
+		// public stays on the search path for the uuid-ossp functions when the extension
+		// is already installed there.
+		u, err := url.Parse(databaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema+",public")
+		u.RawQuery = q.Encode()
+		database.RunMigrations(u.String(), migrations.FS)
+		db := openTestDB(t, u.String())
+		fn(t, db, NewStores(db, testChainKey))
+	})
+}
+
+func openTestDB(t *testing.T, databaseURL string) *sqlx.DB {
+	t.Helper()
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// createTestUser creates a local user of the default organization.
+func createTestUser(t *testing.T, s *Stores, username string) *models.User {
+	t.Helper()
+	user := &models.User{
+		ID:             uuid.New(),
+		Username:       username,
+		PasswordHash:   "hash-1",
+		Role:           "viewer",
+		AuthProvider:   "local",
+		OrganizationID: DefaultOrganizationID,
+	}
+	if err := s.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createAgentDevice inserts an agent device of the default organization, as
+// enrollment does, last seen at lastSeen.
+func createAgentDevice(t *testing.T, db *sqlx.DB, hostname string, lastSeen time.Time) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if _, err := db.Exec(
+		"INSERT INTO devices (id, hostname, serial_number, organization_id, last_seen) VALUES ($1, $2, $3, $4, $5)",
+		id, hostname, "SN-"+hostname, DefaultOrganizationID, lastSeen); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// within reports whether got is within tolerance of want.
+func within(got, want time.Time, tolerance time.Duration) bool {
+	d := got.Sub(want)
+	return d > -tolerance && d < tolerance
+}
+
+func TestStoresUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		ana := createTestUser(t, s, "ana")
+
+		err := s.Users.Create(ctx, &models.User{ID: uuid.New(), Username: "ana", PasswordHash: "x", Role: "viewer",
+			AuthProvider: "local", OrganizationID: DefaultOrganizationID})
+		if !isUniqueViolation(err) {
+			t.Errorf("duplicate username = %v, want a unique violation", err)
+		}
+
+		subject := "subject-1"
+		bruno := &models.User{ID: uuid.New(), Username: "bruno", Role: "admin", AuthProvider: "oidc",
+			ExternalID: &subject, OrganizationID: DefaultOrganizationID}
+		if err := s.Users.Create(ctx, bruno); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Users.GetByExternalID(ctx, "oidc", subject); err != nil || got.ID != bruno.ID {
+			t.Errorf("GetByExternalID = %v, %v; want bruno", got, err)
+		}
+		if _, err := s.Users.GetByUsername(ctx, "carla"); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetByUsername of a missing user = %v, want sql.ErrNoRows", err)
+		}
+
+		// Every third failure locks the account for twice as long as the last time,
+		// capped at the maximum.
+		for i, want := range []time.Duration{10 * time.Minute, 20 * time.Minute, 25 * time.Minute} {
+			for n := 1; n <= 3; n++ {
+				lockedUntil, err := s.Users.RecordLoginFailure(ctx, ana.ID, 3, 10*time.Minute, 25*time.Minute)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n < 3 && lockedUntil != nil {
+					t.Fatalf("lockout %d: failure %d locked the account", i+1, n)
+				}
+				if n == 3 && (lockedUntil == nil || !within(*lockedUntil, time.Now().Add(want), time.Minute)) {
+					t.Fatalf("lockout %d: locked_until = %v, want now + %s", i+1, lockedUntil, want)
+				}
+			}
+		}
+		user, err := s.Users.GetByID(ctx, ana.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.LockoutCount != 3 || user.FailedLoginAttempts != 0 || user.LockedUntil == nil {
+			t.Errorf("after 3 lockouts lockout_count = %d, failed_login_attempts = %d, locked_until = %v",
+				user.LockoutCount, user.FailedLoginAttempts, user.LockedUntil)
+		}
+		if err := s.Users.Unlock(ctx, ana.ID, uuid.New()); err == nil {
+			t.Error("Unlock in another organization succeeded")
+		}
+		if err := s.Users.ResetLoginFailures(ctx, ana.ID); err != nil {
+			t.Fatal(err)
+		}
+		if user, _ = s.Users.GetByID(ctx, ana.ID); user.LockoutCount != 0 || user.LockedUntil != nil {
+			t.Errorf("after reset lockout_count = %d, locked_until = %v", user.LockoutCount, user.LockedUntil)
+		}
+
+		for _, hash := range []string{"hash-2", "hash-3", "hash-4"} {
+			if err := s.Users.SetPassword(ctx, ana.ID, hash, false, 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if hashes, err := s.Users.RecentPasswordHashes(ctx, ana.ID, 5); err != nil || len(hashes) != 2 {
+			t.Errorf("password history = %v, %v; want the last 2", hashes, err)
+		}
+		if user, _ = s.Users.GetByID(ctx, ana.ID); user.PasswordHash != "hash-4" {
+			t.Errorf("password_hash = %q, want hash-4", user.PasswordHash)
+		}
+	})
+}
+
+func TestStoresSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		user := createTestUser(t, s, "ana")
+		org := DefaultOrganizationID
+		now := time.Now()
+		newSession := func(expires, absolute time.Time) *models.UserSession {
+			t.Helper()
+			sess := &models.UserSession{ID: uuid.New(), UserID: user.ID, OrganizationID: &org, IP: "10.0.0.1",
+				UserAgent: "test", ExpiresAt: expires, AbsoluteExpiresAt: absolute}
+			if err := s.Sessions.Create(ctx, sess); err != nil {
+				t.Fatal(err)
+			}
+			return sess
+		}
+		active := newSession(now.Add(time.Hour), now.Add(90*time.Minute))
+		other := newSession(now.Add(time.Hour), now.Add(24*time.Hour))
+		expired := newSession(now.Add(-time.Minute), now.Add(time.Hour))
+
+		if _, err := s.Sessions.GetActive(ctx, expired.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetActive of an expired session = %v, want sql.ErrNoRows", err)
+		}
+
+		// Touch writes at most once a minute.
+		if touched, err := s.Sessions.Touch(ctx, active.ID, "10.0.0.2", time.Hour); err != nil || touched {
+			t.Errorf("Touch right after login = %v, %v; want false", touched, err)
+		}
+		if _, err := db.Exec("UPDATE user_sessions SET last_activity_at = $1 WHERE id = $2", now.Add(-2*time.Minute), active.ID); err != nil {
+			t.Fatal(err)
+		}
+		if touched, err := s.Sessions.Touch(ctx, active.ID, "10.0.0.2", 30*time.Minute); err != nil || !touched {
+			t.Errorf("Touch after 2 minutes = %v, %v; want true", touched, err)
+		}
+		sess, err := s.Sessions.GetActive(ctx, active.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sess.IP != "10.0.0.2" || !within(sess.ExpiresAt, time.Now().Add(30*time.Minute), time.Minute) {
+			t.Errorf("touched session ip = %s, expires_at = %s; want 10.0.0.2, now + 30m", sess.IP, sess.ExpiresAt)
+		}
+
+		// The idle expiry never passes the absolute one.
+		sess, err = s.Sessions.Extend(ctx, active.ID, "10.0.0.3", 2*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sess.ExpiresAt.Equal(sess.AbsoluteExpiresAt) {
+			t.Errorf("extended expires_at = %s, want the absolute expiry %s", sess.ExpiresAt, sess.AbsoluteExpiresAt)
+		}
+
+		if sessions, err := s.Sessions.ListActiveByUser(ctx, user.ID); err != nil || len(sessions) != 2 {
+			t.Errorf("ListActiveByUser = %d sessions, %v; want 2", len(sessions), err)
+		}
+		if n, err := s.Sessions.RevokeAllForUser(ctx, user.ID, active.ID, "password_changed"); err != nil || n != 1 {
+			t.Errorf("RevokeAllForUser = %d, %v; want 1", n, err)
+		}
+		if _, err := s.Sessions.GetActive(ctx, other.ID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetActive of a revoked session = %v, want sql.ErrNoRows", err)
+		}
+		if err := s.Sessions.Revoke(ctx, user.ID, other.ID, "logout"); err == nil {
+			t.Error("revoking a revoked session succeeded")
+		}
+	})
+}
+
+func TestStoresDevices(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		org := authz.Scope{All: true, OrganizationID: DefaultOrganizationID}
+		finance, err := s.Departments.Create(ctx, DefaultOrganizationID, "Finance", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sales, err := s.Departments.Create(ctx, DefaultOrganizationID, "Sales", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		speed := 1000
+		assets := []dto.ManualAssetRequest{
+			{Hostname: "PC-Fin-01", SerialNumber: "SN1", AssetType: "Desktop", OSName: "Windows 11", DepartmentID: &finance.ID,
+				CustomAttributes: map[string]string{"owner": "Ana", "floor": "2"},
+				Hardware:         &dto.HardwareData{CPUModel: "Intel Core i5", CPUCores: 6, CPUThreads: 12, RAMTotalBytes: 16 << 30},
+				NetworkInterfaces: []dto.NetworkData{
+					{Name: "Ethernet", MACAddress: "00:11:22:33:44:55", IPv4Address: "10.0.0.10", SpeedMbps: &speed, IsPhysical: true},
+				}},
+			{Hostname: "pc-fin-02", SerialNumber: "SN2", AssetType: "Laptop", OSName: "Windows 10", DepartmentID: &finance.ID},
+			{Hostname: "PRINTER-01", SerialNumber: "SN3", AssetType: "printer"},
+		}
+		ids := make([]uuid.UUID, len(assets))
+		for i := range assets {
+			ids[i] = uuid.New()
+			if err := s.Devices.SaveManual(ctx, ids[i], true, &assets[i], org); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Devices.SaveManual(ctx, uuid.New(), true, &dto.ManualAssetRequest{Hostname: "PC-X", SerialNumber: "SN1"}, org); !errors.Is(err, ErrSerialNumberInUse) {
+			t.Errorf("SaveManual with a taken serial number = %v, want ErrSerialNumberInUse", err)
+		}
+
+		tests := []struct {
+			name      string
+			params    ListParams
+			scope     authz.Scope
+			wantTotal int
+			wantFirst string
+		}{
+			{name: "hostname ignores case", params: ListParams{Hostname: "FIN"}, scope: org, wantTotal: 2},
+			{name: "os", params: ListParams{OS: "windows 11"}, scope: org, wantTotal: 1, wantFirst: "PC-Fin-01"},
+			{name: "asset type ignores case", params: ListParams{AssetType: "PRINTER"}, scope: org, wantTotal: 1, wantFirst: "PRINTER-01"},
+			{name: "department", params: ListParams{DepartmentID: finance.ID.String()}, scope: org, wantTotal: 2},
+			{name: "source", params: ListParams{Source: "manual"}, scope: org, wantTotal: 3},
+			{name: "agentless devices are never online", params: ListParams{Status: "online"}, scope: org, wantTotal: 0},
+			{name: "sorted and paged", params: ListParams{Hostname: "fin", Sort: "hostname", Order: "desc", Limit: 1}, scope: org,
+				wantTotal: 2, wantFirst: "pc-fin-02"},
+			{name: "department scope", params: ListParams{}, scope: authz.Scope{DepartmentIDs: []uuid.UUID{finance.ID},
+				OrganizationID: DefaultOrganizationID}, wantTotal: 2},
+			{name: "empty scope", params: ListParams{}, scope: authz.Scope{OrganizationID: DefaultOrganizationID}, wantTotal: 0},
+			{name: "another organization", params: ListParams{}, scope: authz.Scope{All: true, OrganizationID: uuid.New()}, wantTotal: 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				res, err := s.Devices.List(ctx, tt.params, tt.scope)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if res.Total != tt.wantTotal {
+					t.Errorf("total = %d, want %d", res.Total, tt.wantTotal)
+				}
+				if tt.wantFirst != "" && (len(res.Devices) == 0 || res.Devices[0].Hostname != tt.wantFirst) {
+					t.Errorf("devices = %v, want %s first", res.Devices, tt.wantFirst)
+				}
+			})
+		}
+
+		d, err := s.Devices.GetByHostname(ctx, "pc-FIN-01", org)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var attrs map[string]string
+		if err := json.Unmarshal(d.CustomAttributes, &attrs); err != nil || !reflect.DeepEqual(attrs, assets[0].CustomAttributes) {
+			t.Errorf("custom_attributes = %s, want %v", d.CustomAttributes, assets[0].CustomAttributes)
+		}
+		if d.DepartmentName == nil || *d.DepartmentName != "Finance" || d.Source != "manual" || d.Online {
+			t.Errorf("device department = %v, source = %s, online = %v", d.DepartmentName, d.Source, d.Online)
+		}
+		if hw, err := s.Devices.GetHardware(ctx, d.ID); err != nil || hw.CPUModel != "Intel Core i5" || hw.RAMTotalBytes != 16<<30 {
+			t.Errorf("hardware = %+v, %v", hw, err)
+		}
+		if nics, err := s.Devices.GetNetworkInterfaces(ctx, d.ID); err != nil || len(nics) != 1 || nics[0].SpeedMbps == nil || *nics[0].SpeedMbps != speed {
+			t.Errorf("network interfaces = %+v, %v", nics, err)
+		}
+
+		// Department changes apply within the scope of the device's current department.
+		salesOnly := authz.Scope{DepartmentIDs: []uuid.UUID{sales.ID}, OrganizationID: DefaultOrganizationID}
+		if err := s.Devices.UpdateDepartment(ctx, ids[0], &sales.ID, salesOnly); err == nil {
+			t.Error("UpdateDepartment of a device outside the scope succeeded")
+		}
+		financeOnly := authz.Scope{DepartmentIDs: []uuid.UUID{finance.ID}, OrganizationID: DefaultOrganizationID}
+		if err := s.Devices.UpdateDepartment(ctx, ids[0], &sales.ID, financeOnly); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.Devices.BulkUpdateDepartment(ctx, ids, nil, salesOnly); err != nil || n != 1 {
+			t.Errorf("BulkUpdateDepartment = %d, %v; want 1", n, err)
+		}
+		if d, err = s.Devices.GetByID(ctx, ids[0], org); err != nil || d.DepartmentID != nil {
+			t.Errorf("department after the bulk update = %v, %v; want none", d.DepartmentID, err)
+		}
+
+		if n, err := s.Devices.BulkUpdateStatus(ctx, ids[:2], "inactive", org); err != nil || n != 2 {
+			t.Errorf("BulkUpdateStatus = %d, %v; want 2", n, err)
+		}
+		if res, err := s.Devices.List(ctx, ListParams{Status: "inactive"}, org); err != nil || res.Total != 2 {
+			t.Errorf("inactive devices = %v, %v; want 2", res, err)
+		}
+		if n, err := s.Devices.BulkDelete(ctx, ids, org); err != nil || n != 3 {
+			t.Errorf("BulkDelete = %d, %v; want 3", n, err)
+		}
+		if _, err := s.Devices.GetHardware(ctx, ids[0]); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("hardware of a deleted device = %v, want sql.ErrNoRows", err)
+		}
+	})
+}
+
+func TestStoresPresence(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		scope := authz.Scope{All: true, OrganizationID: DefaultOrganizationID}
+		// Without reported intervals an agent is offline after an hour.
+		silent := createAgentDevice(t, db, "PC-SILENT", time.Now().Add(-2*time.Hour))
+		recent := createAgentDevice(t, db, "PC-RECENT", time.Now().Add(-10*time.Minute))
+
+		if n, err := s.Devices.MarkOffline(ctx); err != nil || n != 1 {
+			t.Fatalf("MarkOffline = %d, %v; want 1", n, err)
+		}
+		if n, err := s.Devices.MarkOffline(ctx); err != nil || n != 0 {
+			t.Errorf("second MarkOffline = %d, %v; want 0", n, err)
+		}
+		for status, want := range map[string]string{"online": "PC-RECENT", "offline": "PC-SILENT"} {
+			res, err := s.Devices.List(ctx, ListParams{Status: status}, scope)
+			if err != nil || res.Total != 1 || res.Devices[0].Hostname != want {
+				t.Errorf("%s devices = %+v, %v; want %s", status, res, err, want)
+			}
+		}
+
+		if err := s.Inventory.Heartbeat(ctx, silent, &dto.HeartbeatRequest{IntervalSeconds: 60, UptimeSeconds: 3600,
+			AgentVersion: "2.0.0", State: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+		d, err := s.Devices.GetByID(ctx, silent, scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.Online || d.OfflineSince != nil || d.AgentVersion != "2.0.0" || d.UptimeSeconds == nil || *d.UptimeSeconds != 3600 {
+			t.Errorf("after a heartbeat online = %v, offline_since = %v, agent_version = %q, uptime = %v",
+				d.Online, d.OfflineSince, d.AgentVersion, d.UptimeSeconds)
+		}
+		metrics, err := s.Devices.GetMetrics(ctx, silent, time.Now().Add(-time.Minute))
+		if err != nil || len(metrics) != 1 || metrics[0].UptimeSeconds == nil || *metrics[0].UptimeSeconds != 3600 {
+			t.Errorf("metrics = %+v, %v; want the heartbeat's uptime", metrics, err)
+		}
+		if err := s.Inventory.Heartbeat(ctx, uuid.New(), &dto.HeartbeatRequest{IntervalSeconds: 60, State: "ok"}); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("heartbeat of an unknown device = %v, want sql.ErrNoRows", err)
+		}
+
+		// A 60 s heartbeat interval makes the device offline after 3 minutes.
+		if _, err := db.Exec("UPDATE devices SET last_seen = $1 WHERE id = $2", time.Now().Add(-4*time.Minute), silent); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.Devices.MarkOffline(ctx); err != nil || n != 1 {
+			t.Errorf("MarkOffline after missed heartbeats = %d, %v; want 1", n, err)
+		}
+
+		if _, err := db.Exec("UPDATE devices SET last_seen = $1 WHERE id = $2", time.Now().AddDate(0, 0, -40), recent); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.Cleanup.MarkInactiveDevices(ctx, 30); err != nil || n != 1 {
+			t.Errorf("MarkInactiveDevices = %d, %v; want 1", n, err)
+		}
+		if d, err = s.Devices.GetByID(ctx, recent, scope); err != nil || d.Status != "inactive" {
+			t.Errorf("status of a device unseen for 40 days = %v, %v; want inactive", d, err)
+		}
+	})
+}
+
+func TestStoresAuditChain(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		org := DefaultOrganizationID
+		// Times finer than either backend stores must still verify.
+		old := time.Date(2026, 1, 5, 10, 30, 0, 123456789, time.UTC)
+		batch := []*models.AuditLog{
+			{ID: uuid.New(), Username: "ana", Action: "auth.login", ResourceType: "user", CreatedAt: old, Details: `{"success": true}`},
+			{ID: uuid.New(), Username: "ana", Action: "device.update", ResourceType: "device", CreatedAt: old.Add(time.Second), OrganizationID: &org},
+			{ID: uuid.New(), Username: "ana", Action: "device.delete", ResourceType: "device", CreatedAt: old.Add(2 * time.Second), OrganizationID: &org},
+		}
+		if n, err := s.AuditLogs.CreateBatch(ctx, batch); err != nil || n != 3 {
+			t.Fatalf("CreateBatch = %d, %v; want 3", n, err)
+		}
+		if n, err := s.AuditLogs.CreateBatch(ctx, batch); err != nil || n != 0 {
+			t.Errorf("retried CreateBatch = %d, %v; want 0", n, err)
+		}
+		for _, action := range []string{"user.create", "user.delete"} {
+			if err := s.AuditLogs.Create(ctx, &models.AuditLog{ID: uuid.New(), Username: "bruno", Action: action,
+				ResourceType: "user", OrganizationID: &org}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		report, err := s.AuditLogs.Verify(ctx)
+		if err != nil || !report.Valid || report.Checked != 5 || report.Genesis == nil || *report.Genesis != 0 {
+			t.Fatalf("Verify = %+v, %v; want 5 valid entries from genesis 0", report, err)
+		}
+
+		// Entries whose hashes were removed do not pass for entries older than the chain.
+		tx, err := db.Beginx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.Exec("UPDATE audit_logs SET hash = NULL, prev_hash = NULL"); err != nil {
+			t.Fatal(err)
+		}
+		if report, err := verifyAuditChain(ctx, tx, []byte(testChainKey), nil); err != nil || report.Valid || report.Broken == nil ||
+			report.Broken.Seq != 1 || report.Broken.Reason != "entry is not chained" {
+			t.Errorf("Verify of unchained entries = %+v, %v; want broken at seq 1", report, err)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		filters := []struct {
+			filters map[string]interface{}
+			want    int
+		}{
+			{map[string]interface{}{"action": "device.update"}, 1},
+			{map[string]interface{}{"organization_id": org}, 4},
+			{map[string]interface{}{"organization_id": org, "include_unassigned": true}, 5},
+			{map[string]interface{}{"organization_id": org, "resource_type": "user"}, 2},
+		}
+		for _, f := range filters {
+			if logs, total, err := s.AuditLogs.List(ctx, f.filters, 2, 0); err != nil || total != f.want || len(logs) != min(2, f.want) {
+				t.Errorf("List(%v) = %d of %d, %v; want %d", f.filters, len(logs), total, err, f.want)
+			}
+		}
+
+		// The SIEM reads the chain in seq order from its cursor, which a backfill starts
+		// before the oldest entry.
+		if err := s.SIEM.InitCursor(ctx, SIEMStreamAudit, true); err != nil {
+			t.Fatal(err)
+		}
+		logs, err := s.SIEM.AuditAfter(ctx, 0, 10)
+		if err != nil || len(logs) != 5 {
+			t.Fatalf("AuditAfter = %d entries, %v; want 5", len(logs), err)
+		}
+		for i, l := range logs {
+			if l.Seq != logs[0].Seq+int64(i) {
+				t.Errorf("entry %d has seq %d, want %d", i, l.Seq, logs[0].Seq+int64(i))
+			}
+		}
+		var cursors []int64
+		for _, delivered := range []int64{logs[2].Seq, logs[1].Seq} {
+			ok, err := s.SIEM.Advance(ctx, SIEMStreamAudit, func(cursor int64) (int64, error) {
+				cursors = append(cursors, cursor)
+				return delivered, nil
+			})
+			if err != nil || !ok {
+				t.Fatalf("Advance = %v, %v", ok, err)
+			}
+			// An existing cursor is left alone.
+			if err := s.SIEM.InitCursor(ctx, SIEMStreamAudit, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if want := []int64{0, logs[2].Seq}; !reflect.DeepEqual(cursors, want) {
+			t.Errorf("cursors = %v, want %v", cursors, want)
+		}
+		ok, err := s.SIEM.Advance(ctx, SIEMStreamAudit, func(cursor int64) (int64, error) { return cursor, nil })
+		if err != nil || !ok {
+			t.Fatalf("Advance = %v, %v", ok, err)
+		}
+		if ok, err := s.SIEM.Advance(ctx, SIEMStreamActivity, func(int64) (int64, error) { return 0, nil }); err != nil || ok {
+			t.Errorf("Advance of a stream without a cursor = %v, %v; want false", ok, err)
+		}
+
+		purged, err := s.AuditLogs.PurgeBefore(ctx, old.Add(time.Hour), "retention", nil)
+		if err != nil || purged != 3 {
+			t.Fatalf("PurgeBefore = %d, %v; want 3", purged, err)
+		}
+		if report, err = s.AuditLogs.Verify(ctx); err != nil || !report.Valid || report.Checked != 2 || report.Checkpoints != 1 {
+			t.Errorf("Verify after the purge = %+v, %v; want 2 entries from 1 checkpoint", report, err)
+		}
+
+		// A chain that started before genesis checkpoints existed gets one at start-up.
+		if _, err := db.Exec("DELETE FROM audit_checkpoints WHERE reason = 'genesis'"); err != nil {
+			t.Fatal(err)
+		}
+		if report, err = s.AuditLogs.Verify(ctx); err != nil || report.Valid || report.Broken == nil || report.Broken.Seq != logs[3].Seq {
+			t.Errorf("Verify without a genesis = %+v, %v; want broken at seq %d", report, err, logs[3].Seq)
+		}
+		if err := s.AuditLogs.SealMarkers(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if report, err = s.AuditLogs.Verify(ctx); err != nil || !report.Valid || report.Genesis == nil || *report.Genesis != logs[3].Seq-1 {
+			t.Errorf("Verify after SealMarkers = %+v, %v; want valid from genesis %d", report, err, logs[3].Seq-1)
+		}
+
+		// Hashes cover the organization, so an entry cannot be moved to another one.
+		other := uuid.New()
+		if _, err := db.Exec("INSERT INTO organizations (id, name, created_at, updated_at) VALUES ($1, 'Other', $2, $2)", other, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE audit_logs SET organization_id = $1 WHERE seq = $2", other, logs[3].Seq); err != nil {
+			t.Fatal(err)
+		}
+		if report, err = s.AuditLogs.Verify(ctx); err != nil || report.Valid || report.Broken == nil || report.Broken.Seq != logs[3].Seq {
+			t.Errorf("Verify of a moved entry = %+v, %v; want broken at seq %d", report, err, logs[3].Seq)
+		}
+		if _, err := db.Exec("UPDATE audit_logs SET organization_id = $1 WHERE seq = $2", org, logs[3].Seq); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec("UPDATE audit_logs SET action = 'user.update' WHERE seq = $1", logs[4].Seq); err != nil {
+			t.Fatal(err)
+		}
+		if report, err = s.AuditLogs.Verify(ctx); err != nil || report.Valid || report.Broken == nil || report.Broken.Seq != logs[4].Seq {
+			t.Errorf("Verify of a modified entry = %+v, %v; want broken at seq %d", report, err, logs[4].Seq)
+		}
+	})
+}
+
+func TestStoresAuditChainUpgrade(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		org := DefaultOrganizationID
+		for _, action := range []string{"user.create", "user.delete"} {
+			if err := s.AuditLogs.Create(ctx, &models.AuditLog{ID: uuid.New(), Username: "ana", Action: action,
+				ResourceType: "user", OrganizationID: &org}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Turn the entries into a chain written before the markers and HashV2 existed.
+		if _, err := db.Exec("DELETE FROM audit_checkpoints"); err != nil {
+			t.Fatal(err)
+		}
+		var entries []*models.AuditLog
+		if err := db.Select(&entries, "SELECT * FROM audit_logs ORDER BY seq"); err != nil {
+			t.Fatal(err)
+		}
+		prevHash := ""
+		for _, e := range entries {
+			e.PrevHash = &prevHash
+			hash := auditchain.EntryHash([]byte(testChainKey), e, auditchain.HashV1)
+			if _, err := db.Exec("UPDATE audit_logs SET prev_hash = $1, hash = $2 WHERE id = $3", prevHash, hash, e.ID); err != nil {
+				t.Fatal(err)
+			}
+			prevHash = hash
+		}
+
+		if err := s.AuditLogs.SealMarkers(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AuditLogs.Create(ctx, &models.AuditLog{ID: uuid.New(), Username: "ana", Action: "user.update",
+			ResourceType: "user", OrganizationID: &org}); err != nil {
+			t.Fatal(err)
+		}
+		report, err := s.AuditLogs.Verify(ctx)
+		if err != nil || !report.Valid || report.Checked != 3 || report.Genesis == nil || *report.Genesis != 0 ||
+			report.HashV2 == nil || *report.HashV2 != 2 {
+			t.Errorf("Verify = %+v, %v; want 3 valid entries, HashV2 from seq 2", report, err)
+		}
+	})
+}
+
+func TestStoresRetention(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		device := createAgentDevice(t, db, "PC-01", time.Now())
+		if err := s.Inventory.Heartbeat(ctx, device, &dto.HeartbeatRequest{IntervalSeconds: 60, UptimeSeconds: 60, State: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, typ := range []string{"software_installed", "software_removed", "hardware_changed"} {
+			if err := s.Activity.Insert(ctx, ActivityEntry{DeviceID: device, ActivityType: typ, Description: typ}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Everything but the hardware change and the heartbeat's metric is 100 days old.
+		past := time.Now().AddDate(0, 0, -100)
+		if _, err := db.Exec("UPDATE device_activity_log SET detected_at = $1 WHERE activity_type <> 'hardware_changed'", past); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO device_metrics (id, device_id, uptime_seconds, recorded_at) VALUES ($1, $2, 1, $3)",
+			uuid.New(), device, past); err != nil {
+			t.Fatal(err)
+		}
+
+		// A policy keeps installed software for 200 days; the rest falls back to 30.
+		policies, err := s.Retention.Replace(ctx, []models.RetentionPolicy{
+			{Dataset: "device_activity_log", ActivityType: "software_installed", RetentionDays: 200},
+		})
+		if err != nil || len(policies) != 1 {
+			t.Fatalf("Replace = %v, %v", policies, err)
+		}
+		result, err := s.Cleanup.PurgeOldData(ctx, 30, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.ActivityLogs != 1 || result.Metrics != 1 {
+			t.Errorf("purged %d activity entries and %d metrics, want 1 and 1", result.ActivityLogs, result.Metrics)
+		}
+		activity, total, err := s.Activity.ListByDevice(ctx, device, 10, 0)
+		if err != nil || total != 2 {
+			t.Fatalf("activity left = %d, %v; want 2", total, err)
+		}
+		for _, a := range activity {
+			if a.ActivityType == "software_removed" {
+				t.Error("software_removed entry older than the retention was kept")
+			}
+		}
+	})
+}
+
+func TestStoresJobs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *sqlx.DB, s *Stores) {
+		ctx := context.Background()
+		unlock, ok, err := s.Jobs.Lock(ctx, "cleanup")
+		if err != nil || !ok {
+			t.Fatalf("Lock = %v, %v; want the lock", ok, err)
+		}
+		unlock()
+		if unlock, ok, err = s.Jobs.Lock(ctx, "cleanup"); err != nil || !ok {
+			t.Fatalf("Lock after unlock = %v, %v; want the lock", ok, err)
+		}
+		defer unlock()
+
+		if last, err := s.Jobs.LastScheduled(ctx, "cleanup"); err != nil || last != nil {
+			t.Errorf("LastScheduled of a job that never ran = %v, %v; want nil", last, err)
+		}
+		scheduled := time.Date(2026, 3, 1, 3, 0, 0, 0, time.UTC)
+		runs := make([]*models.JobRun, 3)
+		for i := range runs {
+			time.Sleep(5 * time.Millisecond) // distinct started_at with millisecond timestamps
+			at := scheduled.AddDate(0, 0, i)
+			runs[i] = &models.JobRun{ID: uuid.New(), Job: "cleanup", Source: "schedule", ScheduledFor: &at, Replica: "api-1"}
+			if err := s.Jobs.StartRun(ctx, runs[i]); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				continue // left running, as by a replica that stopped
+			}
+			if i == 1 {
+				var status string
+				if err := db.Get(&status, "SELECT status FROM job_runs WHERE id = $1", runs[0].ID); err != nil || status != "interrupted" {
+					t.Errorf("status of the run left running = %q, %v; want interrupted", status, err)
+				}
+			}
+			runs[i].Status, runs[i].Result = "succeeded", json.RawMessage(`{"purged": 3}`)
+			if err := s.Jobs.FinishRun(ctx, runs[i], 2); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		list, total, err := s.Jobs.ListRuns(ctx, "cleanup", 10, 0)
+		if err != nil || total != 2 {
+			t.Fatalf("ListRuns = %d, %v; want the 2 kept", total, err)
+		}
+		if list[0].ID != runs[2].ID || list[1].ID != runs[1].ID || list[0].Status != "succeeded" || list[0].FinishedAt == nil {
+			t.Errorf("runs = %+v, want runs 3 and 2, succeeded", list)
+		}
+		var result map[string]int
+		if err := json.Unmarshal(list[0].Result, &result); err != nil || result["purged"] != 3 {
+			t.Errorf("result = %s, %v", list[0].Result, err)
+		}
+		if last, err := s.Jobs.LastScheduled(ctx, "cleanup"); err != nil || last == nil || !last.Equal(*runs[2].ScheduledFor) {
+			t.Errorf("LastScheduled = %v, %v; want %s", last, err, runs[2].ScheduledFor)
+		}
+	})
+}
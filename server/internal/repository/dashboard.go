@@ -7,6 +7,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/authz"
 )
 
 // DashboardRepository handles dashboard statistics queries.
@@ -19,26 +21,35 @@ func NewDashboardRepository(db *sqlx.DB) *DashboardRepository {
 	return &DashboardRepository{db: db}
 }
 
-// GetStats returns total, online, and inactive device counts.
-// Only active devices count toward total/online/offline. Inactive is separate.
-func (r *DashboardRepository) GetStats(ctx context.Context) (total int, online int, inactive int, err error) {
+// GetStats returns total, online, agentless and inactive device counts within the scope.
+// Only active devices count toward total/online/agentless. Inactive is separate.
+// Agentless devices (source other than "agent") have no last_seen of their own and
+// are neither online nor offline.
+func (r *DashboardRepository) GetStats(ctx context.Context, scope authz.Scope) (total, online, agentless, inactive int, err error) {
+	scopeSQL, args := dashboardScope(scope, 1)
+
 	// Get active device count.
-	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM devices WHERE status = 'active'"); err != nil {
-		return 0, 0, 0, fmt.Errorf("get total devices: %w", err)
+	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM devices WHERE status = 'active'"+scopeSQL, args...); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get total devices: %w", err)
 	}
 
-	// Get online count (active + last_seen within 1 hour).
+	// Get online count (active agent devices seen within their presence window).
 	if err := r.db.GetContext(ctx, &online,
-		"SELECT COUNT(*) FROM devices WHERE status = 'active' AND last_seen > NOW() - INTERVAL '1 hour'"); err != nil {
-		return 0, 0, 0, fmt.Errorf("get online devices: %w", err)
+		"SELECT COUNT(*) FROM devices WHERE status = 'active' AND source = 'agent' AND last_seen > NOW() - "+presenceWindow(r.db, "devices")+scopeSQL, args...); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get online devices: %w", err)
+	}
+
+	// Get active agentless count.
+	if err := r.db.GetContext(ctx, &agentless, "SELECT COUNT(*) FROM devices WHERE status = 'active' AND source <> 'agent'"+scopeSQL, args...); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get agentless devices: %w", err)
 	}
 
 	// Get inactive count.
-	if err := r.db.GetContext(ctx, &inactive, "SELECT COUNT(*) FROM devices WHERE status = 'inactive'"); err != nil {
-		return 0, 0, 0, fmt.Errorf("get inactive devices: %w", err)
+	if err := r.db.GetContext(ctx, &inactive, "SELECT COUNT(*) FROM devices WHERE status = 'inactive'"+scopeSQL, args...); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get inactive devices: %w", err)
 	}
 
-	return total, online, inactive, nil
+	return total, online, agentless, inactive, nil
 }
 
 // OSCount holds the OS name and its device count.
@@ -48,12 +59,13 @@ type OSCount struct {
 }
 
 // GetOSDistribution returns counts of devices grouped by OS name.
-func (r *DashboardRepository) GetOSDistribution(ctx context.Context) ([]OSCount, error) {
+func (r *DashboardRepository) GetOSDistribution(ctx context.Context, scope authz.Scope) ([]OSCount, error) {
+	scopeSQL, args := dashboardScope(scope, 1)
 	var result []OSCount
 	err := r.db.SelectContext(ctx, &result,
 		`SELECT COALESCE(os_name, 'Unknown') AS os_name, COUNT(*) AS count
-		 FROM devices WHERE status != 'inactive'
-		 GROUP BY os_name ORDER BY count DESC LIMIT 10`)
+		 FROM devices WHERE status != 'inactive'`+scopeSQL+`
+		 GROUP BY os_name ORDER BY count DESC LIMIT 10`, args...)
 	if err != nil {
 		return nil, fmt.Errorf("get os distribution: %w", err)
 	}
@@ -66,15 +78,18 @@ type RecentDeviceRow struct {
 	Hostname string    `db:"hostname"`
 	OSName   string    `db:"os_name"`
 	Status   string    `db:"status"`
+	Online   bool      `db:"online"`
 	LastSeen time.Time `db:"last_seen"`
 }
 
-// GetRecentDevices returns the most recently seen devices.
-func (r *DashboardRepository) GetRecentDevices(ctx context.Context, limit int) ([]RecentDeviceRow, error) {
+// GetRecentDevices returns the most recently seen agent devices.
+func (r *DashboardRepository) GetRecentDevices(ctx context.Context, limit int, scope authz.Scope) ([]RecentDeviceRow, error) {
+	scopeSQL, args := dashboardScope(scope, 2)
 	var result []RecentDeviceRow
 	err := r.db.SelectContext(ctx, &result,
-		`SELECT id, hostname, COALESCE(os_name, '') AS os_name, status, last_seen
-		 FROM devices ORDER BY last_seen DESC LIMIT $1`, limit)
+		`SELECT id, hostname, COALESCE(os_name, '') AS os_name, status,
+		 status = 'active' AND last_seen > NOW() - `+presenceWindow(r.db, "devices")+` AS online, last_seen
+		 FROM devices WHERE source = 'agent'`+scopeSQL+` ORDER BY last_seen DESC LIMIT $1`, append([]interface{}{limit}, args...)...)
 	if err != nil {
 		return nil, fmt.Errorf("get recent devices: %w", err)
 	}
@@ -88,14 +103,31 @@ type SoftwareCount struct {
 }
 
 // GetTopSoftware returns the most commonly installed software across all devices.
-func (r *DashboardRepository) GetTopSoftware(ctx context.Context, limit int) ([]SoftwareCount, error) {
-	var result []SoftwareCount
-	err := r.db.SelectContext(ctx, &result,
-		`SELECT name, COUNT(DISTINCT device_id) AS count
+func (r *DashboardRepository) GetTopSoftware(ctx context.Context, limit int, scope authz.Scope) ([]SoftwareCount, error) {
+	query := `SELECT name, COUNT(DISTINCT device_id) AS count
 		 FROM installed_software
-		 GROUP BY name ORDER BY count DESC LIMIT $1`, limit)
-	if err != nil {
+		 GROUP BY name ORDER BY count DESC LIMIT $1`
+	args := []interface{}{limit}
+	if scopeSQL, scopeArgs := dashboardScope(scope, 2); scopeSQL != "" {
+		query = `SELECT s.name, COUNT(DISTINCT s.device_id) AS count
+		 FROM installed_software s JOIN devices ON devices.id = s.device_id
+		 WHERE TRUE` + scopeSQL + `
+		 GROUP BY s.name ORDER BY count DESC LIMIT $1`
+		args = append(args, scopeArgs...)
+	}
+
+	var result []SoftwareCount
+	if err := r.db.SelectContext(ctx, &result, query, args...); err != nil {
 		return nil, fmt.Errorf("get top software: %w", err)
 	}
 	return result, nil
 }
+
+// dashboardScope returns an " AND ..." scope condition on devices, or "" for an unrestricted scope.
+func dashboardScope(scope authz.Scope, argIdx int) (string, []interface{}) {
+	cond, args, _ := scopeCondition(scope, "devices", argIdx)
+	if cond == "" {
+		return "", nil
+	}
+	return " AND " + cond, args
+}
@@ -20,10 +20,11 @@ func NewDepartmentRepository(db *sqlx.DB) *DepartmentRepository {
 	return &DepartmentRepository{db: db}
 }
 
-// List returns all departments ordered by name.
-func (r *DepartmentRepository) List(ctx context.Context) ([]models.Department, error) {
+// List returns the departments of an organization ordered by name.
+func (r *DepartmentRepository) List(ctx context.Context, orgID uuid.UUID) ([]models.Department, error) {
 	var departments []models.Department
-	err := r.db.SelectContext(ctx, &departments, "SELECT * FROM departments ORDER BY name")
+	err := r.db.SelectContext(ctx, &departments,
+		"SELECT * FROM departments WHERE organization_id = $1 ORDER BY name", orgID)
 	if err != nil {
 		return nil, fmt.Errorf("list departments: %w", err)
 	}
@@ -33,41 +34,46 @@ func (r *DepartmentRepository) List(ctx context.Context) ([]models.Department, e
 	return departments, nil
 }
 
-// GetByID returns a single department.
-func (r *DepartmentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Department, error) {
+// GetByID returns a single department of an organization.
+func (r *DepartmentRepository) GetByID(ctx context.Context, id, orgID uuid.UUID) (*models.Department, error) {
 	var dept models.Department
-	err := r.db.GetContext(ctx, &dept, "SELECT * FROM departments WHERE id = $1", id)
+	err := r.db.GetContext(ctx, &dept,
+		"SELECT * FROM departments WHERE id = $1 AND organization_id = $2", id, orgID)
 	if err != nil {
 		return nil, err
 	}
 	return &dept, nil
 }
 
-// Create inserts a new department and returns it.
-func (r *DepartmentRepository) Create(ctx context.Context, name string) (*models.Department, error) {
+// Create inserts a new department in an organization and returns it.
+func (r *DepartmentRepository) Create(ctx context.Context, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error) {
 	var dept models.Department
 	err := r.db.GetContext(ctx, &dept,
-		"INSERT INTO departments (id, name, created_at) VALUES (uuid_generate_v4(), $1, NOW()) RETURNING *", name)
+		`INSERT INTO departments (id, organization_id, name, inactive_days, created_at)
+		 VALUES (uuid_generate_v4(), $1, $2, $3, NOW()) RETURNING *`,
+		orgID, name, inactiveDays)
 	if err != nil {
 		return nil, fmt.Errorf("create department: %w", err)
 	}
 	return &dept, nil
 }
 
-// Update renames an existing department.
-func (r *DepartmentRepository) Update(ctx context.Context, id uuid.UUID, name string) (*models.Department, error) {
+// Update renames an existing department of an organization and replaces its inactive
+// threshold (nil = the organization's).
+func (r *DepartmentRepository) Update(ctx context.Context, id, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error) {
 	var dept models.Department
 	err := r.db.GetContext(ctx, &dept,
-		"UPDATE departments SET name = $1 WHERE id = $2 RETURNING *", name, id)
+		"UPDATE departments SET name = $1, inactive_days = $2 WHERE id = $3 AND organization_id = $4 RETURNING *",
+		name, inactiveDays, id, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("update department: %w", err)
 	}
 	return &dept, nil
 }
 
-// Delete removes a department. Devices referencing it will have department_id set to NULL (ON DELETE SET NULL).
-func (r *DepartmentRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	res, err := r.db.ExecContext(ctx, "DELETE FROM departments WHERE id = $1", id)
+// Delete removes a department of an organization. Devices referencing it will have department_id set to NULL (ON DELETE SET NULL).
+func (r *DepartmentRepository) Delete(ctx context.Context, id, orgID uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM departments WHERE id = $1 AND organization_id = $2", id, orgID)
 	if err != nil {
 		return fmt.Errorf("delete department: %w", err)
 	}
@@ -8,17 +8,24 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
+	"inventario/server/internal/authz"
+	"inventario/server/internal/events"
 	"inventario/shared/models"
 )
 
 // DeviceRepository handles read queries for devices and their related data.
+// Every device query and mutation takes the caller's authz.Scope; devices outside
+// it behave as if they did not exist. Child records (hardware, disks, ...) are
+// keyed by device ID and only read after a scoped device lookup.
 type DeviceRepository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	chainKey []byte // keys the audit entries written with imports
 }
 
-// NewDeviceRepository creates a new DeviceRepository.
-func NewDeviceRepository(db *sqlx.DB) *DeviceRepository {
-	return &DeviceRepository{db: db}
+// NewDeviceRepository creates a new DeviceRepository. chainKey keys the audit log hash
+// chain, like NewAuditLogRepository.
+func NewDeviceRepository(db *sqlx.DB, chainKey string) *DeviceRepository {
+	return &DeviceRepository{db: db, chainKey: []byte(chainKey)}
 }
 
 // ListParams holds filters, pagination, and sorting options for listing devices.
@@ -27,6 +34,8 @@ type ListParams struct {
 	OS           string
 	Status       string // "online", "offline", "inactive", or "" (all active)
 	DepartmentID string // UUID filter
+	Source       string // "agent", "manual", "import", "discovery" or "" (all)
+	AssetType    string // case-insensitive exact match
 	Sort         string // column name
 	Order        string // "asc" or "desc"
 	Page         int
@@ -41,6 +50,29 @@ var allowedSortColumns = map[string]string{
 	"status":    "last_seen",
 }
 
+// missedHeartbeats is how many heartbeat intervals an agent device may stay silent
+// before it is shown offline.
+const missedHeartbeats = 3
+
+// missedInventories is the same for agents that send no heartbeats, in inventory
+// intervals.
+const missedInventories = 2
+
+// presenceWindow returns the SQL interval (on the devices alias) within which an agent
+// device must have been seen to be online: missedHeartbeats of its heartbeat interval,
+// missedInventories of its inventory interval for agents that do not send heartbeats,
+// or one hour for agents that report neither.
+func presenceWindow(db driverNamer, alias string) string {
+	return seconds(db, fmt.Sprintf("COALESCE(%[1]s.checkin_interval_seconds * %[2]d, %[1]s.collection_interval_seconds * %[3]d, 3600)",
+		alias, missedHeartbeats, missedInventories))
+}
+
+// onlineColumn selects models.Device.Online (alias d). Agentless devices have no agent
+// reporting last_seen and are never online.
+func onlineColumn(db driverNamer) string {
+	return "(d.status = 'active' AND d.source = 'agent' AND d.last_seen > NOW() - " + presenceWindow(db, "d") + ") AS online"
+}
+
 // ListResult holds the paginated result from List.
 type ListResult struct {
 	Devices []models.Device
@@ -48,8 +80,14 @@ type ListResult struct {
 }
 
 // Delete removes a device by ID. All related data is cascaded by the database.
-func (r *DeviceRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM devices WHERE id = $1", id)
+func (r *DeviceRepository) Delete(ctx context.Context, id uuid.UUID, scope authz.Scope) error {
+	query := "DELETE FROM devices WHERE id = $1"
+	args := []interface{}{id}
+	if cond, scopeArgs, _ := scopeCondition(scope, "", 2); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+	result, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -65,18 +103,66 @@ func (r *DeviceRepository) Delete(ctx context.Context, id uuid.UUID) error {
 
 // List returns devices with filtering, sorting, and pagination.
 // By default only active devices are returned; pass Status="inactive" to see inactive ones.
-func (r *DeviceRepository) List(ctx context.Context, p ListParams) (*ListResult, error) {
+func (r *DeviceRepository) List(ctx context.Context, p ListParams, scope authz.Scope) (*ListResult, error) {
+	whereClause, args, argIdx := deviceFilter(r.db, p, scope)
+
+	// Count total matching rows.
+	countQuery := "SELECT COUNT(*) FROM devices d" + whereClause
+	var total int
+	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
+		return nil, fmt.Errorf("count devices: %w", err)
+	}
+
+	// Pagination defaults.
+	limit := p.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	page := p.Page
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	dataQuery := fmt.Sprintf(`SELECT d.*, %s, dep.name AS department_name
+		FROM devices d
+		LEFT JOIN departments dep ON dep.id = d.department_id
+		%s ORDER BY %s LIMIT $%d OFFSET $%d`,
+		onlineColumn(r.db), whereClause, deviceOrder(p), argIdx, argIdx+1)
+	args = append(args, limit, offset)
+
+	var devices []models.Device
+	if err := r.db.SelectContext(ctx, &devices, dataQuery, args...); err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	if devices == nil {
+		devices = []models.Device{}
+	}
+
+	return &ListResult{Devices: devices, Total: total}, nil
+}
+
+// deviceFilter builds the WHERE clause (alias d) for the ListParams filters within
+// scope and returns it with its arguments and the next placeholder index.
+// By default only active devices match; Status="inactive" selects inactive ones.
+func deviceFilter(db driverNamer, p ListParams, scope authz.Scope) (string, []interface{}, int) {
 	var where []string
 	args := []interface{}{}
 	argIdx := 1
 
+	if cond, scopeArgs, next := scopeCondition(scope, "d", argIdx); cond != "" {
+		where = append(where, cond)
+		args = append(args, scopeArgs...)
+		argIdx = next
+	}
+
 	if p.Hostname != "" {
-		where = append(where, fmt.Sprintf("d.hostname ILIKE $%d", argIdx))
+		where = append(where, fmt.Sprintf("d.hostname %s $%d", ilike(db), argIdx))
 		args = append(args, "%"+p.Hostname+"%")
 		argIdx++
 	}
 	if p.OS != "" {
-		where = append(where, fmt.Sprintf("(d.os_name ILIKE $%d OR d.os_version ILIKE $%d)", argIdx, argIdx))
+		where = append(where, fmt.Sprintf("(d.os_name %[1]s $%[2]d OR d.os_version %[1]s $%[2]d)", ilike(db), argIdx))
 		args = append(args, "%"+p.OS+"%")
 		argIdx++
 	}
@@ -85,14 +171,25 @@ func (r *DeviceRepository) List(ctx context.Context, p ListParams) (*ListResult,
 		args = append(args, p.DepartmentID)
 		argIdx++
 	}
+	if p.Source != "" {
+		where = append(where, fmt.Sprintf("d.source = $%d", argIdx))
+		args = append(args, p.Source)
+		argIdx++
+	}
+	if p.AssetType != "" {
+		where = append(where, fmt.Sprintf("LOWER(d.asset_type) = LOWER($%d)", argIdx))
+		args = append(args, p.AssetType)
+		argIdx++
+	}
 
+	// Only agent devices report last_seen, so agentless ones are neither online nor offline.
 	switch p.Status {
 	case "online":
-		where = append(where, "d.status = 'active'")
-		where = append(where, "d.last_seen > NOW() - INTERVAL '1 hour'")
+		where = append(where, "d.status = 'active'", "d.source = 'agent'")
+		where = append(where, "d.last_seen > NOW() - "+presenceWindow(db, "d"))
 	case "offline":
-		where = append(where, "d.status = 'active'")
-		where = append(where, "d.last_seen <= NOW() - INTERVAL '1 hour'")
+		where = append(where, "d.status = 'active'", "d.source = 'agent'")
+		where = append(where, "d.last_seen <= NOW() - "+presenceWindow(db, "d"))
 	case "inactive":
 		where = append(where, "d.status = 'inactive'")
 	default:
@@ -100,19 +197,11 @@ func (r *DeviceRepository) List(ctx context.Context, p ListParams) (*ListResult,
 		where = append(where, "d.status = 'active'")
 	}
 
-	whereClause := ""
-	if len(where) > 0 {
-		whereClause = " WHERE " + strings.Join(where, " AND ")
-	}
-
-	// Count total matching rows.
-	countQuery := "SELECT COUNT(*) FROM devices d" + whereClause
-	var total int
-	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
-		return nil, fmt.Errorf("count devices: %w", err)
-	}
+	return " WHERE " + strings.Join(where, " AND "), args, argIdx
+}
 
-	// Sorting — validate column.
+// deviceOrder returns the ORDER BY expression (alias d) for the ListParams sort options.
+func deviceOrder(p ListParams) string {
 	orderCol := "d.hostname"
 	if col, ok := allowedSortColumns[p.Sort]; ok {
 		orderCol = "d." + col
@@ -121,42 +210,22 @@ func (r *DeviceRepository) List(ctx context.Context, p ListParams) (*ListResult,
 	if strings.EqualFold(p.Order, "desc") {
 		orderDir = "DESC"
 	}
-
-	// Pagination defaults.
-	limit := p.Limit
-	if limit <= 0 || limit > 100 {
-		limit = 50
-	}
-	page := p.Page
-	if page < 1 {
-		page = 1
-	}
-	offset := (page - 1) * limit
-
-	dataQuery := fmt.Sprintf(`SELECT d.*, dep.name AS department_name
-		FROM devices d
-		LEFT JOIN departments dep ON dep.id = d.department_id
-		%s ORDER BY %s %s LIMIT $%d OFFSET $%d`,
-		whereClause, orderCol, orderDir, argIdx, argIdx+1)
-	args = append(args, limit, offset)
-
-	var devices []models.Device
-	if err := r.db.SelectContext(ctx, &devices, dataQuery, args...); err != nil {
-		return nil, fmt.Errorf("list devices: %w", err)
-	}
-	if devices == nil {
-		devices = []models.Device{}
-	}
-
-	return &ListResult{Devices: devices, Total: total}, nil
+	return orderCol + " " + orderDir
 }
 
 // GetByID retrieves a single device by its primary key, including department name.
-func (r *DeviceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Device, error) {
-	var device models.Device
-	err := r.db.GetContext(ctx, &device, `SELECT d.*, dep.name AS department_name
+func (r *DeviceRepository) GetByID(ctx context.Context, id uuid.UUID, scope authz.Scope) (*models.Device, error) {
+	query := `SELECT d.*, ` + onlineColumn(r.db) + `, dep.name AS department_name
 		FROM devices d LEFT JOIN departments dep ON dep.id = d.department_id
-		WHERE d.id = $1`, id)
+		WHERE d.id = $1`
+	args := []interface{}{id}
+	if cond, scopeArgs, _ := scopeCondition(scope, "d", 2); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+
+	var device models.Device
+	err := r.db.GetContext(ctx, &device, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -164,11 +233,18 @@ func (r *DeviceRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.D
 }
 
 // GetByHostname retrieves a single device by its hostname, including department name.
-func (r *DeviceRepository) GetByHostname(ctx context.Context, hostname string) (*models.Device, error) {
-	var device models.Device
-	err := r.db.GetContext(ctx, &device, `SELECT d.*, dep.name AS department_name
+func (r *DeviceRepository) GetByHostname(ctx context.Context, hostname string, scope authz.Scope) (*models.Device, error) {
+	query := `SELECT d.*, ` + onlineColumn(r.db) + `, dep.name AS department_name
 		FROM devices d LEFT JOIN departments dep ON dep.id = d.department_id
-		WHERE LOWER(d.hostname) = LOWER($1)`, hostname)
+		WHERE LOWER(d.hostname) = LOWER($1)`
+	args := []interface{}{hostname}
+	if cond, scopeArgs, _ := scopeCondition(scope, "d", 2); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+
+	var device models.Device
+	err := r.db.GetContext(ctx, &device, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -176,33 +252,86 @@ func (r *DeviceRepository) GetByHostname(ctx context.Context, hostname string) (
 }
 
 // UpdateStatus sets the status column of a device (active / inactive).
-func (r *DeviceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
-	res, err := r.db.ExecContext(ctx,
-		"UPDATE devices SET status = $1 WHERE id = $2", status, id)
+func (r *DeviceRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string, scope authz.Scope) error {
+	query := "UPDATE devices SET status = $1 WHERE id = $2"
+	args := []interface{}{status, id}
+	if cond, scopeArgs, _ := scopeCondition(scope, "", 3); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+	n, err := updateAndPublish(ctx, r.db, events.TypeStatusChanged, query+statusReturning, args)
 	if err != nil {
 		return fmt.Errorf("update device status: %w", err)
 	}
-	rows, _ := res.RowsAffected()
-	if rows == 0 {
+	if n == 0 {
 		return fmt.Errorf("device not found")
 	}
 	return nil
 }
 
 // UpdateDepartment assigns a department (or NULL) to a device.
-func (r *DeviceRepository) UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID) error {
-	res, err := r.db.ExecContext(ctx,
-		"UPDATE devices SET department_id = $1 WHERE id = $2", deptID, id)
+// The scope applies to the device's current department; callers check the target.
+func (r *DeviceRepository) UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID, scope authz.Scope) error {
+	query := "UPDATE devices d SET department_id = $1 FROM devices prev WHERE d.id = $2 AND prev.id = d.id"
+	args := []interface{}{deptID, id}
+	if cond, scopeArgs, _ := scopeCondition(scope, "prev", 3); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+	n, err := updateAndPublish(ctx, r.db, events.TypeDepartmentChanged, query+departmentReturning, args)
 	if err != nil {
 		return fmt.Errorf("update device department: %w", err)
 	}
-	rows, _ := res.RowsAffected()
-	if rows == 0 {
+	if n == 0 {
 		return fmt.Errorf("device not found")
 	}
 	return nil
 }
 
+// RETURNING clauses of the status and department updates, scanned into events.Device.
+// The department update joins the row as it was before the update (alias prev).
+const (
+	statusReturning     = " RETURNING id AS device_id, hostname, department_id, organization_id, status"
+	departmentReturning = " RETURNING d.id AS device_id, d.hostname, d.department_id, d.organization_id, prev.department_id AS old_department_id"
+)
+
+// updateAndPublish runs an UPDATE ... RETURNING the events.Device columns and
+// publishes an event of the given type for every updated device, in one transaction.
+// It returns the number of updated devices.
+func updateAndPublish(ctx context.Context, db *sqlx.DB, eventType, query string, args []interface{}) (int, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var changed []events.Device
+	if err := tx.SelectContext(ctx, &changed, query, args...); err != nil {
+		return 0, err
+	}
+	for _, d := range changed {
+		if err := events.PublishDevice(ctx, tx, eventType, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), tx.Commit()
+}
+
+// MarkOffline sets offline_since on the active agent devices that left their presence
+// window and publishes device.offline for each. Replicas may run it concurrently: a
+// device already marked is skipped, so every transition is published once.
+func (r *DeviceRepository) MarkOffline(ctx context.Context) (int, error) {
+	n, err := updateAndPublish(ctx, r.db, events.TypeDeviceOffline,
+		`UPDATE devices SET offline_since = NOW()
+		 WHERE offline_since IS NULL AND status = 'active' AND source = 'agent'
+		   AND last_seen <= NOW() - `+presenceWindow(r.db, "devices")+`
+		 RETURNING id AS device_id, hostname, department_id, organization_id`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("mark offline devices: %w", err)
+	}
+	return n, nil
+}
+
 // GetHardwareHistory returns hardware change records for a device, newest first.
 // If component is non-empty, only changes for that component are returned.
 func (r *DeviceRepository) GetHardwareHistory(ctx context.Context, deviceID uuid.UUID, component string, limit, offset int) ([]models.HardwareHistory, int, error) {
@@ -239,110 +368,58 @@ func (r *DeviceRepository) GetHardwareHistory(ctx context.Context, deviceID uuid
 	return history, total, nil
 }
 
-// ListForExport returns ALL devices matching the filters (no pagination) for CSV export.
-func (r *DeviceRepository) ListForExport(ctx context.Context, p ListParams) ([]models.Device, error) {
-	var where []string
-	args := []interface{}{}
-	argIdx := 1
-
-	if p.Hostname != "" {
-		where = append(where, fmt.Sprintf("d.hostname ILIKE $%d", argIdx))
-		args = append(args, "%"+p.Hostname+"%")
-		argIdx++
-	}
-	if p.OS != "" {
-		where = append(where, fmt.Sprintf("(d.os_name ILIKE $%d OR d.os_version ILIKE $%d)", argIdx, argIdx))
-		args = append(args, "%"+p.OS+"%")
-		argIdx++
-	}
-	if p.DepartmentID != "" {
-		where = append(where, fmt.Sprintf("d.department_id = $%d", argIdx))
-		args = append(args, p.DepartmentID)
-		// argIdx not incremented as it's the last parameter
-	}
-
-	switch p.Status {
-	case "online":
-		where = append(where, "d.status = 'active'")
-		where = append(where, "d.last_seen > NOW() - INTERVAL '1 hour'")
-	case "offline":
-		where = append(where, "d.status = 'active'")
-		where = append(where, "d.last_seen <= NOW() - INTERVAL '1 hour'")
-	case "inactive":
-		where = append(where, "d.status = 'inactive'")
-	default:
-		where = append(where, "d.status = 'active'")
-	}
-
-	whereClause := ""
-	if len(where) > 0 {
-		whereClause = " WHERE " + strings.Join(where, " AND ")
-	}
-
-	orderCol := "d.hostname"
-	if col, ok := allowedSortColumns[p.Sort]; ok {
-		orderCol = "d." + col
-	}
-	orderDir := "ASC"
-	if strings.EqualFold(p.Order, "desc") {
-		orderDir = "DESC"
-	}
-
-	query := fmt.Sprintf(`SELECT d.*, dep.name AS department_name
-		FROM devices d
-		LEFT JOIN departments dep ON dep.id = d.department_id
-		%s ORDER BY %s %s`, whereClause, orderCol, orderDir)
-
-	var devices []models.Device
-	if err := r.db.SelectContext(ctx, &devices, query, args...); err != nil {
-		return nil, fmt.Errorf("list devices for export: %w", err)
-	}
-	if devices == nil {
-		devices = []models.Device{}
-	}
-	return devices, nil
-}
-
 // BulkUpdateStatus sets the status column for multiple devices at once.
-func (r *DeviceRepository) BulkUpdateStatus(ctx context.Context, ids []uuid.UUID, status string) (int64, error) {
+func (r *DeviceRepository) BulkUpdateStatus(ctx context.Context, ids []uuid.UUID, status string, scope authz.Scope) (int64, error) {
 	if len(ids) == 0 {
 		return 0, nil
 	}
-	query, args, err := sqlx.In("UPDATE devices SET status = ? WHERE id IN (?)", status, ids)
+	cond, scopeArgs := scopeConditionIn(scope, "")
+	query, args, err := sqlx.In("UPDATE devices SET status = ? WHERE id IN (?)"+cond+statusReturning, append([]interface{}{status, ids}, scopeArgs...)...)
 	if err != nil {
 		return 0, fmt.Errorf("build bulk status query: %w", err)
 	}
-	query = r.db.Rebind(query)
-	res, err := r.db.ExecContext(ctx, query, args...)
+	n, err := updateAndPublish(ctx, r.db, events.TypeStatusChanged, r.db.Rebind(query), args)
 	if err != nil {
 		return 0, fmt.Errorf("bulk update status: %w", err)
 	}
-	return res.RowsAffected()
+	return int64(n), nil
 }
 
 // BulkUpdateDepartment sets the department for multiple devices at once.
-func (r *DeviceRepository) BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID) (int64, error) {
+// The scope applies to the devices' current department; callers check the target.
+func (r *DeviceRepository) BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID, scope authz.Scope) (int64, error) {
 	if len(ids) == 0 {
 		return 0, nil
 	}
-	query, args, err := sqlx.In("UPDATE devices SET department_id = ? WHERE id IN (?)", deptID, ids)
+	cond, scopeArgs := scopeConditionIn(scope, "prev")
+	query, args, err := sqlx.In("UPDATE devices d SET department_id = ? FROM devices prev WHERE d.id IN (?) AND prev.id = d.id"+cond+departmentReturning,
+		append([]interface{}{nullUUID(deptID), ids}, scopeArgs...)...)
 	if err != nil {
 		return 0, fmt.Errorf("build bulk dept query: %w", err)
 	}
-	query = r.db.Rebind(query)
-	res, err := r.db.ExecContext(ctx, query, args...)
+	n, err := updateAndPublish(ctx, r.db, events.TypeDepartmentChanged, r.db.Rebind(query), args)
 	if err != nil {
 		return 0, fmt.Errorf("bulk update department: %w", err)
 	}
-	return res.RowsAffected()
+	return int64(n), nil
+}
+
+// nullUUID returns id as a query argument for sqlx.In, which calls Value on typed nil
+// pointers.
+func nullUUID(id *uuid.UUID) interface{} {
+	if id == nil {
+		return nil
+	}
+	return *id
 }
 
 // BulkDelete deletes multiple devices by ID. Related data is cascaded.
-func (r *DeviceRepository) BulkDelete(ctx context.Context, ids []uuid.UUID) (int64, error) {
+func (r *DeviceRepository) BulkDelete(ctx context.Context, ids []uuid.UUID, scope authz.Scope) (int64, error) {
 	if len(ids) == 0 {
 		return 0, nil
 	}
-	query, args, err := sqlx.In("DELETE FROM devices WHERE id IN (?)", ids)
+	cond, scopeArgs := scopeConditionIn(scope, "")
+	query, args, err := sqlx.In("DELETE FROM devices WHERE id IN (?)"+cond, append([]interface{}{ids}, scopeArgs...)...)
 	if err != nil {
 		return 0, fmt.Errorf("build bulk delete query: %w", err)
 	}
@@ -355,9 +432,16 @@ func (r *DeviceRepository) BulkDelete(ctx context.Context, ids []uuid.UUID) (int
 }
 
 // GetBySerialNumber retrieves a device by its serial number.
-func (r *DeviceRepository) GetBySerialNumber(ctx context.Context, sn string) (*models.Device, error) {
+func (r *DeviceRepository) GetBySerialNumber(ctx context.Context, sn string, scope authz.Scope) (*models.Device, error) {
+	query := "SELECT * FROM devices WHERE serial_number = $1"
+	args := []interface{}{sn}
+	if cond, scopeArgs, _ := scopeCondition(scope, "", 2); cond != "" {
+		query += " AND " + cond
+		args = append(args, scopeArgs...)
+	}
+
 	var device models.Device
-	err := r.db.GetContext(ctx, &device, "SELECT * FROM devices WHERE serial_number = $1", sn)
+	err := r.db.GetContext(ctx, &device, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -7,6 +7,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
+	"inventario/server/internal/events"
 	"inventario/shared/models"
 )
 
@@ -30,7 +31,8 @@ type ActivityEntry struct {
 	Metadata     *string
 }
 
-// InsertBatch inserts multiple activity entries in a single transaction.
+// InsertBatch inserts multiple activity entries in a single transaction and publishes
+// one device.activity event per device.
 func (r *DeviceActivityRepository) InsertBatch(ctx context.Context, tx *sqlx.Tx, entries []ActivityEntry) error {
 	if len(entries) == 0 {
 		return nil
@@ -39,24 +41,43 @@ func (r *DeviceActivityRepository) InsertBatch(ctx context.Context, tx *sqlx.Tx,
 	stmt := `INSERT INTO device_activity_log (device_id, activity_type, description, old_value, new_value, metadata)
 	         VALUES ($1, $2, $3, $4, $5, $6)`
 
+	var devices []uuid.UUID
+	byDevice := make(map[uuid.UUID][]events.Activity)
 	for _, e := range entries {
 		if _, err := tx.ExecContext(ctx, stmt, e.DeviceID, e.ActivityType, e.Description, e.OldValue, e.NewValue, e.Metadata); err != nil {
 			return fmt.Errorf("insert device activity: %w", err)
 		}
+		if _, ok := byDevice[e.DeviceID]; !ok {
+			devices = append(devices, e.DeviceID)
+		}
+		byDevice[e.DeviceID] = append(byDevice[e.DeviceID], events.Activity{Type: e.ActivityType, Description: e.Description})
+	}
+
+	for _, id := range devices {
+		var ev events.Device
+		if err := tx.GetContext(ctx, &ev, "SELECT id AS device_id, hostname, department_id, organization_id FROM devices WHERE id = $1", id); err != nil {
+			return fmt.Errorf("load device for activity event: %w", err)
+		}
+		ev.Activity, ev.ActivityCount = byDevice[id], len(byDevice[id])
+		if err := events.PublishDevice(ctx, tx, events.TypeDeviceActivity, ev); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Insert inserts a single activity entry (standalone, no existing transaction).
+// Insert inserts a single activity entry in its own transaction.
 func (r *DeviceActivityRepository) Insert(ctx context.Context, entry ActivityEntry) error {
-	_, err := r.db.ExecContext(ctx,
-		`INSERT INTO device_activity_log (device_id, activity_type, description, old_value, new_value, metadata)
-		 VALUES ($1, $2, $3, $4, $5, $6)`,
-		entry.DeviceID, entry.ActivityType, entry.Description, entry.OldValue, entry.NewValue, entry.Metadata)
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("insert device activity: %w", err)
+		return fmt.Errorf("begin transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := r.InsertBatch(ctx, tx, []ActivityEntry{entry}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // ListByDevice returns activity logs for a device, ordered by most recent first.
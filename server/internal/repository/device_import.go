@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/authz"
+	"inventario/shared/models"
+)
+
+// ImportChange is one device created or updated by ApplyImport. Nil fields are left
+// unchanged; Attributes are merged into the existing custom attributes.
+type ImportChange struct {
+	DeviceID     uuid.UUID
+	Create       bool
+	Hostname     string // create only
+	SerialNumber string // create only
+	Status       *string
+	DepartmentID *uuid.UUID // with SetDepartment; nil removes the department
+	// SetDepartment is true when DepartmentID should be written.
+	SetDepartment bool
+	Attributes    map[string]string
+}
+
+// ImportCandidates returns the devices an import file may refer to: those with one of
+// the serial numbers or (case-insensitively) one of the hostnames within the organization.
+// It is not scoped to departments so that the caller can tell a device outside the scope
+// from a missing one.
+func (r *DeviceRepository) ImportCandidates(ctx context.Context, serials, hostnames []string, orgID uuid.UUID) ([]models.Device, error) {
+	var conds []string
+	var args []interface{}
+	if len(serials) > 0 {
+		conds = append(conds, "serial_number IN (?)")
+		args = append(args, serials)
+	}
+	if len(hostnames) > 0 {
+		conds = append(conds, "LOWER(hostname) IN (?)")
+		args = append(args, hostnames)
+	}
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM devices WHERE organization_id = ? AND ("+strings.Join(conds, " OR ")+")",
+		append([]interface{}{orgID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("build import candidates query: %w", err)
+	}
+	var devices []models.Device
+	if err := r.db.SelectContext(ctx, &devices, r.db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("import candidates: %w", err)
+	}
+	return devices, nil
+}
+
+// ApplyImport writes all changes in one transaction, with the audit entry of the import
+// when audit is not nil. Updates are restricted to the scope; if a device was deleted or
+// moved out of the scope since it was validated, the whole import is rolled back.
+func (r *DeviceRepository) ApplyImport(ctx context.Context, changes []ImportChange, scope authz.Scope, audit *models.AuditLog) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	for _, ch := range changes {
+		attrs := []byte("{}")
+		if len(ch.Attributes) > 0 {
+			if attrs, err = json.Marshal(ch.Attributes); err != nil {
+				return fmt.Errorf("marshal attributes: %w", err)
+			}
+		}
+
+		if ch.Create {
+			status := "active"
+			if ch.Status != nil {
+				status = *ch.Status
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO devices (id, organization_id, hostname, serial_number, status, department_id, custom_attributes, source, last_seen)
+				VALUES ($1, $2, $3, $4, $5, $6, `+attributes(tx, "$7")+`, 'import', NOW())`,
+				ch.DeviceID, scope.OrganizationID, ch.Hostname, ch.SerialNumber, status, ch.DepartmentID, string(attrs),
+			); err != nil {
+				return fmt.Errorf("create device %s: %w", ch.SerialNumber, err)
+			}
+			continue
+		}
+
+		sets := []string{"updated_at = NOW()"}
+		args := []interface{}{ch.DeviceID}
+		if ch.Status != nil {
+			args = append(args, *ch.Status)
+			sets = append(sets, fmt.Sprintf("status = $%d", len(args)))
+		}
+		if ch.SetDepartment {
+			args = append(args, ch.DepartmentID)
+			sets = append(sets, fmt.Sprintf("department_id = $%d", len(args)))
+		}
+		if len(ch.Attributes) > 0 {
+			args = append(args, string(attrs))
+			sets = append(sets, "custom_attributes = "+mergeAttributes(tx, fmt.Sprintf("$%d", len(args))))
+		}
+
+		query := "UPDATE devices SET " + strings.Join(sets, ", ") + " WHERE id = $1"
+		if cond, scopeArgs, _ := scopeCondition(scope, "", len(args)+1); cond != "" {
+			query += " AND " + cond
+			args = append(args, scopeArgs...)
+		}
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("update device %s: %w", ch.DeviceID, err)
+		}
+		if rows, _ := res.RowsAffected(); rows == 0 {
+			return fmt.Errorf("device %s was deleted or moved out of scope during the import", ch.DeviceID)
+		}
+	}
+
+	if audit != nil {
+		if _, err := appendAuditLogs(ctx, tx, r.chainKey, []*models.AuditLog{audit}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
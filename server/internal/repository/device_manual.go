@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/shared/dto"
+)
+
+// ErrSerialNumberInUse is returned when a manual asset would take the serial number
+// of another device.
+var ErrSerialNumberInUse = errors.New("serial number already in use")
+
+// SaveManual creates (create = true) or replaces an agentless device, its hardware and
+// its network interfaces in one transaction. Without req.Hardware the hardware record
+// is removed. Updates only apply to non-agent devices within the scope.
+func (r *DeviceRepository) SaveManual(ctx context.Context, id uuid.UUID, create bool, req *dto.ManualAssetRequest, scope authz.Scope) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	attrs := []byte("{}")
+	if len(req.CustomAttributes) > 0 {
+		if attrs, err = json.Marshal(req.CustomAttributes); err != nil {
+			return fmt.Errorf("marshal attributes: %w", err)
+		}
+	}
+	status := req.Status
+	if status == "" {
+		status = "active"
+	}
+
+	args := []interface{}{id, req.Hostname, req.SerialNumber, req.AssetType, req.OSName, req.OSVersion, status,
+		req.DepartmentID, string(attrs)}
+	var query string
+	if create {
+		query = `INSERT INTO devices (id, hostname, serial_number, asset_type, os_name, os_version, status,
+				department_id, custom_attributes, organization_id, source, last_seen)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, ` + attributes(tx, "$9") + `, $10, 'manual', NOW())`
+		args = append(args, scope.OrganizationID)
+	} else {
+		query = `UPDATE devices SET hostname = $2, serial_number = $3, asset_type = $4, os_name = $5,
+			os_version = $6, status = $7, department_id = $8, custom_attributes = ` + attributes(tx, "$9") + `, updated_at = NOW()
+			WHERE id = $1 AND source <> 'agent'`
+		if cond, scopeArgs, _ := scopeCondition(scope, "", len(args)+1); cond != "" {
+			query += " AND " + cond
+			args = append(args, scopeArgs...)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrSerialNumberInUse
+		}
+		return fmt.Errorf("save manual asset: %w", err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		return fmt.Errorf("device not found")
+	}
+
+	if req.Hardware == nil {
+		if _, err = tx.ExecContext(ctx, "DELETE FROM hardware WHERE device_id = $1", id); err != nil {
+			return fmt.Errorf("delete hardware: %w", err)
+		}
+	} else if _, err = tx.ExecContext(ctx, `
+		INSERT INTO hardware (id, device_id, cpu_model, cpu_cores, cpu_threads, ram_total_bytes,
+			motherboard_manufacturer, motherboard_product, motherboard_serial,
+			bios_vendor, bios_version, updated_at)
+		VALUES (uuid_generate_v4(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+		ON CONFLICT (device_id) DO UPDATE SET
+			cpu_model                = EXCLUDED.cpu_model,
+			cpu_cores                = EXCLUDED.cpu_cores,
+			cpu_threads              = EXCLUDED.cpu_threads,
+			ram_total_bytes          = EXCLUDED.ram_total_bytes,
+			motherboard_manufacturer = EXCLUDED.motherboard_manufacturer,
+			motherboard_product      = EXCLUDED.motherboard_product,
+			motherboard_serial       = EXCLUDED.motherboard_serial,
+			bios_vendor              = EXCLUDED.bios_vendor,
+			bios_version             = EXCLUDED.bios_version,
+			updated_at               = NOW()
+	`, id,
+		req.Hardware.CPUModel, req.Hardware.CPUCores, req.Hardware.CPUThreads,
+		req.Hardware.RAMTotalBytes,
+		req.Hardware.MotherboardManufacturer, req.Hardware.MotherboardProduct,
+		req.Hardware.MotherboardSerial,
+		req.Hardware.BIOSVendor, req.Hardware.BIOSVersion,
+	); err != nil {
+		return fmt.Errorf("upsert hardware: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, "DELETE FROM network_interfaces WHERE device_id = $1", id); err != nil {
+		return fmt.Errorf("delete network interfaces: %w", err)
+	}
+	if len(req.NetworkInterfaces) > 0 {
+		vals := make([]string, 0, len(req.NetworkInterfaces))
+		args := []interface{}{}
+		for i, n := range req.NetworkInterfaces {
+			base := i*7 + 1
+			vals = append(vals, fmt.Sprintf("(uuid_generate_v4(), $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				base, base+1, base+2, base+3, base+4, base+5, base+6))
+			args = append(args, id, n.Name, n.MACAddress, n.IPv4Address, n.IPv6Address, n.SpeedMbps, n.IsPhysical)
+		}
+		q := "INSERT INTO network_interfaces (id, device_id, name, mac_address, ipv4_address, ipv6_address, speed_mbps, is_physical) VALUES " + strings.Join(vals, ", ")
+		if _, err = tx.ExecContext(ctx, q, args...); err != nil {
+			return fmt.Errorf("insert network interfaces: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
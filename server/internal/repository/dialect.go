@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"inventario/server/internal/database"
+)
+
+// The helpers below render the SQL fragments PostgreSQL and SQLite spell differently,
+// so that statements that differ only in them are shared by both backends. db is the
+// *sqlx.DB or *sqlx.Tx the statement runs on.
+
+// driverNamer is implemented by *sqlx.DB and *sqlx.Tx.
+type driverNamer interface {
+	DriverName() string
+}
+
+// isSQLite reports whether db is on the SQLite backend.
+func isSQLite(db driverNamer) bool {
+	return db.DriverName() == database.DriverSQLite
+}
+
+// seconds returns an interval of expr seconds, to add to or subtract from a timestamp.
+// SQLite stores timestamps as integer Unix milliseconds.
+func seconds(db driverNamer, expr string) string {
+	if isSQLite(db) {
+		return "CAST((" + expr + ") * 1000 AS INTEGER)"
+	}
+	return "(" + expr + ") * INTERVAL '1 second'"
+}
+
+// days returns an interval of expr days, like seconds.
+func days(db driverNamer, expr string) string {
+	if isSQLite(db) {
+		return "CAST((" + expr + ") * 86400000 AS INTEGER)"
+	}
+	return "make_interval(days => " + expr + ")"
+}
+
+// timestampPrecision returns the precision timestamps are stored with, to which times
+// that are signed before they are stored must be truncated.
+func timestampPrecision(db driverNamer) time.Duration {
+	if isSQLite(db) {
+		return time.Millisecond
+	}
+	return time.Microsecond
+}
+
+// ilike returns the case-insensitive LIKE operator. SQLite's LIKE ignores ASCII case.
+func ilike(db driverNamer) string {
+	if isSQLite(db) {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
+
+// cast returns expr cast to the PostgreSQL type typ. SQLite columns are not typed
+// that way: a uuid needs no cast and jsonb is validated and minified as TEXT.
+func cast(db driverNamer, expr, typ string) string {
+	if !isSQLite(db) {
+		return expr + "::" + typ
+	}
+	if typ == "jsonb" {
+		return "json(" + expr + ")"
+	}
+	return expr
+}
+
+// attributes returns the JSON object expr as a devices.custom_attributes value, which
+// SQLite stores as a BLOB so that it scans into json.RawMessage.
+func attributes(db driverNamer, expr string) string {
+	if isSQLite(db) {
+		return "CAST(json(" + expr + ") AS BLOB)"
+	}
+	return expr + "::jsonb"
+}
+
+// mergeAttributes returns custom_attributes with the keys of the JSON object expr set.
+func mergeAttributes(db driverNamer, expr string) string {
+	if isSQLite(db) {
+		return "CAST(json_patch(CAST(custom_attributes AS TEXT), " + expr + ") AS BLOB)"
+	}
+	return "custom_attributes || " + expr + "::jsonb"
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	var liteErr *sqlite.Error
+	return errors.As(err, &liteErr) &&
+		(liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY)
+}
+
+// IsForeignKeyViolation reports whether err is a foreign key violation, such as the
+// deletion of a row that others still reference.
+func IsForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23503"
+	}
+	var liteErr *sqlite.Error
+	return errors.As(err, &liteErr) && liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// IsRejected reports whether the database refused a statement because of the data it
+// was given — invalid values or violated constraints — so that retrying it cannot
+// succeed. Other errors, such as a lost connection or a busy database, may be transient.
+func IsRejected(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		class := pgErr.Code[:min(2, len(pgErr.Code))]
+		return class == "22" || class == "23" // data exception, integrity constraint violation
+	}
+	var liteErr *sqlite.Error
+	if !errors.As(err, &liteErr) {
+		return false
+	}
+	switch liteErr.Code() & 0xff { // the primary result code
+	case sqlite3.SQLITE_ERROR, sqlite3.SQLITE_CONSTRAINT, sqlite3.SQLITE_MISMATCH, sqlite3.SQLITE_TOOBIG:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"inventario/server/internal/authz"
+)
+
+// exportDataset is a table that can be exported for the devices matching ListParams.
+// query selects from the CTE "d" (the filtered devices with department_name) and
+// returns the columns in order; UUIDs and JSON are cast to text.
+type exportDataset struct {
+	columns   []string
+	csvHeader []string // header of CSV files when it differs from columns
+	query     string
+	order     string // appended to the device sort order
+}
+
+// ExportDatasets lists the dataset names accepted by Export.
+var ExportDatasets = []string{
+	"devices", "hardware", "disks", "network_interfaces", "installed_software", "remote_tools", "activity",
+}
+
+var exportDatasets = map[string]exportDataset{
+	// The first columns of devices are those of the CSV export that predates datasets,
+	// in its order and, in CSV files, with its header, for the scripts that read it.
+	"devices": {
+		columns: []string{"hostname", "serial_number", "os_name", "os_version", "os_build", "os_arch",
+			"logged_in_user", "agent_version", "license_status", "status", "department", "last_seen", "created_at",
+			"device_id", "source", "asset_type", "custom_attributes", "last_boot_time"},
+		csvHeader: []string{"Hostname", "Serial Number", "OS", "OS Version", "OS Build", "Architecture",
+			"Logged In User", "Agent Version", "License Status", "Status", "Department", "Last Seen", "Created At",
+			"Device ID", "Source", "Asset Type", "Custom Attributes", "Last Boot Time"},
+		query: `SELECT d.hostname, d.serial_number, d.os_name, d.os_version, d.os_build, d.os_arch,
+			d.logged_in_user, d.agent_version, d.license_status, d.status, COALESCE(d.department_name, ''),
+			d.last_seen, d.created_at,
+			CAST(d.id AS TEXT), d.source, d.asset_type, CAST(d.custom_attributes AS TEXT), d.last_boot_time
+			FROM d`,
+	},
+	"hardware": {
+		columns: []string{"device_id", "hostname", "cpu_model", "cpu_cores", "cpu_threads", "ram_total_bytes",
+			"motherboard_manufacturer", "motherboard_product", "motherboard_serial", "bios_vendor", "bios_version", "updated_at"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, h.cpu_model, h.cpu_cores, h.cpu_threads, h.ram_total_bytes,
+			h.motherboard_manufacturer, h.motherboard_product, h.motherboard_serial, h.bios_vendor, h.bios_version, h.updated_at
+			FROM d JOIN hardware h ON h.device_id = d.id`,
+	},
+	"disks": {
+		columns: []string{"device_id", "hostname", "model", "size_bytes", "media_type", "serial_number", "interface_type",
+			"drive_letter", "partition_size_bytes", "free_space_bytes"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, x.model, x.size_bytes, x.media_type, x.serial_number, x.interface_type,
+			x.drive_letter, x.partition_size_bytes, x.free_space_bytes
+			FROM d JOIN disks x ON x.device_id = d.id`,
+		order: "x.drive_letter, x.model",
+	},
+	"network_interfaces": {
+		columns: []string{"device_id", "hostname", "name", "mac_address", "ipv4_address", "ipv6_address", "speed_mbps", "is_physical"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, x.name, x.mac_address, x.ipv4_address, x.ipv6_address, x.speed_mbps, x.is_physical
+			FROM d JOIN network_interfaces x ON x.device_id = d.id`,
+		order: "x.name",
+	},
+	"installed_software": {
+		columns: []string{"device_id", "hostname", "name", "version", "vendor", "install_date"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, x.name, x.version, x.vendor, x.install_date
+			FROM d JOIN installed_software x ON x.device_id = d.id`,
+		order: "x.name, x.version",
+	},
+	"remote_tools": {
+		columns: []string{"device_id", "hostname", "tool_name", "remote_id", "version"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, x.tool_name, x.remote_id, x.version
+			FROM d JOIN remote_tools x ON x.device_id = d.id`,
+		order: "x.tool_name",
+	},
+	"activity": {
+		columns: []string{"device_id", "hostname", "activity_type", "description", "old_value", "new_value", "metadata", "detected_at"},
+		query: `SELECT CAST(d.id AS TEXT), d.hostname, x.activity_type, x.description, x.old_value, x.new_value, CAST(x.metadata AS TEXT), x.detected_at
+			FROM d JOIN device_activity_log x ON x.device_id = d.id`,
+		order: "x.detected_at",
+	},
+}
+
+// ExportColumns returns the column names of dataset, or false if it does not exist.
+func ExportColumns(dataset string) ([]string, bool) {
+	ds, ok := exportDatasets[dataset]
+	return ds.columns, ok
+}
+
+// ExportCSVHeader returns the header of CSV exports of dataset.
+func ExportCSVHeader(dataset string) []string {
+	ds := exportDatasets[dataset]
+	if ds.csvHeader != nil {
+		return ds.csvHeader
+	}
+	return ds.columns
+}
+
+// ExportCount returns the number of rows Export would stream.
+func (r *DeviceRepository) ExportCount(ctx context.Context, dataset string, p ListParams, scope authz.Scope) (int, error) {
+	ds, ok := exportDatasets[dataset]
+	if !ok {
+		return 0, fmt.Errorf("unknown export dataset %q", dataset)
+	}
+	query, args := exportQuery(r.db, ds, p, scope)
+	var n int
+	if err := r.db.GetContext(ctx, &n, "SELECT COUNT(*) FROM ("+query+") x", args...); err != nil {
+		return 0, fmt.Errorf("count export %s: %w", dataset, err)
+	}
+	return n, nil
+}
+
+// exportQuery returns the query of ds for the devices matching p within scope, without
+// its order.
+func exportQuery(db driverNamer, ds exportDataset, p ListParams, scope authz.Scope) (string, []interface{}) {
+	whereClause, args, _ := deviceFilter(db, p, scope)
+	return `WITH d AS (
+		SELECT d.*, dep.name AS department_name
+		FROM devices d
+		LEFT JOIN departments dep ON dep.id = d.department_id` + whereClause + `
+	) ` + ds.query, args
+}
+
+// Export streams the rows of dataset for the devices matching the filters within scope,
+// in the devices' sort order, calling row for each one. Rows are read from the database
+// as they are consumed, so memory use does not grow with the export size. Values are
+// string, int64, bool, time.Time or nil.
+func (r *DeviceRepository) Export(ctx context.Context, dataset string, p ListParams, scope authz.Scope, row func([]any) error) error {
+	ds, ok := exportDatasets[dataset]
+	if !ok {
+		return fmt.Errorf("unknown export dataset %q", dataset)
+	}
+
+	query, args := exportQuery(r.db, ds, p, scope)
+	order := deviceOrder(p) + ", d.id"
+	if ds.order != "" {
+		order += ", " + ds.order
+	}
+	query += " ORDER BY " + order
+
+	rows, err := r.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("export %s: %w", dataset, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return fmt.Errorf("export %s: %w", dataset, err)
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if err := row(values); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export %s: %w", dataset, err)
+	}
+	return nil
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 
+	"inventario/server/internal/events"
 	"inventario/shared/dto"
 	"inventario/shared/models"
 )
@@ -98,9 +100,11 @@ func (r *InventoryRepository) Save(ctx context.Context, deviceID uuid.UUID, req
 
 	// Upsert device
 	if _, err = tx.ExecContext(ctx, `
-		INSERT INTO devices (id, hostname, serial_number, os_name, os_version, os_build, os_arch,
-			last_boot_time, logged_in_user, agent_version, license_status, last_seen, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NOW(), NOW())
+		INSERT INTO devices (id, organization_id, hostname, serial_number, os_name, os_version, os_build, os_arch,
+			last_boot_time, logged_in_user, agent_version, license_status, checkin_interval_seconds,
+			collection_interval_seconds, last_seen, updated_at)
+		VALUES ($1, (SELECT organization_id FROM devices WHERE id = $1), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11,
+			NULLIF($12, 0), NULLIF($13, 0), NOW(), NOW())
 		ON CONFLICT (id) DO UPDATE SET
 			hostname       = EXCLUDED.hostname,
 			os_name        = EXCLUDED.os_name,
@@ -111,11 +115,15 @@ func (r *InventoryRepository) Save(ctx context.Context, deviceID uuid.UUID, req
 			logged_in_user = EXCLUDED.logged_in_user,
 			agent_version  = EXCLUDED.agent_version,
 			license_status = EXCLUDED.license_status,
+			checkin_interval_seconds = EXCLUDED.checkin_interval_seconds,
+			collection_interval_seconds = EXCLUDED.collection_interval_seconds,
+			offline_since  = NULL,
 			last_seen      = NOW(),
 			updated_at     = NOW()
 	`, deviceID, req.Hostname, req.SerialNumber,
 		req.OSName, req.OSVersion, req.OSBuild, req.OSArch,
 		req.LastBootTime, req.LoggedInUser, req.AgentVersion, req.LicenseStatus,
+		req.HeartbeatIntervalSeconds, req.CollectionIntervalSeconds,
 	); err != nil {
 		return fmt.Errorf("upsert device: %w", err)
 	}
@@ -261,10 +269,75 @@ func (r *InventoryRepository) Save(ctx context.Context, deviceID uuid.UUID, req
 		}
 	}
 
+	// ── Metrics ──────────────────────────────────────────────────────
+	if free, total, ok := partitionSpace(req.Disks); ok {
+		if err := insertMetric(ctx, tx, deviceID, nil, &free, &total); err != nil {
+			return err
+		}
+	}
+
 	// ── Persist detected activity changes ────────────────────────────
 	if err := r.activityRepo.InsertBatch(ctx, tx, activities); err != nil {
 		return fmt.Errorf("insert activity logs: %w", err)
 	}
 
+	// ── Live events, delivered on commit ─────────────────────────────
+	ev := events.Device{DeviceID: deviceID, Hostname: req.Hostname, DepartmentID: existing.DepartmentID, OrganizationID: existing.OrganizationID}
+	if existing.OfflineSince != nil {
+		if err := events.PublishDevice(ctx, tx, events.TypeDeviceOnline, ev); err != nil {
+			return err
+		}
+	}
+	if err := events.PublishDevice(ctx, tx, events.TypeInventorySaved, ev); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Heartbeat records an agent heartbeat: it bumps last_seen and stores what the agent
+// reported, publishing device.online if the device was offline. It returns
+// sql.ErrNoRows if the device does not exist.
+func (r *InventoryRepository) Heartbeat(ctx context.Context, deviceID uuid.UUID, req *dto.HeartbeatRequest) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	// The joined row is read before the update, so it carries the previous offline_since.
+	var row struct {
+		events.Device
+		WasOffline bool `db:"was_offline"`
+	}
+	err = tx.GetContext(ctx, &row, `
+		UPDATE devices d SET
+			checkin_interval_seconds = $2,
+			uptime_seconds           = $3,
+			logged_in_user           = COALESCE($4, d.logged_in_user),
+			agent_version            = COALESCE(NULLIF($5, ''), d.agent_version),
+			agent_state              = $6,
+			agent_error              = $7,
+			offline_since            = NULL,
+			last_heartbeat           = NOW(),
+			last_seen                = NOW()
+		FROM devices prev
+		WHERE d.id = $1 AND prev.id = d.id
+		RETURNING d.id AS device_id, d.hostname, d.department_id, d.organization_id, prev.offline_since IS NOT NULL AS was_offline`,
+		deviceID, req.IntervalSeconds, req.UptimeSeconds, req.LoggedInUser, req.AgentVersion, req.State, req.Error)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("record heartbeat: %w", err)
+	}
+	if err := insertMetric(ctx, tx, deviceID, &req.UptimeSeconds, nil, nil); err != nil {
+		return err
+	}
+	if row.WasOffline {
+		if err := events.PublishDevice(ctx, tx, events.TypeDeviceOnline, row.Device); err != nil {
+			return err
+		}
+	}
 	return tx.Commit()
 }
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// jobLockClass is the first key of the advisory locks of scheduler jobs; the second is
+// a hash of the job name.
+const jobLockClass = 0x6a6f6273 // "jobs"
+
+// JobRepository keeps the run history of the job scheduler and the lock that elects
+// the replica running each job.
+type JobRepository struct {
+	db *sqlx.DB
+}
+
+// NewJobRepository creates a new JobRepository.
+func NewJobRepository(db *sqlx.DB) *JobRepository {
+	return &JobRepository{db: db}
+}
+
+// Lock takes the lock of job without waiting, on a connection of its own that holds
+// it until unlock is called. ok is false when another replica holds it.
+func (r *JobRepository) Lock(ctx context.Context, job string) (unlock func(), ok bool, err error) {
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("get connection: %w", err)
+	}
+	key := jobLockKey(job)
+	if err := conn.GetContext(ctx, &ok, "SELECT pg_try_advisory_lock($1, $2)", jobLockClass, key); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("lock job %s: %w", job, err)
+	}
+	if !ok {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1, $2)", jobLockClass, key); err != nil {
+			slog.Error("failed to unlock job, closing its connection", "job", job, "error", err)
+			// The lock goes with the session: the connection must not return to the pool.
+			conn.Raw(func(any) error { return driver.ErrBadConn }) //nolint:errcheck
+		}
+		conn.Close()
+	}, true, nil
+}
+
+// jobLockKey returns the second key of the advisory lock of job.
+func jobLockKey(job string) int32 {
+	h := fnv.New32a()
+	h.Write([]byte(job))
+	return int32(h.Sum32())
+}
+
+// LastScheduled returns the activation time of the last scheduled run of job, nil if
+// it never ran on schedule.
+func (r *JobRepository) LastScheduled(ctx context.Context, job string) (*time.Time, error) {
+	var t time.Time
+	err := r.db.GetContext(ctx, &t,
+		`SELECT scheduled_for FROM job_runs WHERE job = $1 AND scheduled_for IS NOT NULL
+		 ORDER BY scheduled_for DESC LIMIT 1`, job)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get last scheduled run: %w", err)
+	}
+	return &t, nil
+}
+
+// StartRun records run as running, stamping its start time. Runs of the same job still
+// marked running were left by a replica that stopped: the caller holds the job's lock,
+// so they are marked interrupted.
+func (r *JobRepository) StartRun(ctx context.Context, run *models.JobRun) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE job_runs SET status = 'interrupted', finished_at = NOW(), error = 'the replica running it stopped'
+		 WHERE job = $1 AND status = 'running'`, run.Job); err != nil {
+		return fmt.Errorf("mark interrupted job runs: %w", err)
+	}
+	run.Status = "running"
+	if err := tx.GetContext(ctx, &run.StartedAt,
+		`INSERT INTO job_runs (id, job, source, requested_by, scheduled_for, replica, status)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING started_at`,
+		run.ID, run.Job, run.Source, run.RequestedBy, run.ScheduledFor, run.Replica, run.Status); err != nil {
+		return fmt.Errorf("insert job run: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// FinishRun records the status, result and error of run, stamping its end time, and
+// deletes the runs of the job beyond the keep most recent.
+func (r *JobRepository) FinishRun(ctx context.Context, run *models.JobRun, keep int) error {
+	var result any
+	if len(run.Result) > 0 {
+		result = []byte(run.Result)
+	}
+	var finishedAt time.Time
+	if err := r.db.GetContext(ctx, &finishedAt,
+		`UPDATE job_runs SET status = $2, finished_at = NOW(), result = $3, error = $4
+		 WHERE id = $1 RETURNING finished_at`,
+		run.ID, run.Status, result, run.Error); err != nil {
+		return fmt.Errorf("finish job run: %w", err)
+	}
+	run.FinishedAt = &finishedAt
+
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM job_runs WHERE job = $1 AND status <> 'running' AND id NOT IN (
+		     SELECT id FROM job_runs WHERE job = $1 ORDER BY started_at DESC LIMIT $2)`,
+		run.Job, keep); err != nil {
+		return fmt.Errorf("trim job runs: %w", err)
+	}
+	return nil
+}
+
+// ListRuns returns a page of the runs of job, newest first, and their total.
+func (r *JobRepository) ListRuns(ctx context.Context, job string, limit, offset int) ([]models.JobRun, int, error) {
+	var total int
+	if err := r.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM job_runs WHERE job = $1", job); err != nil {
+		return nil, 0, fmt.Errorf("count job runs: %w", err)
+	}
+
+	var runs []models.JobRun
+	if err := r.db.SelectContext(ctx, &runs,
+		"SELECT * FROM job_runs WHERE job = $1 ORDER BY started_at DESC LIMIT $2 OFFSET $3",
+		job, limit, offset); err != nil {
+		return nil, 0, fmt.Errorf("list job runs: %w", err)
+	}
+	if runs == nil {
+		runs = []models.JobRun{}
+	}
+	return runs, total, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// insertMetric records a metrics sample of a device in tx. Heartbeats pass the uptime,
+// inventories the free and total partition space; the other values stay NULL.
+func insertMetric(ctx context.Context, tx *sqlx.Tx, deviceID uuid.UUID, uptime, diskFree, diskTotal *int64) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO device_metrics (id, device_id, uptime_seconds, disk_free_bytes, disk_total_bytes)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		uuid.New(), deviceID, uptime, diskFree, diskTotal)
+	if err != nil {
+		return fmt.Errorf("insert device metric: %w", err)
+	}
+	return nil
+}
+
+// partitionSpace sums the free and total space of the partitions among disks. ok is
+// false when the agent reported no partition.
+func partitionSpace(disks []dto.DiskData) (free, total int64, ok bool) {
+	for _, d := range disks {
+		if d.PartitionSizeBytes > 0 {
+			free += d.FreeSpaceBytes
+			total += d.PartitionSizeBytes
+			ok = true
+		}
+	}
+	return free, total, ok
+}
+
+// GetMetrics returns the metrics samples of a device recorded since the given time,
+// oldest first.
+func (r *DeviceRepository) GetMetrics(ctx context.Context, deviceID uuid.UUID, since time.Time) ([]models.DeviceMetric, error) {
+	metrics := []models.DeviceMetric{}
+	if err := r.db.SelectContext(ctx, &metrics,
+		"SELECT * FROM device_metrics WHERE device_id = $1 AND recorded_at >= $2 ORDER BY recorded_at",
+		deviceID, since); err != nil {
+		return nil, fmt.Errorf("get device metrics: %w", err)
+	}
+	return metrics, nil
+}
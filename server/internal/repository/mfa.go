@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// MFARepository handles TOTP secrets and recovery codes for dashboard users.
+type MFARepository struct {
+	db *sqlx.DB
+}
+
+// NewMFARepository creates a new MFARepository.
+func NewMFARepository(db *sqlx.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// SetPendingSecret stores a new TOTP secret for a user who has not enabled TOTP yet.
+// It returns an error if TOTP is already enabled, so an active secret is never replaced.
+func (r *MFARepository) SetPendingSecret(ctx context.Context, userID uuid.UUID, secret string) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = $1, updated_at = NOW() WHERE id = $2 AND NOT totp_enabled",
+		secret, userID)
+	if err != nil {
+		return fmt.Errorf("set totp secret: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("two-factor authentication is already enabled")
+	}
+	return nil
+}
+
+// Enable turns on TOTP for a user and replaces their recovery codes in one transaction.
+// step is the time step of the code used to confirm enrollment.
+func (r *MFARepository) Enable(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE users SET totp_enabled = TRUE, totp_last_step = $1, updated_at = NOW() WHERE id = $2 AND totp_secret IS NOT NULL AND NOT totp_enabled",
+		step, userID)
+	if err != nil {
+		return fmt.Errorf("enable totp: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("no pending two-factor enrollment")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Disable turns off TOTP for a user and deletes their secret and recovery codes.
+func (r *MFARepository) Disable(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0, updated_at = NOW() WHERE id = $1",
+		userID)
+	if err != nil {
+		return fmt.Errorf("disable totp: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ConsumeStep records step as the last accepted TOTP time step.
+// It returns false if a code from this or a later step was already accepted.
+func (r *MFARepository) ConsumeStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1",
+		step, userID)
+	if err != nil {
+		return false, fmt.Errorf("consume totp step: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// ReplaceRecoveryCodes discards all recovery codes of a user and stores new ones.
+func (r *MFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used.
+// It returns false if the code does not exist or was already used.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE user_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("use recovery code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes of a user.
+func (r *MFARepository) CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.GetContext(ctx, &count,
+		"SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL", userID)
+	if err != nil {
+		return 0, fmt.Errorf("count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO user_recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)",
+			uuid.New(), userID, hash); err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// DefaultOrganizationID is the organization created by the migration that introduced
+// tenants. It holds the data of single-tenant deployments, receives agents enrolling
+// with ENROLLMENT_KEY and users provisioned by LDAP or OIDC, and cannot be deleted.
+var DefaultOrganizationID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// OrganizationRepository handles organizations (tenants) and their enrollment keys.
+type OrganizationRepository struct {
+	db *sqlx.DB
+}
+
+// NewOrganizationRepository creates a new OrganizationRepository.
+func NewOrganizationRepository(db *sqlx.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// List returns all organizations ordered by name.
+func (r *OrganizationRepository) List(ctx context.Context) ([]models.Organization, error) {
+	var orgs []models.Organization
+	if err := r.db.SelectContext(ctx, &orgs, "SELECT * FROM organizations ORDER BY name"); err != nil {
+		return nil, fmt.Errorf("list organizations: %w", err)
+	}
+	if orgs == nil {
+		orgs = []models.Organization{}
+	}
+	return orgs, nil
+}
+
+// GetByID returns a single organization.
+func (r *OrganizationRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.db.GetContext(ctx, &org, "SELECT * FROM organizations WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// Create inserts a new organization and returns it.
+func (r *OrganizationRepository) Create(ctx context.Context, name string, retentionDays, inactiveDays *int) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.GetContext(ctx, &org,
+		`INSERT INTO organizations (id, name, retention_days, inactive_days)
+		 VALUES ($1, $2, $3, $4) RETURNING *`,
+		uuid.New(), name, retentionDays, inactiveDays)
+	if err != nil {
+		return nil, fmt.Errorf("create organization: %w", err)
+	}
+	return &org, nil
+}
+
+// Update renames an organization and replaces its settings (nil = server default).
+func (r *OrganizationRepository) Update(ctx context.Context, id uuid.UUID, name string, retentionDays, inactiveDays *int) (*models.Organization, error) {
+	var org models.Organization
+	err := r.db.GetContext(ctx, &org,
+		`UPDATE organizations SET name = $1, retention_days = $2, inactive_days = $3, updated_at = NOW()
+		 WHERE id = $4 RETURNING *`,
+		name, retentionDays, inactiveDays, id)
+	if err != nil {
+		return nil, fmt.Errorf("update organization: %w", err)
+	}
+	return &org, nil
+}
+
+// Delete removes an organization with its departments and enrollment keys. The
+// database refuses it (foreign key violation) while devices or users still belong to it.
+func (r *OrganizationRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM organizations WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("delete organization: %w", err)
+	}
+	rows, _ := res.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("organization not found")
+	}
+	return nil
+}
+
+// CreateEnrollmentKey inserts a new enrollment key.
+func (r *OrganizationRepository) CreateEnrollmentKey(ctx context.Context, key *models.EnrollmentKey) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO enrollment_keys (id, organization_id, name, key_prefix, key_hash, created_by)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.OrganizationID, key.Name, key.KeyPrefix, key.KeyHash, key.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("create enrollment key: %w", err)
+	}
+	return nil
+}
+
+// ListEnrollmentKeys returns the enrollment keys of an organization, newest first,
+// including revoked ones.
+func (r *OrganizationRepository) ListEnrollmentKeys(ctx context.Context, orgID uuid.UUID) ([]models.EnrollmentKey, error) {
+	var keys []models.EnrollmentKey
+	err := r.db.SelectContext(ctx, &keys,
+		"SELECT * FROM enrollment_keys WHERE organization_id = $1 ORDER BY created_at DESC", orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list enrollment keys: %w", err)
+	}
+	if keys == nil {
+		keys = []models.EnrollmentKey{}
+	}
+	return keys, nil
+}
+
+// RevokeEnrollmentKey revokes one of an organization's enrollment keys. Agents
+// enrolled with it keep their device tokens.
+func (r *OrganizationRepository) RevokeEnrollmentKey(ctx context.Context, id, orgID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE enrollment_keys SET revoked_at = NOW() WHERE id = $1 AND organization_id = $2 AND revoked_at IS NULL",
+		id, orgID)
+	if err != nil {
+		return fmt.Errorf("revoke enrollment key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("enrollment key not found")
+	}
+	return nil
+}
+
+// UseEnrollmentKey returns the organization of an active enrollment key and records
+// its use.
+func (r *OrganizationRepository) UseEnrollmentKey(ctx context.Context, hash string) (uuid.UUID, error) {
+	var orgID uuid.UUID
+	err := r.db.GetContext(ctx, &orgID,
+		`UPDATE enrollment_keys SET last_used_at = NOW()
+		 WHERE key_hash = $1 AND revoked_at IS NULL
+		 RETURNING organization_id`, hash)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return orgID, nil
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// RetentionDatasets are the datasets retention policies can be set for: the tables the
+// cleanup purges by age, and snapshots, the JSON snapshots of hardware_history, which
+// the cleanup clears while keeping the change rows. Only device_activity_log policies
+// may name an activity type.
+var RetentionDatasets = []string{"audit_logs", "device_activity_log", "hardware_history", "device_metrics", "snapshots", "user_sessions", "agent_update_reports"}
+
+// RetentionRepository keeps the retention policies.
+type RetentionRepository struct {
+	db *sqlx.DB
+}
+
+// NewRetentionRepository creates a new RetentionRepository.
+func NewRetentionRepository(db *sqlx.DB) *RetentionRepository {
+	return &RetentionRepository{db: db}
+}
+
+// List returns all retention policies ordered by dataset and activity type.
+func (r *RetentionRepository) List(ctx context.Context) ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := r.db.SelectContext(ctx, &policies,
+		"SELECT * FROM retention_policies ORDER BY dataset, activity_type")
+	if err != nil {
+		return nil, fmt.Errorf("list retention policies: %w", err)
+	}
+	if policies == nil {
+		policies = []models.RetentionPolicy{}
+	}
+	return policies, nil
+}
+
+// Replace replaces all retention policies with policies, in one transaction, and
+// returns the stored ones.
+func (r *RetentionRepository) Replace(ctx context.Context, policies []models.RetentionPolicy) ([]models.RetentionPolicy, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM retention_policies"); err != nil {
+		return nil, fmt.Errorf("clear retention policies: %w", err)
+	}
+	for _, p := range policies {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO retention_policies (dataset, activity_type, retention_days, updated_at)
+			 VALUES ($1, $2, $3, NOW())`,
+			p.Dataset, p.ActivityType, p.RetentionDays); err != nil {
+			return nil, fmt.Errorf("insert retention policy: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return r.List(ctx)
+}
+
+// retention returns the SQL expression of the retention in days of a row of dataset:
+// the policy for its activity type (the column typeColumn, if not empty), the
+// organization's retention (the expression organization, if not empty), the policy
+// for the whole dataset, then fallback.
+func retention(dataset, typeColumn, organization, fallback string) string {
+	policy := "(SELECT p.retention_days FROM retention_policies p WHERE p.dataset = '" + dataset + "' AND p.activity_type = "
+	terms := []string{}
+	if typeColumn != "" {
+		terms = append(terms, policy+typeColumn+")")
+	}
+	if organization != "" {
+		terms = append(terms, organization)
+	}
+	terms = append(terms, policy+"'')", fallback)
+	return "COALESCE(" + strings.Join(terms, ", ") + ")"
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/authz"
+	"inventario/shared/models"
+)
+
+// RoleRepository handles roles and user role bindings.
+type RoleRepository struct {
+	db *sqlx.DB
+}
+
+// NewRoleRepository creates a new RoleRepository.
+func NewRoleRepository(db *sqlx.DB) *RoleRepository {
+	return &RoleRepository{db: db}
+}
+
+// List returns all roles ordered by name.
+func (r *RoleRepository) List(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	if err := r.db.SelectContext(ctx, &roles, "SELECT * FROM roles ORDER BY name"); err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+	if roles == nil {
+		roles = []models.Role{}
+	}
+	return roles, nil
+}
+
+// GetByID returns a single role.
+func (r *RoleRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.GetContext(ctx, &role, "SELECT * FROM roles WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// GetByName returns a single role by its unique name.
+func (r *RoleRepository) GetByName(ctx context.Context, name string) (*models.Role, error) {
+	var role models.Role
+	if err := r.db.GetContext(ctx, &role, "SELECT * FROM roles WHERE name = $1", name); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Create inserts a custom role and returns it.
+func (r *RoleRepository) Create(ctx context.Context, name, description, permissions string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.GetContext(ctx, &role,
+		"INSERT INTO roles (id, name, description, permissions) VALUES ($1, $2, $3, $4) RETURNING *",
+		uuid.New(), name, description, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("create role: %w", err)
+	}
+	return &role, nil
+}
+
+// Update changes a custom role. Built-in roles cannot be modified.
+func (r *RoleRepository) Update(ctx context.Context, id uuid.UUID, name, description, permissions string) (*models.Role, error) {
+	var role models.Role
+	err := r.db.GetContext(ctx, &role,
+		`UPDATE roles SET name = $1, description = $2, permissions = $3, updated_at = NOW()
+		 WHERE id = $4 AND NOT builtin RETURNING *`,
+		name, description, permissions, id)
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// Delete removes a custom role and its bindings. Built-in roles cannot be deleted,
+// and the users.role foreign key rejects roles still used as a base role.
+func (r *RoleRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM roles WHERE id = $1 AND NOT builtin", id)
+	if err != nil {
+		return fmt.Errorf("delete role: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("role not found")
+	}
+	return nil
+}
+
+// CountUsers returns how many users have the role as their base role.
+func (r *RoleRepository) CountUsers(ctx context.Context, name string) (int, error) {
+	var count int
+	if err := r.db.GetContext(ctx, &count, "SELECT COUNT(*) FROM users WHERE role = $1", name); err != nil {
+		return 0, fmt.Errorf("count role users: %w", err)
+	}
+	return count, nil
+}
+
+// ListBindings returns a user's role bindings with role and department names.
+func (r *RoleRepository) ListBindings(ctx context.Context, userID uuid.UUID) ([]models.RoleBinding, error) {
+	var bindings []models.RoleBinding
+	err := r.db.SelectContext(ctx, &bindings,
+		`SELECT b.*, r.name AS role_name, dep.name AS department_name
+		 FROM user_role_bindings b
+		 JOIN roles r ON r.id = b.role_id
+		 LEFT JOIN departments dep ON dep.id = b.department_id
+		 WHERE b.user_id = $1
+		 ORDER BY r.name, dep.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list role bindings: %w", err)
+	}
+	if bindings == nil {
+		bindings = []models.RoleBinding{}
+	}
+	return bindings, nil
+}
+
+// CreateBinding grants a role to a user, globally when departmentID is nil.
+func (r *RoleRepository) CreateBinding(ctx context.Context, userID, roleID uuid.UUID, departmentID *uuid.UUID) (uuid.UUID, error) {
+	id := uuid.New()
+	// The department must belong to the user's organization.
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_role_bindings (id, user_id, role_id, department_id)
+		 SELECT $1, $2, $3, `+cast(r.db, "$4", "uuid")+`
+		 WHERE `+cast(r.db, "$4", "uuid")+` IS NULL OR EXISTS (
+		     SELECT 1 FROM departments d JOIN users u ON u.organization_id = d.organization_id
+		     WHERE d.id = `+cast(r.db, "$4", "uuid")+` AND u.id = $2)`,
+		id, userID, roleID, departmentID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("create role binding: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return uuid.Nil, fmt.Errorf("create role binding: department not found")
+	}
+	return id, nil
+}
+
+// DeleteBinding removes one of a user's role bindings.
+func (r *RoleRepository) DeleteBinding(ctx context.Context, userID, bindingID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"DELETE FROM user_role_bindings WHERE id = $1 AND user_id = $2", bindingID, userID)
+	if err != nil {
+		return fmt.Errorf("delete role binding: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("role binding not found")
+	}
+	return nil
+}
+
+// BindingsForUser returns the user's base role (as a global binding) plus all role bindings.
+func (r *RoleRepository) BindingsForUser(ctx context.Context, userID uuid.UUID) ([]authz.Binding, error) {
+	var rows []struct {
+		Permissions  string     `db:"permissions"`
+		DepartmentID *uuid.UUID `db:"department_id"`
+	}
+	err := r.db.SelectContext(ctx, &rows,
+		`SELECT r.permissions, `+cast(r.db, "NULL", "uuid")+` AS department_id
+		 FROM users u JOIN roles r ON r.name = u.role
+		 WHERE u.id = $1
+		 UNION ALL
+		 SELECT r.permissions, b.department_id
+		 FROM user_role_bindings b JOIN roles r ON r.id = b.role_id
+		 WHERE b.user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("load role bindings: %w", err)
+	}
+
+	bindings := make([]authz.Binding, len(rows))
+	for i, row := range rows {
+		bindings[i] = authz.Binding{Permissions: row.Permissions, DepartmentID: row.DepartmentID}
+	}
+	return bindings, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+)
+
+// scopeColumn qualifies a devices column with the table alias ("" for none).
+func scopeColumn(alias, column string) string {
+	if alias == "" {
+		return column
+	}
+	return alias + "." + column
+}
+
+// scopeCondition returns a SQL condition restricting the devices rows (table alias,
+// "" for none) to the scope's organization and departments, using $n placeholders
+// starting at argIdx. An empty condition means no restriction. It also returns the
+// condition's args and the next free placeholder index.
+func scopeCondition(scope authz.Scope, alias string, argIdx int) (string, []interface{}, int) {
+	var conds []string
+	var args []interface{}
+	if scope.OrganizationID != uuid.Nil {
+		conds = append(conds, fmt.Sprintf("%s = $%d", scopeColumn(alias, "organization_id"), argIdx))
+		args = append(args, scope.OrganizationID)
+		argIdx++
+	}
+
+	switch {
+	case scope.All:
+	case len(scope.DepartmentIDs) == 0:
+		conds = append(conds, "FALSE")
+	default:
+		placeholders := make([]string, len(scope.DepartmentIDs))
+		for i, id := range scope.DepartmentIDs {
+			placeholders[i] = fmt.Sprintf("$%d", argIdx)
+			args = append(args, id)
+			argIdx++
+		}
+		conds = append(conds, fmt.Sprintf("%s IN (%s)", scopeColumn(alias, "department_id"), strings.Join(placeholders, ", ")))
+	}
+	return strings.Join(conds, " AND "), args, argIdx
+}
+
+// scopeConditionIn is scopeCondition for queries built with sqlx.In (? placeholders).
+// The returned condition starts with " AND " or is empty.
+func scopeConditionIn(scope authz.Scope, alias string) (string, []interface{}) {
+	var cond string
+	var args []interface{}
+	if scope.OrganizationID != uuid.Nil {
+		cond += fmt.Sprintf(" AND %s = ?", scopeColumn(alias, "organization_id"))
+		args = append(args, scope.OrganizationID)
+	}
+
+	switch {
+	case scope.All:
+	case len(scope.DepartmentIDs) == 0:
+		cond += " AND FALSE"
+	default:
+		cond += fmt.Sprintf(" AND %s IN (?)", scopeColumn(alias, "department_id"))
+		args = append(args, scope.DepartmentIDs)
+	}
+	return cond, args
+}
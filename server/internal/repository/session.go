@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// SessionRepository handles server-side dashboard sessions.
+type SessionRepository struct {
+	db *sqlx.DB
+}
+
+// NewSessionRepository creates a new SessionRepository.
+func NewSessionRepository(db *sqlx.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+// Create inserts a new session.
+func (r *SessionRepository) Create(ctx context.Context, s *models.UserSession) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO user_sessions (id, user_id, organization_id, ip, user_agent, expires_at, absolute_expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		s.ID, s.UserID, s.OrganizationID, s.IP, s.UserAgent, s.ExpiresAt, s.AbsoluteExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	return nil
+}
+
+// SetOrganization moves an active session to another organization.
+func (r *SessionRepository) SetOrganization(ctx context.Context, id, orgID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE user_sessions SET organization_id = $1 WHERE id = $2 AND revoked_at IS NULL",
+		orgID, id)
+	if err != nil {
+		return fmt.Errorf("set session organization: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// GetActive returns a session that is neither revoked nor expired.
+func (r *SessionRepository) GetActive(ctx context.Context, id uuid.UUID) (*models.UserSession, error) {
+	var s models.UserSession
+	err := r.db.GetContext(ctx, &s,
+		"SELECT * FROM user_sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()", id)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Touch records activity on a session and slides its expiry to now + idle, capped at the
+// absolute expiry. Writes are throttled to one per minute; it returns true when the row was updated.
+func (r *SessionRepository) Touch(ctx context.Context, id uuid.UUID, ip string, idle time.Duration) (bool, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE user_sessions
+		 SET last_activity_at = NOW(), ip = $1,
+		     expires_at = LEAST(NOW() + `+seconds(r.db, "$2")+`, absolute_expires_at)
+		 WHERE id = $3 AND revoked_at IS NULL AND last_activity_at < NOW() - `+seconds(r.db, "60"),
+		ip, idle.Seconds(), id)
+	if err != nil {
+		return false, fmt.Errorf("touch session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+// Extend is Touch without throttling; it returns the updated session.
+func (r *SessionRepository) Extend(ctx context.Context, id uuid.UUID, ip string, idle time.Duration) (*models.UserSession, error) {
+	var s models.UserSession
+	err := r.db.GetContext(ctx, &s,
+		`UPDATE user_sessions
+		 SET last_activity_at = NOW(), ip = $1,
+		     expires_at = LEAST(NOW() + `+seconds(r.db, "$2")+`, absolute_expires_at)
+		 WHERE id = $3 AND revoked_at IS NULL AND expires_at > NOW()
+		 RETURNING *`,
+		ip, idle.Seconds(), id)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListActiveByUser returns a user's active sessions, most recently used first.
+func (r *SessionRepository) ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error) {
+	var sessions []models.UserSession
+	err := r.db.SelectContext(ctx, &sessions,
+		`SELECT * FROM user_sessions
+		 WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		 ORDER BY last_activity_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	if sessions == nil {
+		sessions = []models.UserSession{}
+	}
+	return sessions, nil
+}
+
+// Revoke ends one of a user's sessions.
+func (r *SessionRepository) Revoke(ctx context.Context, userID, id uuid.UUID, reason string) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		 WHERE id = $2 AND user_id = $3 AND revoked_at IS NULL`,
+		reason, id, userID)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("session not found")
+	}
+	return nil
+}
+
+// RevokeAllForUser ends every active session of a user except keep (uuid.Nil keeps none)
+// and returns how many were revoked.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID, keep uuid.UUID, reason string) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE user_sessions SET revoked_at = NOW(), revoked_reason = $1
+		 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL AND expires_at > NOW()`,
+		reason, userID, keep)
+	if err != nil {
+		return 0, fmt.Errorf("revoke sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
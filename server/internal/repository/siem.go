@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"inventario/shared/models"
+)
+
+// SIEM forwarding streams and the table each one reads.
+const (
+	SIEMStreamAudit    = "audit"
+	SIEMStreamActivity = "activity"
+)
+
+var siemStreamTables = map[string]string{
+	SIEMStreamAudit:    "audit_logs",
+	SIEMStreamActivity: "device_activity_log",
+}
+
+// SIEMRepository reads events for SIEM forwarding and keeps a cursor per stream.
+type SIEMRepository struct {
+	db *sqlx.DB
+}
+
+// NewSIEMRepository creates a new SIEMRepository.
+func NewSIEMRepository(db *sqlx.DB) *SIEMRepository {
+	return &SIEMRepository{db: db}
+}
+
+// ActivityEvent is a device activity entry as forwarded to the SIEM.
+type ActivityEvent struct {
+	models.DeviceActivityLog
+	Seq      int64  `db:"seq"`
+	Hostname string `db:"hostname"`
+}
+
+// InitCursor creates the stream's cursor if it does not exist yet: at the newest event,
+// or before the oldest one when backfill is set. An existing cursor is left alone.
+func (r *SIEMRepository) InitCursor(ctx context.Context, stream string, backfill bool) error {
+	table, ok := siemStreamTables[stream]
+	if !ok {
+		return fmt.Errorf("unknown siem stream %q", stream)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO siem_cursors (stream, last_seq)
+		 VALUES ($1, CASE WHEN $2 THEN 0 ELSE (SELECT COALESCE(MAX(seq), 0) FROM `+table+`) END)
+		 ON CONFLICT (stream) DO NOTHING`,
+		stream, backfill)
+	if err != nil {
+		return fmt.Errorf("init siem cursor: %w", err)
+	}
+	return nil
+}
+
+// Advance locks the stream's cursor and calls fn with it; fn forwards what it can and
+// returns the seq of the last event delivered, which is stored even when fn also
+// returns an error. Advance reports false without calling fn when another API replica
+// holds the cursor.
+func (r *SIEMRepository) Advance(ctx context.Context, stream string, fn func(cursor int64) (int64, error)) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var cursor int64
+	err = tx.GetContext(ctx, &cursor,
+		"SELECT last_seq FROM siem_cursors WHERE stream = $1 FOR UPDATE SKIP LOCKED", stream)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("lock siem cursor: %w", err)
+	}
+
+	next, fnErr := fn(cursor)
+	if next > cursor {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE siem_cursors SET last_seq = $1, updated_at = NOW() WHERE stream = $2", next, stream); err != nil {
+			return true, fmt.Errorf("save siem cursor: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return true, fmt.Errorf("commit: %w", err)
+		}
+	}
+	return true, fnErr
+}
+
+// AuditAfter returns up to limit audit entries after seq, in chain order. Entries get
+// their seq under the audit chain lock, so they become visible in seq order.
+func (r *SIEMRepository) AuditAfter(ctx context.Context, seq int64, limit int) ([]models.AuditLog, error) {
+	var logs []models.AuditLog
+	if err := r.db.SelectContext(ctx, &logs,
+		"SELECT * FROM audit_logs WHERE seq > $1 ORDER BY seq LIMIT $2", seq, limit); err != nil {
+		return nil, fmt.Errorf("read audit logs: %w", err)
+	}
+	return logs, nil
+}
+
+// ActivityAfter returns up to limit device activity entries after seq, in seq order.
+// Activity is written inside inventory transactions, so a lower seq may commit after a
+// higher one; the result stops before the first entry whose transaction started less
+// than settle ago, leaving it for a later call instead of skipping past it.
+func (r *SIEMRepository) ActivityAfter(ctx context.Context, seq int64, settle time.Duration, limit int) ([]ActivityEvent, error) {
+	var rows []struct {
+		ActivityEvent
+		Settled bool `db:"settled"`
+	}
+	if err := r.db.SelectContext(ctx, &rows,
+		`SELECT a.id, a.device_id, a.activity_type, a.description, a.old_value, a.new_value, a.metadata,
+		        a.detected_at, a.seq, COALESCE(d.hostname, '') AS hostname,
+		        a.detected_at < NOW() - $2 * INTERVAL '1 microsecond' AS settled
+		 FROM device_activity_log a
+		 LEFT JOIN devices d ON d.id = a.device_id
+		 WHERE a.seq > $1
+		 ORDER BY a.seq
+		 LIMIT $3`,
+		seq, settle.Microseconds(), limit); err != nil {
+		return nil, fmt.Errorf("read device activity: %w", err)
+	}
+
+	events := make([]ActivityEvent, 0, len(rows))
+	for _, row := range rows {
+		if !row.Settled {
+			break
+		}
+		events = append(events, row.ActivityEvent)
+	}
+	return events, nil
+}
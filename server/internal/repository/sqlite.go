@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/events"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// newSQLiteStores creates the stores of the SQLite backend: the PostgreSQL
+// repositories, with the methods whose statements SQLite cannot run overridden by the
+// sqlite* types below. A SQLite database serves a single API process and its writers
+// are serialized, which the overrides rely on instead of row locks.
+func newSQLiteStores(db *sqlx.DB, chainKey string) *Stores {
+	activity := NewDeviceActivityRepository(db)
+	return &Stores{
+		Tokens:        NewTokenRepository(db),
+		Users:         NewUserRepository(db),
+		MFA:           NewMFARepository(db),
+		APITokens:     NewAPITokenRepository(db),
+		Roles:         NewRoleRepository(db),
+		Sessions:      NewSessionRepository(db),
+		Devices:       &sqliteDeviceStore{NewDeviceRepository(db, chainKey)},
+		Activity:      activity,
+		Inventory:     &sqliteInventoryStore{NewInventoryRepository(db, activity)},
+		Dashboard:     NewDashboardRepository(db),
+		Departments:   NewDepartmentRepository(db),
+		AuditLogs:     NewAuditLogRepository(db, chainKey),
+		Cleanup:       &sqliteCleanupStore{NewCleanupRepository(db)},
+		Retention:     NewRetentionRepository(db),
+		SIEM:          &sqliteSIEMStore{NewSIEMRepository(db)},
+		AgentUpdates:  NewAgentUpdateRepository(db, activity),
+		Organizations: NewOrganizationRepository(db),
+		Archives:      NewArchiveRepository(db),
+		Jobs:          &sqliteJobStore{NewJobRepository(db)},
+	}
+}
+
+// sqliteDeviceStore is the DeviceStore of the SQLite backend.
+type sqliteDeviceStore struct {
+	*DeviceRepository
+}
+
+// UpdateDepartment assigns a department (or NULL) to a device.
+// The scope applies to the device's current department; callers check the target.
+func (r *sqliteDeviceStore) UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID, scope authz.Scope) error {
+	n, err := r.updateDepartment(ctx, []uuid.UUID{id}, deptID, scope)
+	if err != nil {
+		return fmt.Errorf("update device department: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("device not found")
+	}
+	return nil
+}
+
+// BulkUpdateDepartment sets the department for multiple devices at once.
+// The scope applies to the devices' current department; callers check the target.
+func (r *sqliteDeviceStore) BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID, scope authz.Scope) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	n, err := r.updateDepartment(ctx, ids, deptID, scope)
+	if err != nil {
+		return 0, fmt.Errorf("bulk update department: %w", err)
+	}
+	return int64(n), nil
+}
+
+// updateDepartment moves the devices within scope to deptID and publishes
+// device.department_changed for each. SQLite's RETURNING cannot read the row as it
+// was, so the previous departments are read first, in the same transaction.
+func (r *sqliteDeviceStore) updateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID, scope authz.Scope) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	cond, scopeArgs := scopeConditionIn(scope, "")
+	query, args, err := sqlx.In("SELECT id, department_id FROM devices WHERE id IN (?)"+cond, append([]interface{}{ids}, scopeArgs...)...)
+	if err != nil {
+		return 0, err
+	}
+	var prev []struct {
+		ID           uuid.UUID  `db:"id"`
+		DepartmentID *uuid.UUID `db:"department_id"`
+	}
+	if err := tx.SelectContext(ctx, &prev, tx.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+	if len(prev) == 0 {
+		return 0, nil
+	}
+
+	moved := make([]uuid.UUID, len(prev))
+	old := make(map[uuid.UUID]*uuid.UUID, len(prev))
+	for i, p := range prev {
+		moved[i] = p.ID
+		old[p.ID] = p.DepartmentID
+	}
+	query, args, err = sqlx.In("UPDATE devices SET department_id = ? WHERE id IN (?)"+
+		" RETURNING id AS device_id, hostname, department_id, organization_id", nullUUID(deptID), moved)
+	if err != nil {
+		return 0, err
+	}
+	var changed []events.Device
+	if err := tx.SelectContext(ctx, &changed, tx.Rebind(query), args...); err != nil {
+		return 0, err
+	}
+	for _, d := range changed {
+		d.OldDepartmentID = old[d.DeviceID]
+		if err := events.PublishDevice(ctx, tx, events.TypeDepartmentChanged, d); err != nil {
+			return 0, err
+		}
+	}
+	return len(changed), tx.Commit()
+}
+
+// sqliteInventoryStore is the InventoryStore of the SQLite backend.
+type sqliteInventoryStore struct {
+	*InventoryRepository
+}
+
+// Heartbeat records an agent heartbeat: it bumps last_seen and stores what the agent
+// reported, publishing device.online if the device was offline. It returns
+// sql.ErrNoRows if the device does not exist.
+func (r *sqliteInventoryStore) Heartbeat(ctx context.Context, deviceID uuid.UUID, req *dto.HeartbeatRequest) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var wasOffline bool
+	err = tx.GetContext(ctx, &wasOffline, "SELECT offline_since IS NOT NULL FROM devices WHERE id = $1", deviceID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("record heartbeat: %w", err)
+	}
+
+	var d events.Device
+	if err := tx.GetContext(ctx, &d, `
+		UPDATE devices SET
+			checkin_interval_seconds = $2,
+			uptime_seconds           = $3,
+			logged_in_user           = COALESCE($4, logged_in_user),
+			agent_version            = COALESCE(NULLIF($5, ''), agent_version),
+			agent_state              = $6,
+			agent_error              = $7,
+			offline_since            = NULL,
+			last_heartbeat           = NOW(),
+			last_seen                = NOW()
+		WHERE id = $1
+		RETURNING id AS device_id, hostname, department_id, organization_id`,
+		deviceID, req.IntervalSeconds, req.UptimeSeconds, req.LoggedInUser, req.AgentVersion, req.State, req.Error); err != nil {
+		return fmt.Errorf("record heartbeat: %w", err)
+	}
+	if err := insertMetric(ctx, tx, deviceID, &req.UptimeSeconds, nil, nil); err != nil {
+		return err
+	}
+	if wasOffline {
+		if err := events.PublishDevice(ctx, tx, events.TypeDeviceOnline, d); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqliteCleanupStore is the CleanupStore of the SQLite backend.
+type sqliteCleanupStore struct {
+	*CleanupRepository
+}
+
+// PurgeOldData removes records older than their retention from log/history tables other
+// than audit_logs, like CleanupRepository.PurgeOldData. With an Archiver, purged device
+// history is archived first. SQLite has no rate_limits table: the rate limiter keeps its
+// state in memory.
+func (r *sqliteCleanupStore) PurgeOldData(ctx context.Context, retentionDays int, ar Archiver) (*CleanupResult, error) {
+	result := &CleanupResult{}
+	organizationRetention := func(table string) string {
+		return `(SELECT o.retention_days FROM devices d JOIN organizations o ON o.id = d.organization_id
+			WHERE d.id = ` + table + `.device_id)`
+	}
+
+	var err error
+	result.ActivityLogs, err = purgeTable(ctx, r.db, ar, "device_activity_log",
+		"DELETE FROM device_activity_log WHERE detected_at < NOW() - "+days(r.db, retention("device_activity_log",
+			"device_activity_log.activity_type", organizationRetention("device_activity_log"), "$1")),
+		returning("", activityArchiveColumns), func() any { return &ArchivedActivity{} }, retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge device_activity_log: %w", err)
+	}
+
+	result.HardwareHistory, err = purgeTable(ctx, r.db, ar, "hardware_history",
+		"DELETE FROM hardware_history WHERE changed_at < NOW() - "+days(r.db, retention("hardware_history",
+			"", organizationRetention("hardware_history"), "$1")),
+		returning("", hardwareArchiveColumns), func() any { return &models.HardwareHistory{} }, retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge hardware_history: %w", err)
+	}
+
+	res, err := r.db.ExecContext(ctx,
+		"DELETE FROM device_metrics WHERE recorded_at < NOW() - "+days(r.db, retention("device_metrics",
+			"", organizationRetention("device_metrics"), "$1")), retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge device_metrics: %w", err)
+	}
+	result.Metrics, _ = res.RowsAffected()
+
+	if result.Snapshots, err = clearSnapshots(ctx, r.db); err != nil {
+		return nil, err
+	}
+
+	res, err = r.db.ExecContext(ctx,
+		"DELETE FROM user_sessions WHERE LEAST(expires_at, COALESCE(revoked_at, expires_at)) < NOW() - "+
+			days(r.db, sessionRetention), retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge user_sessions: %w", err)
+	}
+	result.Sessions, _ = res.RowsAffected()
+
+	res, err = r.db.ExecContext(ctx,
+		"DELETE FROM agent_update_reports WHERE reported_at < NOW() - "+days(r.db, updateReportRetention), retentionDays)
+	if err != nil {
+		return nil, fmt.Errorf("purge agent_update_reports: %w", err)
+	}
+	result.UpdateReports, _ = res.RowsAffected()
+
+	return result, nil
+}
+
+// VacuumAnalyze rebuilds the database file to reclaim the space of deleted rows and
+// refreshes the query planner statistics.
+func (r *sqliteCleanupStore) VacuumAnalyze(ctx context.Context) error {
+	for _, stmt := range []string{"VACUUM", "ANALYZE"} {
+		if _, err := r.db.ExecContext(ctx, stmt); err != nil {
+			slog.Warn("vacuum analyze failed", "statement", stmt, "error", err)
+			// Don't return error — VACUUM failures are non-critical
+		}
+	}
+	return nil
+}
+
+// sqliteSIEMStore is the SIEMStore of the SQLite backend.
+type sqliteSIEMStore struct {
+	*SIEMRepository
+}
+
+// Advance calls fn with the stream's cursor; fn forwards what it can and returns the
+// seq of the last event delivered, which is stored even when fn also returns an error.
+// Only one process uses a SQLite database, so the cursor is not locked.
+func (r *sqliteSIEMStore) Advance(ctx context.Context, stream string, fn func(cursor int64) (int64, error)) (bool, error) {
+	var cursor int64
+	err := r.db.GetContext(ctx, &cursor, "SELECT last_seq FROM siem_cursors WHERE stream = $1", stream)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read siem cursor: %w", err)
+	}
+
+	next, fnErr := fn(cursor)
+	if next > cursor {
+		if _, err := r.db.ExecContext(ctx,
+			"UPDATE siem_cursors SET last_seq = $1, updated_at = NOW() WHERE stream = $2", next, stream); err != nil {
+			return true, fmt.Errorf("save siem cursor: %w", err)
+		}
+	}
+	return true, fnErr
+}
+
+// ActivityAfter returns up to limit device activity entries after seq, in seq order.
+// SQLite serializes writers, so entries commit in seq order and settle is not needed.
+func (r *sqliteSIEMStore) ActivityAfter(ctx context.Context, seq int64, _ time.Duration, limit int) ([]ActivityEvent, error) {
+	events := []ActivityEvent{}
+	if err := r.db.SelectContext(ctx, &events,
+		`SELECT a.id, a.device_id, a.activity_type, a.description, a.old_value, a.new_value, a.metadata,
+		        a.detected_at, a.seq, COALESCE(d.hostname, '') AS hostname
+		 FROM device_activity_log a
+		 LEFT JOIN devices d ON d.id = a.device_id
+		 WHERE a.seq > $1
+		 ORDER BY a.seq
+		 LIMIT $2`,
+		seq, limit); err != nil {
+		return nil, fmt.Errorf("read device activity: %w", err)
+	}
+	return events, nil
+}
+
+// sqliteJobStore is the JobStore of the SQLite backend.
+type sqliteJobStore struct {
+	*JobRepository
+}
+
+// Lock always succeeds: only one process uses a SQLite database, and its scheduler
+// does not start a job that is still running.
+func (r *sqliteJobStore) Lock(context.Context, string) (func(), bool, error) {
+	return func() {}, true, nil
+}
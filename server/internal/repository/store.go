@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/database"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// The interfaces below are what services, handlers and middleware depend on. The
+// *Repository types implement them on PostgreSQL; on SQLite they are reused with the
+// sqlite* types in sqlite.go overriding the methods whose statements differ. Fragments
+// that differ inside otherwise shared statements come from dialect.go.
+
+// TokenStore keeps device (agent) tokens.
+type TokenStore interface {
+	GetByHash(ctx context.Context, hash string) (*models.DeviceToken, error)
+	Create(ctx context.Context, token *models.DeviceToken) error
+	DeleteByDeviceID(ctx context.Context, deviceID uuid.UUID) error
+}
+
+// UserStore keeps dashboard users, their lockout state and password history.
+type UserStore interface {
+	GetByUsername(ctx context.Context, username string) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	List(ctx context.Context, orgID uuid.UUID) ([]models.User, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetInOrganization(ctx context.Context, id, orgID uuid.UUID) (*models.User, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*models.User, error)
+	SetSuperAdmin(ctx context.Context, id uuid.UUID, superAdmin bool) error
+	Update(ctx context.Context, id uuid.UUID, username, name, passwordHash, role string) error
+	Delete(ctx context.Context, id, orgID uuid.UUID) error
+	RecordLoginFailure(ctx context.Context, id uuid.UUID, threshold int, base, maxDuration time.Duration) (*time.Time, error)
+	ResetLoginFailures(ctx context.Context, id uuid.UUID) error
+	Unlock(ctx context.Context, id, orgID uuid.UUID) error
+	RecentPasswordHashes(ctx context.Context, id uuid.UUID, n int) ([]string, error)
+	SetPassword(ctx context.Context, id uuid.UUID, passwordHash string, mustChange bool, keep int) error
+	AddPasswordHistory(ctx context.Context, id uuid.UUID, passwordHash string, keep int) error
+}
+
+// MFAStore keeps TOTP secrets and recovery codes.
+type MFAStore interface {
+	SetPendingSecret(ctx context.Context, userID uuid.UUID, secret string) error
+	Enable(ctx context.Context, userID uuid.UUID, step int64, codeHashes []string) error
+	Disable(ctx context.Context, userID uuid.UUID) error
+	ConsumeStep(ctx context.Context, userID uuid.UUID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID uuid.UUID, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// APITokenStore keeps personal API tokens.
+type APITokenStore interface {
+	Create(ctx context.Context, token *models.APIToken) error
+	GetActiveByHash(ctx context.Context, hash string) (*APITokenWithOwner, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error)
+	ListAll(ctx context.Context, orgID uuid.UUID) ([]APITokenWithOwner, error)
+	Revoke(ctx context.Context, id uuid.UUID, ownerID *uuid.UUID, orgID uuid.UUID) error
+	TouchLastUsed(ctx context.Context, id uuid.UUID, ip string) (bool, error)
+}
+
+// RoleStore keeps roles and user role bindings.
+type RoleStore interface {
+	List(ctx context.Context) ([]models.Role, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Role, error)
+	GetByName(ctx context.Context, name string) (*models.Role, error)
+	Create(ctx context.Context, name, description, permissions string) (*models.Role, error)
+	Update(ctx context.Context, id uuid.UUID, name, description, permissions string) (*models.Role, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	CountUsers(ctx context.Context, name string) (int, error)
+	ListBindings(ctx context.Context, userID uuid.UUID) ([]models.RoleBinding, error)
+	CreateBinding(ctx context.Context, userID, roleID uuid.UUID, departmentID *uuid.UUID) (uuid.UUID, error)
+	DeleteBinding(ctx context.Context, userID, bindingID uuid.UUID) error
+	BindingsForUser(ctx context.Context, userID uuid.UUID) ([]authz.Binding, error)
+}
+
+// SessionStore keeps server-side dashboard sessions.
+type SessionStore interface {
+	Create(ctx context.Context, s *models.UserSession) error
+	SetOrganization(ctx context.Context, id, orgID uuid.UUID) error
+	GetActive(ctx context.Context, id uuid.UUID) (*models.UserSession, error)
+	Touch(ctx context.Context, id uuid.UUID, ip string, idle time.Duration) (bool, error)
+	Extend(ctx context.Context, id uuid.UUID, ip string, idle time.Duration) (*models.UserSession, error)
+	ListActiveByUser(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID, reason string) error
+	RevokeAllForUser(ctx context.Context, userID, keep uuid.UUID, reason string) (int64, error)
+}
+
+// DeviceStore reads and changes devices within an authz.Scope, and reads their
+// inventory data.
+type DeviceStore interface {
+	Delete(ctx context.Context, id uuid.UUID, scope authz.Scope) error
+	List(ctx context.Context, p ListParams, scope authz.Scope) (*ListResult, error)
+	GetByID(ctx context.Context, id uuid.UUID, scope authz.Scope) (*models.Device, error)
+	GetByHostname(ctx context.Context, hostname string, scope authz.Scope) (*models.Device, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, status string, scope authz.Scope) error
+	UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID, scope authz.Scope) error
+	MarkOffline(ctx context.Context) (int, error)
+	GetHardwareHistory(ctx context.Context, deviceID uuid.UUID, component string, limit, offset int) ([]models.HardwareHistory, int, error)
+	GetMetrics(ctx context.Context, deviceID uuid.UUID, since time.Time) ([]models.DeviceMetric, error)
+	BulkUpdateStatus(ctx context.Context, ids []uuid.UUID, status string, scope authz.Scope) (int64, error)
+	BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID, scope authz.Scope) (int64, error)
+	BulkDelete(ctx context.Context, ids []uuid.UUID, scope authz.Scope) (int64, error)
+	GetBySerialNumber(ctx context.Context, sn string, scope authz.Scope) (*models.Device, error)
+	GetHardware(ctx context.Context, deviceID uuid.UUID) (*models.Hardware, error)
+	GetDisks(ctx context.Context, deviceID uuid.UUID) ([]models.Disk, error)
+	GetNetworkInterfaces(ctx context.Context, deviceID uuid.UUID) ([]models.NetworkInterface, error)
+	GetInstalledSoftware(ctx context.Context, deviceID uuid.UUID) ([]models.InstalledSoftware, error)
+	GetRemoteTools(ctx context.Context, deviceID uuid.UUID) ([]models.RemoteTool, error)
+	ImportCandidates(ctx context.Context, serials, hostnames []string, orgID uuid.UUID) ([]models.Device, error)
+	ApplyImport(ctx context.Context, changes []ImportChange, scope authz.Scope, audit *models.AuditLog) error
+	SaveManual(ctx context.Context, id uuid.UUID, create bool, req *dto.ManualAssetRequest, scope authz.Scope) error
+	Export(ctx context.Context, dataset string, p ListParams, scope authz.Scope, row func([]any) error) error
+	ExportCount(ctx context.Context, dataset string, p ListParams, scope authz.Scope) (int, error)
+}
+
+// DeviceActivityStore keeps the device activity log.
+type DeviceActivityStore interface {
+	InsertBatch(ctx context.Context, tx *sqlx.Tx, entries []ActivityEntry) error
+	Insert(ctx context.Context, entry ActivityEntry) error
+	ListByDevice(ctx context.Context, deviceID uuid.UUID, limit, offset int) ([]models.DeviceActivityLog, int, error)
+}
+
+// InventoryStore saves agent inventories and heartbeats.
+type InventoryStore interface {
+	Save(ctx context.Context, deviceID uuid.UUID, req *dto.InventoryRequest) error
+	Heartbeat(ctx context.Context, deviceID uuid.UUID, req *dto.HeartbeatRequest) error
+}
+
+// DashboardStore computes the dashboard aggregates.
+type DashboardStore interface {
+	GetStats(ctx context.Context, scope authz.Scope) (total, online, agentless, inactive int, err error)
+	GetOSDistribution(ctx context.Context, scope authz.Scope) ([]OSCount, error)
+	GetRecentDevices(ctx context.Context, limit int, scope authz.Scope) ([]RecentDeviceRow, error)
+	GetTopSoftware(ctx context.Context, limit int, scope authz.Scope) ([]SoftwareCount, error)
+}
+
+// DepartmentStore keeps the departments of each organization.
+type DepartmentStore interface {
+	List(ctx context.Context, orgID uuid.UUID) ([]models.Department, error)
+	GetByID(ctx context.Context, id, orgID uuid.UUID) (*models.Department, error)
+	Create(ctx context.Context, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error)
+	Update(ctx context.Context, id, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error)
+	Delete(ctx context.Context, id, orgID uuid.UUID) error
+}
+
+// AuditLogStore keeps the audit log hash chain.
+type AuditLogStore interface {
+	Create(ctx context.Context, log *models.AuditLog) error
+	CreateBatch(ctx context.Context, logs []*models.AuditLog) (int, error)
+	List(ctx context.Context, filters map[string]interface{}, limit, offset int) ([]models.AuditLog, int, error)
+	GetByResourceID(ctx context.Context, orgID uuid.UUID, resourceType string, resourceID uuid.UUID, limit int) ([]models.AuditLog, error)
+	Verify(ctx context.Context) (*AuditChainReport, error)
+	SealMarkers(ctx context.Context) error
+	PurgeBefore(ctx context.Context, cutoff time.Time, reason string, ar Archiver) (int64, error)
+}
+
+// CleanupStore runs the data retention cleanup.
+type CleanupStore interface {
+	PurgeOldData(ctx context.Context, retentionDays int, ar Archiver) (*CleanupResult, error)
+	CountRecords(ctx context.Context) (audit, activity, hardware int, err error)
+	MarkInactiveDevices(ctx context.Context, inactiveDays int) (int64, error)
+	PreviewPurge(ctx context.Context, retentionDays, inactiveDays int, auditCutoff time.Time) (*PurgePreview, error)
+	VacuumAnalyze(ctx context.Context) error
+}
+
+// RetentionStore keeps the retention policies.
+type RetentionStore interface {
+	List(ctx context.Context) ([]models.RetentionPolicy, error)
+	Replace(ctx context.Context, policies []models.RetentionPolicy) ([]models.RetentionPolicy, error)
+}
+
+// SIEMStore reads events for SIEM forwarding and keeps the stream cursors.
+type SIEMStore interface {
+	InitCursor(ctx context.Context, stream string, backfill bool) error
+	Advance(ctx context.Context, stream string, fn func(cursor int64) (int64, error)) (bool, error)
+	AuditAfter(ctx context.Context, seq int64, limit int) ([]models.AuditLog, error)
+	ActivityAfter(ctx context.Context, seq int64, settle time.Duration, limit int) ([]ActivityEvent, error)
+}
+
+// AgentUpdateStore keeps agent releases, rollouts and update reports.
+type AgentUpdateStore interface {
+	CreateRelease(ctx context.Context, rel *models.AgentRelease, artifact io.Reader) error
+	ListReleases(ctx context.Context) ([]models.AgentRelease, error)
+	GetRelease(ctx context.Context, id uuid.UUID) (*models.AgentRelease, error)
+	DeleteRelease(ctx context.Context, id uuid.UUID) error
+	WriteArtifact(ctx context.Context, id uuid.UUID, w io.Writer) error
+	ListRollouts(ctx context.Context) ([]models.AgentRollout, error)
+	GetRollout(ctx context.Context, id uuid.UUID) (*models.AgentRollout, error)
+	CreateRollout(ctx context.Context, ro *models.AgentRollout) error
+	UpdateRollout(ctx context.Context, ro *models.AgentRollout) error
+	DeleteRollout(ctx context.Context, id uuid.UUID) error
+	RolloutsFor(ctx context.Context, deviceID uuid.UUID, departmentID *uuid.UUID, os, arch, channel string) ([]models.AgentRollout, error)
+	InsertReport(ctx context.Context, deviceID uuid.UUID, req *dto.AgentUpdateReportRequest) error
+	ListReports(ctx context.Context, status string, deviceID *uuid.UUID, limit, offset int) ([]models.AgentUpdateReport, int, error)
+}
+
+// OrganizationStore keeps organizations and their enrollment keys.
+type OrganizationStore interface {
+	List(ctx context.Context) ([]models.Organization, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Organization, error)
+	Create(ctx context.Context, name string, retentionDays, inactiveDays *int) (*models.Organization, error)
+	Update(ctx context.Context, id uuid.UUID, name string, retentionDays, inactiveDays *int) (*models.Organization, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	CreateEnrollmentKey(ctx context.Context, key *models.EnrollmentKey) error
+	ListEnrollmentKeys(ctx context.Context, orgID uuid.UUID) ([]models.EnrollmentKey, error)
+	RevokeEnrollmentKey(ctx context.Context, id, orgID uuid.UUID) error
+	UseEnrollmentKey(ctx context.Context, hash string) (uuid.UUID, error)
+}
+
+// ArchiveStore loads archived rows back.
+type ArchiveStore interface {
+	Restore(ctx context.Context, table string, decode func(dest any) error) (*RestoreResult, error)
+}
+
+// JobStore keeps the run history of the job scheduler and elects the replica that
+// runs each job.
+type JobStore interface {
+	Lock(ctx context.Context, job string) (unlock func(), ok bool, err error)
+	LastScheduled(ctx context.Context, job string) (*time.Time, error)
+	StartRun(ctx context.Context, run *models.JobRun) error
+	FinishRun(ctx context.Context, run *models.JobRun, keep int) error
+	ListRuns(ctx context.Context, job string, limit, offset int) ([]models.JobRun, int, error)
+}
+
+// Stores holds one store of each kind, all on the same database.
+type Stores struct {
+	Tokens        TokenStore
+	Users         UserStore
+	MFA           MFAStore
+	APITokens     APITokenStore
+	Roles         RoleStore
+	Sessions      SessionStore
+	Devices       DeviceStore
+	Activity      DeviceActivityStore
+	Inventory     InventoryStore
+	Dashboard     DashboardStore
+	Departments   DepartmentStore
+	AuditLogs     AuditLogStore
+	Cleanup       CleanupStore
+	Retention     RetentionStore
+	SIEM          SIEMStore
+	AgentUpdates  AgentUpdateStore
+	Organizations OrganizationStore
+	Archives      ArchiveStore
+	Jobs          JobStore
+}
+
+// NewStores creates the stores for db, on the backend its driver belongs to.
+// chainKey keys the audit log hash chain.
+func NewStores(db *sqlx.DB, chainKey string) *Stores {
+	if db.DriverName() == database.DriverSQLite {
+		return newSQLiteStores(db, chainKey)
+	}
+
+	activity := NewDeviceActivityRepository(db)
+	return &Stores{
+		Tokens:        NewTokenRepository(db),
+		Users:         NewUserRepository(db),
+		MFA:           NewMFARepository(db),
+		APITokens:     NewAPITokenRepository(db),
+		Roles:         NewRoleRepository(db),
+		Sessions:      NewSessionRepository(db),
+		Devices:       NewDeviceRepository(db, chainKey),
+		Activity:      activity,
+		Inventory:     NewInventoryRepository(db, activity),
+		Dashboard:     NewDashboardRepository(db),
+		Departments:   NewDepartmentRepository(db),
+		AuditLogs:     NewAuditLogRepository(db, chainKey),
+		Cleanup:       NewCleanupRepository(db),
+		Retention:     NewRetentionRepository(db),
+		SIEM:          NewSIEMRepository(db),
+		AgentUpdates:  NewAgentUpdateRepository(db, activity),
+		Organizations: NewOrganizationRepository(db),
+		Archives:      NewArchiveRepository(db),
+		Jobs:          NewJobRepository(db),
+	}
+}
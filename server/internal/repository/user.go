@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -33,15 +34,20 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (*m
 // Create inserts a new user into the database.
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	_, err := r.db.ExecContext(ctx,
-		"INSERT INTO users (id, username, name, password_hash, role) VALUES ($1, $2, $3, $4, $5)",
-		user.ID, user.Username, user.Name, user.PasswordHash, user.Role)
+		`INSERT INTO users (id, username, name, password_hash, role, auth_provider, external_id, must_change_password, organization_id, super_admin)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		user.ID, user.Username, user.Name, user.PasswordHash, user.Role, user.AuthProvider, user.ExternalID, user.MustChangePassword,
+		user.OrganizationID, user.SuperAdmin)
 	return err
 }
 
-// List returns all users ordered by creation date (newest first).
-func (r *UserRepository) List(ctx context.Context) ([]models.User, error) {
+// List returns the users of an organization ordered by creation date (newest first).
+func (r *UserRepository) List(ctx context.Context, orgID uuid.UUID) ([]models.User, error) {
 	var users []models.User
-	err := r.db.SelectContext(ctx, &users, "SELECT id, username, name, password_hash, role, created_at, updated_at FROM users ORDER BY created_at DESC")
+	err := r.db.SelectContext(ctx, &users, `SELECT id, username, name, password_hash, role, auth_provider, external_id, totp_secret, totp_enabled, totp_last_step,
+		        failed_login_attempts, lockout_count, locked_until, must_change_password, password_changed_at, organization_id, super_admin,
+		        created_at, updated_at
+		 FROM users WHERE organization_id = $1 ORDER BY created_at DESC`, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +67,35 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 	return &user, nil
 }
 
+// GetInOrganization retrieves a user of an organization; users of other
+// organizations are not found (sql.ErrNoRows).
+func (r *UserRepository) GetInOrganization(ctx context.Context, id, orgID uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := r.db.GetContext(ctx, &user, "SELECT * FROM users WHERE id = $1 AND organization_id = $2", id, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByExternalID retrieves a user provisioned by an external identity provider.
+func (r *UserRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*models.User, error) {
+	var user models.User
+	err := r.db.GetContext(ctx, &user,
+		"SELECT * FROM users WHERE auth_provider = $1 AND external_id = $2", provider, externalID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// SetSuperAdmin grants or removes the super-admin flag of a user.
+func (r *UserRepository) SetSuperAdmin(ctx context.Context, id uuid.UUID, superAdmin bool) error {
+	_, err := r.db.ExecContext(ctx,
+		"UPDATE users SET super_admin = $1, updated_at = NOW() WHERE id = $2", superAdmin, id)
+	return err
+}
+
 // Update modifies a user's username, name, password_hash, and/or role.
 func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, username, name, passwordHash, role string) error {
 	result, err := r.db.ExecContext(ctx,
@@ -79,12 +114,104 @@ func (r *UserRepository) Update(ctx context.Context, id uuid.UUID, username, nam
 	return nil
 }
 
-// Delete removes a user by ID. Returns an error if the user does not exist.
-func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1", id)
+// Delete removes a user of an organization by ID. Returns an error if the organization
+// has no such user.
+func (r *UserRepository) Delete(ctx context.Context, id, orgID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, "DELETE FROM users WHERE id = $1 AND organization_id = $2", id, orgID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failed login. Once threshold consecutive failures are reached
+// the account is locked for base * 2^(previous lockouts), capped at maxDuration, and the counter restarts.
+// It returns the new locked_until when this failure triggered a lockout, nil otherwise.
+func (r *UserRepository) RecordLoginFailure(ctx context.Context, id uuid.UUID, threshold int, base, maxDuration time.Duration) (*time.Time, error) {
+	var lockedUntil *time.Time
+	var locked bool
+	err := r.db.QueryRowxContext(ctx,
+		`UPDATE users SET
+		     failed_login_attempts = CASE WHEN failed_login_attempts + 1 >= $1 THEN 0 ELSE failed_login_attempts + 1 END,
+		     lockout_count = CASE WHEN failed_login_attempts + 1 >= $1 THEN lockout_count + 1 ELSE lockout_count END,
+		     locked_until = CASE WHEN failed_login_attempts + 1 >= $1
+		         THEN NOW() + `+seconds(r.db, "LEAST($2 * POWER(2, LEAST(lockout_count, 20)), $3)")+`
+		         ELSE locked_until END
+		 WHERE id = $4
+		 RETURNING locked_until, failed_login_attempts = 0`,
+		threshold, base.Seconds(), maxDuration.Seconds(), id).Scan(&lockedUntil, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("record login failure: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+	return lockedUntil, nil
+}
+
+// ResetLoginFailures clears the failure counters after a successful login.
+func (r *UserRepository) ResetLoginFailures(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL
+		 WHERE id = $1 AND (failed_login_attempts > 0 OR lockout_count > 0 OR locked_until IS NOT NULL)`, id)
+	if err != nil {
+		return fmt.Errorf("reset login failures: %w", err)
+	}
+	return nil
+}
+
+// Unlock lifts a lockout of a user of an organization and clears the failure counters.
+func (r *UserRepository) Unlock(ctx context.Context, id, orgID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET failed_login_attempts = 0, lockout_count = 0, locked_until = NULL, updated_at = NOW() WHERE id = $1 AND organization_id = $2",
+		id, orgID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// RecentPasswordHashes returns the user's last n password hashes, newest first.
+func (r *UserRepository) RecentPasswordHashes(ctx context.Context, id uuid.UUID, n int) ([]string, error) {
+	var hashes []string
+	err := r.db.SelectContext(ctx, &hashes,
+		"SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2", id, n)
+	if err != nil {
+		return nil, fmt.Errorf("list password history: %w", err)
+	}
+	return hashes, nil
+}
+
+// SetPassword stores a new password hash, records it in the history (keeping the last keep
+// entries) and sets whether the user must change it at the next login.
+func (r *UserRepository) SetPassword(ctx context.Context, id uuid.UUID, passwordHash string, mustChange bool, keep int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET password_hash = $1, must_change_password = $2, password_changed_at = NOW(), updated_at = NOW()
+		 WHERE id = $3`,
+		passwordHash, mustChange, id)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
 	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
@@ -92,5 +219,32 @@ func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	if rows == 0 {
 		return fmt.Errorf("user not found")
 	}
+
+	if err := addPasswordHistory(ctx, tx, id, passwordHash, keep); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddPasswordHistory records the initial password of a new user.
+func (r *UserRepository) AddPasswordHistory(ctx context.Context, id uuid.UUID, passwordHash string, keep int) error {
+	return addPasswordHistory(ctx, r.db, id, passwordHash, keep)
+}
+
+func addPasswordHistory(ctx context.Context, db sqlx.ExtContext, id uuid.UUID, passwordHash string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	if _, err := db.ExecContext(ctx,
+		"INSERT INTO password_history (id, user_id, password_hash) VALUES ($1, $2, $3)",
+		uuid.New(), id, passwordHash); err != nil {
+		return fmt.Errorf("record password history: %w", err)
+	}
+	if _, err := db.ExecContext(ctx,
+		`DELETE FROM password_history WHERE user_id = $1 AND id NOT IN (
+		     SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2)`,
+		id, keep); err != nil {
+		return fmt.Errorf("prune password history: %w", err)
+	}
 	return nil
 }
@@ -3,13 +3,14 @@ package router
 
 import (
 	"log/slog"
-	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"inventario/server/internal/authz"
 	"inventario/server/internal/config"
 	"inventario/server/internal/handler"
 	"inventario/server/internal/middleware"
+	"inventario/server/internal/ratelimit"
 	"inventario/server/internal/repository"
 )
 
@@ -24,7 +25,26 @@ func Setup(
 	userHandler *handler.UserHandler,
 	departmentHandler *handler.DepartmentHandler,
 	auditHandler *handler.AuditLogHandler,
-	tokenRepo *repository.TokenRepository,
+	oidcHandler *handler.OIDCHandler,
+	mfaHandler *handler.MFAHandler,
+	apiTokenHandler *handler.APITokenHandler,
+	roleHandler *handler.RoleHandler,
+	sessionHandler *handler.SessionHandler,
+	agentUpdateHandler *handler.AgentUpdateHandler,
+	eventHandler *handler.EventHandler,
+	organizationHandler *handler.OrganizationHandler,
+	archiveHandler *handler.ArchiveHandler,
+	retentionHandler *handler.RetentionHandler,
+	jobHandler *handler.JobHandler,
+	tokenRepo repository.TokenStore,
+	apiTokenRepo repository.APITokenStore,
+	roleRepo repository.RoleStore,
+	userRepo repository.UserStore,
+	sessionRepo repository.SessionStore,
+	limiter ratelimit.Limiter,
+	rates *middleware.RateLimits,
+	origins *middleware.Origins,
+	auditLogger *middleware.AuditLogger,
 ) *gin.Engine {
 	if cfg.LogLevel != slog.LevelDebug {
 		gin.SetMode(gin.ReleaseMode)
@@ -34,8 +54,8 @@ func Setup(
 	r.Use(gin.Recovery())
 	r.Use(middleware.RequestID())
 	r.Use(middleware.Logging())
-	r.Use(middleware.SecurityHeaders(cfg.CORSOrigins))
-	r.Use(middleware.CORS(cfg.CORSOrigins))
+	r.Use(middleware.SecurityHeaders(origins))
+	r.Use(middleware.CORS(origins))
 	r.Use(middleware.DefaultMaxBodySize())
 
 	// Health probes — no authentication required.
@@ -46,46 +66,144 @@ func Setup(
 	api := r.Group("/api/v1")
 	{
 		// Agent endpoints.
-		api.POST("/enroll", middleware.RateLimit(10, time.Minute), authHandler.Enroll)
-		api.POST("/inventory", middleware.DeviceAuth(tokenRepo), inventoryHandler.SubmitInventory)
+		api.POST("/enroll", middleware.RateLimit(limiter, &rates.Enroll, middleware.ByIP), authHandler.Enroll)
+		api.POST("/inventory", middleware.DeviceAuth(tokenRepo), middleware.RateLimit(limiter, &rates.Agent, middleware.ByDevice), inventoryHandler.SubmitInventory)
+		api.POST("/heartbeat", middleware.DeviceAuth(tokenRepo), middleware.RateLimit(limiter, &rates.Agent, middleware.ByDevice), inventoryHandler.Heartbeat)
+		api.GET("/agent/update", middleware.DeviceAuth(tokenRepo), middleware.RateLimit(limiter, &rates.Agent, middleware.ByDevice), agentUpdateHandler.Check)
+		api.GET("/agent/releases/:id/download", middleware.DeviceAuth(tokenRepo), middleware.RateLimit(limiter, &rates.AgentDownload, middleware.ByDevice), agentUpdateHandler.Download)
+		api.POST("/agent/update-report", middleware.DeviceAuth(tokenRepo), middleware.RateLimit(limiter, &rates.Agent, middleware.ByDevice), agentUpdateHandler.Report)
 
 		// Dashboard authentication.
-		api.POST("/auth/login", middleware.RateLimit(5, time.Minute), authHandler.Login)
+		api.POST("/auth/login", middleware.RateLimit(limiter, &rates.Login, middleware.ByIP), authHandler.Login)
+		api.POST("/auth/password/change", middleware.RateLimit(limiter, &rates.Login, middleware.ByIP), authHandler.ChangePassword)
 
-		// Dashboard data endpoints — JWT protected.
-		protected := api.Group("")
-		protected.Use(middleware.JWTAuth(cfg.JWTSecret))
-		{
-			protected.GET("/auth/me", authHandler.Me)
-			protected.POST("/auth/logout", authHandler.Logout)
-			protected.GET("/dashboard/stats", dashboardHandler.GetStats)
-			protected.GET("/devices", deviceHandler.ListDevices)
-			protected.GET("/devices/export", deviceHandler.ExportCSV)
-			protected.GET("/devices/:id", deviceHandler.GetDevice)
-			protected.GET("/devices/:id/hardware-history", deviceHandler.GetHardwareHistory)
-			protected.GET("/devices/:id/activity", deviceHandler.GetDeviceActivity)
-			protected.GET("/departments", departmentHandler.ListDepartments)
-			protected.GET("/users", userHandler.ListUsers)
+		// Second login step — authenticated by the challenge returned from /auth/login.
+		api.POST("/auth/mfa/verify", middleware.RateLimit(limiter, &rates.Login, middleware.ByIP), mfaHandler.Verify)
+		api.POST("/auth/mfa/setup", middleware.RateLimit(limiter, &rates.Login, middleware.ByIP), mfaHandler.Setup)
+		api.POST("/auth/mfa/setup/activate", middleware.RateLimit(limiter, &rates.Login, middleware.ByIP), mfaHandler.SetupActivate)
+
+		// OpenID Connect single sign-on — only registered when configured.
+		if oidcHandler != nil {
+			api.GET("/auth/oidc/login", middleware.RateLimit(limiter, &rates.SSO, middleware.ByIP), oidcHandler.Login)
+			api.GET("/auth/oidc/callback", middleware.RateLimit(limiter, &rates.SSO, middleware.ByIP), oidcHandler.Callback)
 		}
 
-		// Admin-only endpoints
-		admin := api.Group("")
-		admin.Use(middleware.JWTAuth(cfg.JWTSecret), middleware.RequireRole("admin"))
+		// Dashboard endpoints — JWT session or personal API token. Permissions come from
+		// the user's roles and may be limited to departments; handlers apply the scope.
+		// Everything is confined to the organization of the user (or, for super-admins,
+		// the one selected for the session).
+		protected := api.Group("")
+		protected.Use(middleware.JWTAuth(cfg.JWTSecret, sessionRepo, cfg.Session.IdleTimeout, apiTokenRepo, auditLogger), middleware.LoadGrants(roleRepo, userRepo))
 		{
-			admin.PATCH("/devices/:id/status", deviceHandler.UpdateStatus)
-			admin.PATCH("/devices/:id/department", deviceHandler.UpdateDepartment)
-			admin.DELETE("/devices/:id", deviceHandler.DeleteDevice)
-			admin.PATCH("/devices/bulk/status", deviceHandler.BulkUpdateStatus)
-			admin.PATCH("/devices/bulk/department", deviceHandler.BulkUpdateDepartment)
-			admin.POST("/devices/bulk/delete", deviceHandler.BulkDelete)
-			admin.POST("/departments", departmentHandler.CreateDepartment)
-			admin.PUT("/departments/:id", departmentHandler.UpdateDepartment)
-			admin.DELETE("/departments/:id", departmentHandler.DeleteDepartment)
-			admin.POST("/users", userHandler.CreateUser)
-			admin.PUT("/users/:id", userHandler.UpdateUser)
-			admin.DELETE("/users/:id", userHandler.DeleteUser)
-			admin.GET("/audit-logs", auditHandler.ListAuditLogs)
-			admin.GET("/audit-logs/:type/:id", auditHandler.GetResourceAuditLogs)
+			// Account management is only available to interactive sessions.
+			session := protected.Group("", middleware.RequireSession())
+			session.POST("/auth/logout", authHandler.Logout)
+			session.POST("/auth/refresh", authHandler.Refresh)
+			session.GET("/auth/sessions", sessionHandler.ListOwn)
+			session.DELETE("/auth/sessions", sessionHandler.RevokeOthers)
+			session.DELETE("/auth/sessions/:sessionId", sessionHandler.RevokeOwn)
+			session.GET("/auth/mfa", mfaHandler.Status)
+			session.POST("/auth/mfa/enroll", mfaHandler.Enroll)
+			session.POST("/auth/mfa/activate", middleware.RateLimit(limiter, &rates.MFA, middleware.ByUser), mfaHandler.Activate)
+			session.POST("/auth/mfa/recovery-codes", middleware.RateLimit(limiter, &rates.MFA, middleware.ByUser), mfaHandler.RegenerateRecoveryCodes)
+			session.POST("/auth/mfa/disable", middleware.RateLimit(limiter, &rates.MFA, middleware.ByUser), mfaHandler.Disable)
+			session.GET("/auth/api-tokens", apiTokenHandler.ListOwn)
+			session.POST("/auth/api-tokens", apiTokenHandler.Create)
+			session.DELETE("/auth/api-tokens/:id", apiTokenHandler.RevokeOwn)
+			session.POST("/auth/organization", middleware.RequireSuperAdmin(middleware.ScopeSuperAdmin), organizationHandler.Switch)
+
+			read := protected.Group("", middleware.RequireScope(middleware.ScopeRead))
+			read.GET("/auth/me", authHandler.Me)
+			read.GET("/departments", departmentHandler.ListDepartments)
+			read.GET("/users", userHandler.ListUsers)
+			read.GET("/organization", organizationHandler.Current)
+
+			deviceRead := middleware.RequirePermission(authz.DeviceRead)
+			deviceWrite := middleware.RequirePermission(authz.DeviceWrite)
+			deviceDelete := middleware.RequirePermission(authz.DeviceDelete)
+			departmentWrite := middleware.RequirePermission(authz.DepartmentWrite)
+			userManage := middleware.RequirePermission(authz.UserManage)
+			auditRead := middleware.RequirePermission(authz.AuditRead)
+			agentManage := middleware.RequirePermission(authz.AgentManage)
+			superAdminRead := middleware.RequireSuperAdmin(middleware.ScopeRead)
+			superAdminAudit := middleware.RequireSuperAdmin(middleware.ScopeAuditRead)
+			superAdminAgent := middleware.RequireSuperAdmin(middleware.ScopeAgentManage)
+			superAdmin := middleware.RequireSuperAdmin(middleware.ScopeSuperAdmin)
+
+			protected.GET("/dashboard/stats", deviceRead, dashboardHandler.GetStats)
+			protected.GET("/events/stream", deviceRead, middleware.RateLimit(limiter, &rates.EventStream, middleware.ByUser), eventHandler.Stream)
+			protected.GET("/devices", deviceRead, deviceHandler.ListDevices)
+			protected.POST("/devices", deviceWrite, deviceHandler.CreateManualAsset)
+			protected.GET("/devices/export", deviceRead, deviceHandler.Export)
+			protected.GET("/devices/:id", deviceRead, deviceHandler.GetDevice)
+			protected.GET("/devices/:id/hardware-history", deviceRead, deviceHandler.GetHardwareHistory)
+			protected.GET("/devices/:id/metrics", deviceRead, deviceHandler.GetMetrics)
+			protected.GET("/devices/:id/activity", deviceRead, deviceHandler.GetDeviceActivity)
+			protected.PUT("/devices/:id", deviceWrite, deviceHandler.UpdateManualAsset)
+			protected.PATCH("/devices/:id/status", deviceWrite, deviceHandler.UpdateStatus)
+			protected.PATCH("/devices/:id/department", deviceWrite, deviceHandler.UpdateDepartment)
+			protected.DELETE("/devices/:id", deviceDelete, deviceHandler.DeleteDevice)
+			protected.PATCH("/devices/bulk/status", deviceWrite, deviceHandler.BulkUpdateStatus)
+			protected.PATCH("/devices/bulk/department", deviceWrite, deviceHandler.BulkUpdateDepartment)
+			protected.POST("/devices/bulk/delete", deviceDelete, deviceHandler.BulkDelete)
+			protected.POST("/devices/import", deviceWrite, deviceHandler.Import)
+
+			protected.POST("/departments", departmentWrite, departmentHandler.CreateDepartment)
+			protected.PUT("/departments/:id", departmentWrite, departmentHandler.UpdateDepartment)
+			protected.DELETE("/departments/:id", departmentWrite, departmentHandler.DeleteDepartment)
+
+			protected.POST("/users", userManage, userHandler.CreateUser)
+			protected.PUT("/users/:id", userManage, userHandler.UpdateUser)
+			protected.DELETE("/users/:id", userManage, userHandler.DeleteUser)
+			protected.POST("/users/:id/unlock", userManage, userHandler.UnlockUser)
+			protected.GET("/users/:id/role-bindings", userManage, roleHandler.ListBindings)
+			protected.POST("/users/:id/role-bindings", userManage, roleHandler.CreateBinding)
+			protected.DELETE("/users/:id/role-bindings/:bindingId", userManage, roleHandler.DeleteBinding)
+			protected.GET("/roles", userManage, roleHandler.ListRoles)
+			protected.POST("/roles", superAdmin, roleHandler.CreateRole)
+			protected.PUT("/roles/:id", superAdmin, roleHandler.UpdateRole)
+			protected.DELETE("/roles/:id", superAdmin, roleHandler.DeleteRole)
+
+			session.DELETE("/users/:id/mfa", userManage, mfaHandler.Reset)
+			session.GET("/users/:id/sessions", userManage, sessionHandler.ListForUser)
+			session.DELETE("/users/:id/sessions", userManage, sessionHandler.RevokeAllForUser)
+			session.DELETE("/users/:id/sessions/:sessionId", userManage, sessionHandler.RevokeForUser)
+			session.GET("/api-tokens", userManage, apiTokenHandler.ListAll)
+			session.DELETE("/api-tokens/:id", userManage, apiTokenHandler.Revoke)
+
+			protected.GET("/audit-logs", auditRead, auditHandler.ListAuditLogs)
+			protected.GET("/audit-logs/verify", superAdminAudit, auditHandler.VerifyChain)
+			protected.GET("/audit-logs/pipeline", superAdminAudit, auditHandler.PipelineStats)
+			protected.GET("/audit-logs/:type/:id", auditRead, auditHandler.GetResourceAuditLogs)
+			// Archives hold the purged history of all organizations.
+			protected.GET("/archives", superAdminRead, archiveHandler.List)
+			// Retention policies apply to all organizations.
+			protected.GET("/retention-policies", superAdminRead, retentionHandler.List)
+			protected.PUT("/retention-policies", superAdmin, retentionHandler.Replace)
+			protected.GET("/retention-policies/preview", superAdminRead, retentionHandler.Preview)
+			// Background jobs run for all organizations.
+			protected.GET("/jobs", superAdminRead, jobHandler.List)
+			protected.GET("/jobs/:name/runs", superAdminRead, jobHandler.Runs)
+			protected.POST("/jobs/:name/run", superAdmin, jobHandler.Run)
+
+			protected.GET("/enrollment-keys", agentManage, organizationHandler.ListEnrollmentKeys)
+			session.POST("/enrollment-keys", agentManage, organizationHandler.CreateEnrollmentKey)
+			protected.DELETE("/enrollment-keys/:id", agentManage, organizationHandler.RevokeEnrollmentKey)
+
+			// Agent releases and rollouts span all organizations.
+			protected.GET("/agent-releases", superAdminRead, agentUpdateHandler.ListReleases)
+			protected.POST("/agent-releases", superAdminAgent, middleware.MaxBodySize(int64(cfg.AgentUpdate.MaxSizeMB+1)<<20), agentUpdateHandler.UploadRelease)
+			protected.DELETE("/agent-releases/:id", superAdminAgent, agentUpdateHandler.DeleteRelease)
+			protected.GET("/agent-rollouts", superAdminRead, agentUpdateHandler.ListRollouts)
+			protected.POST("/agent-rollouts", superAdminAgent, agentUpdateHandler.CreateRollout)
+			protected.PUT("/agent-rollouts/:id", superAdminAgent, agentUpdateHandler.UpdateRollout)
+			protected.DELETE("/agent-rollouts/:id", superAdminAgent, agentUpdateHandler.DeleteRollout)
+			protected.GET("/agent-update-reports", superAdminRead, agentUpdateHandler.ListReports)
+
+			protected.GET("/organizations", superAdminRead, organizationHandler.List)
+			protected.POST("/organizations", superAdmin, organizationHandler.Create)
+			protected.PUT("/organizations/:id", superAdmin, organizationHandler.Update)
+			protected.DELETE("/organizations/:id", superAdmin, organizationHandler.Delete)
 		}
 	}
 
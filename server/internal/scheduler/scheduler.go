@@ -0,0 +1,422 @@
+// Package scheduler runs background jobs on cron schedules (see package cron). Every
+// replica runs the scheduler, and each activation of a job runs on one of them: the
+// replica first takes the job's lock (a PostgreSQL advisory lock) and skips the
+// activation when another replica holds it or has already recorded a run for it.
+// Runs are stored in job_runs with their result or error, and can be started on
+// demand with RunNow.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/cron"
+	"inventario/server/internal/repository"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// historySize is the number of runs kept per job.
+const historySize = 100
+
+// defaultTimeout bounds the runs of jobs registered without a timeout.
+const defaultTimeout = time.Hour
+
+var (
+	// ErrUnknownJob is returned for a job name that was not registered.
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned by RunNow while the job runs, on any replica.
+	ErrJobRunning = errors.New("job is already running")
+	// ErrStopped is returned by RunNow once the scheduler is stopping.
+	ErrStopped = errors.New("scheduler stopped")
+)
+
+// Func is the work of a job. A non-nil result is stored with the run as JSON; a job
+// that fails after doing part of its work may return both.
+type Func func(ctx context.Context) (any, error)
+
+// Job is a job to register with Register.
+type Job struct {
+	Name     string
+	Schedule string        // cron expression or descriptor
+	Timeout  time.Duration // the run is canceled after it; 0 means an hour
+	Run      Func
+}
+
+// job is a registered Job and its state.
+type job struct {
+	Job
+	schedule    cron.Schedule
+	next        time.Time     // next activation, zero before Start
+	running     bool          // a run is in progress on this replica
+	rescheduled chan struct{} // signals a new schedule to the job's loop
+}
+
+// Scheduler runs the registered jobs.
+type Scheduler struct {
+	store   repository.JobStore
+	replica string
+
+	mu      sync.Mutex // guards jobs, their state and stopped
+	jobs    map[string]*job
+	names   []string // in registration order
+	stopped bool
+
+	ctx    context.Context // canceled by Stop, ending the loops and the runs
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates a Scheduler that records runs in store. Runs are labeled with the host
+// name of the replica.
+func New(store repository.JobStore) *Scheduler {
+	replica, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		store:   store,
+		replica: replica,
+		jobs:    make(map[string]*job),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Register adds a job. Register before Start.
+func (s *Scheduler) Register(j Job) error {
+	schedule, err := cron.Parse(j.Schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", j.Name, err)
+	}
+	if j.Timeout <= 0 {
+		j.Timeout = defaultTimeout
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[j.Name]; ok {
+		return fmt.Errorf("job %s is registered twice", j.Name)
+	}
+	s.jobs[j.Name] = &job{Job: j, schedule: schedule, rescheduled: make(chan struct{}, 1)}
+	s.names = append(s.names, j.Name)
+	return nil
+}
+
+// Configure replaces the schedule and the timeout of a job while the scheduler runs,
+// on configuration reloads. A new schedule takes effect from now; a new timeout, from
+// the next run.
+func (s *Scheduler) Configure(name, schedule string, timeout time.Duration) error {
+	parsed, err := cron.Parse(schedule)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return ErrUnknownJob
+	}
+	rescheduled := schedule != j.Schedule
+	if !rescheduled && timeout == j.Timeout {
+		s.mu.Unlock()
+		return nil
+	}
+	j.Schedule, j.schedule, j.Timeout = schedule, parsed, timeout
+	s.mu.Unlock()
+
+	if rescheduled {
+		select {
+		case j.rescheduled <- struct{}{}:
+		default:
+		}
+	}
+	slog.Info("job reconfigured", "job", name, "schedule", schedule, "timeout", timeout.String())
+	return nil
+}
+
+// Start begins running the jobs, each in a background goroutine. A job whose last
+// scheduled activation was missed while no replica ran runs at once; a job that never
+// ran waits for its first activation. Call Stop() to terminate them.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.names {
+		j := s.jobs[name]
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+	slog.Info("job scheduler started", "jobs", s.names, "replica", s.replica)
+}
+
+// Stop cancels the runs in progress, waits for them to be recorded and terminates the
+// jobs.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	slog.Info("job scheduler stopped")
+}
+
+// loop runs the activations of j until Stop.
+func (s *Scheduler) loop(j *job) {
+	defer s.wg.Done()
+
+	due := s.firstActivation(j)
+	for {
+		s.mu.Lock()
+		j.next = due
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-timer.C:
+			s.runScheduled(j, due)
+		case <-j.rescheduled:
+			timer.Stop()
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		// Activations missed while a run took longer than the interval are skipped.
+		due = s.nextActivation(j, time.Now())
+	}
+}
+
+// firstActivation returns the activation that follows the last scheduled run of j,
+// which is in the past if it was missed. If j never ran on schedule, it returns the
+// first activation after now: replicas started together then wait for the same
+// activation, which only one of them runs, instead of each running the job at its own
+// start time.
+func (s *Scheduler) firstActivation(j *job) time.Time {
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+	last, err := s.store.LastScheduled(ctx, j.Name)
+	if err != nil {
+		slog.Error("failed to read the last run of job", "job", j.Name, "error", err)
+		return s.nextActivation(j, time.Now())
+	}
+	if last == nil {
+		return s.nextActivation(j, time.Now())
+	}
+	// Stored times may come back in UTC; expressions apply in local time.
+	return s.nextActivation(j, last.In(time.Local))
+}
+
+// nextActivation returns the first activation of j after t.
+func (s *Scheduler) nextActivation(j *job, t time.Time) time.Time {
+	s.mu.Lock()
+	schedule := j.schedule
+	s.mu.Unlock()
+	next := schedule.Next(t)
+	if next.IsZero() {
+		// The expression never matches; look again in a year.
+		return t.AddDate(1, 0, 0)
+	}
+	return next
+}
+
+// runScheduled runs the activation due of j unless another replica runs it.
+func (s *Scheduler) runScheduled(j *job, due time.Time) {
+	if err := s.claim(j); err != nil {
+		if errors.Is(err, ErrJobRunning) {
+			slog.Warn("job still running, activation skipped", "job", j.Name, "scheduled_for", due)
+		}
+		return
+	}
+	defer s.release(j)
+
+	ctx, cancel := context.WithTimeout(s.ctx, 30*time.Second)
+	defer cancel()
+	unlock, ok, err := s.store.Lock(ctx, j.Name)
+	if err != nil {
+		slog.Error("failed to lock job", "job", j.Name, "error", err)
+		return
+	}
+	if !ok {
+		slog.Debug("job running on another replica, activation skipped", "job", j.Name)
+		return
+	}
+	defer unlock()
+
+	last, err := s.store.LastScheduled(ctx, j.Name)
+	if err != nil {
+		slog.Error("failed to read the last run of job", "job", j.Name, "error", err)
+		return
+	}
+	if last != nil && !last.Before(due) {
+		slog.Debug("job already ran on another replica, activation skipped", "job", j.Name, "scheduled_for", due)
+		return
+	}
+
+	run := &models.JobRun{ID: uuid.New(), Job: j.Name, Source: "schedule", ScheduledFor: &due, Replica: s.replica}
+	if err := s.store.StartRun(ctx, run); err != nil {
+		slog.Error("failed to record job run", "job", j.Name, "error", err)
+		return
+	}
+	s.execute(j, run)
+}
+
+// RunNow starts a run of the job name outside its schedule, for requestedBy, and
+// returns it once recorded; the job runs in the background.
+func (s *Scheduler) RunNow(ctx context.Context, name, requestedBy string) (*models.JobRun, error) {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	if err := s.claim(j); err != nil {
+		return nil, err
+	}
+
+	unlock, ok, err := s.store.Lock(ctx, name)
+	if err != nil {
+		s.release(j)
+		return nil, err
+	}
+	if !ok {
+		s.release(j)
+		return nil, ErrJobRunning
+	}
+	run := &models.JobRun{ID: uuid.New(), Job: name, Source: "manual", RequestedBy: requestedBy, Replica: s.replica}
+	if err := s.store.StartRun(ctx, run); err != nil {
+		unlock()
+		s.release(j)
+		return nil, err
+	}
+
+	started := *run
+	go func() {
+		defer s.wg.Done()
+		defer s.release(j)
+		defer unlock()
+		s.execute(j, run)
+	}()
+	return &started, nil
+}
+
+// claim marks j as running on this replica. It fails if it already is, or if the
+// scheduler is stopping. A claimed job counts in the wait of Stop.
+func (s *Scheduler) claim(j *job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	if j.running {
+		return ErrJobRunning
+	}
+	j.running = true
+	s.wg.Add(1)
+	return nil
+}
+
+// release ends a claim.
+func (s *Scheduler) release(j *job) {
+	s.mu.Lock()
+	j.running = false
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// execute runs j for the recorded run and records its outcome.
+func (s *Scheduler) execute(j *job, run *models.JobRun) {
+	s.mu.Lock()
+	timeout := j.Timeout
+	s.mu.Unlock()
+
+	slog.Info("job started", "job", j.Name, "run_id", run.ID, "source", run.Source)
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	result, err := j.Run(ctx)
+	cancel()
+
+	run.Status = "succeeded"
+	if result != nil {
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			slog.Error("failed to encode job result", "job", j.Name, "error", merr)
+		}
+		run.Result = data
+	}
+	if err != nil {
+		run.Status = "failed"
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		case s.ctx.Err() != nil:
+			err = fmt.Errorf("canceled by server shutdown: %w", err)
+		}
+		run.Error = err.Error()
+	}
+
+	// The run is recorded even when the scheduler is stopping.
+	recordCtx, recordCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer recordCancel()
+	if rerr := s.store.FinishRun(recordCtx, run, historySize); rerr != nil {
+		slog.Error("failed to record job run", "job", j.Name, "run_id", run.ID, "error", rerr)
+	}
+
+	duration := time.Since(run.StartedAt).Round(time.Millisecond).String()
+	if err != nil {
+		slog.Error("job failed", "job", j.Name, "run_id", run.ID, "duration", duration, "error", err)
+		return
+	}
+	slog.Info("job finished", "job", j.Name, "run_id", run.ID, "duration", duration)
+}
+
+// Jobs returns the registered jobs with their next activation and last run.
+func (s *Scheduler) Jobs(ctx context.Context) (*dto.JobListResponse, error) {
+	s.mu.Lock()
+	jobs := make([]dto.Job, 0, len(s.names))
+	for _, name := range s.names {
+		j := s.jobs[name]
+		item := dto.Job{Name: name, Schedule: j.Schedule, Timeout: j.Timeout.String()}
+		if !j.next.IsZero() {
+			next := j.next
+			item.NextRun = &next
+		}
+		jobs = append(jobs, item)
+	}
+	s.mu.Unlock()
+
+	for i := range jobs {
+		runs, _, err := s.store.ListRuns(ctx, jobs[i].Name, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) > 0 {
+			jobs[i].LastRun = &runs[0]
+		}
+	}
+	return &dto.JobListResponse{Jobs: jobs}, nil
+}
+
+// Runs returns a page of the run history of the job name, newest first.
+func (s *Scheduler) Runs(ctx context.Context, name string, page, limit int) (*dto.JobRunListResponse, error) {
+	s.mu.Lock()
+	_, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	if page < 1 {
+		page = 1
+	}
+	runs, total, err := s.store.ListRuns(ctx, name, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.JobRunListResponse{Runs: runs, Total: total, Page: page, Limit: limit}, nil
+}
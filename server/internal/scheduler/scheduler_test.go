@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"inventario/shared/models"
+)
+
+// lastStore is a JobStore whose only state is the activation of the last scheduled run.
+type lastStore struct {
+	last *time.Time
+}
+
+func (s *lastStore) Lock(context.Context, string) (func(), bool, error) { return func() {}, true, nil }
+func (s *lastStore) LastScheduled(context.Context, string) (*time.Time, error) {
+	return s.last, nil
+}
+func (s *lastStore) StartRun(context.Context, *models.JobRun) error       { return nil }
+func (s *lastStore) FinishRun(context.Context, *models.JobRun, int) error { return nil }
+func (s *lastStore) ListRuns(context.Context, string, int, int) ([]models.JobRun, int, error) {
+	return nil, 0, nil
+}
+
+func TestFirstActivation(t *testing.T) {
+	missed := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+	recent := time.Now().Truncate(time.Hour)
+
+	tests := []struct {
+		name string
+		last *time.Time
+		want func(now time.Time) time.Time
+	}{
+		// Replicas starting at different times must agree on the activation, so a
+		// job that never ran waits for the next one instead of running at start.
+		{"never ran", nil, func(now time.Time) time.Time { return now.Truncate(time.Hour).Add(time.Hour) }},
+		{"missed activation runs at once", &missed, func(time.Time) time.Time { return missed.Add(time.Hour) }},
+		{"on schedule", &recent, func(time.Time) time.Time { return recent.Add(time.Hour) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&lastStore{last: tt.last})
+			defer s.cancel()
+			if err := s.Register(Job{Name: "test", Schedule: "@every 1h", Run: func(context.Context) (any, error) { return nil, nil }}); err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			got := s.firstActivation(s.jobs["test"])
+			if want := tt.want(now); !got.Equal(want) {
+				t.Errorf("firstActivation = %s, want %s", got, want)
+			}
+		})
+	}
+}
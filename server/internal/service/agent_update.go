@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/config"
+	"inventario/server/internal/repository"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// ErrInvalidRelease is wrapped by validation errors of an uploaded release.
+var ErrInvalidRelease = errors.New("invalid release")
+
+// ErrReleaseSigningDisabled is returned for uploads when no signing key is configured.
+var ErrReleaseSigningDisabled = errors.New("release uploads are disabled: AGENT_RELEASE_PUBLIC_KEYS is not set")
+
+// ErrInvalidRollout is wrapped by validation errors of a rollout.
+var ErrInvalidRollout = errors.New("invalid rollout")
+
+// Platforms agents may be built for.
+var (
+	releaseOSes   = []string{"windows", "linux", "darwin"}
+	releaseArches = []string{"amd64", "arm64", "386"}
+)
+
+var (
+	releaseVersion = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.+-]{0,49}$`)
+	releaseChannel = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,19}$`)
+)
+
+// ReleaseUpload describes an artifact being published as an agent release.
+type ReleaseUpload struct {
+	Version   string
+	OS        string
+	Arch      string
+	Channel   string // default "stable"
+	Signature string // base64 Ed25519 signature of dto.ReleaseSigningPayload
+	Notes     string
+	CreatedBy *uuid.UUID
+}
+
+// AgentUpdateService publishes agent releases, resolves which release each agent should
+// run and records the outcome of updates.
+type AgentUpdateService struct {
+	repo       repository.AgentUpdateStore
+	deviceRepo repository.DeviceStore
+	publicKeys []ed25519.PublicKey
+	maxSize    int64
+}
+
+// NewAgentUpdateService creates a new AgentUpdateService. It fails if a configured
+// public key is not a base64 Ed25519 key.
+func NewAgentUpdateService(repo repository.AgentUpdateStore, deviceRepo repository.DeviceStore, cfg config.AgentUpdateConfig) (*AgentUpdateService, error) {
+	s := &AgentUpdateService{repo: repo, deviceRepo: deviceRepo, maxSize: int64(cfg.MaxSizeMB) << 20}
+	for _, k := range cfg.PublicKeys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("AGENT_RELEASE_PUBLIC_KEYS: %q is not a base64 Ed25519 public key", k)
+		}
+		s.publicKeys = append(s.publicKeys, ed25519.PublicKey(key))
+	}
+	return s, nil
+}
+
+// MaxSize returns the largest accepted artifact in bytes.
+func (s *AgentUpdateService) MaxSize() int64 {
+	return s.maxSize
+}
+
+// CreateRelease checks the artifact's signature against the configured public keys and
+// stores it as a new release.
+func (s *AgentUpdateService) CreateRelease(ctx context.Context, up ReleaseUpload, artifact io.ReadSeeker) (*models.AgentRelease, error) {
+	if len(s.publicKeys) == 0 {
+		return nil, ErrReleaseSigningDisabled
+	}
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidRelease, fmt.Sprintf(format, args...))
+	}
+
+	if up.Channel == "" {
+		up.Channel = "stable"
+	}
+	switch {
+	case !releaseVersion.MatchString(up.Version):
+		return nil, invalid("version must be 1-50 letters, digits, '.', '+' or '-'")
+	case !slices.Contains(releaseOSes, up.OS):
+		return nil, invalid("os must be one of %s", strings.Join(releaseOSes, ", "))
+	case !slices.Contains(releaseArches, up.Arch):
+		return nil, invalid("arch must be one of %s", strings.Join(releaseArches, ", "))
+	case !releaseChannel.MatchString(up.Channel):
+		return nil, invalid("channel must be 1-20 lowercase letters, digits or '-'")
+	case len(up.Notes) > 2000:
+		return nil, invalid("notes are limited to 2000 characters")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(up.Signature))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, invalid("signature must be a base64 Ed25519 signature")
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, io.LimitReader(artifact, s.maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read artifact: %w", err)
+	}
+	if size == 0 || size > s.maxSize {
+		return nil, invalid("the artifact must be between 1 byte and %d MB", s.maxSize>>20)
+	}
+	digest := hex.EncodeToString(h.Sum(nil))
+	payload := dto.ReleaseSigningPayload(up.Version, up.OS, up.Arch, digest)
+	if !slices.ContainsFunc(s.publicKeys, func(k ed25519.PublicKey) bool { return ed25519.Verify(k, payload, sig) }) {
+		return nil, invalid("the signature does not match the artifact, version and platform with any configured public key")
+	}
+	if _, err := artifact.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewind artifact: %w", err)
+	}
+
+	rel := &models.AgentRelease{
+		ID:        uuid.New(),
+		Version:   up.Version,
+		OS:        up.OS,
+		Arch:      up.Arch,
+		Channel:   up.Channel,
+		SHA256:    digest,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+		SizeBytes: size,
+		Notes:     up.Notes,
+		CreatedBy: up.CreatedBy,
+	}
+	if err := s.repo.CreateRelease(ctx, rel, io.LimitReader(artifact, size)); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// ListReleases returns all releases.
+func (s *AgentUpdateService) ListReleases(ctx context.Context) (*dto.AgentReleaseListResponse, error) {
+	releases, err := s.repo.ListReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AgentReleaseListResponse{Releases: releases, Total: len(releases)}, nil
+}
+
+// GetRelease returns a single release.
+func (s *AgentUpdateService) GetRelease(ctx context.Context, id uuid.UUID) (*models.AgentRelease, error) {
+	rel, err := s.repo.GetRelease(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("release not found")
+		}
+		return nil, fmt.Errorf("get release: %w", err)
+	}
+	return rel, nil
+}
+
+// WriteArtifact copies the artifact of a release to w.
+func (s *AgentUpdateService) WriteArtifact(ctx context.Context, id uuid.UUID, w io.Writer) error {
+	return s.repo.WriteArtifact(ctx, id, w)
+}
+
+// DeleteRelease removes a release and its rollouts.
+func (s *AgentUpdateService) DeleteRelease(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.DeleteRelease(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("release not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// ListRollouts returns all rollouts.
+func (s *AgentUpdateService) ListRollouts(ctx context.Context) (*dto.AgentRolloutListResponse, error) {
+	rollouts, err := s.repo.ListRollouts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AgentRolloutListResponse{Rollouts: rollouts, Total: len(rollouts)}, nil
+}
+
+// CreateRollout starts offering a release.
+func (s *AgentUpdateService) CreateRollout(ctx context.Context, req *dto.AgentRolloutRequest, createdBy *uuid.UUID) (*models.AgentRollout, error) {
+	ro, err := rolloutFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	ro.ID = uuid.New()
+	ro.CreatedBy = createdBy
+	if err := s.repo.CreateRollout(ctx, ro); err != nil {
+		return nil, err
+	}
+	return s.repo.GetRollout(ctx, ro.ID)
+}
+
+// UpdateRollout changes the release, target, percentage or paused state of a rollout.
+func (s *AgentUpdateService) UpdateRollout(ctx context.Context, id uuid.UUID, req *dto.AgentRolloutRequest) (*models.AgentRollout, error) {
+	ro, err := rolloutFromRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	ro.ID = id
+	if err := s.repo.UpdateRollout(ctx, ro); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("rollout not found")
+		}
+		return nil, err
+	}
+	return s.repo.GetRollout(ctx, id)
+}
+
+// DeleteRollout stops offering a rollout's release. Agents already updated keep it.
+func (s *AgentUpdateService) DeleteRollout(ctx context.Context, id uuid.UUID) error {
+	if err := s.repo.DeleteRollout(ctx, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("rollout not found")
+		}
+		return err
+	}
+	return nil
+}
+
+func rolloutFromRequest(req *dto.AgentRolloutRequest) (*models.AgentRollout, error) {
+	if req.DepartmentID != nil && req.DeviceID != nil {
+		return nil, fmt.Errorf("%w: department_id and device_id are mutually exclusive", ErrInvalidRollout)
+	}
+	ro := &models.AgentRollout{
+		ReleaseID:    req.ReleaseID,
+		Percentage:   100,
+		DepartmentID: req.DepartmentID,
+		DeviceID:     req.DeviceID,
+		Paused:       req.Paused,
+		Rollback:     req.Rollback,
+	}
+	if req.Percentage != nil {
+		ro.Percentage = *req.Percentage
+	}
+	return ro, nil
+}
+
+// Check returns the release an agent should move to, if it differs from the version it
+// runs. The first applicable rollout that includes the device decides: a pin always
+// does, other rollouts include a stable pseudo-random share of the devices, so raising
+// the percentage only adds devices. Agents only move to an older release from a
+// rollout marked as a rollback, which is how a bad release is rolled back.
+func (s *AgentUpdateService) Check(ctx context.Context, deviceID uuid.UUID, os, arch, channel, version string) (*dto.AgentUpdateResponse, error) {
+	if channel == "" {
+		channel = "stable"
+	}
+	device, err := s.deviceRepo.GetByID(ctx, deviceID, authz.Global)
+	if err != nil {
+		return nil, fmt.Errorf("get device: %w", err)
+	}
+	rollouts, err := s.repo.RolloutsFor(ctx, deviceID, device.DepartmentID, os, arch, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ro := range rollouts {
+		if ro.DeviceID == nil && rolloutBucket(deviceID, ro.ReleaseID) >= ro.Percentage {
+			continue
+		}
+		if ro.Version == version {
+			break
+		}
+		rel, err := s.repo.GetRelease(ctx, ro.ReleaseID)
+		if err != nil {
+			return nil, fmt.Errorf("get release: %w", err)
+		}
+		return &dto.AgentUpdateResponse{
+			Available:   true,
+			ReleaseID:   &rel.ID,
+			Version:     rel.Version,
+			Rollback:    ro.Rollback,
+			SHA256:      rel.SHA256,
+			Signature:   rel.Signature,
+			SizeBytes:   rel.SizeBytes,
+			DownloadURL: fmt.Sprintf("/api/v1/agent/releases/%s/download", rel.ID),
+		}, nil
+	}
+	return &dto.AgentUpdateResponse{Available: false}, nil
+}
+
+// rolloutBucket places a device in one of 100 buckets for a release. The same device
+// lands in different buckets for different releases, so early adopters rotate.
+func rolloutBucket(deviceID, releaseID uuid.UUID) int {
+	sum := sha256.Sum256(append(deviceID[:], releaseID[:]...))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// Report records the outcome of an update attempt by an agent.
+func (s *AgentUpdateService) Report(ctx context.Context, deviceID uuid.UUID, req *dto.AgentUpdateReportRequest) error {
+	return s.repo.InsertReport(ctx, deviceID, req)
+}
+
+// ListReports returns update reports, optionally filtered by status ("success" or
+// "failed") and device.
+func (s *AgentUpdateService) ListReports(ctx context.Context, status string, deviceID *uuid.UUID, page, limit int) (*dto.AgentUpdateReportListResponse, error) {
+	if page < 1 {
+		page = 1
+	}
+	reports, total, err := s.repo.ListReports(ctx, status, deviceID, limit, (page-1)*limit)
+	if err != nil {
+		return nil, err
+	}
+	return &dto.AgentUpdateReportListResponse{Reports: reports, Total: total, Page: page, Limit: limit}, nil
+}
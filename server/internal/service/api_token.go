@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// defaultAPITokenTTL is used when the client does not ask for a specific lifetime.
+const defaultAPITokenTTL = 90 * 24 * time.Hour
+
+// APITokenService manages personal API tokens.
+type APITokenService struct {
+	repo repository.APITokenStore
+}
+
+// NewAPITokenService creates a new APITokenService.
+func NewAPITokenService(repo repository.APITokenStore) *APITokenService {
+	return &APITokenService{repo: repo}
+}
+
+// Create issues a new token for a user and returns the plain-text secret, which is shown only once.
+// Scopes beyond read require the owner to hold the matching permission; permissions are
+// also re-checked against the owner's current grants on every request.
+func (s *APITokenService) Create(ctx context.Context, userID uuid.UUID, grants authz.Grants, superAdmin bool, name string, scopes []string, expiresInDays int) (string, *models.APIToken, error) {
+	scopes = normalizeScopes(scopes)
+	if len(scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(middleware.APITokenScopes, scope) {
+			return "", nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if scope == middleware.ScopeSuperAdmin {
+			if !superAdmin {
+				return "", nil, fmt.Errorf("scope %q requires a super-admin", scope)
+			}
+			continue
+		}
+		if scope != middleware.ScopeRead && !grants.Has(authz.Permission(scope)) {
+			return "", nil, fmt.Errorf("scope %q requires the %s permission", scope, scope)
+		}
+	}
+
+	ttl := defaultAPITokenTTL
+	if expiresInDays > 0 {
+		ttl = time.Duration(expiresInDays) * 24 * time.Hour
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := middleware.APITokenPrefix + secret
+
+	token := &models.APIToken{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        name,
+		TokenPrefix: raw[:len(middleware.APITokenPrefix)+8],
+		TokenHash:   middleware.SHA256Hex(raw),
+		Scopes:      strings.Join(scopes, " "),
+		ExpiresAt:   time.Now().Add(ttl),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repo.Create(ctx, token); err != nil {
+		return "", nil, err
+	}
+	return raw, token, nil
+}
+
+// ListOwn returns the tokens of a user.
+func (s *APITokenService) ListOwn(ctx context.Context, userID uuid.UUID) ([]models.APIToken, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// ListAll returns the tokens of every user of an organization.
+func (s *APITokenService) ListAll(ctx context.Context, orgID uuid.UUID) ([]repository.APITokenWithOwner, error) {
+	return s.repo.ListAll(ctx, orgID)
+}
+
+// RevokeOwn revokes one of the user's own tokens.
+func (s *APITokenService) RevokeOwn(ctx context.Context, userID, tokenID uuid.UUID) error {
+	return s.repo.Revoke(ctx, tokenID, &userID, uuid.Nil)
+}
+
+// Revoke revokes the token of any user of an organization (admin only).
+func (s *APITokenService) Revoke(ctx context.Context, tokenID, orgID uuid.UUID) error {
+	return s.repo.Revoke(ctx, tokenID, nil, orgID)
+}
+
+// normalizeScopes trims, lowercases and de-duplicates the requested scopes.
+func normalizeScopes(scopes []string) []string {
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope != "" && !slices.Contains(out, scope) {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
@@ -6,35 +6,82 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"golang.org/x/crypto/bcrypt"
 
+	"inventario/server/internal/config"
+	"inventario/server/internal/events"
 	"inventario/server/internal/middleware"
 	"inventario/server/internal/repository"
 	"inventario/shared/dto"
 	"inventario/shared/models"
 )
 
+// AuthProviderLocal marks users that sign in with a local bcrypt password.
+const AuthProviderLocal = "local"
+
+// ExternalIdentity is a user identity asserted by an external authentication provider.
+type ExternalIdentity struct {
+	Provider string // e.g. "oidc"
+	Subject  string // stable identifier at the provider
+	Username string
+	Name     string
+	Role     string // admin or viewer, already mapped from provider claims
+}
+
 // AuthService handles enrollment, login, and user management.
 type AuthService struct {
 	db        *sqlx.DB
-	userRepo  *repository.UserRepository
-	tokenRepo *repository.TokenRepository
+	userRepo  repository.UserStore
+	orgRepo   repository.OrganizationStore
+	tokenRepo repository.TokenStore
+	mfaRepo   repository.MFAStore
+	roleRepo  repository.RoleStore
+	sessions  *SessionService
+	ldap      *LDAPAuthenticator
+	policy    *PasswordPolicy
+	mfaCfg    config.MFAConfig
+	lockout   config.LockoutConfig
 	jwtSecret string
 }
 
 // NewAuthService creates a new AuthService.
-func NewAuthService(db *sqlx.DB, userRepo *repository.UserRepository, tokenRepo *repository.TokenRepository, jwtSecret string) *AuthService {
-	return &AuthService{db: db, userRepo: userRepo, tokenRepo: tokenRepo, jwtSecret: jwtSecret}
+// ldap is optional; when nil only local passwords are accepted by Login.
+func NewAuthService(db *sqlx.DB, userRepo repository.UserStore, orgRepo repository.OrganizationStore, tokenRepo repository.TokenStore, mfaRepo repository.MFAStore, roleRepo repository.RoleStore, sessions *SessionService, ldap *LDAPAuthenticator, policy *PasswordPolicy, mfaCfg config.MFAConfig, lockout config.LockoutConfig, jwtSecret string) *AuthService {
+	return &AuthService{db: db, userRepo: userRepo, orgRepo: orgRepo, tokenRepo: tokenRepo, mfaRepo: mfaRepo, roleRepo: roleRepo, sessions: sessions, ldap: ldap, policy: policy, mfaCfg: mfaCfg, lockout: lockout, jwtSecret: jwtSecret}
+}
+
+// ErrSuperAdminTarget is returned when a user who is not a super-admin tries to
+// change, delete, unlock or reset the second factor of a super-admin.
+var ErrSuperAdminTarget = errors.New("only a super-admin can manage a super-admin")
+
+// ErrInvalidEnrollmentKey is returned for an unknown or revoked enrollment key.
+var ErrInvalidEnrollmentKey = errors.New("invalid enrollment key")
+
+// EnrollmentOrganization returns the organization an organization enrollment key
+// enrolls agents into.
+func (s *AuthService) EnrollmentOrganization(ctx context.Context, key string) (uuid.UUID, error) {
+	orgID, err := s.orgRepo.UseEnrollmentKey(ctx, middleware.SHA256Hex(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrInvalidEnrollmentKey
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("look up enrollment key: %w", err)
+	}
+	return orgID, nil
 }
 
-// Enroll registers a new agent or re-enrolls an existing one.
-// It creates the device if it does not exist (by serial_number), then generates a fresh token.
-func (s *AuthService) Enroll(ctx context.Context, req *dto.EnrollRequest) (*dto.EnrollResponse, error) {
+// GetOrganization returns the organization a user works in.
+func (s *AuthService) GetOrganization(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	return s.orgRepo.GetByID(ctx, id)
+}
+
+// Enroll registers a new agent in an organization or re-enrolls an existing one.
+// It creates the device if the organization has none with its serial_number, then
+// generates a fresh token.
+func (s *AuthService) Enroll(ctx context.Context, orgID uuid.UUID, req *dto.EnrollRequest) (*dto.EnrollResponse, error) {
 	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("begin transaction: %w", err)
@@ -43,7 +90,7 @@ func (s *AuthService) Enroll(ctx context.Context, req *dto.EnrollRequest) (*dto.
 
 	// Check if device already exists by serial number.
 	var device models.Device
-	err = tx.GetContext(ctx, &device, "SELECT * FROM devices WHERE serial_number = $1", req.SerialNumber)
+	err = tx.GetContext(ctx, &device, "SELECT * FROM devices WHERE organization_id = $1 AND serial_number = $2", orgID, req.SerialNumber)
 
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
@@ -51,19 +98,20 @@ func (s *AuthService) Enroll(ctx context.Context, req *dto.EnrollRequest) (*dto.
 		device.ID = uuid.New()
 		device.Hostname = req.Hostname
 		device.SerialNumber = req.SerialNumber
+		device.OrganizationID = orgID
 		if _, err = tx.ExecContext(ctx,
-			"INSERT INTO devices (id, hostname, serial_number, last_seen) VALUES ($1, $2, $3, NOW())",
-			device.ID, device.Hostname, device.SerialNumber,
+			"INSERT INTO devices (id, hostname, serial_number, organization_id, last_seen) VALUES ($1, $2, $3, $4, NOW())",
+			device.ID, device.Hostname, device.SerialNumber, device.OrganizationID,
 		); err != nil {
 			return nil, fmt.Errorf("insert device: %w", err)
 		}
-		slog.Info("new device created via enrollment", "device_id", device.ID, "hostname", req.Hostname)
+		slog.Info("new device created via enrollment", "device_id", device.ID, "hostname", req.Hostname, "organization_id", orgID)
 	case err != nil:
 		return nil, fmt.Errorf("query device: %w", err)
 	default:
-		// Existing device — update hostname and last_seen.
+		// Existing device — update hostname and last_seen. An imported record becomes an agent device.
 		if _, err = tx.ExecContext(ctx,
-			"UPDATE devices SET hostname = $1, last_seen = NOW(), updated_at = NOW() WHERE id = $2",
+			"UPDATE devices SET hostname = $1, source = 'agent', offline_since = NULL, last_seen = NOW(), updated_at = NOW() WHERE id = $2",
 			req.Hostname, device.ID,
 		); err != nil {
 			return nil, fmt.Errorf("update device: %w", err)
@@ -87,6 +135,15 @@ func (s *AuthService) Enroll(ctx context.Context, req *dto.EnrollRequest) (*dto.
 		return nil, fmt.Errorf("create token: %w", err)
 	}
 
+	if err = events.PublishDevice(ctx, tx, events.TypeDeviceEnrolled, events.Device{
+		DeviceID:       device.ID,
+		Hostname:       req.Hostname,
+		DepartmentID:   device.DepartmentID,
+		OrganizationID: device.OrganizationID,
+	}); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, fmt.Errorf("commit: %w", err)
 	}
@@ -97,31 +154,148 @@ func (s *AuthService) Enroll(ctx context.Context, req *dto.EnrollRequest) (*dto.
 	}, nil
 }
 
-// Login authenticates a dashboard user and returns a signed JWT string.
-func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest) (string, error) {
+// Login checks a dashboard user's password. The result carries the session JWT,
+// or an MFA challenge when the user must still present a second factor.
+// When LDAP is configured the directory is tried first; local accounts are only
+// consulted if the directory does not know the user or is unreachable and local
+// fallback is enabled. Directory users are locked out like local ones: a locked user
+// is refused before the directory is asked, and passwords it rejects count as failures.
+func (s *AuthService) Login(ctx context.Context, req *dto.LoginRequest, client ClientInfo) (*LoginResult, error) {
+	if s.ldap != nil {
+		dirUser := s.directoryUser(ctx, req.Username)
+		if dirUser != nil {
+			if err := s.checkLockout(dirUser); err != nil {
+				return nil, err
+			}
+		}
+
+		identity, err := s.ldap.Authenticate(ctx, req.Username, req.Password)
+		switch {
+		case err == nil:
+			user, err := s.provisionExternalUser(ctx, identity)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.checkLockout(user); err != nil {
+				return nil, err
+			}
+			s.resetLoginFailures(ctx, user)
+			return s.completeLogin(ctx, user, client)
+		case s.ldap.LocalFallback() && (errors.Is(err, ErrDirectoryUserNotFound) || errors.Is(err, ErrDirectoryUnavailable)):
+			if errors.Is(err, ErrDirectoryUnavailable) {
+				slog.Warn("ldap unavailable, falling back to local accounts", "error", err)
+			}
+		case errors.Is(err, ErrInvalidCredentials) && dirUser != nil:
+			return nil, s.recordLoginFailure(ctx, dirUser, fmt.Errorf("invalid credentials"))
+		default:
+			if !errors.Is(err, ErrInvalidCredentials) && !errors.Is(err, ErrDirectoryUserNotFound) {
+				slog.Warn("ldap authentication failed", "username", req.Username, "error", err)
+			}
+			return nil, fmt.Errorf("invalid credentials")
+		}
+	}
+
+	return s.loginLocal(ctx, req, client)
+}
+
+// directoryUser returns the local record of the LDAP user signing in as username, or
+// nil if they never signed in.
+func (s *AuthService) directoryUser(ctx context.Context, username string) *models.User {
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil || user.AuthProvider != AuthProviderLDAP {
+		return nil
+	}
+	return user
+}
+
+// loginLocal verifies a password against a local bcrypt account.
+// Locked accounts are refused without checking the password; failures count towards a lockout.
+func (s *AuthService) loginLocal(ctx context.Context, req *dto.LoginRequest, client ClientInfo) (*LoginResult, error) {
 	user, err := s.userRepo.GetByUsername(ctx, req.Username)
 	if err != nil {
-		return "", fmt.Errorf("invalid credentials")
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	// Externally provisioned users have no local password.
+	if user.AuthProvider != AuthProviderLocal {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return "", fmt.Errorf("invalid credentials")
+		return nil, s.recordLoginFailure(ctx, user, fmt.Errorf("invalid credentials"))
 	}
 
-	now := time.Now()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      user.ID.String(),
-		"username": user.Username,
-		"role":     user.Role,
-		"iat":      now.Unix(),
-		"exp":      now.Add(24 * time.Hour).Unix(),
-	})
+	s.resetLoginFailures(ctx, user)
+	return s.completeLogin(ctx, user, client)
+}
+
+// LoginExternal signs in a user asserted by an external identity provider.
+// The user is provisioned on first login; name and role are re-synced on every login.
+// Like a password login, the result carries an MFA challenge instead of the session
+// when the user has TOTP enabled or MFA_REQUIRED_FOR_ADMIN applies to them.
+func (s *AuthService) LoginExternal(ctx context.Context, identity *ExternalIdentity, client ClientInfo) (*LoginResult, error) {
+	user, err := s.provisionExternalUser(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+	return s.completeLogin(ctx, user, client)
+}
+
+// provisionExternalUser finds or creates the local user record for an external identity.
+func (s *AuthService) provisionExternalUser(ctx context.Context, identity *ExternalIdentity) (*models.User, error) {
+	if identity.Role != "admin" && identity.Role != "viewer" {
+		return nil, fmt.Errorf("invalid role: must be admin or viewer")
+	}
+
+	user, err := s.userRepo.GetByExternalID(ctx, identity.Provider, identity.Subject)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// A local account with the same username is never linked implicitly.
+		if _, err := s.userRepo.GetByUsername(ctx, identity.Username); err == nil {
+			return nil, fmt.Errorf("username %q is already taken by another account", identity.Username)
+		}
+
+		subject := identity.Subject
+		user = &models.User{
+			ID:             uuid.New(),
+			Username:       identity.Username,
+			Name:           identity.Name,
+			Role:           identity.Role,
+			AuthProvider:   identity.Provider,
+			ExternalID:     &subject,
+			OrganizationID: repository.DefaultOrganizationID,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("provision user: %w", err)
+		}
+		slog.Info("external user provisioned", "user_id", user.ID, "username", user.Username, "provider", identity.Provider)
+		return user, nil
+	case err != nil:
+		return nil, fmt.Errorf("lookup external user: %w", err)
+	}
 
-	return token.SignedString([]byte(s.jwtSecret))
+	if user.Username != identity.Username || user.Name != identity.Name || user.Role != identity.Role {
+		if err := s.userRepo.Update(ctx, user.ID, identity.Username, identity.Name, user.PasswordHash, identity.Role); err != nil {
+			return nil, fmt.Errorf("sync external user: %w", err)
+		}
+		user.Username, user.Name, user.Role = identity.Username, identity.Name, identity.Role
+	}
+	return user, nil
 }
 
-// CreateUser creates a new dashboard user with a bcrypt-hashed password.
-func (s *AuthService) CreateUser(ctx context.Context, username, name, password, role string) error {
+// CreateUser creates a new dashboard user of an organization with a bcrypt-hashed password.
+// When mustChangePassword is set the user has to choose a new password at the first login.
+func (s *AuthService) CreateUser(ctx context.Context, orgID uuid.UUID, username, name, password, role string, mustChangePassword, superAdmin bool) error {
+	if err := s.policy.Validate(username, password); err != nil {
+		return err
+	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return fmt.Errorf("hash password: %w", err)
@@ -132,30 +306,52 @@ func (s *AuthService) CreateUser(ctx context.Context, username, name, password,
 		role = "viewer"
 	}
 
-	// Validate role
-	if role != "admin" && role != "viewer" {
-		return fmt.Errorf("invalid role: must be admin or viewer")
+	if err := s.validateRole(ctx, role); err != nil {
+		return err
 	}
 
 	user := &models.User{
-		ID:           uuid.New(),
-		Username:     username,
-		Name:         name,
-		PasswordHash: string(hash),
-		Role:         role,
+		ID:                 uuid.New(),
+		Username:           username,
+		Name:               name,
+		PasswordHash:       string(hash),
+		Role:               role,
+		AuthProvider:       AuthProviderLocal,
+		MustChangePassword: mustChangePassword,
+		OrganizationID:     orgID,
+		SuperAdmin:         superAdmin,
 	}
 
-	return s.userRepo.Create(ctx, user)
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return err
+	}
+	return s.userRepo.AddPasswordHistory(ctx, user.ID, user.PasswordHash, s.policy.HistorySize())
+}
+
+// validateRole checks that a base role exists.
+func (s *AuthService) validateRole(ctx context.Context, role string) error {
+	if _, err := s.roleRepo.GetByName(ctx, role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("invalid role: %s", role)
+		}
+		return fmt.Errorf("get role: %w", err)
+	}
+	return nil
 }
 
 // UpdateUser updates a dashboard user's info. Only non-empty fields are applied.
-// Prevents a user from changing their own role (to avoid admin lock-out).
-func (s *AuthService) UpdateUser(ctx context.Context, requestingUserID, targetUserID uuid.UUID, username, name, password, role string) error {
+// Prevents a user from changing their own role or super-admin flag (to avoid admin
+// lock-out). superAdmin is nil when unchanged; callers allow it for super-admins only.
+// Changing the password, role or super-admin flag revokes all of the user's sessions.
+func (s *AuthService) UpdateUser(ctx context.Context, orgID, requestingUserID, targetUserID uuid.UUID, username, name, password, role string, superAdmin *bool) error {
 	// Fetch existing user.
-	user, err := s.userRepo.GetByID(ctx, targetUserID)
+	user, err := s.userRepo.GetInOrganization(ctx, targetUserID, orgID)
 	if err != nil {
 		return fmt.Errorf("user not found")
 	}
+	if err := s.checkSuperAdminTarget(ctx, requestingUserID, user); err != nil {
+		return err
+	}
 
 	// Apply only non-empty fields.
 	if username != "" {
@@ -164,37 +360,91 @@ func (s *AuthService) UpdateUser(ctx context.Context, requestingUserID, targetUs
 	if name != "" {
 		user.Name = name
 	}
+	newHash := ""
+	revokeReason := ""
 	if password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
-		if err != nil {
-			return fmt.Errorf("hash password: %w", err)
+		if user.AuthProvider != AuthProviderLocal {
+			return fmt.Errorf("cannot set a password for a %s user", user.AuthProvider)
+		}
+		if newHash, err = s.hashNewPassword(ctx, user, password); err != nil {
+			return err
 		}
-		user.PasswordHash = string(hash)
+		revokeReason = SessionRevokedPasswordChange
 	}
 	if role != "" {
 		// Prevent changing own role.
 		if requestingUserID == targetUserID {
 			return fmt.Errorf("cannot change your own role")
 		}
-		if role != "admin" && role != "viewer" {
-			return fmt.Errorf("invalid role: must be admin or viewer")
+		if err := s.validateRole(ctx, role); err != nil {
+			return err
+		}
+		if role != user.Role {
+			revokeReason = SessionRevokedRoleChange
 		}
 		user.Role = role
 	}
+	if superAdmin != nil && *superAdmin != user.SuperAdmin {
+		if requestingUserID == targetUserID {
+			return fmt.Errorf("cannot change your own super-admin flag")
+		}
+		if err := s.userRepo.SetSuperAdmin(ctx, targetUserID, *superAdmin); err != nil {
+			return err
+		}
+		revokeReason = SessionRevokedRoleChange
+	}
+
+	if err := s.userRepo.Update(ctx, targetUserID, user.Username, user.Name, user.PasswordHash, user.Role); err != nil {
+		return err
+	}
+	if newHash != "" {
+		if err := s.userRepo.SetPassword(ctx, targetUserID, newHash, false, s.policy.HistorySize()); err != nil {
+			return err
+		}
+	}
 
-	return s.userRepo.Update(ctx, targetUserID, user.Username, user.Name, user.PasswordHash, user.Role)
+	// A new password or role ends every existing session of the user.
+	if revokeReason != "" {
+		if _, err := s.sessions.RevokeAll(ctx, targetUserID, uuid.Nil, revokeReason); err != nil {
+			return fmt.Errorf("revoke sessions: %w", err)
+		}
+	}
+	return nil
 }
 
-// ListUsers returns all dashboard users.
-func (s *AuthService) ListUsers(ctx context.Context) ([]models.User, error) {
-	return s.userRepo.List(ctx)
+// ListUsers returns the dashboard users of an organization.
+func (s *AuthService) ListUsers(ctx context.Context, orgID uuid.UUID) ([]models.User, error) {
+	return s.userRepo.List(ctx, orgID)
 }
 
-// DeleteUser deletes a dashboard user by ID.
+// DeleteUser deletes a dashboard user of an organization by ID.
 // It prevents a user from deleting themselves.
-func (s *AuthService) DeleteUser(ctx context.Context, requestingUserID, targetUserID uuid.UUID) error {
+func (s *AuthService) DeleteUser(ctx context.Context, orgID, requestingUserID, targetUserID uuid.UUID) error {
 	if requestingUserID == targetUserID {
 		return fmt.Errorf("cannot delete your own account")
 	}
-	return s.userRepo.Delete(ctx, targetUserID)
+	user, err := s.userRepo.GetInOrganization(ctx, targetUserID, orgID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if err := s.checkSuperAdminTarget(ctx, requestingUserID, user); err != nil {
+		return err
+	}
+	return s.userRepo.Delete(ctx, targetUserID, orgID)
+}
+
+// checkSuperAdminTarget refuses to let a user who is not a super-admin manage a
+// super-admin. requestingUserID is uuid.Nil for the CLI, which is always allowed.
+func (s *AuthService) checkSuperAdminTarget(ctx context.Context, requestingUserID uuid.UUID, target *models.User) error {
+	if !target.SuperAdmin || requestingUserID == uuid.Nil {
+		return nil
+	}
+	requester, err := s.userRepo.GetByID(ctx, requestingUserID)
+	if err != nil {
+		return fmt.Errorf("get requesting user: %w", err)
+	}
+	if !requester.SuperAdmin {
+		return ErrSuperAdminTarget
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/database"
+	"inventario/server/internal/repository"
+	"inventario/server/migrations"
+	"inventario/shared/dto"
+)
+
+// newTestAuthService returns an AuthService over a new SQLite database, with a lockout
+// after 3 failures.
+func newTestAuthService(t *testing.T, ldapAuth *LDAPAuthenticator, mfaCfg config.MFAConfig) (*AuthService, *repository.Stores) {
+	t.Helper()
+	url := "sqlite://" + filepath.Join(t.TempDir(), "inventario.db")
+	database.RunMigrations(url, migrations.SQLite)
+	db, err := database.Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	stores := repository.NewStores(db, "test-chain-key")
+	policy, err := NewPasswordPolicy(config.PasswordConfig{MinLength: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const secret = "test-jwt-secret-0123456789abcdef"
+	sessions := NewSessionService(stores.Sessions, stores.Users, config.SessionConfig{IdleTimeout: time.Hour, MaxLifetime: 24 * time.Hour}, secret)
+	lockout := config.LockoutConfig{Threshold: 3, Duration: 15 * time.Minute, MaxDuration: time.Hour}
+	auth := NewAuthService(db, stores.Users, stores.Organizations, stores.Tokens, stores.MFA, stores.Roles, sessions, ldapAuth, policy, mfaCfg, lockout, secret)
+	return auth, stores
+}
+
+func TestLoginLDAPLockout(t *testing.T) {
+	dir, url := newFakeDirectory(t, testDirectoryEntries()...)
+	auth, stores := newTestAuthService(t, NewLDAPAuthenticator(testLDAPConfig(url)), config.MFAConfig{})
+	ctx := context.Background()
+	const bruno = "CN=Bruno Lima,OU=Users,DC=corp,DC=local"
+	login := func(password string) (*LoginResult, error) {
+		return auth.Login(ctx, &dto.LoginRequest{Username: "bruno", Password: password}, ClientInfo{IP: "127.0.0.1"})
+	}
+
+	// The first login provisions the local record that failures are counted on.
+	res, err := login("bruno-pass")
+	if err != nil || res.Token == "" {
+		t.Fatalf("first login = %+v, %v; want a session", res, err)
+	}
+	if res.User.AuthProvider != AuthProviderLDAP || res.User.Role != "viewer" {
+		t.Fatalf("provisioned user = %s/%s, want ldap/viewer", res.User.AuthProvider, res.User.Role)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err := login("wrong"); err == nil || err.Error() != "invalid credentials" {
+			t.Fatalf("failure %d = %v, want invalid credentials", i, err)
+		}
+	}
+	var locked *AccountLockedError
+	if _, err := login("wrong"); !errors.As(err, &locked) || !locked.New {
+		t.Fatalf("third failure = %v, want a new AccountLockedError", err)
+	}
+
+	// While locked even the right password is refused, without asking the directory.
+	binds := dir.bindCount(bruno)
+	if _, err := login("bruno-pass"); !errors.As(err, &locked) || locked.New {
+		t.Fatalf("login while locked = %v, want AccountLockedError", err)
+	}
+	if n := dir.bindCount(bruno); n != binds {
+		t.Errorf("login while locked bound as the user %d times", n-binds)
+	}
+
+	if err := auth.UnlockUser(ctx, repository.DefaultOrganizationID, uuid.Nil, res.User.ID); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = login("bruno-pass"); err != nil || res.Token == "" {
+		t.Fatalf("login after unlock = %+v, %v; want a session", res, err)
+	}
+	user, err := stores.Users.GetByID(ctx, res.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FailedLoginAttempts != 0 || user.LockedUntil != nil {
+		t.Errorf("after a successful login failed_login_attempts = %d, locked_until = %v; want 0, nil", user.FailedLoginAttempts, user.LockedUntil)
+	}
+}
+
+func TestSuperAdminTargets(t *testing.T) {
+	auth, stores := newTestAuthService(t, nil, config.MFAConfig{})
+	ctx := context.Background()
+	org := repository.DefaultOrganizationID
+	userID := func(username string, superAdmin bool) uuid.UUID {
+		t.Helper()
+		if err := auth.CreateUser(ctx, org, username, username, "Test#Pass1234", "admin", false, superAdmin); err != nil {
+			t.Fatal(err)
+		}
+		user, err := stores.Users.GetByUsername(ctx, username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return user.ID
+	}
+	root := userID("root", true)
+	admin := userID("admin", false)
+	boss := userID("boss", true)
+	clerk := userID("clerk", false)
+
+	ops := []struct {
+		name string
+		run  func(requester, target uuid.UUID) error
+	}{
+		{"update", func(requester, target uuid.UUID) error {
+			return auth.UpdateUser(ctx, org, requester, target, "", "Renamed", "", "", nil)
+		}},
+		{"unlock", func(requester, target uuid.UUID) error {
+			return auth.UnlockUser(ctx, org, requester, target)
+		}},
+		{"reset mfa", func(requester, target uuid.UUID) error {
+			return auth.ResetMFA(ctx, org, requester, target)
+		}},
+		{"delete", func(requester, target uuid.UUID) error {
+			return auth.DeleteUser(ctx, org, requester, target)
+		}},
+	}
+
+	// An admin manages ordinary users but not super-admins; a super-admin manages both.
+	for _, op := range ops {
+		if err := op.run(admin, boss); !errors.Is(err, ErrSuperAdminTarget) {
+			t.Errorf("%s of a super-admin by an admin = %v, want ErrSuperAdminTarget", op.name, err)
+		}
+	}
+	if _, err := stores.Users.GetByID(ctx, boss); err != nil {
+		t.Fatalf("super-admin after refused delete: %v", err)
+	}
+	for _, op := range ops {
+		if err := op.run(admin, clerk); err != nil {
+			t.Errorf("%s of a user by an admin = %v, want nil", op.name, err)
+		}
+		if err := op.run(root, boss); err != nil {
+			t.Errorf("%s of a super-admin by a super-admin = %v, want nil", op.name, err)
+		}
+	}
+}
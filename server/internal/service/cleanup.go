@@ -2,110 +2,118 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"inventario/server/internal/archive"
 	"inventario/server/internal/repository"
+	"inventario/shared/dto"
+	"inventario/shared/models"
 )
 
-// CleanupService handles scheduled data retention and housekeeping tasks.
+// ErrInvalidRetentionPolicy is returned for a retention policy of an unknown dataset,
+// with an activity type outside device_activity_log, or set twice.
+var ErrInvalidRetentionPolicy = errors.New("invalid retention policy")
+
+// CleanupService handles data retention and housekeeping tasks. It runs as the
+// "cleanup" job of the scheduler (see RunJob).
 type CleanupService struct {
-	repo          *repository.CleanupRepository
+	repo      repository.CleanupStore
+	auditRepo repository.AuditLogStore
+	policies  repository.RetentionStore
+	archiver  *archive.Archiver // nil when purged history is not archived
+
+	mu            sync.Mutex // guards the settings below, changed by Configure
 	retentionDays int
 	inactiveDays  int
-	interval      time.Duration
-	stopCh        chan struct{}
 }
 
 // NewCleanupService creates a new CleanupService.
-// retentionDays: records older than this are purged (default 90).
-// inactiveDays: devices not seen for this many days are marked inactive (default 30).
-// interval: how often the cleanup runs (default 24h).
-func NewCleanupService(repo *repository.CleanupRepository, retentionDays, inactiveDays int, interval time.Duration) *CleanupService {
+// retentionDays: records older than this are purged (default 90), unless a retention
+// policy or the organization sets another retention.
+// inactiveDays: devices not seen for this many days are marked inactive (default 30),
+// unless their department or organization sets another threshold.
+// archiver, if not nil, archives the purged audit logs and device history.
+func NewCleanupService(repo repository.CleanupStore, auditRepo repository.AuditLogStore, policies repository.RetentionStore, archiver *archive.Archiver, retentionDays, inactiveDays int) *CleanupService {
 	if retentionDays <= 0 {
 		retentionDays = 90
 	}
 	if inactiveDays <= 0 {
 		inactiveDays = 30
 	}
-	if interval <= 0 {
-		interval = 24 * time.Hour
-	}
 	return &CleanupService{
 		repo:          repo,
+		auditRepo:     auditRepo,
+		policies:      policies,
+		archiver:      archiver,
 		retentionDays: retentionDays,
 		inactiveDays:  inactiveDays,
-		interval:      interval,
-		stopCh:        make(chan struct{}),
 	}
 }
 
-// Start begins the periodic cleanup loop in a background goroutine.
-// Call Stop() to terminate it gracefully.
-func (s *CleanupService) Start() {
-	// Run once immediately at startup
-	go func() {
-		s.runCleanup()
-
-		ticker := time.NewTicker(s.interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				s.runCleanup()
-			case <-s.stopCh:
-				slog.Info("cleanup service stopped")
-				return
-			}
-		}
-	}()
+// Configure replaces the default retention and the inactive threshold on
+// configuration reloads; they apply from the next run.
+func (s *CleanupService) Configure(retentionDays, inactiveDays int) {
+	if retentionDays <= 0 || inactiveDays <= 0 {
+		return
+	}
+	s.mu.Lock()
+	changed := retentionDays != s.retentionDays || inactiveDays != s.inactiveDays
+	s.retentionDays, s.inactiveDays = retentionDays, inactiveDays
+	s.mu.Unlock()
 
-	slog.Info("cleanup service started",
-		"retention_days", s.retentionDays,
-		"inactive_days", s.inactiveDays,
-		"interval", s.interval.String(),
-	)
+	if changed {
+		slog.Info("cleanup service reconfigured",
+			"retention_days", retentionDays,
+			"inactive_days", inactiveDays,
+		)
+	}
 }
 
-// Stop signals the cleanup goroutine to terminate.
-func (s *CleanupService) Stop() {
-	close(s.stopCh)
+// settings returns the default retention and the inactive threshold.
+func (s *CleanupService) settings() (retentionDays, inactiveDays int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retentionDays, s.inactiveDays
 }
 
-func (s *CleanupService) runCleanup() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
-
-	slog.Info("running scheduled data cleanup")
+// RunJob is the work of the "cleanup" job: it runs the cleanup, logs what it did and
+// returns the report as the job's result.
+func (s *CleanupService) RunJob(ctx context.Context) (any, error) {
+	retentionDays, inactiveDays := s.settings()
+	slog.Info("running scheduled data cleanup", "retention_days", retentionDays, "inactive_days", inactiveDays)
 
-	// 1. Count before
+	// Count before
 	auditBefore, activityBefore, hwBefore, err := s.repo.CountRecords(ctx)
 	if err != nil {
 		slog.Error("cleanup: failed to count records", "error", err)
 	}
 
-	// 2. Purge old data
-	result, err := s.repo.PurgeOldData(ctx, s.retentionDays)
-	if err != nil {
-		slog.Error("cleanup: failed to purge old data", "error", err)
-		return
+	report, err := s.Run(ctx)
+	if report == nil {
+		return nil, fmt.Errorf("purge old data: %w", err)
 	}
-
-	// 3. Mark inactive devices
-	inactiveCount, err := s.repo.MarkInactiveDevices(ctx, s.inactiveDays)
-	if err != nil {
-		slog.Error("cleanup: failed to mark inactive devices", "error", err)
+	if report.Archive != "" {
+		slog.Info("cleanup: purged history archived", "archive", report.Archive, "location", s.archiver.String())
 	}
 
-	// 4. Log results
-	totalPurged := result.AuditLogs + result.ActivityLogs + result.HardwareHistory
-	if totalPurged > 0 || inactiveCount > 0 {
+	// Log results
+	if report.Total() > 0 || report.SnapshotsCleared > 0 || report.InactiveDevices > 0 {
 		slog.Info("cleanup completed",
-			"audit_logs_purged", result.AuditLogs,
-			"activity_logs_purged", result.ActivityLogs,
-			"hardware_history_purged", result.HardwareHistory,
-			"devices_marked_inactive", inactiveCount,
+			"audit_logs_purged", report.AuditLogs,
+			"activity_logs_purged", report.ActivityLogs,
+			"hardware_history_purged", report.HardwareHistory,
+			"metrics_purged", report.Metrics,
+			"snapshots_cleared", report.SnapshotsCleared,
+			"sessions_purged", report.Sessions,
+			"rate_limits_purged", report.RateLimits,
+			"update_reports_purged", report.UpdateReports,
+			"devices_marked_inactive", report.InactiveDevices,
 			"audit_before", auditBefore,
 			"activity_before", activityBefore,
 			"hardware_before", hwBefore,
@@ -113,4 +121,161 @@ func (s *CleanupService) runCleanup() {
 	} else {
 		slog.Debug("cleanup completed — nothing to purge")
 	}
+	return report, err
+}
+
+// CleanupReport is the outcome of a cleanup run.
+type CleanupReport struct {
+	AuditLogs       int64 `json:"audit_logs_purged"`
+	ActivityLogs    int64 `json:"activity_logs_purged"`
+	HardwareHistory int64 `json:"hardware_history_purged"`
+	Metrics         int64 `json:"metrics_purged"`
+	Sessions        int64 `json:"sessions_purged"`
+	RateLimits      int64 `json:"rate_limits_purged"`
+	UpdateReports   int64 `json:"update_reports_purged"`
+	InactiveDevices int64 `json:"devices_marked_inactive"`
+	// SnapshotsCleared counts the hardware_history rows whose snapshot was cleared; the
+	// rows are kept, so they are not in Total.
+	SnapshotsCleared int64  `json:"snapshots_cleared"`
+	Archive          string `json:"archive,omitempty"` // ID of the archive of the purged rows
+}
+
+// Total returns the number of rows purged.
+func (r *CleanupReport) Total() int64 {
+	return r.AuditLogs + r.ActivityLogs + r.HardwareHistory + r.Metrics + r.Sessions + r.RateLimits + r.UpdateReports
+}
+
+// Run runs the cleanup once, now: it purges the rows past their retention, archiving
+// them first when configured, and marks inactive devices. The report is nil when the
+// purge fails; a failure of the later steps is returned with the report of the others.
+func (s *CleanupService) Run(ctx context.Context) (*CleanupReport, error) {
+	retentionDays, inactiveDays := s.settings()
+
+	// 1. Purge old data, archiving it first when configured; audit logs leave a signed
+	// checkpoint in their hash chain
+	var ar repository.Archiver
+	var run *archive.Run
+	if s.archiver != nil {
+		run = s.archiver.Begin(retentionDays)
+		ar = run
+	}
+	result, err := s.repo.PurgeOldData(ctx, retentionDays, ar)
+	if err != nil {
+		return nil, err
+	}
+	report := &CleanupReport{
+		ActivityLogs:    result.ActivityLogs,
+		HardwareHistory: result.HardwareHistory,
+		Metrics:         result.Metrics,
+		Sessions:        result.Sessions,
+		RateLimits:      result.RateLimits,
+		UpdateReports:   result.UpdateReports,
+
+		SnapshotsCleared: result.Snapshots,
+	}
+
+	var errs []error
+	auditCutoff, err := s.auditCutoff(ctx)
+	if err == nil {
+		report.AuditLogs, err = s.auditRepo.PurgeBefore(ctx, auditCutoff, "retention", ar)
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("purge audit logs: %w", err))
+	}
+
+	// 2. Mark inactive devices
+	if report.InactiveDevices, err = s.repo.MarkInactiveDevices(ctx, inactiveDays); err != nil {
+		errs = append(errs, fmt.Errorf("mark inactive devices: %w", err))
+	}
+
+	if run != nil && !run.Empty() {
+		report.Archive = run.ID()
+	}
+	return report, errors.Join(errs...)
+}
+
+// auditCutoff returns the creation time before which audit entries are purged, from
+// the audit_logs retention policy or the default retention.
+func (s *CleanupService) auditCutoff(ctx context.Context) (time.Time, error) {
+	policies, err := s.policies.List(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	days, _ := s.settings()
+	for _, p := range policies {
+		if p.Dataset == "audit_logs" {
+			days = p.RetentionDays
+		}
+	}
+	return time.Now().AddDate(0, 0, -days), nil
+}
+
+// Policies returns the retention policies and the defaults of datasets without one.
+func (s *CleanupService) Policies(ctx context.Context) (*dto.RetentionPolicyListResponse, error) {
+	policies, err := s.policies.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	retentionDays, inactiveDays := s.settings()
+	return &dto.RetentionPolicyListResponse{
+		Policies:             policies,
+		Datasets:             repository.RetentionDatasets,
+		DefaultRetentionDays: retentionDays,
+		DefaultInactiveDays:  inactiveDays,
+	}, nil
+}
+
+// ReplacePolicies validates policies and replaces the retention policies with them.
+// They take effect on the next cleanup run.
+func (s *CleanupService) ReplacePolicies(ctx context.Context, policies []models.RetentionPolicy) ([]models.RetentionPolicy, error) {
+	seen := map[[2]string]bool{}
+	for i := range policies {
+		p := &policies[i]
+		p.ActivityType = strings.TrimSpace(p.ActivityType)
+		if !slices.Contains(repository.RetentionDatasets, p.Dataset) {
+			return nil, fmt.Errorf("%w: unknown dataset %q", ErrInvalidRetentionPolicy, p.Dataset)
+		}
+		if p.ActivityType != "" && p.Dataset != "device_activity_log" {
+			return nil, fmt.Errorf("%w: only device_activity_log policies may set an activity type", ErrInvalidRetentionPolicy)
+		}
+		key := [2]string{p.Dataset, p.ActivityType}
+		if seen[key] {
+			name := p.Dataset
+			if p.ActivityType != "" {
+				name += " (" + p.ActivityType + ")"
+			}
+			return nil, fmt.Errorf("%w: %s is set twice", ErrInvalidRetentionPolicy, name)
+		}
+		seen[key] = true
+	}
+	return s.policies.Replace(ctx, policies)
+}
+
+// Preview counts the rows the cleanup would delete and the devices it would mark
+// inactive if it ran now, with the current policies.
+func (s *CleanupService) Preview(ctx context.Context) (*dto.RetentionPreviewResponse, error) {
+	auditCutoff, err := s.auditCutoff(ctx)
+	if err != nil {
+		return nil, err
+	}
+	retentionDays, inactiveDays := s.settings()
+	p, err := s.repo.PreviewPurge(ctx, retentionDays, inactiveDays, auditCutoff)
+	if err != nil {
+		return nil, err
+	}
+	resp := &dto.RetentionPreviewResponse{
+		AuditLogs:             p.AuditLogs,
+		ActivityLogsByType:    p.ActivityLogs,
+		HardwareHistory:       p.HardwareHistory,
+		Metrics:               p.Metrics,
+		SnapshotsCleared:      p.Snapshots,
+		Sessions:              p.Sessions,
+		UpdateReports:         p.UpdateReports,
+		DevicesMarkedInactive: p.InactiveDevices,
+	}
+	for _, n := range p.ActivityLogs {
+		resp.ActivityLogs += n
+	}
+	resp.Total = resp.AuditLogs + resp.ActivityLogs + resp.HardwareHistory + resp.Metrics + resp.Sessions + resp.UpdateReports
+	return resp, nil
 }
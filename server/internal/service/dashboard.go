@@ -4,31 +4,32 @@ import (
 	"context"
 	"fmt"
 
+	"inventario/server/internal/authz"
 	"inventario/server/internal/repository"
 	"inventario/shared/dto"
 )
 
 // DashboardService handles dashboard statistics business logic.
 type DashboardService struct {
-	dashboardRepo *repository.DashboardRepository
+	dashboardRepo repository.DashboardStore
 }
 
 // NewDashboardService creates a new DashboardService.
-func NewDashboardService(repo *repository.DashboardRepository) *DashboardService {
+func NewDashboardService(repo repository.DashboardStore) *DashboardService {
 	return &DashboardService{dashboardRepo: repo}
 }
 
-// GetStats returns aggregated dashboard statistics.
-func (s *DashboardService) GetStats(ctx context.Context) (*dto.DashboardStatsResponse, error) {
-	total, online, inactive, err := s.dashboardRepo.GetStats(ctx)
+// GetStats returns aggregated dashboard statistics for the devices within the scope.
+func (s *DashboardService) GetStats(ctx context.Context, scope authz.Scope) (*dto.DashboardStatsResponse, error) {
+	total, online, agentless, inactive, err := s.dashboardRepo.GetStats(ctx, scope)
 	if err != nil {
 		return nil, fmt.Errorf("get stats: %w", err)
 	}
 
-	offline := total - online
+	offline := total - online - agentless
 
 	// OS distribution
-	osRows, err := s.dashboardRepo.GetOSDistribution(ctx)
+	osRows, err := s.dashboardRepo.GetOSDistribution(ctx, scope)
 	if err != nil {
 		return nil, fmt.Errorf("get os distribution: %w", err)
 	}
@@ -38,7 +39,7 @@ func (s *DashboardService) GetStats(ctx context.Context) (*dto.DashboardStatsRes
 	}
 
 	// Recent devices
-	recentRows, err := s.dashboardRepo.GetRecentDevices(ctx, 5)
+	recentRows, err := s.dashboardRepo.GetRecentDevices(ctx, 5, scope)
 	if err != nil {
 		return nil, fmt.Errorf("get recent devices: %w", err)
 	}
@@ -49,12 +50,13 @@ func (s *DashboardService) GetStats(ctx context.Context) (*dto.DashboardStatsRes
 			Hostname: r.Hostname,
 			OSName:   r.OSName,
 			Status:   r.Status,
+			Online:   r.Online,
 			LastSeen: r.LastSeen.Format("2006-01-02T15:04:05Z"),
 		}
 	}
 
 	// Top software
-	swRows, err := s.dashboardRepo.GetTopSoftware(ctx, 8)
+	swRows, err := s.dashboardRepo.GetTopSoftware(ctx, 8, scope)
 	if err != nil {
 		return nil, fmt.Errorf("get top software: %w", err)
 	}
@@ -67,6 +69,7 @@ func (s *DashboardService) GetStats(ctx context.Context) (*dto.DashboardStatsRes
 		Total:          total,
 		Online:         online,
 		Offline:        offline,
+		Agentless:      agentless,
 		Inactive:       inactive,
 		OSDistribution: osDist,
 		RecentDevices:  recent,
@@ -15,17 +15,17 @@ import (
 
 // DepartmentService handles department business logic.
 type DepartmentService struct {
-	deptRepo *repository.DepartmentRepository
+	deptRepo repository.DepartmentStore
 }
 
 // NewDepartmentService creates a new DepartmentService.
-func NewDepartmentService(repo *repository.DepartmentRepository) *DepartmentService {
+func NewDepartmentService(repo repository.DepartmentStore) *DepartmentService {
 	return &DepartmentService{deptRepo: repo}
 }
 
-// List returns all departments.
-func (s *DepartmentService) List(ctx context.Context) (*dto.DepartmentListResponse, error) {
-	departments, err := s.deptRepo.List(ctx)
+// List returns the departments of an organization.
+func (s *DepartmentService) List(ctx context.Context, orgID uuid.UUID) (*dto.DepartmentListResponse, error) {
+	departments, err := s.deptRepo.List(ctx, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("list departments: %w", err)
 	}
@@ -35,18 +35,19 @@ func (s *DepartmentService) List(ctx context.Context) (*dto.DepartmentListRespon
 	}, nil
 }
 
-// Create adds a new department.
-func (s *DepartmentService) Create(ctx context.Context, name string) (*models.Department, error) {
-	dept, err := s.deptRepo.Create(ctx, name)
+// Create adds a new department to an organization. A nil inactiveDays uses the
+// organization's threshold.
+func (s *DepartmentService) Create(ctx context.Context, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error) {
+	dept, err := s.deptRepo.Create(ctx, orgID, name, inactiveDays)
 	if err != nil {
 		return nil, fmt.Errorf("create department: %w", err)
 	}
 	return dept, nil
 }
 
-// Update renames a department.
-func (s *DepartmentService) Update(ctx context.Context, id uuid.UUID, name string) (*models.Department, error) {
-	dept, err := s.deptRepo.Update(ctx, id, name)
+// Update renames a department of an organization and replaces its inactive threshold.
+func (s *DepartmentService) Update(ctx context.Context, id, orgID uuid.UUID, name string, inactiveDays *int) (*models.Department, error) {
+	dept, err := s.deptRepo.Update(ctx, id, orgID, name, inactiveDays)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("department not found")
@@ -56,7 +57,7 @@ func (s *DepartmentService) Update(ctx context.Context, id uuid.UUID, name strin
 	return dept, nil
 }
 
-// Delete removes a department.
-func (s *DepartmentService) Delete(ctx context.Context, id uuid.UUID) error {
-	return s.deptRepo.Delete(ctx, id)
+// Delete removes a department of an organization.
+func (s *DepartmentService) Delete(ctx context.Context, id, orgID uuid.UUID) error {
+	return s.deptRepo.Delete(ctx, id, orgID)
 }
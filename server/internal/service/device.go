@@ -5,27 +5,41 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	"github.com/google/uuid"
 
+	"inventario/server/internal/authz"
 	"inventario/server/internal/repository"
 	"inventario/shared/dto"
 	"inventario/shared/models"
 )
 
 // DeviceService handles device listing and detail queries.
+// Every method takes the caller's authz.Scope for the permission the operation needs.
 type DeviceService struct {
-	deviceRepo *repository.DeviceRepository
+	deviceRepo repository.DeviceStore
+	deptRepo   repository.DepartmentStore
 }
 
+// ErrDepartmentOutOfScope is returned when a device would be moved to a department
+// the caller may not manage.
+var ErrDepartmentOutOfScope = errors.New("department outside your scope")
+
+// Custom attribute names and value sizes, shared by imports and manual assets.
+var attributeName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+const maxAttributeValue = 1024
+
 // NewDeviceService creates a new DeviceService.
-func NewDeviceService(repo *repository.DeviceRepository) *DeviceService {
-	return &DeviceService{deviceRepo: repo}
+func NewDeviceService(repo repository.DeviceStore, deptRepo repository.DepartmentStore) *DeviceService {
+	return &DeviceService{deviceRepo: repo, deptRepo: deptRepo}
 }
 
 // ListDevices returns devices with pagination, filtering, and sorting.
-func (s *DeviceService) ListDevices(ctx context.Context, p repository.ListParams) (*dto.DeviceListResponse, error) {
-	result, err := s.deviceRepo.List(ctx, p)
+func (s *DeviceService) ListDevices(ctx context.Context, p repository.ListParams, scope authz.Scope) (*dto.DeviceListResponse, error) {
+	result, err := s.deviceRepo.List(ctx, p, scope)
 	if err != nil {
 		return nil, fmt.Errorf("list devices: %w", err)
 	}
@@ -38,22 +52,28 @@ func (s *DeviceService) ListDevices(ctx context.Context, p repository.ListParams
 }
 
 // GetDeviceDetail returns a device with all its related data.
-func (s *DeviceService) GetDeviceDetail(ctx context.Context, id uuid.UUID) (*dto.DeviceDetailResponse, error) {
-	return s.buildDeviceDetail(ctx, id)
+func (s *DeviceService) GetDeviceDetail(ctx context.Context, id uuid.UUID, scope authz.Scope) (*dto.DeviceDetailResponse, error) {
+	return s.buildDeviceDetail(ctx, id, scope)
 }
 
 // GetDeviceDetailByHostname returns a device detail looked up by hostname.
-func (s *DeviceService) GetDeviceDetailByHostname(ctx context.Context, hostname string) (*dto.DeviceDetailResponse, error) {
-	device, err := s.deviceRepo.GetByHostname(ctx, hostname)
+func (s *DeviceService) GetDeviceDetailByHostname(ctx context.Context, hostname string, scope authz.Scope) (*dto.DeviceDetailResponse, error) {
+	device, err := s.deviceRepo.GetByHostname(ctx, hostname, scope)
 	if err != nil {
 		return nil, fmt.Errorf("device not found")
 	}
-	return s.buildDeviceDetail(ctx, device.ID)
+	return s.buildDeviceDetail(ctx, device.ID, scope)
 }
 
-// ResolveDeviceID resolves a hostname to its UUID.
-func (s *DeviceService) ResolveDeviceID(ctx context.Context, hostname string) (uuid.UUID, error) {
-	device, err := s.deviceRepo.GetByHostname(ctx, hostname)
+// ResolveDeviceID resolves a UUID or hostname to the UUID of a device within the scope.
+func (s *DeviceService) ResolveDeviceID(ctx context.Context, idOrHostname string, scope authz.Scope) (uuid.UUID, error) {
+	var device *models.Device
+	var err error
+	if id, parseErr := uuid.Parse(idOrHostname); parseErr == nil {
+		device, err = s.deviceRepo.GetByID(ctx, id, scope)
+	} else {
+		device, err = s.deviceRepo.GetByHostname(ctx, idOrHostname, scope)
+	}
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("device not found")
 	}
@@ -61,8 +81,8 @@ func (s *DeviceService) ResolveDeviceID(ctx context.Context, hostname string) (u
 }
 
 // buildDeviceDetail fetches a device and all related data by UUID.
-func (s *DeviceService) buildDeviceDetail(ctx context.Context, id uuid.UUID) (*dto.DeviceDetailResponse, error) {
-	device, err := s.deviceRepo.GetByID(ctx, id)
+func (s *DeviceService) buildDeviceDetail(ctx context.Context, id uuid.UUID, scope authz.Scope) (*dto.DeviceDetailResponse, error) {
+	device, err := s.deviceRepo.GetByID(ctx, id, scope)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("device not found")
@@ -105,18 +125,27 @@ func (s *DeviceService) buildDeviceDetail(ctx context.Context, id uuid.UUID) (*d
 }
 
 // UpdateStatus changes the status of a device (active / inactive).
-func (s *DeviceService) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
-	return s.deviceRepo.UpdateStatus(ctx, id, status)
+func (s *DeviceService) UpdateStatus(ctx context.Context, id uuid.UUID, status string, scope authz.Scope) error {
+	return s.deviceRepo.UpdateStatus(ctx, id, status, scope)
 }
 
 // UpdateDepartment changes the department assignment for a device.
-func (s *DeviceService) UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID) error {
-	return s.deviceRepo.UpdateDepartment(ctx, id, deptID)
+// The target department must also be within the scope.
+func (s *DeviceService) UpdateDepartment(ctx context.Context, id uuid.UUID, deptID *uuid.UUID, scope authz.Scope) error {
+	if err := s.checkDepartment(ctx, deptID, scope); err != nil {
+		return err
+	}
+	return s.deviceRepo.UpdateDepartment(ctx, id, deptID, scope)
+}
+
+// Export streams the rows of an export dataset for the devices matching the filters.
+func (s *DeviceService) Export(ctx context.Context, dataset string, p repository.ListParams, scope authz.Scope, row func([]any) error) error {
+	return s.deviceRepo.Export(ctx, dataset, p, scope, row)
 }
 
-// ListForExport returns all devices matching the filters (no pagination) for CSV export.
-func (s *DeviceService) ListForExport(ctx context.Context, p repository.ListParams) ([]models.Device, error) {
-	return s.deviceRepo.ListForExport(ctx, p)
+// ExportCount returns the number of rows Export would stream.
+func (s *DeviceService) ExportCount(ctx context.Context, dataset string, p repository.ListParams, scope authz.Scope) (int, error) {
+	return s.deviceRepo.ExportCount(ctx, dataset, p, scope)
 }
 
 // GetHardwareHistory returns hardware change records for a device, with optional component filtering and pagination.
@@ -124,28 +153,52 @@ func (s *DeviceService) GetHardwareHistory(ctx context.Context, id uuid.UUID, co
 	return s.deviceRepo.GetHardwareHistory(ctx, id, component, limit, offset)
 }
 
+// GetMetrics returns the metrics samples of a device recorded since the given time.
+func (s *DeviceService) GetMetrics(ctx context.Context, id uuid.UUID, since time.Time) ([]models.DeviceMetric, error) {
+	return s.deviceRepo.GetMetrics(ctx, id, since)
+}
+
 // BulkUpdateStatus changes the status of multiple devices at once.
-func (s *DeviceService) BulkUpdateStatus(ctx context.Context, ids []uuid.UUID, status string) (int64, error) {
-	return s.deviceRepo.BulkUpdateStatus(ctx, ids, status)
+func (s *DeviceService) BulkUpdateStatus(ctx context.Context, ids []uuid.UUID, status string, scope authz.Scope) (int64, error) {
+	return s.deviceRepo.BulkUpdateStatus(ctx, ids, status, scope)
 }
 
 // BulkUpdateDepartment sets the department for multiple devices.
-func (s *DeviceService) BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID) (int64, error) {
-	return s.deviceRepo.BulkUpdateDepartment(ctx, ids, deptID)
+// Devices outside the scope are skipped; the target department must be within it.
+func (s *DeviceService) BulkUpdateDepartment(ctx context.Context, ids []uuid.UUID, deptID *uuid.UUID, scope authz.Scope) (int64, error) {
+	if err := s.checkDepartment(ctx, deptID, scope); err != nil {
+		return 0, err
+	}
+	return s.deviceRepo.BulkUpdateDepartment(ctx, ids, deptID, scope)
+}
+
+// checkDepartment returns ErrDepartmentOutOfScope unless the target department (nil =
+// none) is within the scope and belongs to the scope's organization.
+func (s *DeviceService) checkDepartment(ctx context.Context, deptID *uuid.UUID, scope authz.Scope) error {
+	if !scope.Allows(deptID) {
+		return ErrDepartmentOutOfScope
+	}
+	if deptID != nil && scope.OrganizationID != uuid.Nil {
+		if _, err := s.deptRepo.GetByID(ctx, *deptID, scope.OrganizationID); err != nil {
+			return ErrDepartmentOutOfScope
+		}
+	}
+	return nil
 }
 
 // BulkDelete removes multiple devices and all their related data.
-func (s *DeviceService) BulkDelete(ctx context.Context, ids []uuid.UUID) (int64, error) {
-	return s.deviceRepo.BulkDelete(ctx, ids)
+// Devices outside the scope are skipped.
+func (s *DeviceService) BulkDelete(ctx context.Context, ids []uuid.UUID, scope authz.Scope) (int64, error) {
+	return s.deviceRepo.BulkDelete(ctx, ids, scope)
 }
 
 // DeleteDevice removes a device and all its related data. Returns the device info for audit logging.
-func (s *DeviceService) DeleteDevice(ctx context.Context, id uuid.UUID) (*models.Device, error) {
-	device, err := s.deviceRepo.GetByID(ctx, id)
+func (s *DeviceService) DeleteDevice(ctx context.Context, id uuid.UUID, scope authz.Scope) (*models.Device, error) {
+	device, err := s.deviceRepo.GetByID(ctx, id, scope)
 	if err != nil {
 		return nil, fmt.Errorf("device not found")
 	}
-	if err := s.deviceRepo.Delete(ctx, id); err != nil {
+	if err := s.deviceRepo.Delete(ctx, id, scope); err != nil {
 		return nil, fmt.Errorf("delete device: %w", err)
 	}
 	return device, nil
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/importer"
+	"inventario/server/internal/repository"
+	"inventario/shared/dto"
+	"inventario/shared/models"
+)
+
+// ImportMaxRows is the number of data rows an import file may have.
+const ImportMaxRows = 10_000
+
+// ErrInvalidImport is wrapped by errors about the file as a whole, such as a bad header.
+var ErrInvalidImport = errors.New("invalid import file")
+
+// ImportOptions controls a device import.
+type ImportOptions struct {
+	DryRun bool
+	// CreateMissing creates an import record for rows that match no device.
+	CreateMissing bool
+	// Audit, if set, builds the audit entry of a committed import from its details,
+	// which is written in the import's transaction.
+	Audit func(details map[string]interface{}) *models.AuditLog
+}
+
+const (
+	importAttrPrefix = "attr."
+	// importClear in the department column removes the device's department.
+	importClear = "-"
+)
+
+// importColumns maps the known columns of an import file to their index (-1 = absent).
+type importColumns struct {
+	serial, hostname, department, status int
+	attrs                                map[int]string // column index → attribute name
+}
+
+// importRow is a parsed data row.
+type importRow struct {
+	result     dto.DeviceImportRow
+	serial     string
+	hostname   string
+	department string
+	status     string
+	attrs      map[string]string
+}
+
+// Import validates the rows of an import file (header first) against the devices in
+// scope and, unless opts.DryRun is set or a row fails, applies them in one transaction.
+// Rows are matched by serial number, or by hostname when the serial number is empty.
+func (s *DeviceService) Import(ctx context.Context, rows []importer.Row, opts ImportOptions, scope authz.Scope) (*dto.DeviceImportResponse, error) {
+	if len(rows) < 2 {
+		return nil, fmt.Errorf("%w: the file has no data rows", ErrInvalidImport)
+	}
+	cols, err := parseImportHeader(rows[0].Cells)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := make([]*importRow, 0, len(rows)-1)
+	var serials, hostnames []string
+	for _, r := range rows[1:] {
+		row := cols.parse(r)
+		parsed = append(parsed, row)
+		if row.serial != "" {
+			serials = append(serials, row.serial)
+		} else if row.hostname != "" {
+			hostnames = append(hostnames, strings.ToLower(row.hostname))
+		}
+	}
+
+	candidates, err := s.deviceRepo.ImportCandidates(ctx, serials, hostnames, scope.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	bySerial := make(map[string]*models.Device, len(candidates))
+	byHostname := make(map[string][]*models.Device, len(candidates))
+	for i := range candidates {
+		d := &candidates[i]
+		bySerial[d.SerialNumber] = d
+		byHostname[strings.ToLower(d.Hostname)] = append(byHostname[strings.ToLower(d.Hostname)], d)
+	}
+
+	departments, err := s.deptRepo.List(ctx, scope.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	deptByID := make(map[uuid.UUID]*models.Department, len(departments))
+	deptByName := make(map[string]*models.Department, len(departments))
+	for i := range departments {
+		deptByID[departments[i].ID] = &departments[i]
+		deptByName[strings.ToLower(departments[i].Name)] = &departments[i]
+	}
+	deptName := func(id *uuid.UUID) string {
+		if id == nil {
+			return "(none)"
+		}
+		if d, ok := deptByID[*id]; ok {
+			return d.Name
+		}
+		return id.String()
+	}
+
+	resp := &dto.DeviceImportResponse{DryRun: opts.DryRun, Total: len(parsed), Rows: make([]dto.DeviceImportRow, 0, len(parsed))}
+	var changes []repository.ImportChange
+	created := make(map[int]uuid.UUID) // index in resp.Rows → ID of the device it creates
+	seen := make(map[string]int)       // match key → first row using it
+
+	for _, row := range parsed {
+		res := &row.result
+		addErr := func(format string, args ...any) { res.Errors = append(res.Errors, fmt.Sprintf(format, args...)) }
+
+		key := "serial:" + row.serial
+		if row.serial == "" {
+			key = "hostname:" + strings.ToLower(row.hostname)
+		}
+		if res.Key != "" {
+			if first, dup := seen[key]; dup {
+				addErr("duplicate of row %d", first)
+			} else {
+				seen[key] = res.Row
+			}
+		}
+
+		ch := repository.ImportChange{Attributes: row.attrs}
+		if row.status != "" {
+			status := strings.ToLower(row.status)
+			if status != "active" && status != "inactive" {
+				addErr("invalid status %q, must be active or inactive", row.status)
+			}
+			ch.Status = &status
+		}
+		if row.department != "" {
+			ch.SetDepartment = true
+			if row.department != importClear {
+				dept, ok := deptByName[strings.ToLower(row.department)]
+				if id, err := uuid.Parse(row.department); err == nil {
+					dept, ok = deptByID[id]
+				}
+				if !ok {
+					addErr("unknown department %q", row.department)
+				} else {
+					ch.DepartmentID = &dept.ID
+				}
+			}
+		}
+
+		// Find the device the row refers to.
+		var device *models.Device
+		ambiguous := false
+		if row.serial != "" {
+			device = bySerial[row.serial]
+		} else if matches := byHostname[strings.ToLower(row.hostname)]; len(matches) > 1 {
+			addErr("hostname matches %d devices, use serial_number", len(matches))
+			ambiguous = true
+		} else if len(matches) == 1 {
+			device = matches[0]
+		}
+
+		switch {
+		case res.Key == "" || ambiguous:
+			// Already reported.
+		case device != nil && !scope.Allows(device.DepartmentID):
+			addErr("device is outside your scope")
+		case device != nil:
+			ch.DeviceID = device.ID
+			if ch.SetDepartment && !scope.Allows(ch.DepartmentID) {
+				addErr("%s", ErrDepartmentOutOfScope)
+			}
+			res.Changes = deviceImportChanges(device, &ch, deptName)
+		case !opts.CreateMissing:
+			addErr("no device matches %s", res.Key)
+		case row.serial == "" || row.hostname == "":
+			addErr("creating a device requires serial_number and hostname")
+		case !scope.Allows(ch.DepartmentID):
+			addErr("%s", ErrDepartmentOutOfScope)
+		default:
+			ch.Create = true
+			ch.DeviceID = uuid.New()
+			ch.Hostname = row.hostname
+			ch.SerialNumber = row.serial
+			res.Changes = append([]string{"hostname: " + row.hostname}, deviceImportChanges(&models.Device{}, &ch, deptName)...)
+		}
+
+		switch {
+		case len(res.Errors) > 0:
+			res.Action = "error"
+			resp.Failed++
+		case ch.Create:
+			res.Action = "create"
+			resp.Created++
+			changes = append(changes, ch)
+			created[len(resp.Rows)] = ch.DeviceID
+		case len(res.Changes) > 0:
+			res.Action = "update"
+			res.DeviceID = &ch.DeviceID
+			resp.Updated++
+			changes = append(changes, ch)
+		default:
+			res.Action = "unchanged"
+			res.DeviceID = &ch.DeviceID
+			resp.Unchanged++
+		}
+		resp.Rows = append(resp.Rows, *res)
+	}
+
+	if opts.DryRun || resp.Failed > 0 {
+		return resp, nil
+	}
+
+	var audit *models.AuditLog
+	if opts.Audit != nil {
+		createdIDs, updatedIDs := []uuid.UUID{}, []uuid.UUID{}
+		for _, ch := range changes {
+			if ch.Create {
+				createdIDs = append(createdIDs, ch.DeviceID)
+			} else {
+				updatedIDs = append(updatedIDs, ch.DeviceID)
+			}
+		}
+		audit = opts.Audit(map[string]interface{}{
+			"rows":        resp.Total,
+			"created":     resp.Created,
+			"updated":     resp.Updated,
+			"unchanged":   resp.Unchanged,
+			"created_ids": createdIDs,
+			"updated_ids": updatedIDs,
+		})
+	}
+	if len(changes) > 0 || audit != nil {
+		if err := s.deviceRepo.ApplyImport(ctx, changes, scope, audit); err != nil {
+			return nil, fmt.Errorf("apply import: %w", err)
+		}
+	}
+	resp.Committed = true
+	// Created devices only report their ID once it exists.
+	for i, id := range created {
+		resp.Rows[i].DeviceID = &id
+	}
+	return resp, nil
+}
+
+// parseImportHeader maps the header cells to columns. Column names are matched
+// case-insensitively; attribute columns are "attr.<name>".
+func parseImportHeader(header []string) (importColumns, error) {
+	cols := importColumns{serial: -1, hostname: -1, department: -1, status: -1, attrs: make(map[int]string)}
+	seen := make(map[string]bool, len(header))
+	for i, cell := range header {
+		name := strings.ToLower(cell)
+		if name == "" {
+			continue
+		}
+		if strings.HasPrefix(name, importAttrPrefix) {
+			attr := cell[len(importAttrPrefix):]
+			if !attributeName.MatchString(attr) {
+				return cols, fmt.Errorf("%w: invalid attribute column %q (names are 1-64 letters, digits, '.', '_' or '-')", ErrInvalidImport, cell)
+			}
+			name = importAttrPrefix + attr
+			cols.attrs[i] = attr
+		} else {
+			switch name {
+			case "serial_number":
+				cols.serial = i
+			case "hostname":
+				cols.hostname = i
+			case "department":
+				cols.department = i
+			case "status":
+				cols.status = i
+			default:
+				return cols, fmt.Errorf("%w: unknown column %q", ErrInvalidImport, cell)
+			}
+		}
+		if seen[name] {
+			return cols, fmt.Errorf("%w: duplicate column %q", ErrInvalidImport, cell)
+		}
+		seen[name] = true
+	}
+	if cols.serial < 0 && cols.hostname < 0 {
+		return cols, fmt.Errorf("%w: a serial_number or hostname column is required", ErrInvalidImport)
+	}
+	return cols, nil
+}
+
+// parse reads the known columns of a data row. Empty cells leave the field unchanged.
+func (c importColumns) parse(r importer.Row) *importRow {
+	cell := func(i int) string {
+		if i < 0 || i >= len(r.Cells) {
+			return ""
+		}
+		return r.Cells[i]
+	}
+
+	row := &importRow{
+		serial:     cell(c.serial),
+		hostname:   cell(c.hostname),
+		department: cell(c.department),
+		status:     cell(c.status),
+	}
+	row.result.Row = r.Number
+	row.result.Key = row.serial
+	if row.serial == "" {
+		row.result.Key = row.hostname
+	}
+	if row.result.Key == "" {
+		row.result.Errors = append(row.result.Errors, "serial_number or hostname is required")
+	}
+	if len(row.serial) > 255 || len(row.hostname) > 255 {
+		row.result.Errors = append(row.result.Errors, "serial_number and hostname are limited to 255 characters")
+	}
+
+	for i, name := range c.attrs {
+		v := cell(i)
+		if v == "" {
+			continue
+		}
+		if len(v) > maxAttributeValue {
+			row.result.Errors = append(row.result.Errors, fmt.Sprintf("attribute %s is longer than %d characters", name, maxAttributeValue))
+			continue
+		}
+		if row.attrs == nil {
+			row.attrs = make(map[string]string)
+		}
+		row.attrs[name] = v
+	}
+	return row
+}
+
+// deviceImportChanges describes what ch changes on device, dropping the fields it
+// would set to their current value from ch.
+func deviceImportChanges(device *models.Device, ch *repository.ImportChange, deptName func(*uuid.UUID) string) []string {
+	var out []string
+	if ch.Status != nil {
+		if *ch.Status == device.Status {
+			ch.Status = nil
+		} else {
+			out = append(out, fmt.Sprintf("status: %s → %s", orNone(device.Status), *ch.Status))
+		}
+	}
+	if ch.SetDepartment {
+		if sameDepartment(device.DepartmentID, ch.DepartmentID) {
+			ch.SetDepartment = false
+		} else {
+			out = append(out, fmt.Sprintf("department: %s → %s", deptName(device.DepartmentID), deptName(ch.DepartmentID)))
+		}
+	}
+
+	current := map[string]any{}
+	if len(device.CustomAttributes) > 0 {
+		_ = json.Unmarshal(device.CustomAttributes, &current)
+	}
+	names := make([]string, 0, len(ch.Attributes))
+	for name := range ch.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		old, ok := current[name].(string)
+		if ok && old == ch.Attributes[name] {
+			delete(ch.Attributes, name)
+			continue
+		}
+		out = append(out, fmt.Sprintf("%s%s: %s → %s", importAttrPrefix, name, orNone(old), ch.Attributes[name]))
+	}
+	return out
+}
+
+func sameDepartment(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
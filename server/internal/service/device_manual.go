@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/shared/dto"
+)
+
+// ErrAgentDevice is returned when editing a device whose data is reported by its agent.
+var ErrAgentDevice = errors.New("device is managed by its agent")
+
+// ErrInvalidAsset is wrapped by validation errors of a manual asset.
+var ErrInvalidAsset = errors.New("invalid asset")
+
+// CreateManualAsset creates an agentless device (source "manual") in a department
+// within the scope and returns its details.
+func (s *DeviceService) CreateManualAsset(ctx context.Context, req *dto.ManualAssetRequest, scope authz.Scope) (*dto.DeviceDetailResponse, error) {
+	if err := normalizeManualAsset(req); err != nil {
+		return nil, err
+	}
+	if err := s.checkDepartment(ctx, req.DepartmentID, scope); err != nil {
+		return nil, err
+	}
+
+	id := uuid.New()
+	if err := s.deviceRepo.SaveManual(ctx, id, true, req, scope); err != nil {
+		return nil, err
+	}
+	return s.buildDeviceDetail(ctx, id, scope)
+}
+
+// UpdateManualAsset replaces the editable fields, hardware and network interfaces of
+// an agentless device. Agent devices are rejected with ErrAgentDevice: their agent
+// would overwrite the changes on the next report.
+func (s *DeviceService) UpdateManualAsset(ctx context.Context, id uuid.UUID, req *dto.ManualAssetRequest, scope authz.Scope) (*dto.DeviceDetailResponse, error) {
+	if err := normalizeManualAsset(req); err != nil {
+		return nil, err
+	}
+	device, err := s.deviceRepo.GetByID(ctx, id, scope)
+	if err != nil {
+		return nil, fmt.Errorf("device not found")
+	}
+	if device.Source == "agent" {
+		return nil, ErrAgentDevice
+	}
+	if err := s.checkDepartment(ctx, req.DepartmentID, scope); err != nil {
+		return nil, err
+	}
+
+	if err := s.deviceRepo.SaveManual(ctx, id, false, req, scope); err != nil {
+		return nil, err
+	}
+	return s.buildDeviceDetail(ctx, id, scope)
+}
+
+// normalizeManualAsset trims the request and checks what binding tags cannot express:
+// attribute names, MAC and IP addresses and the hardware field sizes. MAC addresses
+// are rewritten as AA:BB:CC:DD:EE:FF, like the agent reports them.
+func normalizeManualAsset(req *dto.ManualAssetRequest) error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidAsset, fmt.Sprintf(format, args...))
+	}
+
+	req.Hostname = strings.TrimSpace(req.Hostname)
+	req.SerialNumber = strings.TrimSpace(req.SerialNumber)
+	req.AssetType = strings.TrimSpace(req.AssetType)
+	if req.Hostname == "" || req.SerialNumber == "" {
+		return invalid("hostname and serial_number are required")
+	}
+
+	for name, value := range req.CustomAttributes {
+		if !attributeName.MatchString(name) {
+			return invalid("attribute name %q must be 1-64 letters, digits, '.', '_' or '-'", name)
+		}
+		if len(value) > maxAttributeValue {
+			return invalid("attribute %s is longer than %d characters", name, maxAttributeValue)
+		}
+	}
+
+	if hw := req.Hardware; hw != nil {
+		for _, v := range []string{hw.CPUModel, hw.MotherboardManufacturer, hw.MotherboardProduct,
+			hw.MotherboardSerial, hw.BIOSVendor, hw.BIOSVersion} {
+			if len(v) > 255 {
+				return invalid("hardware fields are limited to 255 characters")
+			}
+		}
+		if hw.CPUCores < 0 || hw.CPUThreads < 0 || hw.RAMTotalBytes < 0 {
+			return invalid("hardware counts must not be negative")
+		}
+	}
+
+	for i := range req.NetworkInterfaces {
+		n := &req.NetworkInterfaces[i]
+		if len(n.Name) > 255 {
+			return invalid("network interface names are limited to 255 characters")
+		}
+		if n.MACAddress != "" {
+			mac, err := net.ParseMAC(n.MACAddress)
+			if err != nil || len(mac) != 6 {
+				return invalid("invalid MAC address %q", n.MACAddress)
+			}
+			n.MACAddress = strings.ToUpper(mac.String())
+		}
+		if n.IPv4Address != "" {
+			if ip := net.ParseIP(n.IPv4Address); ip == nil || ip.To4() == nil {
+				return invalid("invalid IPv4 address %q", n.IPv4Address)
+			}
+		}
+		if n.IPv6Address != "" {
+			if ip := net.ParseIP(n.IPv6Address); ip == nil || ip.To4() != nil || len(n.IPv6Address) > 45 {
+				return invalid("invalid IPv6 address %q", n.IPv6Address)
+			}
+		}
+		if n.SpeedMbps != nil && *n.SpeedMbps < 0 {
+			return invalid("speed_mbps must not be negative")
+		}
+	}
+	return nil
+}
@@ -12,11 +12,11 @@ import (
 
 // InventoryService orchestrates the inventory submission workflow.
 type InventoryService struct {
-	inventoryRepo *repository.InventoryRepository
+	inventoryRepo repository.InventoryStore
 }
 
 // NewInventoryService creates a new InventoryService.
-func NewInventoryService(repo *repository.InventoryRepository) *InventoryService {
+func NewInventoryService(repo repository.InventoryStore) *InventoryService {
 	return &InventoryService{inventoryRepo: repo}
 }
 
@@ -24,3 +24,8 @@ func NewInventoryService(repo *repository.InventoryRepository) *InventoryService
 func (s *InventoryService) ProcessInventory(ctx context.Context, deviceID uuid.UUID, req *dto.InventoryRequest) error {
 	return s.inventoryRepo.Save(ctx, deviceID, req)
 }
+
+// Heartbeat records a heartbeat from the given device.
+func (s *InventoryService) Heartbeat(ctx context.Context, deviceID uuid.UUID, req *dto.HeartbeatRequest) error {
+	return s.inventoryRepo.Heartbeat(ctx, deviceID, req)
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"inventario/server/internal/config"
+)
+
+// AuthProviderLDAP marks users provisioned through LDAP / Active Directory.
+const AuthProviderLDAP = "ldap"
+
+var (
+	// ErrDirectoryUserNotFound is returned when the username does not exist in the directory.
+	ErrDirectoryUserNotFound = errors.New("user not found in directory")
+	// ErrDirectoryUnavailable is returned when the directory cannot be reached or searched.
+	ErrDirectoryUnavailable = errors.New("directory unavailable")
+	// ErrInvalidCredentials is returned when the directory rejects the user's password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// LDAPAuthenticator verifies passwords by binding to an LDAP / Active Directory server
+// and maps the user's group memberships to a dashboard role.
+type LDAPAuthenticator struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAPAuthenticator creates a new LDAPAuthenticator.
+func NewLDAPAuthenticator(cfg config.LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{cfg: cfg}
+}
+
+// LocalFallback reports whether local accounts may be tried when the directory cannot vouch for a user.
+func (a *LDAPAuthenticator) LocalFallback() bool {
+	return a.cfg.LocalFallback
+}
+
+// Authenticate looks the user up with the service account, binds as the user to verify
+// the password and reads their groups. The role is re-derived on every call.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*ExternalIdentity, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service bind: %v", ErrDirectoryUnavailable, err)
+		}
+	}
+
+	attributes := []string{a.cfg.UsernameAttribute, a.cfg.NameAttribute, a.cfg.GroupAttribute}
+	if a.cfg.IDAttribute != "" {
+		attributes = append(attributes, a.cfg.IDAttribute)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.UserBaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(a.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: search user: %v", ErrDirectoryUnavailable, err)
+	}
+	switch len(result.Entries) {
+	case 0:
+		return nil, ErrDirectoryUserNotFound
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: filter matched %d entries", ErrDirectoryUnavailable, len(result.Entries))
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: user bind: %v", ErrDirectoryUnavailable, err)
+	}
+
+	role := a.mapRole(entry.GetAttributeValues(a.cfg.GroupAttribute))
+	if role == "" {
+		return nil, fmt.Errorf("user %q is in no mapped group", username)
+	}
+
+	localUsername := entry.GetAttributeValue(a.cfg.UsernameAttribute)
+	if localUsername == "" {
+		localUsername = username
+	}
+
+	return &ExternalIdentity{
+		Provider: AuthProviderLDAP,
+		Subject:  a.subject(entry),
+		Username: localUsername,
+		Name:     entry.GetAttributeValue(a.cfg.NameAttribute),
+		Role:     role,
+	}, nil
+}
+
+// dial connects to the directory, upgrading the connection with StartTLS when configured.
+func (a *LDAPAuthenticator) dial(ctx context.Context) (*ldap.Conn, error) {
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: a.cfg.InsecureSkipVerify, //nolint:gosec // configurable for lab directories
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Timeout: a.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(tlsCfg))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDirectoryUnavailable, err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: start tls: %v", ErrDirectoryUnavailable, err)
+		}
+	}
+	return conn, nil
+}
+
+// mapRole returns the role for the given group DNs. Admin groups take precedence.
+func (a *LDAPAuthenticator) mapRole(groups []string) string {
+	for _, g := range groups {
+		if containsDN(a.cfg.AdminGroups, g) {
+			return "admin"
+		}
+	}
+	for _, g := range groups {
+		if containsDN(a.cfg.ViewerGroups, g) {
+			return "viewer"
+		}
+	}
+	return a.cfg.DefaultRole
+}
+
+// subject returns the stable identifier used to link the directory entry to a local user.
+// Binary attributes such as objectGUID are hex-encoded.
+func (a *LDAPAuthenticator) subject(entry *ldap.Entry) string {
+	if a.cfg.IDAttribute != "" {
+		if raw := entry.GetRawAttributeValue(a.cfg.IDAttribute); len(raw) > 0 {
+			if utf8.Valid(raw) {
+				return string(raw)
+			}
+			return hex.EncodeToString(raw)
+		}
+	}
+	return strings.ToLower(entry.DN)
+}
+
+// containsDN compares distinguished names case-insensitively, ignoring spaces after commas.
+func containsDN(list []string, dn string) bool {
+	norm := normalizeDN(dn)
+	for _, item := range list {
+		if normalizeDN(item) == norm {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+
+	"inventario/server/internal/config"
+)
+
+const (
+	testServiceDN       = "cn=svc-inventario,ou=service,dc=corp,dc=local"
+	testServicePassword = "svc-secret"
+	testAdminGroup      = "CN=Inventario Admins,OU=Groups,DC=corp,DC=local"
+	testViewerGroup     = "CN=Helpdesk,OU=Groups,DC=corp,DC=local"
+)
+
+// directoryEntry is a user of fakeDirectory.
+type directoryEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeDirectory is an LDAP server that answers the simple binds and searches an
+// LDAPAuthenticator sends. Searches need a bind as the service account, like in Active
+// Directory, and match the sAMAccountName in the filter case-insensitively.
+type fakeDirectory struct {
+	entries []directoryEntry
+
+	mu    sync.Mutex
+	binds map[string]int // successful and failed binds by DN
+}
+
+func newFakeDirectory(t *testing.T, entries ...directoryEntry) (*fakeDirectory, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	d := &fakeDirectory{entries: entries, binds: map[string]int{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d, "ldap://" + ln.Addr().String()
+}
+
+// bindCount returns the number of binds as dn.
+func (d *fakeDirectory) bindCount(dn string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.binds[dn]
+}
+
+func (d *fakeDirectory) serve(conn net.Conn) {
+	defer conn.Close()
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := d.bind(dn, password)
+			if code == ldap.LDAPResultSuccess {
+				boundDN = dn
+			}
+			writeMessage(conn, id, ldapResult(ldap.ApplicationBindResponse, code, ""))
+		case ldap.ApplicationSearchRequest:
+			if boundDN != testServiceDN {
+				writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights, "bind as the service account first"))
+				continue
+			}
+			baseDN, _ := op.Children[0].Value.(string)
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, err.Error()))
+				continue
+			}
+			for _, e := range d.search(baseDN, filter) {
+				writeMessage(conn, id, searchEntry(e))
+			}
+			writeMessage(conn, id, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess, ""))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			writeMessage(conn, id, ldapResult(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "unsupported operation"))
+		}
+	}
+}
+
+func (d *fakeDirectory) bind(dn, password string) uint16 {
+	d.mu.Lock()
+	d.binds[dn]++
+	d.mu.Unlock()
+
+	if dn == testServiceDN && password == testServicePassword {
+		return ldap.LDAPResultSuccess
+	}
+	for _, e := range d.entries {
+		if e.dn == dn && e.password == password && password != "" {
+			return ldap.LDAPResultSuccess
+		}
+	}
+	return ldap.LDAPResultInvalidCredentials
+}
+
+func (d *fakeDirectory) search(baseDN, filter string) []directoryEntry {
+	var found []directoryEntry
+	for _, e := range d.entries {
+		if !strings.HasSuffix(strings.ToLower(e.dn), ","+strings.ToLower(baseDN)) {
+			continue
+		}
+		for _, name := range e.attributes["sAMAccountName"] {
+			if strings.Contains(strings.ToLower(filter), "(samaccountname="+strings.ToLower(name)+")") {
+				found = append(found, e)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func writeMessage(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.NewSequence("LDAP Message")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	msg.AppendChild(op)
+	_, _ = conn.Write(msg.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code uint16, message string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	return op
+}
+
+func searchEntry(e directoryEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "DN"))
+	attributes := ber.NewSequence("Attributes")
+	for name, values := range e.attributes {
+		attribute := ber.NewSequence("Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return op
+}
+
+// objectGUID is the binary objectGUID of testDirectoryEntries' ana.
+var objectGUID = string([]byte{0x4f, 0x9a, 0x00, 0xd2, 0xff, 0x10, 0x4e, 0x2b, 0x91, 0x7c, 0x0a, 0x55, 0xe3, 0x01, 0xbe, 0x8c})
+
+func testDirectoryEntries() []directoryEntry {
+	return []directoryEntry{
+		{
+			dn:       "CN=Ana Souza,OU=Users,DC=corp,DC=local",
+			password: "ana-pass",
+			attributes: map[string][]string{
+				"sAMAccountName": {"ana"},
+				"displayName":    {"Ana Souza"},
+				"objectGUID":     {objectGUID},
+				// Written differently from the configuration; admin wins over viewer.
+				"memberOf": {"cn=helpdesk, ou=groups, dc=corp, dc=local", "cn=inventario admins, ou=groups, dc=corp, dc=local"},
+			},
+		},
+		{
+			dn:       "CN=Bruno Lima,OU=Users,DC=corp,DC=local",
+			password: "bruno-pass",
+			attributes: map[string][]string{
+				"sAMAccountName": {"bruno"},
+				"displayName":    {"Bruno Lima"},
+				"memberOf":       {testViewerGroup},
+			},
+		},
+		{
+			dn:       "CN=Carla Dias,OU=Users,DC=corp,DC=local",
+			password: "carla-pass",
+			attributes: map[string][]string{
+				"sAMAccountName": {"carla"},
+				"displayName":    {"Carla Dias"},
+				"memberOf":       {"CN=Finance,OU=Groups,DC=corp,DC=local"},
+			},
+		},
+	}
+}
+
+func testLDAPConfig(url string) config.LDAPConfig {
+	return config.LDAPConfig{
+		URL:               url,
+		Timeout:           5 * time.Second,
+		BindDN:            testServiceDN,
+		BindPassword:      testServicePassword,
+		UserBaseDN:        "OU=Users,DC=corp,DC=local",
+		UserFilter:        "(&(objectClass=user)(sAMAccountName=%s))",
+		UsernameAttribute: "sAMAccountName",
+		NameAttribute:     "displayName",
+		IDAttribute:       "objectGUID",
+		GroupAttribute:    "memberOf",
+		AdminGroups:       []string{testAdminGroup},
+		ViewerGroups:      []string{testViewerGroup},
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	dir, url := newFakeDirectory(t, testDirectoryEntries()...)
+
+	tests := []struct {
+		name     string
+		cfg      func(*config.LDAPConfig)
+		username string
+		password string
+		want     *ExternalIdentity
+		wantErr  error  // checked with errors.Is
+		errText  string // checked when wantErr is nil
+	}{
+		{
+			name: "admin group wins", username: "ana", password: "ana-pass",
+			want: &ExternalIdentity{Provider: AuthProviderLDAP, Subject: hex.EncodeToString([]byte(objectGUID)), Username: "ana", Name: "Ana Souza", Role: "admin"},
+		},
+		{
+			// The local username is the directory's, not what the user typed.
+			name: "viewer group", username: "BRUNO", password: "bruno-pass",
+			want: &ExternalIdentity{Provider: AuthProviderLDAP, Subject: "cn=bruno lima,ou=users,dc=corp,dc=local", Username: "bruno", Name: "Bruno Lima", Role: "viewer"},
+		},
+		{name: "no mapped group", username: "carla", password: "carla-pass", errText: `user "carla" is in no mapped group`},
+		{
+			name: "default role", cfg: func(c *config.LDAPConfig) { c.DefaultRole = "viewer" }, username: "carla", password: "carla-pass",
+			want: &ExternalIdentity{Provider: AuthProviderLDAP, Subject: "cn=carla dias,ou=users,dc=corp,dc=local", Username: "carla", Name: "Carla Dias", Role: "viewer"},
+		},
+		{name: "wrong password", username: "ana", password: "wrong", wantErr: ErrInvalidCredentials},
+		{name: "empty password", username: "ana", password: "", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "daniel", password: "x", wantErr: ErrDirectoryUserNotFound},
+		{name: "filter is escaped", username: "ana)(sAMAccountName=bruno", password: "bruno-pass", wantErr: ErrDirectoryUserNotFound},
+		{name: "outside the base DN", cfg: func(c *config.LDAPConfig) { c.UserBaseDN = "OU=Staff,DC=corp,DC=local" }, username: "ana", password: "ana-pass", wantErr: ErrDirectoryUserNotFound},
+		{name: "wrong service password", cfg: func(c *config.LDAPConfig) { c.BindPassword = "wrong" }, username: "ana", password: "ana-pass", wantErr: ErrDirectoryUnavailable},
+		{name: "directory down", cfg: func(c *config.LDAPConfig) { c.URL = "ldap://127.0.0.1:1" }, username: "ana", password: "ana-pass", wantErr: ErrDirectoryUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testLDAPConfig(url)
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			got, err := NewLDAPAuthenticator(cfg).Authenticate(context.Background(), tt.username, tt.password)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Authenticate = %+v, %v; want %v", got, err, tt.wantErr)
+				}
+			case tt.errText != "":
+				if err == nil || err.Error() != tt.errText {
+					t.Fatalf("Authenticate = %+v, %v; want error %q", got, err, tt.errText)
+				}
+			case err != nil:
+				t.Fatalf("Authenticate: %v", err)
+			case *got != *tt.want:
+				t.Errorf("Authenticate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	// Only "admin group wins" and "wrong password" bind as ana: an empty password would
+	// be an anonymous bind and must not reach the directory.
+	if n := dir.bindCount("CN=Ana Souza,OU=Users,DC=corp,DC=local"); n != 2 {
+		t.Errorf("binds as ana = %d, want 2", n)
+	}
+}
@@ -0,0 +1,422 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/totp"
+	"inventario/shared/models"
+)
+
+const (
+	// mfaChallengeTTL bounds the time between the password step and the second factor.
+	mfaChallengeTTL = 5 * time.Minute
+
+	mfaPurposeVerify = "mfa_verify" // user has TOTP enabled and must present a code
+	mfaPurposeSetup  = "mfa_setup"  // user must enroll TOTP before a session is issued
+
+	// totpSkew is the number of 30-second steps of clock drift accepted on either side.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+// Second-factor methods reported for auditing.
+const (
+	MFAMethodTOTP         = "totp"
+	MFAMethodRecoveryCode = "recovery_code"
+)
+
+var (
+	// ErrInvalidMFAChallenge is returned when the login challenge is missing, expired or of the wrong kind.
+	ErrInvalidMFAChallenge = errors.New("invalid or expired login challenge")
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong or was already used.
+	ErrInvalidMFACode = errors.New("invalid verification code")
+)
+
+// LoginResult is the outcome of a successful password check.
+// Either Token is set, or PasswordChange or MFA describes the next step the user must complete.
+type LoginResult struct {
+	User           *models.User
+	Token          string
+	ExpiresAt      time.Time // when Token expires at the latest (the session may end earlier when idle)
+	PasswordChange string    // challenge for choosing a new password before anything else
+	MFA            *MFAChallenge
+}
+
+// MFAChallenge is the short-lived token handed to the client between the
+// password step and the second factor.
+type MFAChallenge struct {
+	Token         string
+	SetupRequired bool // the user must enroll TOTP first because MFA is mandatory for their role
+}
+
+// TOTPEnrollment holds a pending TOTP secret shown to the user once.
+type TOTPEnrollment struct {
+	Secret          string
+	ProvisioningURI string
+}
+
+// MFAStatus describes a user's second-factor state.
+type MFAStatus struct {
+	Enabled                bool
+	Required               bool
+	RecoveryCodesRemaining int
+}
+
+type mfaChallengeClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// completeLogin issues the session token, or a challenge when the password must be changed
+// or a second factor is needed.
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, client ClientInfo) (*LoginResult, error) {
+	if user.MustChangePassword && user.AuthProvider == AuthProviderLocal {
+		challenge, err := s.issueChallenge(user, passwordChangePurpose)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, PasswordChange: challenge}, nil
+	}
+
+	purpose := ""
+	switch {
+	case user.TOTPEnabled:
+		purpose = mfaPurposeVerify
+	case s.mfaRequired(user):
+		purpose = mfaPurposeSetup
+	}
+
+	if purpose == "" {
+		token, expiresAt, err := s.sessions.Create(ctx, user, client)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{User: user, Token: token, ExpiresAt: expiresAt}, nil
+	}
+
+	challenge, err := s.issueChallenge(user, purpose)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginResult{
+		User: user,
+		MFA:  &MFAChallenge{Token: challenge, SetupRequired: purpose == mfaPurposeSetup},
+	}, nil
+}
+
+// mfaRequired reports whether the configuration makes TOTP mandatory for the user's role.
+func (s *AuthService) mfaRequired(user *models.User) bool {
+	return s.mfaCfg.RequiredForAdmin && user.Role == "admin"
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code and issues the session token.
+// It also returns the method used so callers can audit recovery code use.
+func (s *AuthService) VerifyMFA(ctx context.Context, challenge, code string, client ClientInfo) (*LoginResult, string, error) {
+	user, err := s.userFromChallenge(ctx, challenge, mfaPurposeVerify)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return &LoginResult{User: user}, "", err
+	}
+
+	method, err := s.verifySecondFactor(ctx, user, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			err = s.recordLoginFailure(ctx, user, err)
+		}
+		return &LoginResult{User: user}, method, err
+	}
+	s.resetLoginFailures(ctx, user)
+
+	token, expiresAt, err := s.sessions.Create(ctx, user, client)
+	if err != nil {
+		return nil, method, err
+	}
+	return &LoginResult{User: user, Token: token, ExpiresAt: expiresAt}, method, nil
+}
+
+// BeginMFASetup starts the mandatory TOTP enrollment of a user who has only passed the password step.
+func (s *AuthService) BeginMFASetup(ctx context.Context, challenge string) (*TOTPEnrollment, *models.User, error) {
+	user, err := s.userFromChallenge(ctx, challenge, mfaPurposeSetup)
+	if err != nil {
+		return nil, nil, err
+	}
+	enrollment, err := s.beginEnrollment(ctx, user)
+	if err != nil {
+		return nil, user, err
+	}
+	return enrollment, user, nil
+}
+
+// CompleteMFASetup confirms the mandatory TOTP enrollment and issues the session token.
+// The recovery codes are returned in plain text exactly once.
+func (s *AuthService) CompleteMFASetup(ctx context.Context, challenge, code string, client ClientInfo) (*LoginResult, []string, error) {
+	user, err := s.userFromChallenge(ctx, challenge, mfaPurposeSetup)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := s.confirmEnrollment(ctx, user, code)
+	if err != nil {
+		return &LoginResult{User: user}, nil, err
+	}
+
+	token, expiresAt, err := s.sessions.Create(ctx, user, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &LoginResult{User: user, Token: token, ExpiresAt: expiresAt}, codes, nil
+}
+
+// GetMFAStatus returns the second-factor state of a user.
+func (s *AuthService) GetMFAStatus(ctx context.Context, userID uuid.UUID) (*MFAStatus, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	status := &MFAStatus{Enabled: user.TOTPEnabled, Required: s.mfaRequired(user)}
+	if user.TOTPEnabled {
+		status.RecoveryCodesRemaining, err = s.mfaRepo.CountRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginTOTPEnrollment generates a pending TOTP secret for a signed-in user.
+func (s *AuthService) BeginTOTPEnrollment(ctx context.Context, userID uuid.UUID) (*TOTPEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return s.beginEnrollment(ctx, user)
+}
+
+// ConfirmTOTPEnrollment enables TOTP for a signed-in user once they prove the
+// authenticator app works. The recovery codes are returned in plain text exactly once.
+func (s *AuthService) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return s.confirmEnrollment(ctx, user, code)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user. A current TOTP code is required.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if !user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is not enabled")
+	}
+	if err := s.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns off TOTP for a signed-in user after checking a TOTP or recovery code.
+// It is refused while MFA is mandatory for the user's role.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if !user.TOTPEnabled {
+		return fmt.Errorf("two-factor authentication is not enabled")
+	}
+	if s.mfaRequired(user) {
+		return fmt.Errorf("two-factor authentication is mandatory for the %s role", user.Role)
+	}
+	if _, err := s.verifySecondFactor(ctx, user, code); err != nil {
+		return err
+	}
+	return s.mfaRepo.Disable(ctx, userID)
+}
+
+// ResetMFA removes another user's TOTP secret and recovery codes, e.g. after a lost phone.
+// Users cannot reset their own second factor this way; they must use DisableTOTP.
+func (s *AuthService) ResetMFA(ctx context.Context, orgID, requestingUserID, targetUserID uuid.UUID) error {
+	if requestingUserID == targetUserID {
+		return fmt.Errorf("cannot reset your own two-factor authentication")
+	}
+	user, err := s.userRepo.GetInOrganization(ctx, targetUserID, orgID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if err := s.checkSuperAdminTarget(ctx, requestingUserID, user); err != nil {
+		return err
+	}
+	return s.mfaRepo.Disable(ctx, targetUserID)
+}
+
+func (s *AuthService) beginEnrollment(ctx context.Context, user *models.User) (*TOTPEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.SetPendingSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.mfaCfg.Issuer, user.Username, secret),
+	}, nil
+}
+
+func (s *AuthService) confirmEnrollment(ctx context.Context, user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == nil {
+		return nil, fmt.Errorf("no pending two-factor enrollment")
+	}
+
+	step, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mfaRepo.Enable(ctx, user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+	user.TOTPEnabled = true
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a 6-digit TOTP code or an unused recovery code.
+func (s *AuthService) verifySecondFactor(ctx context.Context, user *models.User, code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return MFAMethodTOTP, s.verifyTOTP(ctx, user, code)
+	}
+
+	ok, err := s.mfaRepo.UseRecoveryCode(ctx, user.ID, middleware.SHA256Hex(normalizeRecoveryCode(code)))
+	if err != nil {
+		return MFAMethodRecoveryCode, err
+	}
+	if !ok {
+		return MFAMethodRecoveryCode, ErrInvalidMFACode
+	}
+	return MFAMethodRecoveryCode, nil
+}
+
+// verifyTOTP checks a TOTP code and rejects codes that were already accepted once.
+func (s *AuthService) verifyTOTP(ctx context.Context, user *models.User, code string) error {
+	if !user.TOTPEnabled || user.TOTPSecret == nil {
+		return ErrInvalidMFACode
+	}
+	step, ok := totp.Validate(*user.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+	fresh, err := s.mfaRepo.ConsumeStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// issueChallenge signs a short-lived token that identifies the user between the login steps.
+// It uses a key derived from the JWT secret so it is never accepted as a session.
+func (s *AuthService) issueChallenge(user *models.User, purpose string) (string, error) {
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, mfaChallengeClaims{
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+		},
+	}).SignedString(s.challengeKey())
+	if err != nil {
+		return "", fmt.Errorf("sign mfa challenge: %w", err)
+	}
+	return token, nil
+}
+
+// userFromChallenge validates a challenge of the given purpose and loads its user.
+func (s *AuthService) userFromChallenge(ctx context.Context, challenge, purpose string) (*models.User, error) {
+	var claims mfaChallengeClaims
+	if _, err := jwt.ParseWithClaims(challenge, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.challengeKey(), nil
+	}, jwt.WithValidMethods([]string{"HS256"})); err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if claims.Purpose != purpose {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return user, nil
+}
+
+func (s *AuthService) challengeKey() []byte {
+	return []byte("mfa-challenge:" + s.jwtSecret)
+}
+
+// generateRecoveryCodes returns new recovery codes formatted as "xxxxx-xxxxx" and their hashes.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for range recoveryCodeCount {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("generate recovery code: %w", err)
+		}
+		raw := strings.ToLower(enc.EncodeToString(b))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, middleware.SHA256Hex(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips separators and case so codes can be typed loosely.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+
+	"inventario/server/internal/config"
+)
+
+// AuthProviderOIDC marks users provisioned through OpenID Connect.
+const AuthProviderOIDC = "oidc"
+
+// oidcFlowTTL bounds how long a user may take to complete the login at the provider.
+const oidcFlowTTL = 10 * time.Minute
+
+// OIDCService implements the OpenID Connect authorization code flow with PKCE.
+// The per-login state (state, nonce, PKCE verifier) is kept in a signed, short-lived
+// token held by the browser, so any API replica can complete the callback.
+type OIDCService struct {
+	cfg        config.OIDCConfig
+	authSvc    *AuthService
+	flowSecret []byte
+	httpClient *http.Client
+
+	// Provider discovery is lazy so the API still starts when the IdP is unreachable.
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCService creates a new OIDCService.
+// httpClient is used for discovery, JWKS and token requests; nil uses a default client.
+func NewOIDCService(cfg config.OIDCConfig, authSvc *AuthService, jwtSecret string, httpClient *http.Client) *OIDCService {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCService{
+		cfg:        cfg,
+		authSvc:    authSvc,
+		flowSecret: []byte("oidc-flow:" + jwtSecret),
+		httpClient: httpClient,
+	}
+}
+
+// oidcFlowClaims is the signed per-login state stored in the browser.
+type oidcFlowClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to redirect to and
+// the signed flow token that must be presented again on callback.
+func (s *OIDCService) AuthCodeURL(ctx context.Context) (authURL, flowToken string, err error) {
+	oauthCfg, err := s.oauthConfig(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	flowToken, err = jwt.NewWithClaims(jwt.SigningMethodHS256, oidcFlowClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcFlowTTL)),
+		},
+	}).SignedString(s.flowSecret)
+	if err != nil {
+		return "", "", fmt.Errorf("sign flow state: %w", err)
+	}
+
+	authURL = oauthCfg.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, flowToken, nil
+}
+
+// Callback completes a login: it validates the flow state, redeems the code,
+// verifies the ID token and signs the user in, provisioning them if needed.
+func (s *OIDCService) Callback(ctx context.Context, flowToken, state, code string, client ClientInfo) (*LoginResult, error) {
+	var flow oidcFlowClaims
+	if _, err := jwt.ParseWithClaims(flowToken, &flow, func(*jwt.Token) (interface{}, error) {
+		return s.flowSecret, nil
+	}, jwt.WithValidMethods([]string{"HS256"})); err != nil {
+		return nil, fmt.Errorf("invalid login state: %w", err)
+	}
+	if state == "" || state != flow.State {
+		return nil, fmt.Errorf("login state mismatch")
+	}
+
+	oauthCfg, err := s.oauthConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, s.httpClient)
+	oauthToken, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+
+	rawIDToken, ok := oauthToken.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, fmt.Errorf("id token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode id token claims: %w", err)
+	}
+
+	identity, err := s.mapIdentity(idToken.Subject, claims)
+	if err != nil {
+		return nil, err
+	}
+	return s.authSvc.LoginExternal(ctx, identity, client)
+}
+
+// mapIdentity converts ID token claims into an ExternalIdentity using the configured claim mapping.
+func (s *OIDCService) mapIdentity(subject string, claims map[string]interface{}) (*ExternalIdentity, error) {
+	username, _ := claims[s.cfg.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["email"].(string)
+	}
+	if username == "" {
+		return nil, fmt.Errorf("id token has no %q claim", s.cfg.UsernameClaim)
+	}
+	name, _ := claims["name"].(string)
+
+	role := s.cfg.DefaultRole
+	values := claimValues(claims[s.cfg.RoleClaim])
+	switch {
+	case containsAny(values, s.cfg.AdminValues):
+		role = "admin"
+	case containsAny(values, s.cfg.ViewerValues):
+		role = "viewer"
+	}
+	if role == "" {
+		return nil, fmt.Errorf("user %q matches no role mapping", username)
+	}
+
+	return &ExternalIdentity{
+		Provider: AuthProviderOIDC,
+		Subject:  subject,
+		Username: username,
+		Name:     name,
+		Role:     role,
+	}, nil
+}
+
+// oauthConfig returns the OAuth2 client configuration, discovering the provider on first use.
+func (s *OIDCService) oauthConfig(ctx context.Context) (*oauth2.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(oidc.ClientContext(ctx, s.httpClient), s.cfg.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("discover oidc provider: %w", err)
+		}
+		s.provider = provider
+		s.verifier = provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID})
+	}
+
+	return &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     s.provider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, s.cfg.Scopes...),
+	}, nil
+}
+
+// claimValues normalizes a string or list claim into a string slice.
+func claimValues(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// containsAny reports whether any of values is in allowed.
+func containsAny(values, allowed []string) bool {
+	for _, v := range values {
+		if slices.Contains(allowed, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns a URL-safe random string with 256 bits of entropy.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/repository"
+)
+
+const (
+	testClientID     = "inventario"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://inventario.example.com/api/v1/auth/oidc/callback"
+)
+
+// fakeIssuer is an OpenID Connect provider with discovery, JWKS and token endpoints.
+// The token endpoint checks the client credentials, the redirect URI and the PKCE
+// verifier of codes issued by authorize, and returns an RS256 ID token.
+type fakeIssuer struct {
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]issuedCode
+}
+
+// issuedCode is an authorization code and what redeeming it yields.
+type issuedCode struct {
+	challenge string // S256 PKCE challenge of the authorization request
+	claims    jwt.MapClaims
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIssuer{key: key, codes: map[string]issuedCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                f.srv.URL,
+			"authorization_endpoint":                f.srv.URL + "/authorize",
+			"token_endpoint":                        f.srv.URL + "/token",
+			"jwks_uri":                              f.srv.URL + "/keys",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": "test-key",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", f.token)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	// RFC 6749 allows the client credentials in the Authorization header or the body.
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if id != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	f.mu.Lock()
+	code, ok := f.codes[r.PostForm.Get("code")]
+	f.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	case r.PostForm.Get("redirect_uri") != testRedirectURL:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	// Codes are single use. Failed attempts keep them because oauth2 retries the exchange
+	// with the client credentials in the body.
+	f.mu.Lock()
+	delete(f.codes, r.PostForm.Get("code"))
+	f.mu.Unlock()
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, code.claims)
+	idToken.Header["kid"] = "test-key"
+	signed, err := idToken.SignedString(f.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"access_token": "access", "token_type": "Bearer", "expires_in": 300, "id_token": signed})
+}
+
+// authorize plays the user signing in at the provider for the authorization request
+// authURL. It checks the request and returns its state and a code for an ID token with
+// the request's nonce and claims, which override the defaults.
+func (f *fakeIssuer) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (state, code string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if !strings.HasPrefix(authURL, f.srv.URL+"/authorize?") {
+		t.Fatalf("authorization URL %s is not the provider's", authURL)
+	}
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("authorization request %s = %q, want %q", param, got, want)
+		}
+	}
+	if q.Get("state") == "" || q.Get("nonce") == "" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without state, nonce or code_challenge: %s", authURL)
+	}
+
+	now := time.Now()
+	all := jwt.MapClaims{
+		"iss":   f.srv.URL,
+		"aud":   testClientID,
+		"sub":   "subject-ana",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": q.Get("nonce"),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	code = base64.RawURLEncoding.EncodeToString([]byte(q.Get("state")))
+	f.mu.Lock()
+	f.codes[code] = issuedCode{challenge: q.Get("code_challenge"), claims: all}
+	f.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func newTestOIDCService(t *testing.T, mfaCfg config.MFAConfig) (*OIDCService, *AuthService, *fakeIssuer) {
+	t.Helper()
+	issuer := newFakeIssuer(t)
+	auth, _ := newTestAuthService(t, nil, mfaCfg)
+	svc := NewOIDCService(config.OIDCConfig{
+		IssuerURL:     issuer.srv.URL,
+		ClientID:      testClientID,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   testRedirectURL,
+		Scopes:        []string{"profile", "email"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		AdminValues:   []string{"inventario-admins"},
+		ViewerValues:  []string{"inventario-viewers"},
+	}, auth, "test-jwt-secret-0123456789abcdef", issuer.srv.Client())
+	return svc, auth, issuer
+}
+
+// oidcLogin runs a login through svc and issuer, letting tamper change the state and
+// code returned to the callback.
+func oidcLogin(t *testing.T, svc *OIDCService, issuer *fakeIssuer, claims jwt.MapClaims, tamper func(state, code *string)) (*LoginResult, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, flowToken, err := svc.AuthCodeURL(ctx)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	state, code := issuer.authorize(t, authURL, claims)
+	if tamper != nil {
+		tamper(&state, &code)
+	}
+	return svc.Callback(ctx, flowToken, state, code, ClientInfo{IP: "127.0.0.1"})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	svc, _, issuer := newTestOIDCService(t, config.MFAConfig{})
+
+	tests := []struct {
+		name         string
+		claims       jwt.MapClaims
+		tamper       func(state, code *string)
+		wantUsername string
+		wantRole     string
+		wantErr      string
+	}{
+		{
+			name:         "viewer",
+			claims:       jwt.MapClaims{"sub": "s-viewer", "preferred_username": "bruno", "name": "Bruno Lima", "groups": []string{"inventario-viewers"}},
+			wantUsername: "bruno", wantRole: "viewer",
+		},
+		{
+			name:         "admin wins over viewer",
+			claims:       jwt.MapClaims{"sub": "s-admin", "preferred_username": "ana", "groups": []string{"inventario-viewers", "inventario-admins"}},
+			wantUsername: "ana", wantRole: "admin",
+		},
+		{
+			name:         "role claim as a string, username from email",
+			claims:       jwt.MapClaims{"sub": "s-email", "email": "carla@example.com", "groups": "inventario-viewers"},
+			wantUsername: "carla@example.com", wantRole: "viewer",
+		},
+		{
+			name:    "no role mapping",
+			claims:  jwt.MapClaims{"sub": "s-none", "preferred_username": "daniel", "groups": []string{"finance"}},
+			wantErr: `user "daniel" matches no role mapping`,
+		},
+		{
+			name:    "state mismatch",
+			claims:  jwt.MapClaims{"preferred_username": "ana"},
+			tamper:  func(state, _ *string) { *state = "another-state" },
+			wantErr: "login state mismatch",
+		},
+		{
+			name:    "unknown code",
+			claims:  jwt.MapClaims{"preferred_username": "ana"},
+			tamper:  func(_, code *string) { *code = "forged" },
+			wantErr: "unknown code",
+		},
+		{
+			name:   "PKCE verifier mismatch",
+			claims: jwt.MapClaims{"preferred_username": "ana"},
+			tamper: func(_, code *string) {
+				issuer.mu.Lock()
+				defer issuer.mu.Unlock()
+				c := issuer.codes[*code]
+				c.challenge = base64.RawURLEncoding.EncodeToString(make([]byte, sha256.Size))
+				issuer.codes[*code] = c
+			},
+			wantErr: "PKCE verification failed",
+		},
+		{
+			name:    "nonce mismatch",
+			claims:  jwt.MapClaims{"preferred_username": "ana", "nonce": "replayed"},
+			wantErr: "id token nonce mismatch",
+		},
+		{
+			name:    "another audience",
+			claims:  jwt.MapClaims{"preferred_username": "ana", "aud": "another-client"},
+			wantErr: "verify id token",
+		},
+		{
+			name:    "another issuer",
+			claims:  jwt.MapClaims{"preferred_username": "ana", "iss": "https://evil.example.com"},
+			wantErr: "verify id token",
+		},
+		{
+			name:    "expired",
+			claims:  jwt.MapClaims{"preferred_username": "ana", "exp": time.Now().Add(-time.Minute).Unix()},
+			wantErr: "verify id token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := oidcLogin(t, svc, issuer, tt.claims, tt.tamper)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Callback = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Callback: %v", err)
+			}
+			if res.Token == "" || res.MFA != nil {
+				t.Errorf("Callback = %+v, want a session", res)
+			}
+			u := res.User
+			if u.AuthProvider != AuthProviderOIDC || u.Username != tt.wantUsername || u.Role != tt.wantRole {
+				t.Errorf("user = %s %s/%s, want oidc %s/%s", u.AuthProvider, u.Username, u.Role, tt.wantUsername, tt.wantRole)
+			}
+			if u.ExternalID == nil || *u.ExternalID != tt.claims["sub"] {
+				t.Errorf("external_id = %v, want %v", u.ExternalID, tt.claims["sub"])
+			}
+		})
+	}
+
+	// A code is redeemed once: the callback of the flow cannot be replayed.
+	ctx := context.Background()
+	authURL, flowToken, _ := svc.AuthCodeURL(ctx)
+	state, code := issuer.authorize(t, authURL, jwt.MapClaims{"sub": "s-viewer", "preferred_username": "bruno", "groups": []string{"inventario-viewers"}})
+	if _, err := svc.Callback(ctx, flowToken, state, code, ClientInfo{}); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if _, err := svc.Callback(ctx, flowToken, state, code, ClientInfo{}); err == nil {
+		t.Error("replayed callback succeeded")
+	}
+}
+
+func TestOIDCLoginMFA(t *testing.T) {
+	svc, auth, issuer := newTestOIDCService(t, config.MFAConfig{RequiredForAdmin: true})
+	admin := jwt.MapClaims{"sub": "s-1", "preferred_username": "ana", "groups": []string{"inventario-admins"}}
+
+	// MFA_REQUIRED_FOR_ADMIN applies to OIDC admins too: no session before the second factor.
+	res, err := oidcLogin(t, svc, issuer, admin, nil)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if res.Token != "" || res.MFA == nil || !res.MFA.SetupRequired || res.MFA.Token == "" {
+		t.Fatalf("admin login = %+v, want a TOTP setup challenge and no session", res)
+	}
+	if _, err := auth.userFromChallenge(context.Background(), res.MFA.Token, mfaPurposeSetup); err != nil {
+		t.Errorf("setup challenge is not accepted by /auth/mfa/setup: %v", err)
+	}
+
+	// The role is re-synced from the claims: as a viewer the same user needs no TOTP.
+	viewer := jwt.MapClaims{"sub": "s-1", "preferred_username": "ana", "groups": []string{"inventario-viewers"}}
+	res2, err := oidcLogin(t, svc, issuer, viewer, nil)
+	if err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if res2.Token == "" || res2.MFA != nil {
+		t.Fatalf("viewer login = %+v, want a session", res2)
+	}
+	if res2.User.ID != res.User.ID || res2.User.Role != "viewer" {
+		t.Errorf("second login user %s/%s, want %s/viewer", res2.User.ID, res2.User.Role, res.User.ID)
+	}
+}
+
+func TestOIDCLoginLocalUsername(t *testing.T) {
+	svc, auth, issuer := newTestOIDCService(t, config.MFAConfig{})
+	if err := auth.CreateUser(context.Background(), repository.DefaultOrganizationID, "carla", "Carla", "Local#Pass123", "viewer", false, false); err != nil {
+		t.Fatal(err)
+	}
+	// A local account is never linked to an external identity implicitly.
+	_, err := oidcLogin(t, svc, issuer, jwt.MapClaims{"sub": "s-carla", "preferred_username": "carla", "groups": []string{"inventario-admins"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), `username "carla" is already taken`) {
+		t.Errorf("Callback = %v, want the username taken error", err)
+	}
+}
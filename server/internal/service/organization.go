@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/middleware"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// enrollmentKeyPrefix marks per-organization enrollment keys.
+const enrollmentKeyPrefix = "enr_"
+
+// ErrDefaultOrganization is returned when trying to delete the default organization.
+var ErrDefaultOrganization = errors.New("the default organization cannot be deleted")
+
+// ErrOrganizationInUse is returned when deleting an organization that still has
+// devices or users.
+var ErrOrganizationInUse = errors.New("organization still has devices or users")
+
+// OrganizationService manages organizations (tenants), their enrollment keys and
+// the organization a super-admin's session works in.
+type OrganizationService struct {
+	repo     repository.OrganizationStore
+	sessions *SessionService
+}
+
+// NewOrganizationService creates a new OrganizationService.
+func NewOrganizationService(repo repository.OrganizationStore, sessions *SessionService) *OrganizationService {
+	return &OrganizationService{repo: repo, sessions: sessions}
+}
+
+// List returns all organizations.
+func (s *OrganizationService) List(ctx context.Context) ([]models.Organization, error) {
+	return s.repo.List(ctx)
+}
+
+// Get returns a single organization.
+func (s *OrganizationService) Get(ctx context.Context, id uuid.UUID) (*models.Organization, error) {
+	org, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, fmt.Errorf("get organization: %w", err)
+	}
+	return org, nil
+}
+
+// Create adds an organization. Nil settings use the server defaults.
+func (s *OrganizationService) Create(ctx context.Context, name string, retentionDays, inactiveDays *int) (*models.Organization, error) {
+	org, err := s.repo.Create(ctx, strings.TrimSpace(name), retentionDays, inactiveDays)
+	if err != nil {
+		return nil, fmt.Errorf("organization name already exists")
+	}
+	return org, nil
+}
+
+// Update renames an organization and replaces its settings.
+func (s *OrganizationService) Update(ctx context.Context, id uuid.UUID, name string, retentionDays, inactiveDays *int) (*models.Organization, error) {
+	org, err := s.repo.Update(ctx, id, strings.TrimSpace(name), retentionDays, inactiveDays)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, fmt.Errorf("organization name already exists")
+	}
+	return org, nil
+}
+
+// Delete removes an empty organization with its departments and enrollment keys.
+func (s *OrganizationService) Delete(ctx context.Context, id uuid.UUID) error {
+	if id == repository.DefaultOrganizationID {
+		return ErrDefaultOrganization
+	}
+	err := s.repo.Delete(ctx, id)
+	if repository.IsForeignKeyViolation(err) {
+		return ErrOrganizationInUse
+	}
+	return err
+}
+
+// CreateEnrollmentKey issues an enrollment key for an organization and returns the
+// plain-text key, which is shown only once. createdBy is uuid.Nil for keys issued from
+// the CLI.
+func (s *OrganizationService) CreateEnrollmentKey(ctx context.Context, orgID, createdBy uuid.UUID, name string) (string, *models.EnrollmentKey, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := enrollmentKeyPrefix + secret
+
+	key := &models.EnrollmentKey{
+		ID:             uuid.New(),
+		OrganizationID: orgID,
+		Name:           strings.TrimSpace(name),
+		KeyPrefix:      raw[:len(enrollmentKeyPrefix)+8],
+		KeyHash:        middleware.SHA256Hex(raw),
+		CreatedAt:      time.Now(),
+	}
+	if createdBy != uuid.Nil {
+		key.CreatedBy = &createdBy
+	}
+	if err := s.repo.CreateEnrollmentKey(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return raw, key, nil
+}
+
+// ListEnrollmentKeys returns the enrollment keys of an organization.
+func (s *OrganizationService) ListEnrollmentKeys(ctx context.Context, orgID uuid.UUID) ([]models.EnrollmentKey, error) {
+	return s.repo.ListEnrollmentKeys(ctx, orgID)
+}
+
+// RevokeEnrollmentKey revokes one of an organization's enrollment keys.
+func (s *OrganizationService) RevokeEnrollmentKey(ctx context.Context, id, orgID uuid.UUID) error {
+	return s.repo.RevokeEnrollmentKey(ctx, id, orgID)
+}
+
+// RotateEnrollmentKey issues a new enrollment key for an organization, then revokes
+// its other active keys. It returns the plain-text key, the new key and the revoked
+// ones.
+func (s *OrganizationService) RotateEnrollmentKey(ctx context.Context, orgID, createdBy uuid.UUID, name string) (string, *models.EnrollmentKey, []models.EnrollmentKey, error) {
+	existing, err := s.repo.ListEnrollmentKeys(ctx, orgID)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	raw, key, err := s.CreateEnrollmentKey(ctx, orgID, createdBy, name)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	revoked := []models.EnrollmentKey{}
+	for _, k := range existing {
+		if k.RevokedAt != nil {
+			continue
+		}
+		if err := s.repo.RevokeEnrollmentKey(ctx, k.ID, orgID); err != nil {
+			return raw, key, revoked, fmt.Errorf("revoke enrollment key %s: %w", k.ID, err)
+		}
+		revoked = append(revoked, k)
+	}
+	return raw, key, revoked, nil
+}
+
+// Switch moves a super-admin's session to another organization.
+func (s *OrganizationService) Switch(ctx context.Context, sessionID, orgID uuid.UUID) (*models.Organization, error) {
+	org, err := s.Get(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.SetOrganization(ctx, sessionID, org.ID); err != nil {
+		return nil, err
+	}
+	return org, nil
+}
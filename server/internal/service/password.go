@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"inventario/server/internal/config"
+	"inventario/shared/models"
+)
+
+// passwordChangePurpose marks the login challenge of a user who must choose a new password
+// before a session is issued.
+const passwordChangePurpose = "password_change"
+
+// ErrPasswordPolicy is wrapped by every password policy violation.
+var ErrPasswordPolicy = errors.New("password does not meet the policy")
+
+// AccountLockedError is returned when a login is refused because the account is locked out.
+type AccountLockedError struct {
+	Until time.Time
+	New   bool // this attempt triggered the lockout
+}
+
+func (e *AccountLockedError) Error() string {
+	return "account temporarily locked"
+}
+
+// PasswordPolicy validates new local passwords.
+type PasswordPolicy struct {
+	cfg      config.PasswordConfig
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy creates a PasswordPolicy, loading the breached-password list if configured.
+// The list holds one password per line; blank lines and lines starting with # are ignored.
+func NewPasswordPolicy(cfg config.PasswordConfig) (*PasswordPolicy, error) {
+	p := &PasswordPolicy{cfg: cfg, breached: map[string]struct{}{}}
+	if cfg.BreachedList == "" {
+		return p, nil
+	}
+
+	f, err := os.Open(cfg.BreachedList)
+	if err != nil {
+		return nil, fmt.Errorf("open breached password list: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read breached password list: %w", err)
+	}
+	return p, nil
+}
+
+// HistorySize is the number of previous passwords that may not be reused.
+func (p *PasswordPolicy) HistorySize() int {
+	return p.cfg.HistorySize
+}
+
+// Validate checks a new password against the length, character class and breached-list rules.
+// Reuse of previous passwords is checked separately by AuthService.
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if n := len([]rune(password)); n < p.cfg.MinLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordPolicy, p.cfg.MinLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	var missing []string
+	if p.cfg.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.cfg.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.cfg.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if p.cfg.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: must contain %s", ErrPasswordPolicy, strings.Join(missing, ", "))
+	}
+
+	if strings.EqualFold(password, username) {
+		return fmt.Errorf("%w: must not match the username", ErrPasswordPolicy)
+	}
+	if _, ok := p.breached[strings.ToLower(password)]; ok {
+		return fmt.Errorf("%w: password is known to be compromised", ErrPasswordPolicy)
+	}
+	return nil
+}
+
+// hashNewPassword validates a password for an existing user, rejects reuse of the current
+// and recent passwords, and returns its bcrypt hash.
+func (s *AuthService) hashNewPassword(ctx context.Context, user *models.User, password string) (string, error) {
+	if err := s.policy.Validate(user.Username, password); err != nil {
+		return "", err
+	}
+
+	if n := s.policy.HistorySize(); n > 0 {
+		previous, err := s.userRepo.RecentPasswordHashes(ctx, user.ID, n)
+		if err != nil {
+			return "", err
+		}
+		if user.PasswordHash != "" {
+			previous = append(previous, user.PasswordHash)
+		}
+		for _, hash := range previous {
+			if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				return "", fmt.Errorf("%w: must not match any of the last %d passwords", ErrPasswordPolicy, n)
+			}
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// checkLockout refuses users whose account is locked out.
+func (s *AuthService) checkLockout(user *models.User) error {
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return &AccountLockedError{Until: *user.LockedUntil}
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed password or second-factor attempt, of local and
+// directory users alike. It returns an AccountLockedError when the attempt locks the
+// account, and fallback otherwise.
+func (s *AuthService) recordLoginFailure(ctx context.Context, user *models.User, fallback error) error {
+	if s.lockout.Threshold <= 0 {
+		return fallback
+	}
+	lockedUntil, err := s.userRepo.RecordLoginFailure(ctx, user.ID, s.lockout.Threshold, s.lockout.Duration, s.lockout.MaxDuration)
+	if err != nil {
+		slog.Error("failed to record login failure", "error", err, "user_id", user.ID)
+		return fallback
+	}
+	if lockedUntil == nil {
+		return fallback
+	}
+	slog.Warn("account locked after failed logins", "username", user.Username, "locked_until", lockedUntil)
+	return &AccountLockedError{Until: *lockedUntil, New: true}
+}
+
+// resetLoginFailures clears the failure counters after a successful login.
+func (s *AuthService) resetLoginFailures(ctx context.Context, user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockoutCount == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := s.userRepo.ResetLoginFailures(ctx, user.ID); err != nil {
+		slog.Error("failed to reset login failures", "error", err, "user_id", user.ID)
+	}
+}
+
+// UnlockUser lifts a lockout of a dashboard user of an organization.
+func (s *AuthService) UnlockUser(ctx context.Context, orgID, requestingUserID, userID uuid.UUID) error {
+	user, err := s.userRepo.GetInOrganization(ctx, userID, orgID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if err := s.checkSuperAdminTarget(ctx, requestingUserID, user); err != nil {
+		return err
+	}
+	return s.userRepo.Unlock(ctx, userID, orgID)
+}
+
+// ResetPassword gives a local user a temporary password, to be changed at the next
+// login, lifts any lockout and ends the user's sessions: the way back in for a user
+// who forgot their password, run from the CLI.
+func (s *AuthService) ResetPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if user.AuthProvider != AuthProviderLocal {
+		return fmt.Errorf("cannot set a password for a %s user", user.AuthProvider)
+	}
+	hash, err := s.hashNewPassword(ctx, user, password)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.SetPassword(ctx, userID, hash, true, s.policy.HistorySize()); err != nil {
+		return err
+	}
+	if err := s.userRepo.Unlock(ctx, userID, user.OrganizationID); err != nil {
+		return err
+	}
+	if _, err := s.sessions.RevokeAll(ctx, userID, uuid.Nil, SessionRevokedPasswordChange); err != nil {
+		return fmt.Errorf("revoke sessions: %w", err)
+	}
+	return nil
+}
+
+// ChangeExpiredPassword sets the new password of a user who was asked to change it at login,
+// then continues the login (which may still require a second factor).
+func (s *AuthService) ChangeExpiredPassword(ctx context.Context, challenge, newPassword string, client ClientInfo) (*LoginResult, error) {
+	user, err := s.userFromChallenge(ctx, challenge, passwordChangePurpose)
+	if err != nil {
+		return nil, err
+	}
+	if !user.MustChangePassword {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	hash, err := s.hashNewPassword(ctx, user, newPassword)
+	if err != nil {
+		return &LoginResult{User: user}, err
+	}
+	if err := s.userRepo.SetPassword(ctx, user.ID, hash, false, s.policy.HistorySize()); err != nil {
+		return nil, err
+	}
+	user.PasswordHash = hash
+	user.MustChangePassword = false
+
+	return s.completeLogin(ctx, user, client)
+}
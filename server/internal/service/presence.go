@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"inventario/server/internal/repository"
+)
+
+// presenceInterval is how often devices that went offline are looked for.
+const presenceInterval = time.Minute
+
+// PresenceService marks agent devices offline when they leave their presence window,
+// which publishes device.offline to the live event stream.
+type PresenceService struct {
+	deviceRepo repository.DeviceStore
+	stopCh     chan struct{}
+}
+
+// NewPresenceService creates a new PresenceService.
+func NewPresenceService(deviceRepo repository.DeviceStore) *PresenceService {
+	return &PresenceService{deviceRepo: deviceRepo, stopCh: make(chan struct{})}
+}
+
+// Start begins the periodic sweep in a background goroutine.
+// Call Stop() to terminate it.
+func (s *PresenceService) Start() {
+	go func() {
+		ticker := time.NewTicker(presenceInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.sweep()
+			case <-s.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop signals the sweep goroutine to terminate.
+func (s *PresenceService) Stop() {
+	close(s.stopCh)
+}
+
+func (s *PresenceService) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	n, err := s.deviceRepo.MarkOffline(ctx)
+	if err != nil {
+		slog.Error("presence: failed to mark offline devices", "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("presence: devices went offline", "count", n)
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/authz"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// ErrBuiltinRole is returned when trying to modify or delete a built-in role.
+var ErrBuiltinRole = errors.New("built-in roles cannot be modified")
+
+// ErrDepartmentNotFound is returned when binding a role to a department outside the
+// organization.
+var ErrDepartmentNotFound = errors.New("department not found")
+
+// RoleService manages roles and user role bindings.
+type RoleService struct {
+	roleRepo repository.RoleStore
+	userRepo repository.UserStore
+	deptRepo repository.DepartmentStore
+}
+
+// NewRoleService creates a new RoleService.
+func NewRoleService(roleRepo repository.RoleStore, userRepo repository.UserStore, deptRepo repository.DepartmentStore) *RoleService {
+	return &RoleService{roleRepo: roleRepo, userRepo: userRepo, deptRepo: deptRepo}
+}
+
+// List returns all roles.
+func (s *RoleService) List(ctx context.Context) ([]models.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+// Create adds a custom role bundling the given permissions.
+func (s *RoleService) Create(ctx context.Context, name, description string, permissions []string) (*models.Role, error) {
+	perms, err := authz.ParsePermissions(strings.Join(permissions, " "))
+	if err != nil {
+		return nil, err
+	}
+	role, err := s.roleRepo.Create(ctx, strings.TrimSpace(name), description, authz.FormatPermissions(perms))
+	if err != nil {
+		return nil, fmt.Errorf("role name already exists")
+	}
+	return role, nil
+}
+
+// Update renames a custom role or replaces its permissions. Users keep their
+// base role across renames.
+func (s *RoleService) Update(ctx context.Context, id uuid.UUID, name, description string, permissions []string) (*models.Role, error) {
+	perms, err := authz.ParsePermissions(strings.Join(permissions, " "))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("role not found")
+	}
+	if existing.Builtin {
+		return nil, ErrBuiltinRole
+	}
+
+	role, err := s.roleRepo.Update(ctx, id, strings.TrimSpace(name), description, authz.FormatPermissions(perms))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("role not found")
+		}
+		return nil, fmt.Errorf("role name already exists")
+	}
+	return role, nil
+}
+
+// Delete removes a custom role and all its bindings. Roles still used as a
+// user's base role must be reassigned first.
+func (s *RoleService) Delete(ctx context.Context, id uuid.UUID) (*models.Role, error) {
+	role, err := s.roleRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("role not found")
+	}
+	if role.Builtin {
+		return nil, ErrBuiltinRole
+	}
+
+	count, err := s.roleRepo.CountUsers(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("role is the base role of %d user(s)", count)
+	}
+
+	if err := s.roleRepo.Delete(ctx, id); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Exists reports whether a role with the given name exists.
+func (s *RoleService) Exists(ctx context.Context, name string) (bool, error) {
+	_, err := s.roleRepo.GetByName(ctx, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get role: %w", err)
+	}
+	return true, nil
+}
+
+// ListBindings returns the role bindings of a user of an organization.
+func (s *RoleService) ListBindings(ctx context.Context, orgID, userID uuid.UUID) ([]models.RoleBinding, error) {
+	if _, err := s.userRepo.GetInOrganization(ctx, userID, orgID); err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return s.roleRepo.ListBindings(ctx, userID)
+}
+
+// CreateBinding grants a role to a user of an organization for one of its departments,
+// or organization-wide when departmentID is nil. The department must belong to the
+// organization, or ErrDepartmentNotFound is returned. Roles whose permissions are all
+// global-only (user.manage, audit.read, ...) cannot be bound to a department.
+func (s *RoleService) CreateBinding(ctx context.Context, orgID, userID, roleID uuid.UUID, departmentID *uuid.UUID) (uuid.UUID, error) {
+	if _, err := s.userRepo.GetInOrganization(ctx, userID, orgID); err != nil {
+		return uuid.Nil, fmt.Errorf("user not found")
+	}
+	role, err := s.roleRepo.GetByID(ctx, roleID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("role not found")
+	}
+
+	if departmentID != nil {
+		if _, err := s.deptRepo.GetByID(ctx, *departmentID, orgID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return uuid.Nil, ErrDepartmentNotFound
+			}
+			return uuid.Nil, fmt.Errorf("get department: %w", err)
+		}
+		perms, _ := authz.ParsePermissions(role.Permissions)
+		scopable := false
+		for _, p := range perms {
+			if p.Scopable() {
+				scopable = true
+				break
+			}
+		}
+		if !scopable {
+			return uuid.Nil, fmt.Errorf("role %q has no department-scoped permissions", role.Name)
+		}
+	}
+
+	id, err := s.roleRepo.CreateBinding(ctx, userID, roleID, departmentID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("binding already exists")
+	}
+	return id, nil
+}
+
+// DeleteBinding removes one of the role bindings of a user of an organization.
+func (s *RoleService) DeleteBinding(ctx context.Context, orgID, userID, bindingID uuid.UUID) error {
+	if _, err := s.userRepo.GetInOrganization(ctx, userID, orgID); err != nil {
+		return fmt.Errorf("role binding not found")
+	}
+	return s.roleRepo.DeleteBinding(ctx, userID, bindingID)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// Reasons recorded when a session is revoked.
+const (
+	SessionRevokedLogout         = "logout"
+	SessionRevokedByUser         = "revoked"
+	SessionRevokedByAdmin        = "revoked_by_admin"
+	SessionRevokedPasswordChange = "password_changed"
+	SessionRevokedRoleChange     = "role_changed"
+)
+
+// ClientInfo identifies the client a session is issued to.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// SessionService issues session JWTs backed by server-side session records.
+// The JWT expires at the session's absolute expiry; the shorter idle expiry is
+// enforced server-side by middleware.JWTAuth and slides forward with activity.
+type SessionService struct {
+	repo      repository.SessionStore
+	userRepo  repository.UserStore
+	cfg       config.SessionConfig
+	jwtSecret string
+}
+
+// NewSessionService creates a new SessionService.
+func NewSessionService(repo repository.SessionStore, userRepo repository.UserStore, cfg config.SessionConfig, jwtSecret string) *SessionService {
+	return &SessionService{repo: repo, userRepo: userRepo, cfg: cfg, jwtSecret: jwtSecret}
+}
+
+// Create records a new session for the user and returns its signed JWT and the JWT's expiry.
+func (s *SessionService) Create(ctx context.Context, user *models.User, client ClientInfo) (string, time.Time, error) {
+	now := time.Now()
+	orgID := user.OrganizationID
+	session := &models.UserSession{
+		ID:                uuid.New(),
+		UserID:            user.ID,
+		OrganizationID:    &orgID,
+		IP:                client.IP,
+		UserAgent:         truncate(client.UserAgent, 512),
+		ExpiresAt:         now.Add(s.cfg.IdleTimeout),
+		AbsoluteExpiresAt: now.Add(s.cfg.MaxLifetime),
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return "", time.Time{}, err
+	}
+	token, err := s.sign(user, session.ID, session.AbsoluteExpiresAt)
+	return token, session.AbsoluteExpiresAt, err
+}
+
+// Refresh slides the session's idle expiry and returns a new JWT for the same session,
+// picking up the user's current username and role. Fails once the session has ended.
+// Clients use it to keep a session alive while the user is active without API traffic.
+func (s *SessionService) Refresh(ctx context.Context, sessionID uuid.UUID, client ClientInfo) (string, *models.UserSession, error) {
+	session, err := s.repo.Extend(ctx, sessionID, client.IP, s.cfg.IdleTimeout)
+	if err != nil {
+		return "", nil, fmt.Errorf("session not found")
+	}
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
+	if err != nil {
+		return "", nil, fmt.Errorf("user not found")
+	}
+	token, err := s.sign(user, session.ID, session.AbsoluteExpiresAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, session, nil
+}
+
+// List returns a user's active sessions.
+func (s *SessionService) List(ctx context.Context, userID uuid.UUID) ([]models.UserSession, error) {
+	return s.repo.ListActiveByUser(ctx, userID)
+}
+
+// Revoke ends one of a user's sessions.
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID uuid.UUID, reason string) error {
+	return s.repo.Revoke(ctx, userID, sessionID, reason)
+}
+
+// RevokeAll ends every session of a user except keep (uuid.Nil keeps none).
+func (s *SessionService) RevokeAll(ctx context.Context, userID, keep uuid.UUID, reason string) (int64, error) {
+	return s.repo.RevokeAllForUser(ctx, userID, keep, reason)
+}
+
+// InOrganization reports whether a user belongs to an organization.
+func (s *SessionService) InOrganization(ctx context.Context, userID, orgID uuid.UUID) bool {
+	_, err := s.userRepo.GetInOrganization(ctx, userID, orgID)
+	return err == nil
+}
+
+// SetOrganization moves a session to another organization; the caller checks that
+// the user is a super-admin.
+func (s *SessionService) SetOrganization(ctx context.Context, sessionID, orgID uuid.UUID) error {
+	return s.repo.SetOrganization(ctx, sessionID, orgID)
+}
+
+// sign creates the session JWT checked by middleware.JWTAuth.
+func (s *SessionService) sign(user *models.User, sessionID uuid.UUID, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      user.ID.String(),
+		"username": user.Username,
+		"role":     user.Role,
+		"jti":      sessionID.String(),
+		"iat":      time.Now().Unix(),
+		"exp":      expiresAt.Unix(),
+	})
+	return token.SignedString([]byte(s.jwtSecret))
+}
+
+// truncate cuts s to at most n characters, the length of VARCHAR(n) columns, on a rune
+// boundary. Invalid UTF-8 and NUL bytes, which PostgreSQL rejects, are dropped first.
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(strings.ToValidUTF8(s, ""), "\x00", "")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	i, count := 0, 0
+	for i = range s {
+		if count == n {
+			break
+		}
+		count++
+	}
+	return s[:i]
+}
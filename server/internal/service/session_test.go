@@ -0,0 +1,35 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		n    int
+		want string
+	}{
+		{"short", "curl/8.0", 512, "curl/8.0"},
+		{"exact", "abc", 3, "abc"},
+		{"ascii", "abcdef", 3, "abc"},
+		{"multibyte boundary", "ação", 2, "aç"},
+		{"multibyte kept whole", strings.Repeat("é", 600), 512, strings.Repeat("é", 512)},
+		{"invalid utf8 dropped", "ab\xffcd", 3, "abc"},
+		{"nul dropped", "a\x00b", 512, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncate(tt.in, tt.n)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q is not valid UTF-8", tt.in, tt.n, got)
+			}
+		})
+	}
+}
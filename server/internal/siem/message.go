@@ -0,0 +1,237 @@
+package siem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"inventario/server/internal/repository"
+	"inventario/shared/models"
+)
+
+// Syslog severities used for forwarded events.
+const (
+	severityWarning = 4
+	severityNotice  = 5
+	severityInfo    = 6
+)
+
+const (
+	appName = "inventario"
+	// sdID is the structured data element carrying the stream cursor; 32473 is the
+	// private enterprise number reserved for documentation (RFC 5612).
+	sdID = "inventario@32473"
+
+	cefVendor  = "Inventario"
+	cefProduct = "Inventario Server"
+	cefVersion = "1"
+)
+
+// Event is an audit or device activity entry ready to be formatted.
+type Event struct {
+	Stream    string // repository.SIEMStreamAudit or repository.SIEMStreamActivity
+	Seq       int64  // position in the stream; SIEMs can deduplicate on stream + seq
+	ID        string
+	Time      time.Time
+	Severity  int    // syslog severity
+	Signature string // CEF signature ID: audit action or activity type
+	Name      string // CEF name
+	Fields    []Field
+}
+
+// Field is one attribute of an Event. Empty values are left out.
+type Field struct {
+	Key   string // JSON key, also the label of CEF custom fields
+	CEF   string // CEF extension key; "cs1".."cs6" are custom strings labelled with Key
+	Value string
+	Raw   bool // Value is JSON and is embedded as-is in the JSON format
+}
+
+// AuditEvent converts an audit log entry. Failed authentication attempts
+// ("success": false in details) are sent as warnings.
+func AuditEvent(log *models.AuditLog) Event {
+	severity := severityNotice
+	var details struct {
+		Success *bool `json:"success"`
+	}
+	if json.Unmarshal([]byte(log.Details), &details) == nil && details.Success != nil && !*details.Success {
+		severity = severityWarning
+	}
+
+	var userID, resourceID, hash string
+	if log.UserID != nil {
+		userID = log.UserID.String()
+	}
+	if log.ResourceID != nil {
+		resourceID = log.ResourceID.String()
+	}
+	if log.Hash != nil {
+		hash = *log.Hash
+	}
+
+	return Event{
+		Stream:    repository.SIEMStreamAudit,
+		Seq:       log.Seq,
+		ID:        log.ID.String(),
+		Time:      log.CreatedAt,
+		Severity:  severity,
+		Signature: log.Action,
+		Name:      log.Action,
+		Fields: []Field{
+			{Key: "action", CEF: "act", Value: log.Action},
+			{Key: "username", CEF: "suser", Value: log.Username},
+			{Key: "user_id", CEF: "suid", Value: userID},
+			{Key: "ip_address", CEF: "src", Value: log.IPAddress},
+			{Key: "user_agent", CEF: "requestClientApplication", Value: log.UserAgent},
+			{Key: "resource_type", CEF: "cs1", Value: log.ResourceType},
+			{Key: "resource_id", CEF: "cs2", Value: resourceID},
+			{Key: "details", CEF: "cs3", Value: log.Details, Raw: true},
+			{Key: "hash", CEF: "cs4", Value: hash},
+		},
+	}
+}
+
+// ActivityEvent converts a device activity entry.
+func ActivityEvent(e *repository.ActivityEvent) Event {
+	var metadata string
+	if e.Metadata != nil {
+		metadata = *e.Metadata
+	}
+	return Event{
+		Stream:    repository.SIEMStreamActivity,
+		Seq:       e.Seq,
+		ID:        e.ID.String(),
+		Time:      e.DetectedAt,
+		Severity:  severityInfo,
+		Signature: e.ActivityType,
+		Name:      e.Description,
+		Fields: []Field{
+			{Key: "activity_type", CEF: "cat", Value: e.ActivityType},
+			{Key: "description", CEF: "msg", Value: e.Description},
+			{Key: "device_id", CEF: "deviceExternalId", Value: e.DeviceID.String()},
+			{Key: "hostname", CEF: "dhost", Value: e.Hostname},
+			{Key: "old_value", CEF: "cs1", Value: deref(e.OldValue)},
+			{Key: "new_value", CEF: "cs2", Value: deref(e.NewValue)},
+			{Key: "metadata", CEF: "cs3", Value: metadata, Raw: true},
+		},
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Syslog formats e as an RFC 5424 message with a JSON or CEF body.
+func Syslog(e Event, facility int, hostname, format string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - %s [%s stream=\"%s\" seq=\"%d\" id=\"%s\"] ",
+		facility*8+e.Severity,
+		e.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		headerField(hostname, 255),
+		appName,
+		e.Stream,
+		sdID, sdEscape(e.Stream), e.Seq, sdEscape(e.ID),
+	)
+	if format == "cef" {
+		b.WriteString(CEF(e))
+	} else {
+		b.Write(JSON(e))
+	}
+	return b.Bytes()
+}
+
+// JSON renders e as a single-line JSON object.
+func JSON(e Event) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"stream":`)
+	writeJSON(&b, e.Stream)
+	b.WriteString(`,"seq":`)
+	b.WriteString(strconv.FormatInt(e.Seq, 10))
+	b.WriteString(`,"id":`)
+	writeJSON(&b, e.ID)
+	b.WriteString(`,"time":`)
+	writeJSON(&b, e.Time.UTC().Format(time.RFC3339Nano))
+	for _, f := range e.Fields {
+		if f.Value == "" {
+			continue
+		}
+		b.WriteByte(',')
+		writeJSON(&b, f.Key)
+		b.WriteByte(':')
+		if f.Raw && json.Valid([]byte(f.Value)) {
+			_ = json.Compact(&b, []byte(f.Value))
+		} else {
+			writeJSON(&b, f.Value)
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+func writeJSON(b *bytes.Buffer, v string) {
+	out, _ := json.Marshal(v)
+	b.Write(out)
+}
+
+// CEF renders e in ArcSight Common Event Format.
+func CEF(e Event) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CEF:0|%s|%s|%s|%s|%s|%d|rt=%d externalId=%s cn1Label=seq cn1=%d",
+		cefHeader(cefVendor), cefHeader(cefProduct), cefVersion,
+		cefHeader(e.Signature), cefHeader(e.Name), cefSeverity(e.Severity),
+		e.Time.UnixMilli(), cefValue(e.ID), e.Seq,
+	)
+	for _, f := range e.Fields {
+		if f.Value == "" {
+			continue
+		}
+		if strings.HasPrefix(f.CEF, "cs") {
+			fmt.Fprintf(&b, " %sLabel=%s", f.CEF, cefValue(f.Key))
+		}
+		fmt.Fprintf(&b, " %s=%s", f.CEF, cefValue(f.Value))
+	}
+	return b.String()
+}
+
+// cefSeverity maps syslog severities onto the CEF 0-10 scale.
+func cefSeverity(severity int) int {
+	switch severity {
+	case severityWarning:
+		return 7
+	case severityNotice:
+		return 5
+	default:
+		return 3
+	}
+}
+
+var (
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper  = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	sdEscaper        = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+)
+
+func cefHeader(s string) string { return cefHeaderEscaper.Replace(s) }
+func cefValue(s string) string  { return cefValueEscaper.Replace(s) }
+func sdEscape(s string) string  { return sdEscaper.Replace(s) }
+
+// headerField makes s a valid RFC 5424 header field: printable US-ASCII without
+// spaces, at most limit characters, or the nil value "-".
+func headerField(s string, limit int) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(out) < limit; i++ {
+		if c := s[i]; c > 32 && c < 127 {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 0 {
+		return "-"
+	}
+	return string(out)
+}
@@ -0,0 +1,198 @@
+// Package siem forwards audit log entries and device activity to a SIEM as RFC 5424
+// syslog messages (JSON or CEF body) over udp, tcp or tls. Each stream has a cursor in
+// the siem_cursors table that only advances past events the transport accepted, so a
+// restart resumes where forwarding stopped.
+//
+// Delivery is at least once over tcp and tls: the cursor is committed after the batch
+// is written, so a crash or a failed commit in between sends the batch again, and
+// receivers deduplicate on the stream and seq in the structured data of each message.
+// Over udp, datagrams the receiver drops are not detected and are lost.
+package siem
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+
+	"inventario/server/internal/config"
+	"inventario/server/internal/repository"
+)
+
+// activitySettle is how long device activity waits before being forwarded, so that
+// inventory transactions that took a lower seq have committed (see ActivityAfter).
+const activitySettle = 2 * time.Minute
+
+// Forwarder polls new events and sends them to the configured receiver.
+type Forwarder struct {
+	repo     repository.SIEMStore
+	cfg      config.SIEMConfig
+	out      *transport
+	hostname string
+
+	ready  map[string]bool // streams whose cursor exists
+	stopCh chan struct{}
+	done   chan struct{}
+}
+
+// NewForwarder creates a Forwarder for cfg; it fails when the TLS settings cannot be loaded.
+func NewForwarder(repo repository.SIEMStore, cfg config.SIEMConfig) (*Forwarder, error) {
+	out, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostname := cfg.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	return &Forwarder{
+		repo:     repo,
+		cfg:      cfg,
+		out:      out,
+		hostname: hostname,
+		ready:    make(map[string]bool),
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start begins forwarding in a background goroutine. Call Stop() to terminate it.
+func (f *Forwarder) Start() {
+	go func() {
+		defer close(f.done)
+		defer f.out.close()
+
+		ticker := time.NewTicker(f.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			f.poll()
+			select {
+			case <-ticker.C:
+			case <-f.stopCh:
+				return
+			}
+		}
+	}()
+
+	slog.Info("siem forwarding started",
+		"address", f.cfg.Address,
+		"protocol", f.cfg.Protocol,
+		"format", f.cfg.Format,
+		"interval", f.cfg.Interval.String(),
+	)
+}
+
+// Stop waits for the poll in progress and terminates forwarding.
+func (f *Forwarder) Stop() {
+	close(f.stopCh)
+	<-f.done
+	slog.Info("siem forwarding stopped")
+}
+
+// SendTest sends a single test message with the configured settings, bypassing the cursors.
+func (f *Forwarder) SendTest() error {
+	defer f.out.close()
+	msg := Syslog(Event{
+		Stream:    "test",
+		ID:        uuid.New().String(),
+		Time:      time.Now(),
+		Severity:  severityInfo,
+		Signature: "siem.test",
+		Name:      "SIEM forwarding test",
+		Fields:    []Field{{Key: "description", CEF: "msg", Value: "SIEM forwarding test"}},
+	}, f.cfg.Facility, f.hostname, f.cfg.Format)
+	_, err := f.out.send([][]byte{msg})
+	return err
+}
+
+func (f *Forwarder) poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	for _, stream := range []string{repository.SIEMStreamAudit, repository.SIEMStreamActivity} {
+		if !f.ready[stream] {
+			if err := f.repo.InitCursor(ctx, stream, f.cfg.Backfill); err != nil {
+				slog.Error("siem: cannot initialize cursor", "stream", stream, "error", err)
+				continue
+			}
+			f.ready[stream] = true
+		}
+
+		// Drain the backlog one batch at a time, stopping early on Stop.
+		for {
+			full, err := f.forward(ctx, stream)
+			if err != nil {
+				slog.Error("siem: forwarding failed", "stream", stream, "error", err)
+				break
+			}
+			if !full || f.stopping() {
+				break
+			}
+		}
+	}
+}
+
+// forward sends one batch of the stream and reports whether the batch was full.
+func (f *Forwarder) forward(ctx context.Context, stream string) (bool, error) {
+	var events []Event
+	locked, err := f.repo.Advance(ctx, stream, func(cursor int64) (int64, error) {
+		var err error
+		if events, err = f.read(ctx, stream, cursor); err != nil || len(events) == 0 {
+			return cursor, err
+		}
+
+		msgs := make([][]byte, len(events))
+		for i, e := range events {
+			msgs[i] = Syslog(e, f.cfg.Facility, f.hostname, f.cfg.Format)
+		}
+		sent, err := f.out.send(msgs)
+		if sent == 0 {
+			return cursor, err
+		}
+		return events[sent-1].Seq, err
+	})
+	if err != nil || !locked {
+		// Another replica is forwarding this stream, or the batch failed.
+		return false, err
+	}
+	return len(events) == f.cfg.BatchSize, nil
+}
+
+func (f *Forwarder) read(ctx context.Context, stream string, cursor int64) ([]Event, error) {
+	switch stream {
+	case repository.SIEMStreamAudit:
+		logs, err := f.repo.AuditAfter(ctx, cursor, f.cfg.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]Event, len(logs))
+		for i := range logs {
+			events[i] = AuditEvent(&logs[i])
+		}
+		return events, nil
+	case repository.SIEMStreamActivity:
+		rows, err := f.repo.ActivityAfter(ctx, cursor, activitySettle, f.cfg.BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		events := make([]Event, len(rows))
+		for i := range rows {
+			events[i] = ActivityEvent(&rows[i])
+		}
+		return events, nil
+	}
+	return nil, errors.New("unknown siem stream " + stream)
+}
+
+func (f *Forwarder) stopping() bool {
+	select {
+	case <-f.stopCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,109 @@
+package siem
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"inventario/server/internal/config"
+)
+
+const ioTimeout = 10 * time.Second
+
+// transport delivers syslog messages: one datagram per message over udp, octet-counted
+// framing (RFC 6587/5425) over tcp and tls. The connection is reopened after an error.
+type transport struct {
+	protocol string
+	address  string
+	tls      *tls.Config
+	conn     net.Conn
+}
+
+func newTransport(cfg config.SIEMConfig) (*transport, error) {
+	t := &transport{protocol: cfg.Protocol, address: cfg.Address}
+	if cfg.Protocol != "tls" {
+		return t, nil
+	}
+
+	t.tls = &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // configurable for lab receivers
+		MinVersion:         tls.VersionTLS12,
+	}
+	if host, _, err := net.SplitHostPort(cfg.Address); err == nil {
+		t.tls.ServerName = host
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read SIEM_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("SIEM_TLS_CA_FILE contains no PEM certificates")
+		}
+		t.tls.RootCAs = pool
+	}
+	return t, nil
+}
+
+// send writes msgs in order and returns how many were written before an error.
+func (t *transport) send(msgs [][]byte) (int, error) {
+	for i, msg := range msgs {
+		if err := t.write(msg); err != nil {
+			t.close()
+			return i, err
+		}
+	}
+	return len(msgs), nil
+}
+
+func (t *transport) write(msg []byte) error {
+	if t.conn == nil {
+		if err := t.dial(); err != nil {
+			return err
+		}
+	}
+	if err := t.conn.SetWriteDeadline(time.Now().Add(ioTimeout)); err != nil {
+		return err
+	}
+
+	if t.protocol != "udp" {
+		frame := make([]byte, 0, len(msg)+8)
+		frame = strconv.AppendInt(frame, int64(len(msg)), 10)
+		frame = append(frame, ' ')
+		msg = append(frame, msg...)
+	}
+	if _, err := t.conn.Write(msg); err != nil {
+		return fmt.Errorf("write to %s: %w", t.address, err)
+	}
+	return nil
+}
+
+func (t *transport) dial() error {
+	dialer := &net.Dialer{Timeout: ioTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if t.protocol == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.address, t.tls)
+	} else {
+		conn, err = dialer.Dial(t.protocol, t.address)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", t.address, err)
+	}
+	t.conn = conn
+	return nil
+}
+
+func (t *transport) close() {
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
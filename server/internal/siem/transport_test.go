@@ -0,0 +1,270 @@
+package siem
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"inventario/server/internal/config"
+)
+
+// rfc5424 matches the messages built by Syslog: PRI, VERSION, TIMESTAMP, HOSTNAME,
+// APP-NAME, PROCID, MSGID, STRUCTURED-DATA and MSG.
+var rfc5424 = regexp.MustCompile(`^<(\d{1,3})>1 (\S+) (\S+) inventario - (\S+) \[inventario@32473 stream="([^"]*)" seq="(\d+)" id="([^"]*)"\] (.+)$`)
+
+// testEvents returns n audit events with seq 1..n.
+func testEvents(n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = Event{
+			Stream:    "audit",
+			Seq:       int64(i + 1),
+			ID:        fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1),
+			Time:      time.Date(2026, 3, 2, 14, 5, 11, 482113000, time.UTC),
+			Severity:  severityWarning,
+			Signature: "auth.login",
+			Name:      "auth.login",
+			Fields: []Field{
+				{Key: "action", CEF: "act", Value: "auth.login"},
+				// Multi-line values must not break the framing.
+				{Key: "user_agent", CEF: "requestClientApplication", Value: "line one\nline two"},
+				{Key: "details", CEF: "cs3", Value: `{"success": false}`, Raw: true},
+			},
+		}
+	}
+	return events
+}
+
+// checkMessage checks that msg is the RFC 5424 message of e with a JSON body.
+func checkMessage(t *testing.T, msg string, e Event) {
+	t.Helper()
+	m := rfc5424.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("not an RFC 5424 message: %q", msg)
+	}
+	if pri, _ := strconv.Atoi(m[1]); pri != 13*8+severityWarning {
+		t.Errorf("PRI = %d, want %d (facility 13, severity %d)", pri, 13*8+severityWarning, severityWarning)
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, m[2]); err != nil || !ts.Equal(e.Time) {
+		t.Errorf("TIMESTAMP = %q, want %s", m[2], e.Time.Format(time.RFC3339Nano))
+	}
+	// The HOSTNAME field drops the space of "api 01".
+	if m[3] != "api01" {
+		t.Errorf("HOSTNAME = %q, want api01", m[3])
+	}
+	if m[4] != e.Stream || m[5] != e.Stream {
+		t.Errorf("MSGID = %q, stream = %q, want %q", m[4], m[5], e.Stream)
+	}
+	if m[6] != strconv.FormatInt(e.Seq, 10) || m[7] != e.ID {
+		t.Errorf("seq = %q, id = %q, want %d, %q", m[6], m[7], e.Seq, e.ID)
+	}
+	var body struct {
+		Seq       int64           `json:"seq"`
+		UserAgent string          `json:"user_agent"`
+		Details   json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal([]byte(m[8]), &body); err != nil {
+		t.Fatalf("MSG is not JSON: %v: %q", err, m[8])
+	}
+	if body.Seq != e.Seq || body.UserAgent != "line one\nline two" || string(body.Details) != `{"success":false}` {
+		t.Errorf("MSG = %s", m[8])
+	}
+}
+
+// sendEvents formats events and sends them over tr.
+func sendEvents(t *testing.T, tr *transport, events []Event) {
+	t.Helper()
+	msgs := make([][]byte, len(events))
+	for i, e := range events {
+		msgs[i] = Syslog(e, 13, "api 01", "json")
+		if strings.Contains(string(msgs[i]), "\n") {
+			t.Fatalf("message %d contains a raw newline: %q", i, msgs[i])
+		}
+	}
+	n, err := tr.send(msgs)
+	if err != nil || n != len(msgs) {
+		t.Fatalf("send = %d, %v; want %d, nil", n, err, len(msgs))
+	}
+}
+
+// readFrames reads n octet-counted frames (RFC 6587/5425): MSG-LEN SP SYSLOG-MSG.
+func readFrames(r io.Reader, n int) ([]string, error) {
+	br := bufio.NewReader(r)
+	frames := make([]string, 0, n)
+	for len(frames) < n {
+		lenText, err := br.ReadString(' ')
+		if err != nil {
+			return nil, fmt.Errorf("read frame %d length: %w", len(frames)+1, err)
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(lenText, " "))
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("frame %d: invalid MSG-LEN %q", len(frames)+1, lenText)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			return nil, fmt.Errorf("read frame %d: %w", len(frames)+1, err)
+		}
+		frames = append(frames, string(msg))
+	}
+	return frames, nil
+}
+
+func TestTransportUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer pc.Close()
+
+	tr, err := newTransport(config.SIEMConfig{Protocol: "udp", Address: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.close()
+	events := testEvents(3)
+	sendEvents(t, tr, events)
+
+	// One datagram per message, without framing.
+	buf := make([]byte, 64*1024)
+	for _, e := range events {
+		_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read datagram %d: %v", e.Seq, err)
+		}
+		checkMessage(t, string(buf[:n]), e)
+	}
+}
+
+func TestTransportTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	tr, err := newTransport(config.SIEMConfig{Protocol: "tcp", Address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.close()
+	events := testEvents(3)
+	received := acceptFrames(t, ln, len(events))
+	sendEvents(t, tr, events)
+
+	for i, msg := range <-received {
+		checkMessage(t, msg, events[i])
+	}
+}
+
+func TestTransportTLS(t *testing.T) {
+	cert, caFile := testCertificate(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	t.Run("untrusted receiver", func(t *testing.T) {
+		tr, err := newTransport(config.SIEMConfig{Protocol: "tls", Address: ln.Addr().String()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			if conn, err := ln.Accept(); err == nil {
+				_ = conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}
+		}()
+		if n, err := tr.send([][]byte{[]byte("x")}); err == nil || n != 0 {
+			t.Fatalf("send to a receiver with an unknown CA = %d, %v; want a certificate error", n, err)
+		}
+		if tr.conn != nil {
+			t.Error("connection kept after a failed send")
+		}
+	})
+
+	t.Run("trusted receiver", func(t *testing.T) {
+		tr, err := newTransport(config.SIEMConfig{Protocol: "tls", Address: ln.Addr().String(), CAFile: caFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tr.close()
+		events := testEvents(3)
+		received := acceptFrames(t, ln, len(events))
+		sendEvents(t, tr, events)
+
+		for i, msg := range <-received {
+			checkMessage(t, msg, events[i])
+		}
+	})
+}
+
+// acceptFrames accepts one connection on ln and returns the n frames read from it.
+func acceptFrames(t *testing.T, ln net.Listener, n int) <-chan []string {
+	t.Helper()
+	out := make(chan []string, 1)
+	go func() {
+		defer close(out)
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Errorf("accept: %v", err)
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		frames, err := readFrames(conn, n)
+		if err != nil {
+			t.Error(err)
+		}
+		out <- frames
+	}()
+	return out
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and the path of a
+// PEM file holding it, to use as the CA.
+func testCertificate(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "syslog receiver"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_external_identity;
+ALTER TABLE users
+    DROP COLUMN external_id,
+    DROP COLUMN auth_provider;
@@ -0,0 +1,10 @@
+-- Track where each dashboard user authenticates.
+-- Local users keep a bcrypt password_hash; external users (e.g. OIDC) are
+-- provisioned just-in-time and identified by the provider's subject.
+ALTER TABLE users
+    ADD COLUMN auth_provider VARCHAR(20)  NOT NULL DEFAULT 'local',
+    ADD COLUMN external_id   VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_users_external_identity
+    ON users (auth_provider, external_id)
+    WHERE external_id IS NOT NULL;
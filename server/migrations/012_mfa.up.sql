@@ -0,0 +1,18 @@
+-- TOTP two-factor authentication for dashboard users.
+-- totp_secret is set when enrollment starts and only takes effect once
+-- totp_enabled is true; totp_last_step prevents reuse of an accepted code.
+ALTER TABLE users
+    ADD COLUMN totp_secret    VARCHAR(64),
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT  NOT NULL DEFAULT 0;
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE user_recovery_codes (
+    id         UUID PRIMARY KEY,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_user_recovery_codes_user ON user_recovery_codes (user_id);
@@ -0,0 +1,18 @@
+-- Personal API tokens for automation clients.
+-- Only the SHA-256 hash is stored; token_prefix is kept so users can tell tokens apart.
+-- scopes is a space-separated list (e.g. "read device.write").
+CREATE TABLE api_tokens (
+    id           UUID PRIMARY KEY,
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16)  NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    scopes       TEXT         NOT NULL,
+    expires_at   TIMESTAMPTZ  NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip VARCHAR(45),
+    revoked_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens (user_id);
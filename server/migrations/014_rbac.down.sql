@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS user_role_bindings;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+UPDATE users SET role = 'viewer' WHERE role NOT IN ('admin', 'viewer');
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'viewer'));
+
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,37 @@
+-- Fine-grained, department-scoped RBAC.
+-- A role bundles permissions (space-separated, e.g. "device.read device.write").
+-- users.role stays the user's global base role; user_role_bindings grant extra
+-- roles, either globally (department_id IS NULL) or for a single department.
+CREATE TABLE roles (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT         NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    permissions TEXT         NOT NULL DEFAULT '',
+    builtin     BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO roles (name, description, permissions, builtin) VALUES
+    ('admin',          'Full access',                                            'device.read device.write device.delete department.write user.manage audit.read', TRUE),
+    ('viewer',         'Read-only access to all devices',                        'device.read', TRUE),
+    ('auditor',        'Read devices and audit logs',                            'device.read audit.read', TRUE),
+    ('member',         'Can sign in; permissions come only from role bindings',  '', TRUE),
+    ('device-manager', 'Manage devices; bind to a department to limit its scope', 'device.read device.write', FALSE);
+
+-- The base role must now be any existing role instead of admin/viewer only.
+ALTER TABLE users DROP CONSTRAINT users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey
+    FOREIGN KEY (role) REFERENCES roles (name) ON UPDATE CASCADE;
+
+CREATE TABLE user_role_bindings (
+    id            UUID PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id       UUID NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    department_id UUID REFERENCES departments(id) ON DELETE CASCADE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_user_role_bindings_unique
+    ON user_role_bindings (user_id, role_id, COALESCE(department_id, '00000000-0000-0000-0000-000000000000'));
+CREATE INDEX idx_user_role_bindings_user ON user_role_bindings (user_id);
@@ -0,0 +1,18 @@
+-- Server-side dashboard sessions. The session ID is the "jti" claim of the session JWT;
+-- middleware.JWTAuth rejects tokens whose session is revoked or past expires_at.
+-- expires_at slides forward with activity but never beyond absolute_expires_at.
+CREATE TABLE user_sessions (
+    id                  UUID PRIMARY KEY,
+    user_id             UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip                  VARCHAR(45)  NOT NULL DEFAULT '',
+    user_agent          VARCHAR(512) NOT NULL DEFAULT '',
+    created_at          TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_activity_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at          TIMESTAMPTZ  NOT NULL,
+    absolute_expires_at TIMESTAMPTZ  NOT NULL,
+    revoked_at          TIMESTAMPTZ,
+    revoked_reason      VARCHAR(50)
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id);
+CREATE INDEX idx_user_sessions_expires ON user_sessions (expires_at);
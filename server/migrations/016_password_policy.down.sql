@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS password_history;
+ALTER TABLE users
+    DROP COLUMN password_changed_at,
+    DROP COLUMN must_change_password,
+    DROP COLUMN locked_until,
+    DROP COLUMN lockout_count,
+    DROP COLUMN failed_login_attempts;
@@ -0,0 +1,19 @@
+-- Per-account lockout and password policy for local dashboard users.
+-- failed_login_attempts counts consecutive failures since the last success or lockout;
+-- lockout_count drives the progressive lockout duration and resets on a successful login.
+ALTER TABLE users
+    ADD COLUMN failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN lockout_count         INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until          TIMESTAMPTZ,
+    ADD COLUMN must_change_password  BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN password_changed_at   TIMESTAMPTZ;
+
+-- Previous bcrypt hashes, used to reject password reuse.
+CREATE TABLE password_history (
+    id            UUID PRIMARY KEY,
+    user_id       UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_password_history_user ON password_history (user_id, created_at DESC);
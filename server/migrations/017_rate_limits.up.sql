@@ -0,0 +1,6 @@
+-- Shared rate limit state (GCRA): one theoretical arrival time per key.
+-- UNLOGGED: the state is disposable, so it skips the WAL and is emptied after a crash.
+CREATE UNLOGGED TABLE rate_limits (
+    key TEXT PRIMARY KEY,
+    tat TIMESTAMPTZ NOT NULL
+);
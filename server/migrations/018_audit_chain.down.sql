@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP INDEX IF EXISTS idx_audit_logs_seq;
+ALTER TABLE audit_logs
+    DROP COLUMN hash,
+    DROP COLUMN prev_hash,
+    DROP COLUMN seq;
@@ -0,0 +1,28 @@
+-- Tamper-evident audit log: entries are numbered and each carries an HMAC over its
+-- content and the previous entry's hash. Entries written before this migration keep
+-- NULL hashes and are reported as unchained by the verification.
+ALTER TABLE audit_logs
+    ADD COLUMN seq       BIGINT,
+    ADD COLUMN prev_hash VARCHAR(64),
+    ADD COLUMN hash      VARCHAR(64);
+
+UPDATE audit_logs a SET seq = o.rn
+FROM (SELECT id, row_number() OVER (ORDER BY created_at, id) AS rn FROM audit_logs) o
+WHERE a.id = o.id;
+
+ALTER TABLE audit_logs ALTER COLUMN seq SET NOT NULL;
+CREATE UNIQUE INDEX idx_audit_logs_seq ON audit_logs (seq);
+
+-- Signed record of each purge: the chain continues from last_hash after the
+-- entries up to last_seq were deleted.
+CREATE TABLE audit_checkpoints (
+    id         UUID PRIMARY KEY,
+    last_seq   BIGINT      NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    purged     BIGINT      NOT NULL,
+    reason     VARCHAR(50) NOT NULL,
+    signature  VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_audit_checkpoints_last_seq ON audit_checkpoints (last_seq DESC);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS siem_cursors;
+DROP INDEX IF EXISTS idx_device_activity_seq;
+ALTER TABLE device_activity_log DROP COLUMN seq;
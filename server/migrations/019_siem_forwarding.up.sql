@@ -0,0 +1,23 @@
+-- SIEM forwarding reads device activity in insertion order, so it gets a sequence
+-- number like audit_logs.seq. Existing rows are numbered by detection time.
+ALTER TABLE device_activity_log ADD COLUMN seq BIGINT;
+
+UPDATE device_activity_log a SET seq = o.rn
+FROM (SELECT id, row_number() OVER (ORDER BY detected_at, id) AS rn FROM device_activity_log) o
+WHERE a.id = o.id;
+
+CREATE SEQUENCE device_activity_log_seq_seq OWNED BY device_activity_log.seq;
+SELECT setval('device_activity_log_seq_seq', COALESCE((SELECT MAX(seq) FROM device_activity_log), 0) + 1, false);
+
+ALTER TABLE device_activity_log
+    ALTER COLUMN seq SET DEFAULT nextval('device_activity_log_seq_seq'),
+    ALTER COLUMN seq SET NOT NULL;
+CREATE UNIQUE INDEX idx_device_activity_seq ON device_activity_log (seq);
+
+-- Last event forwarded per stream ("audit", "activity"). The row is locked while a
+-- batch is sent so only one API replica forwards at a time.
+CREATE TABLE siem_cursors (
+    stream     VARCHAR(20) PRIMARY KEY,
+    last_seq   BIGINT      NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
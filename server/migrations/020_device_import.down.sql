@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_devices_source;
+ALTER TABLE devices
+    DROP COLUMN source,
+    DROP COLUMN custom_attributes;
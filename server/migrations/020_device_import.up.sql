@@ -0,0 +1,9 @@
+-- Free-form key/value attributes set by imports (asset tag, location, ...), and where a
+-- device record came from: "agent" for enrolled agents, "import" for records created by
+-- a bulk import. An agent enrolling with the serial number of an imported record takes
+-- it over and turns it into an agent device.
+ALTER TABLE devices
+    ADD COLUMN custom_attributes JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    ADD COLUMN source            VARCHAR(20) NOT NULL DEFAULT 'agent';
+
+CREATE INDEX idx_devices_source ON devices (source);
@@ -0,0 +1,3 @@
+ALTER TABLE devices
+    DROP CONSTRAINT IF EXISTS chk_devices_source,
+    DROP COLUMN asset_type;
@@ -0,0 +1,6 @@
+-- Agentless assets (printers, monitors, phones, switches, machines without the agent)
+-- are device records without a token. source says where a record came from and
+-- asset_type classifies agentless ones; only agent devices are online or offline.
+ALTER TABLE devices
+    ADD COLUMN asset_type VARCHAR(50) NOT NULL DEFAULT '',
+    ADD CONSTRAINT chk_devices_source CHECK (source IN ('agent', 'manual', 'import', 'discovery'));
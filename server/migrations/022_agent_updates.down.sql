@@ -0,0 +1,6 @@
+UPDATE roles SET permissions = TRIM(REPLACE(' ' || permissions || ' ', ' agent.manage ', ' '));
+
+DROP TABLE IF EXISTS agent_update_reports;
+DROP TABLE IF EXISTS agent_rollouts;
+DROP TABLE IF EXISTS agent_release_chunks;
+DROP TABLE IF EXISTS agent_releases;
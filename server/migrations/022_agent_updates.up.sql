@@ -0,0 +1,59 @@
+-- Agent self-update. A release is one signed agent build for a platform and channel;
+-- its artifact is kept in 1 MB chunks so every API replica can serve it. The
+-- signature is an Ed25519 signature of the artifact's SHA-256 digest.
+CREATE TABLE agent_releases (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    version    VARCHAR(50)  NOT NULL,
+    os         VARCHAR(20)  NOT NULL,
+    arch       VARCHAR(20)  NOT NULL,
+    channel    VARCHAR(20)  NOT NULL DEFAULT 'stable',
+    sha256     CHAR(64)     NOT NULL,
+    signature  TEXT         NOT NULL,
+    size_bytes BIGINT       NOT NULL,
+    notes      TEXT         NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (version, os, arch, channel)
+);
+
+CREATE TABLE agent_release_chunks (
+    release_id UUID    NOT NULL REFERENCES agent_releases(id) ON DELETE CASCADE,
+    seq        INTEGER NOT NULL,
+    data       BYTEA   NOT NULL,
+    PRIMARY KEY (release_id, seq)
+);
+
+-- A rollout offers a release to one pinned device, to a share of one department or to
+-- a share of every device on the release's channel. Pins win over department rollouts,
+-- which win over global ones.
+CREATE TABLE agent_rollouts (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    release_id    UUID        NOT NULL REFERENCES agent_releases(id) ON DELETE CASCADE,
+    percentage    SMALLINT    NOT NULL DEFAULT 100 CHECK (percentage BETWEEN 0 AND 100),
+    department_id UUID        REFERENCES departments(id) ON DELETE CASCADE,
+    device_id     UUID        REFERENCES devices(id) ON DELETE CASCADE,
+    paused        BOOLEAN     NOT NULL DEFAULT FALSE,
+    created_by    UUID        REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (department_id IS NULL OR device_id IS NULL)
+);
+
+CREATE INDEX idx_agent_rollouts_release ON agent_rollouts (release_id);
+
+-- Outcome of each update attempt, as reported by the agent.
+CREATE TABLE agent_update_reports (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id    UUID        NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    release_id   UUID        REFERENCES agent_releases(id) ON DELETE SET NULL,
+    from_version VARCHAR(50) NOT NULL,
+    to_version   VARCHAR(50) NOT NULL,
+    status       VARCHAR(20) NOT NULL CHECK (status IN ('success', 'failed')),
+    error        TEXT        NOT NULL DEFAULT '',
+    reported_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_update_reports_device ON agent_update_reports (device_id, reported_at DESC);
+CREATE INDEX idx_agent_update_reports_status ON agent_update_reports (status, reported_at DESC);
+
+UPDATE roles SET permissions = TRIM(permissions || ' agent.manage') WHERE name = 'admin' AND builtin;
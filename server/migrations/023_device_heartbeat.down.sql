@@ -0,0 +1,6 @@
+ALTER TABLE devices
+    DROP COLUMN agent_error,
+    DROP COLUMN agent_state,
+    DROP COLUMN uptime_seconds,
+    DROP COLUMN last_heartbeat,
+    DROP COLUMN checkin_interval_seconds;
@@ -0,0 +1,10 @@
+-- Agents send a heartbeat every few minutes between inventories. checkin_interval_seconds
+-- is the heartbeat interval the agent reported; a device is online while it has been
+-- seen within three of its intervals (one hour when it is NULL, for agents without
+-- heartbeats). agent_state is the outcome of the agent's last inventory cycle.
+ALTER TABLE devices
+    ADD COLUMN checkin_interval_seconds INTEGER,
+    ADD COLUMN last_heartbeat           TIMESTAMPTZ,
+    ADD COLUMN uptime_seconds           BIGINT,
+    ADD COLUMN agent_state              VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN agent_error              TEXT        NOT NULL DEFAULT '';
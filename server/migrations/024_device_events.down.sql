@@ -0,0 +1,2 @@
+ALTER TABLE devices DROP COLUMN offline_since;
+DROP SEQUENCE event_stream_seq;
@@ -0,0 +1,11 @@
+-- Live event stream. Event IDs come from event_stream_seq. offline_since is set by the
+-- presence sweeper when an agent device leaves its presence window (it then publishes
+-- device.offline) and cleared by the next heartbeat or inventory.
+CREATE SEQUENCE event_stream_seq;
+
+ALTER TABLE devices ADD COLUMN offline_since TIMESTAMPTZ;
+
+-- Devices that are already offline must not all produce an event on the first sweep.
+UPDATE devices SET offline_since = NOW()
+WHERE status = 'active' AND source = 'agent'
+  AND last_seen <= NOW() - COALESCE(checkin_interval_seconds * 3, 3600) * INTERVAL '1 second';
@@ -0,0 +1,29 @@
+DROP INDEX IF EXISTS idx_audit_logs_organization;
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS organization_id;
+
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS organization_id;
+
+DROP INDEX IF EXISTS idx_users_organization;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS super_admin,
+    DROP COLUMN IF EXISTS organization_id;
+
+-- Restoring the global unique constraints fails if organizations share serial
+-- numbers or department names.
+DROP INDEX IF EXISTS idx_devices_organization;
+ALTER TABLE devices
+    DROP CONSTRAINT IF EXISTS devices_department_fkey,
+    DROP CONSTRAINT IF EXISTS devices_organization_serial_key,
+    ADD CONSTRAINT devices_serial_number_key UNIQUE (serial_number),
+    DROP COLUMN IF EXISTS organization_id,
+    ADD CONSTRAINT devices_department_id_fkey FOREIGN KEY (department_id)
+        REFERENCES departments (id) ON DELETE SET NULL;
+
+ALTER TABLE departments
+    DROP CONSTRAINT IF EXISTS departments_id_organization_key,
+    DROP CONSTRAINT IF EXISTS departments_organization_name_key,
+    ADD CONSTRAINT departments_name_key UNIQUE (name),
+    DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS enrollment_keys;
+DROP TABLE IF EXISTS organizations;
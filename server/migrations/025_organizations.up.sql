@@ -0,0 +1,75 @@
+-- Multi-tenant organizations. Departments, devices and users belong to one
+-- organization; every dashboard query is confined to the organization the user
+-- works in. Roles, agent releases and rollouts stay shared by the deployment.
+-- Existing data moves to the Default organization, whose fixed ID also receives
+-- agents enrolling with the ENROLLMENT_KEY environment variable.
+CREATE TABLE organizations (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name           VARCHAR(100) NOT NULL UNIQUE,
+    retention_days INTEGER,     -- NULL = RETENTION_DAYS
+    inactive_days  INTEGER,     -- NULL = INACTIVE_DAYS
+    created_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO organizations (id, name) VALUES ('00000000-0000-0000-0000-000000000001', 'Default');
+
+-- Agents enroll with a key of their organization. Only the SHA-256 hash is stored.
+CREATE TABLE enrollment_keys (
+    id              UUID PRIMARY KEY,
+    organization_id UUID         NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    key_prefix      VARCHAR(16)  NOT NULL,
+    key_hash        VARCHAR(64)  NOT NULL UNIQUE,
+    created_by      UUID REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at    TIMESTAMPTZ,
+    revoked_at      TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_enrollment_keys_organization ON enrollment_keys (organization_id);
+
+-- Department names are unique per organization.
+ALTER TABLE departments
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001'
+        REFERENCES organizations(id) ON DELETE CASCADE,
+    DROP CONSTRAINT departments_name_key,
+    ADD CONSTRAINT departments_organization_name_key UNIQUE (organization_id, name),
+    ADD CONSTRAINT departments_id_organization_key UNIQUE (id, organization_id);
+ALTER TABLE departments ALTER COLUMN organization_id DROP DEFAULT;
+
+-- Serial numbers are unique per organization, and a device's department must be
+-- one of its own organization's (enforced by the composite foreign key).
+ALTER TABLE devices
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001'
+        REFERENCES organizations(id),
+    DROP CONSTRAINT devices_serial_number_key,
+    ADD CONSTRAINT devices_organization_serial_key UNIQUE (organization_id, serial_number),
+    DROP CONSTRAINT devices_department_id_fkey,
+    ADD CONSTRAINT devices_department_fkey FOREIGN KEY (department_id, organization_id)
+        REFERENCES departments (id, organization_id) ON DELETE SET NULL (department_id);
+ALTER TABLE devices ALTER COLUMN organization_id DROP DEFAULT;
+
+CREATE INDEX idx_devices_organization ON devices (organization_id);
+
+-- Usernames stay unique across the deployment, so login needs no organization.
+-- Super-admins manage organizations, roles and agent releases and may switch the
+-- organization of their session; existing admins keep the access they had.
+ALTER TABLE users
+    ADD COLUMN organization_id UUID NOT NULL DEFAULT '00000000-0000-0000-0000-000000000001'
+        REFERENCES organizations(id),
+    ADD COLUMN super_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ALTER COLUMN organization_id DROP DEFAULT;
+UPDATE users SET super_admin = TRUE WHERE role = 'admin';
+
+CREATE INDEX idx_users_organization ON users (organization_id);
+
+-- The organization a session works in: the user's own, or the one a super-admin switched to.
+ALTER TABLE user_sessions
+    ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+UPDATE user_sessions s SET organization_id = u.organization_id FROM users u WHERE u.id = s.user_id;
+
+-- Organization the audited action was made in; NULL for deployment-wide actions.
+ALTER TABLE audit_logs ADD COLUMN organization_id UUID;
+
+CREATE INDEX idx_audit_logs_organization ON audit_logs (organization_id, created_at DESC);
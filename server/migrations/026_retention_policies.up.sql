@@ -0,0 +1,13 @@
+-- Retention policies override RETENTION_DAYS (and an organization's retention_days)
+-- for one dataset, or for one activity type of device_activity_log. They apply to
+-- every organization; activity_type '' is the policy of the whole dataset.
+CREATE TABLE retention_policies (
+    dataset        VARCHAR(50)  NOT NULL,
+    activity_type  VARCHAR(50)  NOT NULL DEFAULT '',
+    retention_days INTEGER      NOT NULL CHECK (retention_days > 0),
+    updated_at     TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (dataset, activity_type)
+);
+
+-- Departments may override the inactive threshold of their organization.
+ALTER TABLE departments ADD COLUMN inactive_days INTEGER; -- NULL = organization's
@@ -0,0 +1,21 @@
+-- Run history of the background job scheduler. A run stays 'running' until it ends;
+-- runs left 'running' by a replica that died are marked 'interrupted' by the next run
+-- of the job. Scheduled runs record the activation time they ran for, which keeps
+-- replicas from running it twice.
+CREATE TABLE job_runs (
+    id            UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job           VARCHAR(100) NOT NULL,
+    source        VARCHAR(20)  NOT NULL CHECK (source IN ('schedule', 'manual')),
+    requested_by  VARCHAR(255) NOT NULL DEFAULT '', -- username of manual runs
+    scheduled_for TIMESTAMPTZ,                      -- NULL for manual runs
+    replica       VARCHAR(255) NOT NULL DEFAULT '',
+    status        VARCHAR(20)  NOT NULL DEFAULT 'running'
+                  CHECK (status IN ('running', 'succeeded', 'failed', 'interrupted')),
+    started_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    finished_at   TIMESTAMPTZ,
+    result        JSONB,
+    error         TEXT         NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_job_runs_job ON job_runs (job, started_at DESC);
+CREATE INDEX idx_job_runs_scheduled ON job_runs (job, scheduled_for DESC) WHERE scheduled_for IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Agents report how often they send a full inventory. Devices whose agent sends no
+-- heartbeats are online while seen within two of these intervals, instead of a fixed
+-- hour that agents collecting every few hours always missed.
+ALTER TABLE devices ADD COLUMN collection_interval_seconds INTEGER;
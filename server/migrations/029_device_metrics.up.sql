@@ -0,0 +1,13 @@
+-- Device metrics over time: uptime from each agent heartbeat, free and total partition
+-- space from each inventory. Rows are purged with the device_metrics retention policy.
+CREATE TABLE device_metrics (
+    id               UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    device_id        UUID        NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    uptime_seconds   BIGINT,     -- NULL on inventory rows
+    disk_free_bytes  BIGINT,     -- NULL on heartbeat rows
+    disk_total_bytes BIGINT,     -- NULL on heartbeat rows
+    recorded_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_device_metrics_device ON device_metrics (device_id, recorded_at DESC);
+CREATE INDEX idx_device_metrics_recorded ON device_metrics (recorded_at);
@@ -0,0 +1 @@
+ALTER TABLE agent_rollouts DROP COLUMN rollback;
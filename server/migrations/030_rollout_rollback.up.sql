@@ -0,0 +1,3 @@
+-- Agents refuse releases that are not newer than the version they run, unless the
+-- rollout is marked as a rollback.
+ALTER TABLE agent_rollouts ADD COLUMN rollback BOOLEAN NOT NULL DEFAULT FALSE;
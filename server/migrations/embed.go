@@ -1,7 +1,18 @@
 // Package migrations embeds SQL migration files for use with golang-migrate.
+// The top-level files migrate PostgreSQL; the sqlite directory holds the
+// migrations of the SQLite backend.
 package migrations
 
-import "embed"
+import (
+	"embed"
+	"io/fs"
+)
 
 //go:embed *.sql
 var FS embed.FS
+
+//go:embed sqlite/*.sql
+var sqliteFS embed.FS
+
+// SQLite holds the migrations of the SQLite backend.
+var SQLite, _ = fs.Sub(sqliteFS, "sqlite")
@@ -0,0 +1,27 @@
+DROP TABLE IF EXISTS event_outbox;
+DROP TABLE IF EXISTS enrollment_keys;
+DROP TABLE IF EXISTS agent_update_reports;
+DROP TABLE IF EXISTS agent_rollouts;
+DROP TABLE IF EXISTS agent_release_chunks;
+DROP TABLE IF EXISTS agent_releases;
+DROP TABLE IF EXISTS password_history;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS user_role_bindings;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS siem_cursors;
+DROP TABLE IF EXISTS device_activity_log;
+DROP TABLE IF EXISTS audit_checkpoints;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS hardware_history;
+DROP TABLE IF EXISTS remote_tools;
+DROP TABLE IF EXISTS installed_software;
+DROP TABLE IF EXISTS network_interfaces;
+DROP TABLE IF EXISTS disks;
+DROP TABLE IF EXISTS hardware;
+DROP TABLE IF EXISTS device_tokens;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS departments;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,420 @@
+-- SQLite schema for small deployments (DATABASE_URL=sqlite://...). It matches the
+-- PostgreSQL schema after migration 025; later schema changes need a migration in
+-- both directories. Differences from PostgreSQL:
+--   * UUIDs are TEXT; timestamps are Unix milliseconds (TIMESTAMP columns, read back
+--     as time.Time by the driver) and default to the current time.
+--   * JSON documents are TEXT, except devices.custom_attributes, which is kept as a
+--     BLOB so that it scans into json.RawMessage like PostgreSQL's JSONB.
+--   * device_activity_log.seq is the AUTOINCREMENT row ID instead of a sequence.
+--   * A device's department must belong to its organization: triggers check what
+--     PostgreSQL's composite foreign key does.
+--   * Device events go to event_outbox, which the event hub polls, instead of NOTIFY.
+--   * There is no rate_limits table: RATE_LIMIT_BACKEND=postgres is not available.
+
+CREATE TABLE organizations (
+    id             TEXT PRIMARY KEY,
+    name           VARCHAR(100) NOT NULL UNIQUE,
+    retention_days INTEGER,     -- NULL = RETENTION_DAYS
+    inactive_days  INTEGER,     -- NULL = INACTIVE_DAYS
+    created_at     TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at     TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+INSERT INTO organizations (id, name) VALUES ('00000000-0000-0000-0000-000000000001', 'Default');
+
+CREATE TABLE roles (
+    id          TEXT PRIMARY KEY,
+    name        TEXT         NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL DEFAULT '',
+    permissions TEXT         NOT NULL DEFAULT '',
+    builtin     BOOLEAN      NOT NULL DEFAULT FALSE,
+    created_at  TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at  TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+INSERT INTO roles (id, name, description, permissions, builtin) VALUES
+    ('7d1c2f0e-6a53-4c1e-9a51-2f1b7c0e0001', 'admin',          'Full access',                                            'device.read device.write device.delete department.write user.manage audit.read agent.manage', TRUE),
+    ('7d1c2f0e-6a53-4c1e-9a51-2f1b7c0e0002', 'viewer',         'Read-only access to all devices',                        'device.read', TRUE),
+    ('7d1c2f0e-6a53-4c1e-9a51-2f1b7c0e0003', 'auditor',        'Read devices and audit logs',                            'device.read audit.read', TRUE),
+    ('7d1c2f0e-6a53-4c1e-9a51-2f1b7c0e0004', 'member',         'Can sign in; permissions come only from role bindings',  '', TRUE),
+    ('7d1c2f0e-6a53-4c1e-9a51-2f1b7c0e0005', 'device-manager', 'Manage devices; bind to a department to limit its scope', 'device.read device.write', FALSE);
+
+CREATE TABLE users (
+    id                    TEXT PRIMARY KEY,
+    organization_id       TEXT         NOT NULL REFERENCES organizations(id),
+    username              VARCHAR(100) NOT NULL UNIQUE,
+    name                  VARCHAR(255) NOT NULL DEFAULT '',
+    password_hash         VARCHAR(255) NOT NULL,
+    role                  TEXT         NOT NULL DEFAULT 'viewer' REFERENCES roles(name) ON UPDATE CASCADE,
+    super_admin           BOOLEAN      NOT NULL DEFAULT FALSE,
+    auth_provider         VARCHAR(20)  NOT NULL DEFAULT 'local',
+    external_id           VARCHAR(255),
+    totp_secret           VARCHAR(64),
+    totp_enabled          BOOLEAN      NOT NULL DEFAULT FALSE,
+    totp_last_step        BIGINT       NOT NULL DEFAULT 0,
+    failed_login_attempts INTEGER      NOT NULL DEFAULT 0,
+    lockout_count         INTEGER      NOT NULL DEFAULT 0,
+    locked_until          TIMESTAMP,
+    must_change_password  BOOLEAN      NOT NULL DEFAULT FALSE,
+    password_changed_at   TIMESTAMP,
+    created_at            TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at            TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_users_role ON users (role);
+CREATE INDEX idx_users_organization ON users (organization_id);
+CREATE UNIQUE INDEX idx_users_external_identity
+    ON users (auth_provider, external_id)
+    WHERE external_id IS NOT NULL;
+
+CREATE TABLE departments (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT         NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    created_at      TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    UNIQUE (organization_id, name)
+);
+
+CREATE TABLE devices (
+    id                       TEXT PRIMARY KEY,
+    organization_id          TEXT         NOT NULL REFERENCES organizations(id),
+    hostname                 VARCHAR(255) NOT NULL,
+    serial_number            VARCHAR(255) NOT NULL,
+    os_name                  VARCHAR(100) NOT NULL DEFAULT '',
+    os_version               VARCHAR(100) NOT NULL DEFAULT '',
+    os_build                 VARCHAR(50)  NOT NULL DEFAULT '',
+    os_arch                  VARCHAR(20)  NOT NULL DEFAULT '',
+    last_boot_time           TIMESTAMP,
+    logged_in_user           VARCHAR(255) NOT NULL DEFAULT '',
+    agent_version            VARCHAR(50)  NOT NULL DEFAULT '',
+    license_status           VARCHAR(100) NOT NULL DEFAULT '',
+    status                   VARCHAR(20)  NOT NULL DEFAULT 'active',
+    department_id            TEXT REFERENCES departments(id) ON DELETE SET NULL,
+    custom_attributes        BLOB         NOT NULL DEFAULT (CAST('{}' AS BLOB)),
+    source                   VARCHAR(20)  NOT NULL DEFAULT 'agent'
+                             CHECK (source IN ('agent', 'manual', 'import', 'discovery')),
+    asset_type               VARCHAR(50)  NOT NULL DEFAULT '',
+    checkin_interval_seconds INTEGER,
+    last_heartbeat           TIMESTAMP,
+    uptime_seconds           BIGINT,
+    agent_state              VARCHAR(20)  NOT NULL DEFAULT '',
+    agent_error              TEXT         NOT NULL DEFAULT '',
+    offline_since            TIMESTAMP,
+    last_seen                TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    created_at               TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at               TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    UNIQUE (organization_id, serial_number)
+);
+
+CREATE INDEX idx_devices_hostname ON devices (hostname);
+CREATE INDEX idx_devices_last_seen ON devices (last_seen);
+CREATE INDEX idx_devices_status ON devices (status);
+CREATE INDEX idx_devices_department ON devices (department_id);
+CREATE INDEX idx_devices_source ON devices (source);
+CREATE INDEX idx_devices_organization ON devices (organization_id);
+
+CREATE TRIGGER devices_department_organization_insert BEFORE INSERT ON devices
+WHEN NEW.department_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM departments WHERE id = NEW.department_id AND organization_id = NEW.organization_id)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed: department of another organization');
+END;
+
+CREATE TRIGGER devices_department_organization_update BEFORE UPDATE OF department_id, organization_id ON devices
+WHEN NEW.department_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM departments WHERE id = NEW.department_id AND organization_id = NEW.organization_id)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed: department of another organization');
+END;
+
+CREATE TABLE device_tokens (
+    id         TEXT PRIMARY KEY,
+    device_id  TEXT        NOT NULL UNIQUE REFERENCES devices(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE TABLE hardware (
+    id                       TEXT PRIMARY KEY,
+    device_id                TEXT         NOT NULL UNIQUE REFERENCES devices(id) ON DELETE CASCADE,
+    cpu_model                VARCHAR(255) NOT NULL DEFAULT '',
+    cpu_cores                INTEGER      NOT NULL DEFAULT 0,
+    cpu_threads              INTEGER      NOT NULL DEFAULT 0,
+    ram_total_bytes          BIGINT       NOT NULL DEFAULT 0,
+    motherboard_manufacturer VARCHAR(255) NOT NULL DEFAULT '',
+    motherboard_product      VARCHAR(255) NOT NULL DEFAULT '',
+    motherboard_serial       VARCHAR(255) NOT NULL DEFAULT '',
+    bios_vendor              VARCHAR(255) NOT NULL DEFAULT '',
+    bios_version             VARCHAR(255) NOT NULL DEFAULT '',
+    created_at               TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at               TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE TABLE disks (
+    id                   TEXT PRIMARY KEY,
+    device_id            TEXT         NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    model                VARCHAR(255) NOT NULL DEFAULT '',
+    size_bytes           BIGINT       NOT NULL DEFAULT 0,
+    media_type           VARCHAR(20)  NOT NULL DEFAULT '',
+    serial_number        VARCHAR(255) NOT NULL DEFAULT '',
+    interface_type       VARCHAR(20)  NOT NULL DEFAULT '',
+    drive_letter         VARCHAR(5)   NOT NULL DEFAULT '',
+    partition_size_bytes BIGINT       NOT NULL DEFAULT 0,
+    free_space_bytes     BIGINT       NOT NULL DEFAULT 0,
+    created_at           TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_disks_device_id ON disks (device_id);
+
+CREATE TABLE network_interfaces (
+    id           TEXT PRIMARY KEY,
+    device_id    TEXT         NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    name         VARCHAR(255) NOT NULL DEFAULT '',
+    mac_address  VARCHAR(17)  NOT NULL DEFAULT '',
+    ipv4_address VARCHAR(15)  NOT NULL DEFAULT '',
+    ipv6_address VARCHAR(45)  NOT NULL DEFAULT '',
+    speed_mbps   BIGINT,
+    is_physical  BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_network_interfaces_device_id ON network_interfaces (device_id);
+
+CREATE TABLE installed_software (
+    id           TEXT PRIMARY KEY,
+    device_id    TEXT         NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    name         VARCHAR(500) NOT NULL,
+    version      VARCHAR(100) NOT NULL DEFAULT '',
+    vendor       VARCHAR(255) NOT NULL DEFAULT '',
+    install_date VARCHAR(20)  NOT NULL DEFAULT '',
+    created_at   TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_installed_software_device_id ON installed_software (device_id);
+CREATE INDEX idx_installed_software_device_name ON installed_software (device_id, name);
+
+CREATE TABLE remote_tools (
+    id         TEXT PRIMARY KEY,
+    device_id  TEXT         NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    tool_name  VARCHAR(100) NOT NULL DEFAULT '',
+    remote_id  VARCHAR(255) NOT NULL DEFAULT '',
+    version    VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_remote_tools_device_id ON remote_tools (device_id);
+
+CREATE TABLE hardware_history (
+    id          TEXT PRIMARY KEY,
+    device_id   TEXT         NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    snapshot    TEXT         NOT NULL,
+    component   VARCHAR(50)  NOT NULL,
+    change_type VARCHAR(50)  NOT NULL,
+    field       VARCHAR(100),
+    old_value   TEXT,
+    new_value   TEXT,
+    changed_at  TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_hw_history_device ON hardware_history (device_id);
+CREATE INDEX idx_hardware_history_component ON hardware_history (device_id, component, changed_at DESC);
+
+CREATE TABLE audit_logs (
+    id              TEXT PRIMARY KEY,
+    seq             BIGINT      NOT NULL UNIQUE,
+    organization_id TEXT,
+    user_id         TEXT REFERENCES users(id) ON DELETE SET NULL,
+    username        TEXT        NOT NULL,
+    action          TEXT        NOT NULL,
+    resource_type   TEXT        NOT NULL,
+    resource_id     TEXT,
+    details         TEXT,
+    ip_address      TEXT,
+    user_agent      TEXT,
+    created_at      TIMESTAMP   DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    prev_hash       VARCHAR(64),
+    hash            VARCHAR(64)
+);
+
+CREATE INDEX idx_audit_logs_user_id ON audit_logs (user_id);
+CREATE INDEX idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at DESC);
+CREATE INDEX idx_audit_logs_resource ON audit_logs (resource_type, resource_id);
+CREATE INDEX idx_audit_logs_composite ON audit_logs (user_id, created_at DESC);
+CREATE INDEX idx_audit_logs_organization ON audit_logs (organization_id, created_at DESC);
+
+CREATE TABLE audit_checkpoints (
+    id         TEXT PRIMARY KEY,
+    last_seq   BIGINT      NOT NULL,
+    last_hash  VARCHAR(64) NOT NULL,
+    purged     BIGINT      NOT NULL,
+    reason     VARCHAR(50) NOT NULL,
+    signature  VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP   NOT NULL
+);
+
+CREATE INDEX idx_audit_checkpoints_last_seq ON audit_checkpoints (last_seq DESC);
+
+CREATE TABLE device_activity_log (
+    seq           INTEGER PRIMARY KEY AUTOINCREMENT,
+    id            TEXT      NOT NULL UNIQUE DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+                      substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+                      substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    device_id     TEXT      NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    activity_type TEXT      NOT NULL,
+    description   TEXT      NOT NULL,
+    old_value     TEXT,
+    new_value     TEXT,
+    metadata      TEXT,
+    detected_at   TIMESTAMP DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_device_activity_device_id ON device_activity_log (device_id);
+CREATE INDEX idx_device_activity_type ON device_activity_log (activity_type);
+CREATE INDEX idx_device_activity_detected_at ON device_activity_log (detected_at DESC);
+CREATE INDEX idx_device_activity_device_time ON device_activity_log (device_id, detected_at DESC);
+
+CREATE TABLE siem_cursors (
+    stream     VARCHAR(20) PRIMARY KEY,
+    last_seq   BIGINT      NOT NULL,
+    updated_at TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE TABLE user_recovery_codes (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT        NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMP,
+    created_at TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_user_recovery_codes_user ON user_recovery_codes (user_id);
+
+CREATE TABLE api_tokens (
+    id           TEXT PRIMARY KEY,
+    user_id      TEXT         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16)  NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    scopes       TEXT         NOT NULL,
+    expires_at   TIMESTAMP    NOT NULL,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR(45),
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_api_tokens_user ON api_tokens (user_id);
+
+CREATE TABLE user_role_bindings (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT      NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_id       TEXT      NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    department_id TEXT REFERENCES departments(id) ON DELETE CASCADE,
+    created_at    TIMESTAMP NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE UNIQUE INDEX idx_user_role_bindings_unique
+    ON user_role_bindings (user_id, role_id, COALESCE(department_id, '00000000-0000-0000-0000-000000000000'));
+CREATE INDEX idx_user_role_bindings_user ON user_role_bindings (user_id);
+
+CREATE TABLE user_sessions (
+    id                  TEXT PRIMARY KEY,
+    user_id             TEXT         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id     TEXT REFERENCES organizations(id) ON DELETE SET NULL,
+    ip                  VARCHAR(45)  NOT NULL DEFAULT '',
+    user_agent          VARCHAR(512) NOT NULL DEFAULT '',
+    created_at          TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    last_activity_at    TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    expires_at          TIMESTAMP    NOT NULL,
+    absolute_expires_at TIMESTAMP    NOT NULL,
+    revoked_at          TIMESTAMP,
+    revoked_reason      VARCHAR(50)
+);
+
+CREATE INDEX idx_user_sessions_user ON user_sessions (user_id);
+CREATE INDEX idx_user_sessions_expires ON user_sessions (expires_at);
+
+CREATE TABLE password_history (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT         NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at    TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_password_history_user ON password_history (user_id, created_at DESC);
+
+CREATE TABLE agent_releases (
+    id         TEXT PRIMARY KEY,
+    version    VARCHAR(50) NOT NULL,
+    os         VARCHAR(20) NOT NULL,
+    arch       VARCHAR(20) NOT NULL,
+    channel    VARCHAR(20) NOT NULL DEFAULT 'stable',
+    sha256     CHAR(64)    NOT NULL,
+    signature  TEXT        NOT NULL,
+    size_bytes BIGINT      NOT NULL,
+    notes      TEXT        NOT NULL DEFAULT '',
+    created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    UNIQUE (version, os, arch, channel)
+);
+
+CREATE TABLE agent_release_chunks (
+    release_id TEXT    NOT NULL REFERENCES agent_releases(id) ON DELETE CASCADE,
+    seq        INTEGER NOT NULL,
+    data       BLOB    NOT NULL,
+    PRIMARY KEY (release_id, seq)
+);
+
+CREATE TABLE agent_rollouts (
+    id            TEXT PRIMARY KEY,
+    release_id    TEXT      NOT NULL REFERENCES agent_releases(id) ON DELETE CASCADE,
+    percentage    SMALLINT  NOT NULL DEFAULT 100 CHECK (percentage BETWEEN 0 AND 100),
+    department_id TEXT REFERENCES departments(id) ON DELETE CASCADE,
+    device_id     TEXT REFERENCES devices(id) ON DELETE CASCADE,
+    paused        BOOLEAN   NOT NULL DEFAULT FALSE,
+    created_by    TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    updated_at    TIMESTAMP NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    CHECK (department_id IS NULL OR device_id IS NULL)
+);
+
+CREATE INDEX idx_agent_rollouts_release ON agent_rollouts (release_id);
+
+CREATE TABLE agent_update_reports (
+    id           TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+                     substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+                     substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    device_id    TEXT        NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    release_id   TEXT REFERENCES agent_releases(id) ON DELETE SET NULL,
+    from_version VARCHAR(50) NOT NULL,
+    to_version   VARCHAR(50) NOT NULL,
+    status       VARCHAR(20) NOT NULL CHECK (status IN ('success', 'failed')),
+    error        TEXT        NOT NULL DEFAULT '',
+    reported_at  TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_agent_update_reports_device ON agent_update_reports (device_id, reported_at DESC);
+CREATE INDEX idx_agent_update_reports_status ON agent_update_reports (status, reported_at DESC);
+
+CREATE TABLE enrollment_keys (
+    id              TEXT PRIMARY KEY,
+    organization_id TEXT         NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    key_prefix      VARCHAR(16)  NOT NULL,
+    key_hash        VARCHAR(64)  NOT NULL UNIQUE,
+    created_by      TEXT REFERENCES users(id) ON DELETE SET NULL,
+    last_used_at    TIMESTAMP,
+    revoked_at      TIMESTAMP,
+    created_at      TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_enrollment_keys_organization ON enrollment_keys (organization_id);
+
+-- Device events, in publication order; the ID is the event's position in the stream.
+-- The event hub reads new rows and deletes old ones.
+CREATE TABLE event_outbox (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    payload    TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
@@ -0,0 +1,2 @@
+ALTER TABLE departments DROP COLUMN inactive_days;
+DROP TABLE retention_policies;
@@ -0,0 +1,11 @@
+-- Retention policies per dataset and per-department inactive thresholds
+-- (PostgreSQL migration 026).
+CREATE TABLE retention_policies (
+    dataset        VARCHAR(50) NOT NULL,
+    activity_type  VARCHAR(50) NOT NULL DEFAULT '',
+    retention_days INTEGER     NOT NULL CHECK (retention_days > 0),
+    updated_at     TIMESTAMP   NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    PRIMARY KEY (dataset, activity_type)
+);
+
+ALTER TABLE departments ADD COLUMN inactive_days INTEGER;
@@ -0,0 +1,19 @@
+-- Run history of the background job scheduler (PostgreSQL migration 027). result is
+-- a BLOB so that it scans into json.RawMessage.
+CREATE TABLE job_runs (
+    id            TEXT PRIMARY KEY,
+    job           VARCHAR(100) NOT NULL,
+    source        VARCHAR(20)  NOT NULL CHECK (source IN ('schedule', 'manual')),
+    requested_by  VARCHAR(255) NOT NULL DEFAULT '',
+    scheduled_for TIMESTAMP,
+    replica       VARCHAR(255) NOT NULL DEFAULT '',
+    status        VARCHAR(20)  NOT NULL DEFAULT 'running'
+                  CHECK (status IN ('running', 'succeeded', 'failed', 'interrupted')),
+    started_at    TIMESTAMP    NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER)),
+    finished_at   TIMESTAMP,
+    result        BLOB,
+    error         TEXT         NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_job_runs_job ON job_runs (job, started_at DESC);
+CREATE INDEX idx_job_runs_scheduled ON job_runs (job, scheduled_for DESC) WHERE scheduled_for IS NOT NULL;
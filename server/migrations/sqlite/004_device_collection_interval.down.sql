@@ -0,0 +1 @@
+ALTER TABLE devices DROP COLUMN collection_interval_seconds;
@@ -0,0 +1,2 @@
+-- Inventory interval reported by agents (PostgreSQL migration 028).
+ALTER TABLE devices ADD COLUMN collection_interval_seconds INTEGER;
@@ -0,0 +1,12 @@
+-- Device metrics over time (PostgreSQL migration 029).
+CREATE TABLE device_metrics (
+    id               TEXT PRIMARY KEY,
+    device_id        TEXT      NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    uptime_seconds   BIGINT,
+    disk_free_bytes  BIGINT,
+    disk_total_bytes BIGINT,
+    recorded_at      TIMESTAMP NOT NULL DEFAULT (CAST(unixepoch('subsec') * 1000 AS INTEGER))
+);
+
+CREATE INDEX idx_device_metrics_device ON device_metrics (device_id, recorded_at DESC);
+CREATE INDEX idx_device_metrics_recorded ON device_metrics (recorded_at);
@@ -0,0 +1,2 @@
+-- Rollouts marked as rollbacks (PostgreSQL migration 030).
+ALTER TABLE agent_rollouts ADD COLUMN rollback BOOLEAN NOT NULL DEFAULT FALSE;
@@ -30,6 +30,23 @@ type InventoryRequest struct {
 	Network       []NetworkData    `json:"network_interfaces"`
 	Software      []SoftwareData   `json:"installed_software"`
 	RemoteTools   []RemoteToolData `json:"remote_tools"`
+	// HeartbeatIntervalSeconds is set by agents that send heartbeats. Without it the
+	// presence window follows CollectionIntervalSeconds, the agent's inventory interval,
+	// or is one hour for agents that report neither.
+	HeartbeatIntervalSeconds  int `json:"heartbeat_interval_seconds,omitempty" binding:"omitempty,min=60,max=86400"`
+	CollectionIntervalSeconds int `json:"collection_interval_seconds,omitempty" binding:"omitempty,min=60,max=2678400"`
+}
+
+// HeartbeatRequest is sent by the agent between inventories (POST /api/v1/heartbeat).
+// IntervalSeconds is how often the agent sends it; the device is shown offline after
+// three intervals without one.
+type HeartbeatRequest struct {
+	IntervalSeconds int     `json:"interval_seconds" binding:"required,min=60,max=86400"`
+	UptimeSeconds   int64   `json:"uptime_seconds" binding:"min=0"`
+	LoggedInUser    *string `json:"logged_in_user,omitempty" binding:"omitempty,max=255"` // nil keeps the stored user
+	AgentVersion    string  `json:"agent_version" binding:"max=50"`
+	State           string  `json:"state" binding:"required,oneof=ok error"`
+	Error           string  `json:"error" binding:"max=1000"`
 }
 
 // HardwareData contains CPU, RAM, motherboard, and BIOS info.
@@ -87,12 +104,43 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required,max=200"`
 }
 
+// MFAVerifyRequest completes a login with a TOTP code or a recovery code.
+type MFAVerifyRequest struct {
+	Challenge string `json:"challenge" binding:"required,max=1000"`
+	Code      string `json:"code" binding:"required,max=20"`
+}
+
+// PasswordChangeRequest sets a new password during login when the account requires it.
+type PasswordChangeRequest struct {
+	Challenge   string `json:"challenge" binding:"required,max=1000"`
+	NewPassword string `json:"new_password" binding:"required,min=8,max=100"`
+}
+
+// MFASetupRequest starts the mandatory TOTP enrollment during login.
+type MFASetupRequest struct {
+	Challenge string `json:"challenge" binding:"required,max=1000"`
+}
+
+// MFACodeRequest carries a TOTP (or recovery) code for a signed-in user.
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required,max=20"`
+}
+
+// CreateAPITokenRequest is used to issue a personal API token.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,max=10"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
 // CreateUserRequest is used to create a new dashboard user.
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=100"`
 	Name     string `json:"name" binding:"required,max=255"`
 	Password string `json:"password" binding:"required,min=8,max=100"`
-	Role     string `json:"role" binding:"omitempty,oneof=admin viewer"`
+	Role     string `json:"role" binding:"omitempty,max=50"`
+	// SuperAdmin may only be set by super-admins.
+	SuperAdmin bool `json:"super_admin"`
 }
 
 // UpdateUserRequest is used to update a dashboard user's info.
@@ -100,7 +148,9 @@ type UpdateUserRequest struct {
 	Username string `json:"username" binding:"omitempty,min=3,max=100"`
 	Name     string `json:"name" binding:"omitempty,max=255"`
 	Password string `json:"password" binding:"omitempty,min=8,max=100"`
-	Role     string `json:"role" binding:"omitempty,oneof=admin viewer"`
+	Role     string `json:"role" binding:"omitempty,max=50"`
+	// SuperAdmin may only be changed by super-admins.
+	SuperAdmin *bool `json:"super_admin"`
 }
 
 // UpdateDeviceStatusRequest is used to change a device's lifecycle status.
@@ -113,6 +163,21 @@ type UpdateDeviceDepartmentRequest struct {
 	DepartmentID *uuid.UUID `json:"department_id"`
 }
 
+// ManualAssetRequest creates or replaces an agentless asset (printer, monitor, switch, ...).
+// Hardware and network interfaces replace the stored ones; a nil Hardware removes it.
+type ManualAssetRequest struct {
+	Hostname          string            `json:"hostname" binding:"required,max=255"`
+	SerialNumber      string            `json:"serial_number" binding:"required,max=255"`
+	AssetType         string            `json:"asset_type" binding:"max=50"`
+	OSName            string            `json:"os_name" binding:"max=100"`
+	OSVersion         string            `json:"os_version" binding:"max=100"`
+	Status            string            `json:"status" binding:"omitempty,oneof=active inactive"`
+	DepartmentID      *uuid.UUID        `json:"department_id"`
+	CustomAttributes  map[string]string `json:"custom_attributes" binding:"max=50"`
+	Hardware          *HardwareData     `json:"hardware"`
+	NetworkInterfaces []NetworkData     `json:"network_interfaces" binding:"max=32"`
+}
+
 // BulkDeviceStatusRequest is used to change the status of multiple devices at once.
 type BulkDeviceStatusRequest struct {
 	DeviceIDs []uuid.UUID `json:"device_ids" binding:"required,min=1,max=100"`
@@ -136,12 +201,113 @@ type BulkActionResponse struct {
 	Message  string `json:"message"`
 }
 
-// CreateDepartmentRequest is used to create a new department.
+// DeviceImportResponse is the report of a device import. In a dry run, or when any
+// row fails validation, nothing is written and Committed is false.
+type DeviceImportResponse struct {
+	DryRun    bool              `json:"dry_run"`
+	Committed bool              `json:"committed"`
+	Total     int               `json:"total"`
+	Created   int               `json:"created"`
+	Updated   int               `json:"updated"`
+	Unchanged int               `json:"unchanged"`
+	Failed    int               `json:"failed"`
+	Rows      []DeviceImportRow `json:"rows"`
+}
+
+// DeviceImportRow is the validation result of one row of an import file.
+type DeviceImportRow struct {
+	Row      int        `json:"row"`                 // row number in the file; the header is row 1
+	Key      string     `json:"key"`                 // serial number or hostname the row was matched by
+	Action   string     `json:"action"`              // create, update, unchanged or error
+	DeviceID *uuid.UUID `json:"device_id,omitempty"` // set for created devices only once committed
+	Changes  []string   `json:"changes,omitempty"`
+	Errors   []string   `json:"errors,omitempty"`
+}
+
+// CreateDepartmentRequest is used to create a new department. InactiveDays overrides
+// the inactive threshold of the organization; omitted = the organization's.
 type CreateDepartmentRequest struct {
-	Name string `json:"name" binding:"required,min=1,max=100"`
+	Name         string `json:"name" binding:"required,min=1,max=100"`
+	InactiveDays *int   `json:"inactive_days" binding:"omitempty,min=1,max=3650"`
 }
 
-// UpdateDepartmentRequest is used to rename a department.
+// UpdateDepartmentRequest is used to rename a department and replace its inactive
+// threshold; omitted = the organization's.
 type UpdateDepartmentRequest struct {
+	Name         string `json:"name" binding:"required,min=1,max=100"`
+	InactiveDays *int   `json:"inactive_days" binding:"omitempty,min=1,max=3650"`
+}
+
+// OrganizationRequest creates an organization or replaces its name and settings.
+// RetentionDays and InactiveDays override the server defaults; omitted = default.
+type OrganizationRequest struct {
+	Name          string `json:"name" binding:"required,min=1,max=100"`
+	RetentionDays *int   `json:"retention_days" binding:"omitempty,min=1,max=3650"`
+	InactiveDays  *int   `json:"inactive_days" binding:"omitempty,min=1,max=3650"`
+}
+
+// RetentionPoliciesRequest replaces all retention policies; an empty list removes them.
+type RetentionPoliciesRequest struct {
+	Policies []RetentionPolicyRequest `json:"policies" binding:"required,max=100,dive"`
+}
+
+// RetentionPolicyRequest sets the retention of a dataset, or of one activity type of
+// device_activity_log.
+type RetentionPolicyRequest struct {
+	Dataset       string `json:"dataset" binding:"required,max=50"`
+	ActivityType  string `json:"activity_type" binding:"max=50"`
+	RetentionDays int    `json:"retention_days" binding:"required,min=1,max=3650"`
+}
+
+// SwitchOrganizationRequest moves a super-admin's session to another organization.
+type SwitchOrganizationRequest struct {
+	OrganizationID uuid.UUID `json:"organization_id" binding:"required"`
+}
+
+// CreateEnrollmentKeyRequest is used to issue an enrollment key for the organization.
+type CreateEnrollmentKeyRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=100"`
 }
+
+// CreateRoleRequest is used to create a custom role.
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=1,max=50"`
+	Description string   `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions" binding:"required,max=20"`
+}
+
+// UpdateRoleRequest is used to rename a custom role or change its permissions.
+type UpdateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,min=1,max=50"`
+	Description string   `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions" binding:"required,max=20"`
+}
+
+// CreateRoleBindingRequest grants a role to a user, limited to one department
+// or globally when DepartmentID is omitted.
+type CreateRoleBindingRequest struct {
+	RoleID       uuid.UUID  `json:"role_id" binding:"required"`
+	DepartmentID *uuid.UUID `json:"department_id"`
+}
+
+// AgentRolloutRequest creates or changes a rollout. DeviceID pins one device, which
+// always gets the release; otherwise Percentage (default 100) of the devices on the
+// release's channel, limited to DepartmentID when set, get it. Rollback lets agents
+// that run a newer version move back to the release.
+type AgentRolloutRequest struct {
+	ReleaseID    uuid.UUID  `json:"release_id" binding:"required"`
+	Percentage   *int       `json:"percentage" binding:"omitempty,min=0,max=100"`
+	DepartmentID *uuid.UUID `json:"department_id"`
+	DeviceID     *uuid.UUID `json:"device_id"`
+	Paused       bool       `json:"paused"`
+	Rollback     bool       `json:"rollback"`
+}
+
+// AgentUpdateReportRequest is sent by an agent after an update attempt.
+type AgentUpdateReportRequest struct {
+	ReleaseID   *uuid.UUID `json:"release_id"`
+	FromVersion string     `json:"from_version" binding:"required,max=50"`
+	ToVersion   string     `json:"to_version" binding:"required,max=50"`
+	Status      string     `json:"status" binding:"required,oneof=success failed"`
+	Error       string     `json:"error" binding:"max=2000"`
+}
@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"time"
+
 	"inventario/shared/models"
 
 	"github.com/google/uuid"
@@ -17,10 +19,100 @@ type MessageResponse struct {
 }
 
 // MeResponse is returned by GET /api/v1/auth/me.
+// Permissions maps each held permission to the departments it applies to.
 type MeResponse struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	ID          string                     `json:"id"`
+	Username    string                     `json:"username"`
+	Role        string                     `json:"role"`
+	Permissions map[string]PermissionScope `json:"permissions"`
+	// Organization the session works in; super-admins may switch it.
+	OrganizationID   uuid.UUID `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	SuperAdmin       bool      `json:"super_admin"`
+}
+
+// PermissionScope describes where a permission applies: everywhere, or only to
+// devices in the listed departments.
+type PermissionScope struct {
+	All           bool        `json:"all"`
+	DepartmentIDs []uuid.UUID `json:"department_ids,omitempty"`
+}
+
+// LoginResponse is returned by POST /api/v1/auth/login.
+// When a second factor is needed no session cookie is set and Challenge must be
+// sent to /auth/mfa/verify (or /auth/mfa/setup when MFASetupRequired is true).
+// When PasswordChangeRequired is true Challenge must be sent to /auth/password/change first.
+type LoginResponse struct {
+	Message                string `json:"message"`
+	PasswordChangeRequired bool   `json:"password_change_required,omitempty"`
+	MFARequired            bool   `json:"mfa_required,omitempty"`
+	MFASetupRequired       bool   `json:"mfa_setup_required,omitempty"`
+	Challenge              string `json:"challenge,omitempty"`
+}
+
+// TOTPEnrollmentResponse contains a pending TOTP secret and its otpauth:// URI for QR codes.
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse returns newly generated recovery codes. They are shown only once.
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// MFAStatusResponse is returned by GET /api/v1/auth/mfa.
+type MFAStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// APITokenResponse describes a personal API token. The secret itself is never returned again.
+type APITokenResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Name        string     `json:"name"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Username    string     `json:"username,omitempty"` // only in the admin listing
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP  *string    `json:"last_used_ip,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// APITokenListResponse is returned by GET /api/v1/auth/api-tokens and GET /api/v1/api-tokens.
+type APITokenListResponse struct {
+	Tokens []APITokenResponse `json:"tokens"`
+	Total  int                `json:"total"`
+}
+
+// CreateAPITokenResponse is returned once when a token is created; Token holds the secret.
+type CreateAPITokenResponse struct {
+	Token string `json:"token"`
+	APITokenResponse
+}
+
+// OrganizationListResponse is returned by GET /api/v1/organizations.
+type OrganizationListResponse struct {
+	Organizations []models.Organization `json:"organizations"`
+	Total         int                   `json:"total"`
+}
+
+// EnrollmentKeyListResponse is returned by GET /api/v1/enrollment-keys.
+type EnrollmentKeyListResponse struct {
+	Keys  []models.EnrollmentKey `json:"keys"`
+	Total int                    `json:"total"`
+}
+
+// CreateEnrollmentKeyResponse is returned once when an enrollment key is created;
+// Key holds the secret.
+type CreateEnrollmentKeyResponse struct {
+	Key string `json:"key"`
+	models.EnrollmentKey
 }
 
 // HealthResponse is returned by the liveness probe.
@@ -39,6 +131,7 @@ type DashboardStatsResponse struct {
 	Total          int            `json:"total"`
 	Online         int            `json:"online"`
 	Offline        int            `json:"offline"`
+	Agentless      int            `json:"agentless"` // active devices without an agent, in total but neither online nor offline
 	Inactive       int            `json:"inactive"`
 	OSDistribution []ChartItem    `json:"os_distribution"`
 	RecentDevices  []RecentDevice `json:"recent_devices"`
@@ -57,16 +150,24 @@ type RecentDevice struct {
 	Hostname string    `json:"hostname"`
 	OSName   string    `json:"os_name"`
 	Status   string    `json:"status"`
+	Online   bool      `json:"online"`
 	LastSeen string    `json:"last_seen"`
 }
 
 // UserResponse is a single user returned by the API (no password hash).
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Username  string    `json:"username"`
-	Name      string    `json:"name"`
-	Role      string    `json:"role"`
-	CreatedAt string    `json:"created_at"`
+	ID           uuid.UUID `json:"id"`
+	Username     string    `json:"username"`
+	Name         string    `json:"name"`
+	Role         string    `json:"role"`
+	AuthProvider string    `json:"auth_provider"`
+	TOTPEnabled  bool      `json:"totp_enabled"`
+	SuperAdmin   bool      `json:"super_admin"`
+	CreatedAt    string    `json:"created_at"`
+
+	FailedLoginAttempts int        `json:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty"`
+	MustChangePassword  bool       `json:"must_change_password"`
 }
 
 // UserListResponse is returned by GET /api/v1/users.
@@ -125,6 +226,7 @@ type AuditLogResponse struct {
 	IPAddress    string     `json:"ip_address,omitempty"`
 	UserAgent    string     `json:"user_agent,omitempty"`
 	CreatedAt    string     `json:"created_at"`
+	Seq          int64      `json:"seq"`
 }
 
 // AuditLogListResponse is returned by GET /api/v1/audit-logs.
@@ -132,3 +234,194 @@ type AuditLogListResponse struct {
 	Logs  []AuditLogResponse `json:"logs"`
 	Total int                `json:"total"`
 }
+
+// AuditVerifyResponse is returned by GET /api/v1/audit-logs/verify.
+type AuditVerifyResponse struct {
+	Valid       bool             `json:"valid"`
+	Checked     int64            `json:"checked"`
+	Unchained   int64            `json:"unchained"`
+	Checkpoints int              `json:"checkpoints"`
+	AnchorSeq   int64            `json:"anchor_seq,omitempty"` // last purged entry the walk started after
+	Broken      *AuditChainBreak `json:"broken,omitempty"`
+}
+
+// ArchiveListResponse is returned by GET /api/v1/archives.
+type ArchiveListResponse struct {
+	Enabled  bool      `json:"enabled"`            // whether purged history is archived
+	Location string    `json:"location,omitempty"` // directory or s3://bucket/prefix
+	Archives []Archive `json:"archives"`           // newest first
+}
+
+// Archive is the manifest of the history one cleanup run purged.
+type Archive struct {
+	ID            string        `json:"id"`
+	CreatedAt     time.Time     `json:"created_at"`
+	RetentionDays int           `json:"retention_days"`
+	Files         []ArchiveFile `json:"files"`
+}
+
+// ArchiveFile is the gzip-compressed NDJSON file of one table within an archive.
+type ArchiveFile struct {
+	Table  string `json:"table"`
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// AuditPipelineStatsResponse is returned by GET /api/v1/audit-logs/pipeline. Counters
+// are per API instance and start at zero on each restart.
+type AuditPipelineStatsResponse struct {
+	Queued   int   `json:"queued"`
+	Written  int64 `json:"written"`
+	Retries  int64 `json:"retries"`
+	Spilled  int64 `json:"spilled"`
+	Replayed int64 `json:"replayed"`
+	Dropped  int64 `json:"dropped"`
+	Rejected int64 `json:"rejected"`
+	Pending  bool  `json:"pending"`
+}
+
+// AuditChainBreak identifies the first audit entry or checkpoint that failed verification.
+type AuditChainBreak struct {
+	Seq    int64     `json:"seq"`
+	ID     uuid.UUID `json:"id"`
+	Reason string    `json:"reason"`
+}
+
+// RoleResponse is returned for role CRUD operations.
+type RoleResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Permissions []string  `json:"permissions"`
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// RoleListResponse is returned by GET /api/v1/roles.
+type RoleListResponse struct {
+	Roles       []RoleResponse `json:"roles"`
+	Total       int            `json:"total"`
+	Permissions []string       `json:"available_permissions"`
+}
+
+// RoleBindingListResponse is returned by GET /api/v1/users/:id/role-bindings.
+type RoleBindingListResponse struct {
+	Bindings []models.RoleBinding `json:"bindings"`
+	Total    int                  `json:"total"`
+}
+
+// SessionResponse describes an active dashboard session.
+type SessionResponse struct {
+	ID                uuid.UUID `json:"id"`
+	IP                string    `json:"ip"`
+	UserAgent         string    `json:"user_agent"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	Current           bool      `json:"current"`
+}
+
+// SessionListResponse is returned by GET /api/v1/auth/sessions and GET /api/v1/users/:id/sessions.
+type SessionListResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+	Total    int               `json:"total"`
+}
+
+// SessionRefreshResponse is returned by POST /api/v1/auth/refresh.
+type SessionRefreshResponse struct {
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+}
+
+// AgentUpdateResponse is returned by GET /api/v1/agent/update. When Available is true
+// the agent should download DownloadURL (relative to the server URL), check its size,
+// SHA-256 and signature, and replace itself with it. Agents refuse a Version that is
+// not newer than theirs unless Rollback is set.
+type AgentUpdateResponse struct {
+	Available   bool       `json:"available"`
+	ReleaseID   *uuid.UUID `json:"release_id,omitempty"`
+	Version     string     `json:"version,omitempty"`
+	Rollback    bool       `json:"rollback,omitempty"`
+	SHA256      string     `json:"sha256,omitempty"`
+	Signature   string     `json:"signature,omitempty"`
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	DownloadURL string     `json:"download_url,omitempty"`
+}
+
+// ReleaseSigningPayload returns the bytes an agent release signature covers: the
+// version, platform and hex SHA-256 of the artifact, separated by "|". Binding the
+// version and platform keeps a signed build from being offered as another release.
+func ReleaseSigningPayload(version, os, arch, sha256 string) []byte {
+	return []byte(version + "|" + os + "|" + arch + "|" + sha256)
+}
+
+// AgentReleaseListResponse is returned by GET /api/v1/agent-releases.
+type AgentReleaseListResponse struct {
+	Releases []models.AgentRelease `json:"releases"`
+	Total    int                   `json:"total"`
+}
+
+// AgentRolloutListResponse is returned by GET /api/v1/agent-rollouts.
+type AgentRolloutListResponse struct {
+	Rollouts []models.AgentRollout `json:"rollouts"`
+	Total    int                   `json:"total"`
+}
+
+// AgentUpdateReportListResponse is returned by GET /api/v1/agent-update-reports.
+type AgentUpdateReportListResponse struct {
+	Reports []models.AgentUpdateReport `json:"reports"`
+	Total   int                        `json:"total"`
+	Page    int                        `json:"page"`
+	Limit   int                        `json:"limit"`
+}
+
+// RetentionPolicyListResponse is returned by GET /api/v1/retention-policies. Datasets
+// without a policy keep the defaults (or their organization's settings).
+type RetentionPolicyListResponse struct {
+	Policies             []models.RetentionPolicy `json:"policies"`
+	Datasets             []string                 `json:"datasets"`
+	DefaultRetentionDays int                      `json:"default_retention_days"`
+	DefaultInactiveDays  int                      `json:"default_inactive_days"`
+}
+
+// RetentionPreviewResponse counts the rows the cleanup would delete, per dataset, and
+// the devices it would mark inactive if it ran now.
+type RetentionPreviewResponse struct {
+	AuditLogs             int64            `json:"audit_logs"`
+	ActivityLogs          int64            `json:"device_activity_log"`
+	ActivityLogsByType    map[string]int64 `json:"device_activity_log_by_type"`
+	HardwareHistory       int64            `json:"hardware_history"`
+	Metrics               int64            `json:"device_metrics"`
+	SnapshotsCleared      int64            `json:"snapshots"` // rows kept, not in Total
+	Sessions              int64            `json:"user_sessions"`
+	UpdateReports         int64            `json:"agent_update_reports"`
+	Total                 int64            `json:"total"`
+	DevicesMarkedInactive int64            `json:"devices_marked_inactive"`
+}
+
+// JobListResponse is returned by GET /api/v1/jobs.
+type JobListResponse struct {
+	Jobs []Job `json:"jobs"`
+}
+
+// Job is a background job of the scheduler with its last run. NextRun is the next
+// activation time; one replica runs it.
+type Job struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	Timeout  string         `json:"timeout"`
+	NextRun  *time.Time     `json:"next_run,omitempty"`
+	LastRun  *models.JobRun `json:"last_run,omitempty"`
+}
+
+// JobRunListResponse is returned by GET /api/v1/jobs/:name/runs.
+type JobRunListResponse struct {
+	Runs  []models.JobRun `json:"runs"`
+	Total int             `json:"total"`
+	Page  int             `json:"page"`
+	Limit int             `json:"limit"`
+}
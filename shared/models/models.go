@@ -2,6 +2,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -23,9 +24,32 @@ type Device struct {
 	Status         string     `json:"status" db:"status"`
 	DepartmentID   *uuid.UUID `json:"department_id,omitempty" db:"department_id"`
 	DepartmentName *string    `json:"department_name,omitempty" db:"department_name"`
+	OrganizationID uuid.UUID  `json:"organization_id" db:"organization_id"`
 	LastSeen       time.Time  `json:"last_seen" db:"last_seen"`
 	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Source is "agent", "manual", "import" or "discovery"; only agent devices are
+	// online or offline, the others have no agent reporting last_seen.
+	Source string `json:"source" db:"source"`
+	// AssetType classifies agentless assets (printer, monitor, switch, ...).
+	AssetType string `json:"asset_type" db:"asset_type"`
+	// CustomAttributes is a JSON object of string values set by imports.
+	CustomAttributes json.RawMessage `json:"custom_attributes" db:"custom_attributes"`
+
+	// Heartbeat: the agent's heartbeat and inventory intervals, its last heartbeat and
+	// what it reported. AgentState is "ok" or "error" (last inventory cycle failed, see
+	// AgentError).
+	CheckinIntervalSeconds    *int       `json:"checkin_interval_seconds,omitempty" db:"checkin_interval_seconds"`
+	CollectionIntervalSeconds *int       `json:"collection_interval_seconds,omitempty" db:"collection_interval_seconds"`
+	LastHeartbeat             *time.Time `json:"last_heartbeat,omitempty" db:"last_heartbeat"`
+	UptimeSeconds             *int64     `json:"uptime_seconds,omitempty" db:"uptime_seconds"`
+	AgentState                string     `json:"agent_state" db:"agent_state"`
+	AgentError                string     `json:"agent_error,omitempty" db:"agent_error"`
+	// OfflineSince is set when the presence sweeper saw the agent go offline.
+	OfflineSince *time.Time `json:"offline_since,omitempty" db:"offline_since"`
+	// Online is computed by the device queries from last_seen and the check-in interval.
+	Online bool `json:"online" db:"online"`
 }
 
 // DeviceToken stores the hashed authentication token for an agent.
@@ -102,11 +126,59 @@ type RemoteTool struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
+// DeviceMetric is a sample of a device's metrics: heartbeats record UptimeSeconds,
+// inventories the free and total space of the device's partitions.
+type DeviceMetric struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	DeviceID       uuid.UUID `json:"device_id" db:"device_id"`
+	UptimeSeconds  *int64    `json:"uptime_seconds,omitempty" db:"uptime_seconds"`
+	DiskFreeBytes  *int64    `json:"disk_free_bytes,omitempty" db:"disk_free_bytes"`
+	DiskTotalBytes *int64    `json:"disk_total_bytes,omitempty" db:"disk_total_bytes"`
+	RecordedAt     time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// Organization is a tenant: it owns departments, devices, users and enrollment keys.
+// RetentionDays and InactiveDays override the server defaults when set.
+type Organization struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	RetentionDays *int      `json:"retention_days" db:"retention_days"`
+	InactiveDays  *int      `json:"inactive_days" db:"inactive_days"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// EnrollmentKey lets agents enroll into an organization. Only the hash is stored;
+// KeyPrefix is kept so that keys can be told apart.
+type EnrollmentKey struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	OrganizationID uuid.UUID  `json:"organization_id" db:"organization_id"`
+	Name           string     `json:"name" db:"name"`
+	KeyPrefix      string     `json:"key_prefix" db:"key_prefix"`
+	KeyHash        string     `json:"-" db:"key_hash"`
+	CreatedBy      *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+}
+
 // Department represents an organizational unit that devices can be assigned to.
+// InactiveDays overrides the inactive threshold of the organization when set.
 type Department struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ID             uuid.UUID `json:"id" db:"id"`
+	Name           string    `json:"name" db:"name"`
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	InactiveDays   *int      `json:"inactive_days" db:"inactive_days"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+}
+
+// RetentionPolicy sets how long the cleanup keeps the rows of a dataset (a table),
+// or of one activity type of device_activity_log, in every organization.
+type RetentionPolicy struct {
+	Dataset       string    `json:"dataset" db:"dataset"`
+	ActivityType  string    `json:"activity_type,omitempty" db:"activity_type"`
+	RetentionDays int       `json:"retention_days" db:"retention_days"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // HardwareHistory stores a snapshot of hardware state before it changed,
@@ -128,9 +200,76 @@ type User struct {
 	Username     string    `json:"username" db:"username"`
 	Name         string    `json:"name" db:"name"`
 	PasswordHash string    `json:"-" db:"password_hash"`
-	Role         string    `json:"role" db:"role"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	Role         string    `json:"role" db:"role"`                   // base role, applies globally
+	AuthProvider string    `json:"auth_provider" db:"auth_provider"` // local, oidc, ldap
+	ExternalID   *string   `json:"-" db:"external_id"`               // subject at the external provider
+	TOTPSecret   *string   `json:"-" db:"totp_secret"`               // base32 secret, pending until TOTPEnabled
+	TOTPEnabled  bool      `json:"totp_enabled" db:"totp_enabled"`
+	TOTPLastStep int64     `json:"-" db:"totp_last_step"` // last accepted time step (replay protection)
+
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	SuperAdmin     bool      `json:"super_admin" db:"super_admin"` // manages organizations and may switch between them
+
+	FailedLoginAttempts int        `json:"failed_login_attempts" db:"failed_login_attempts"` // since the last success or lockout
+	LockoutCount        int        `json:"-" db:"lockout_count"`                             // consecutive lockouts, grows the lockout duration
+	LockedUntil         *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+	MustChangePassword  bool       `json:"must_change_password" db:"must_change_password"`
+	PasswordChangedAt   *time.Time `json:"password_changed_at,omitempty" db:"password_changed_at"`
+
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Role bundles permissions. Users hold a base role (User.Role) and optional RoleBindings.
+type Role struct {
+	ID          uuid.UUID `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Permissions string    `json:"permissions" db:"permissions"` // space-separated
+	Builtin     bool      `json:"builtin" db:"builtin"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RoleBinding grants a role to a user globally or for a single department.
+type RoleBinding struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	RoleID         uuid.UUID  `json:"role_id" db:"role_id"`
+	DepartmentID   *uuid.UUID `json:"department_id" db:"department_id"` // nil = global
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	RoleName       string     `json:"role_name" db:"role_name"`                       // populated by JOIN
+	DepartmentName *string    `json:"department_name,omitempty" db:"department_name"` // populated by JOIN
+}
+
+// APIToken is a personal access token used by automation clients instead of a session cookie.
+type APIToken struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Name        string     `json:"name" db:"name"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"`
+	TokenHash   string     `json:"-" db:"token_hash"`
+	Scopes      string     `json:"scopes" db:"scopes"` // space-separated
+	ExpiresAt   time.Time  `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	LastUsedIP  *string    `json:"last_used_ip,omitempty" db:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// UserSession is a server-side dashboard session; its ID is the session JWT's "jti" claim.
+type UserSession struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	UserID            uuid.UUID  `json:"user_id" db:"user_id"`
+	IP                string     `json:"ip" db:"ip"`
+	UserAgent         string     `json:"user_agent" db:"user_agent"`
+	CreatedAt         time.Time  `json:"created_at" db:"created_at"`
+	LastActivityAt    time.Time  `json:"last_activity_at" db:"last_activity_at"`
+	ExpiresAt         time.Time  `json:"expires_at" db:"expires_at"` // slides with activity
+	AbsoluteExpiresAt time.Time  `json:"absolute_expires_at" db:"absolute_expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedReason     *string    `json:"revoked_reason,omitempty" db:"revoked_reason"`
+	OrganizationID    *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"` // organization the session works in
 }
 
 // AuditLog represents a record of an important system action.
@@ -145,6 +284,23 @@ type AuditLog struct {
 	IPAddress    string     `json:"ip_address,omitempty" db:"ip_address"`
 	UserAgent    string     `json:"user_agent,omitempty" db:"user_agent"`
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	// OrganizationID is the organization the action was made in; nil for deployment-wide actions.
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
+	Seq            int64      `json:"seq" db:"seq"`                       // position in the hash chain
+	PrevHash       *string    `json:"prev_hash,omitempty" db:"prev_hash"` // NULL for entries older than the chain
+	Hash           *string    `json:"hash,omitempty" db:"hash"`
+}
+
+// AuditCheckpoint is the signed record of an audit log purge; verification of the
+// hash chain resumes from LastHash.
+type AuditCheckpoint struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	LastSeq   int64     `json:"last_seq" db:"last_seq"`
+	LastHash  string    `json:"last_hash" db:"last_hash"`
+	Purged    int64     `json:"purged" db:"purged"`
+	Reason    string    `json:"reason" db:"reason"`
+	Signature string    `json:"-" db:"signature"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
 }
 
 // DeviceActivityLog tracks changes detected during inventory submissions.
@@ -158,3 +314,68 @@ type DeviceActivityLog struct {
 	Metadata     *string   `json:"metadata,omitempty" db:"metadata"` // JSONB
 	DetectedAt   time.Time `json:"detected_at" db:"detected_at"`
 }
+
+// AgentRelease is a signed agent build for one platform and channel. The artifact
+// itself is stored in agent_release_chunks.
+type AgentRelease struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	Version   string     `json:"version" db:"version"`
+	OS        string     `json:"os" db:"os"`
+	Arch      string     `json:"arch" db:"arch"`
+	Channel   string     `json:"channel" db:"channel"`
+	SHA256    string     `json:"sha256" db:"sha256"`
+	Signature string     `json:"signature" db:"signature"` // base64 Ed25519 signature of the SHA-256 digest
+	SizeBytes int64      `json:"size_bytes" db:"size_bytes"`
+	Notes     string     `json:"notes" db:"notes"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// AgentRollout offers a release to a pinned device, a department or every device on
+// the release's channel.
+type AgentRollout struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	ReleaseID    uuid.UUID  `json:"release_id" db:"release_id"`
+	Percentage   int        `json:"percentage" db:"percentage"`
+	DepartmentID *uuid.UUID `json:"department_id,omitempty" db:"department_id"`
+	DeviceID     *uuid.UUID `json:"device_id,omitempty" db:"device_id"`
+	Paused       bool       `json:"paused" db:"paused"`
+	Rollback     bool       `json:"rollback" db:"rollback"` // agents on a newer version move back to the release
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Populated by JOIN with agent_releases
+	Version string `json:"version" db:"version"`
+	OS      string `json:"os" db:"os"`
+	Arch    string `json:"arch" db:"arch"`
+	Channel string `json:"channel" db:"channel"`
+}
+
+// AgentUpdateReport is the outcome of one agent update attempt.
+type AgentUpdateReport struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	DeviceID    uuid.UUID  `json:"device_id" db:"device_id"`
+	Hostname    string     `json:"hostname" db:"hostname"` // populated by JOIN
+	ReleaseID   *uuid.UUID `json:"release_id,omitempty" db:"release_id"`
+	FromVersion string     `json:"from_version" db:"from_version"`
+	ToVersion   string     `json:"to_version" db:"to_version"`
+	Status      string     `json:"status" db:"status"` // "success" or "failed"
+	Error       string     `json:"error,omitempty" db:"error"`
+	ReportedAt  time.Time  `json:"reported_at" db:"reported_at"`
+}
+
+// JobRun is one run of a background job of the scheduler.
+type JobRun struct {
+	ID           uuid.UUID       `json:"id" db:"id"`
+	Job          string          `json:"job" db:"job"`
+	Source       string          `json:"source" db:"source"` // "schedule" or "manual"
+	RequestedBy  string          `json:"requested_by,omitempty" db:"requested_by"`
+	ScheduledFor *time.Time      `json:"scheduled_for,omitempty" db:"scheduled_for"`
+	Replica      string          `json:"replica" db:"replica"`
+	Status       string          `json:"status" db:"status"` // "running", "succeeded", "failed" or "interrupted"
+	StartedAt    time.Time       `json:"started_at" db:"started_at"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty" db:"finished_at"`
+	Result       json.RawMessage `json:"result,omitempty" db:"result"`
+	Error        string          `json:"error,omitempty" db:"error"`
+}